@@ -75,3 +75,10 @@ Usage: include "xkms.providerSecretEnv" "corp-sso" -> XKMS_SECRET_CORP_SSO
 {{- define "xkms.providerSecretEnv" -}}
 {{- printf "XKMS_SECRET_%s" (. | upper | replace "-" "_" | replace "." "_") }}
 {{- end }}
+
+{{/*
+Env var carrying the unseal key pulled from config.unseal.keyRef.
+*/}}
+{{- define "xkms.unsealKeyEnv" -}}
+XKMS_UNSEAL_KEY
+{{- end }}
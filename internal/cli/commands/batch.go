@@ -0,0 +1,296 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/utils"
+)
+
+// getInputPaths returns the input paths given with --file and as arguments, and
+// whether they call for batch mode: several paths, glob patterns, directories,
+// --recursive, --out-dir or --in-place.
+func getInputPaths(cmd *cobra.Command, args []string) ([]string, bool) {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	paths := args
+	if srcPath := cmd.Flag(sourceFileFlag.name).Value.String(); srcPath != "" {
+		paths = append([]string{srcPath}, paths...)
+	}
+	if len(paths) == 0 {
+		exitOnErrorWithMessage(fmt.Sprintf("set the input file using --%s or as an argument", sourceFileFlag.name), jsonFormat)
+	}
+	recursive, _ := cmd.Flags().GetBool(recursiveFlag.name)
+	outDir, _ := cmd.Flags().GetString(outDirFlag.name)
+	inPlace, _ := cmd.Flags().GetBool(inPlaceFlag.name)
+	if inPlace && (outDir != "" || cmd.Flag(outputFileFlag.name).Value.String() != "") {
+		exitOnErrorWithMessage(fmt.Sprintf("--%s cannot be used with --%s or --%s", inPlaceFlag.name, outputFileFlag.name, outDirFlag.name), jsonFormat)
+	}
+	if shred, _ := cmd.Flags().GetBool(shredFlag.name); shred && !inPlace {
+		exitOnErrorWithMessage(fmt.Sprintf("--%s requires --%s", shredFlag.name, inPlaceFlag.name), jsonFormat)
+	}
+	batch := len(paths) > 1 || recursive || outDir != "" || inPlace
+	for _, path := range paths {
+		if strings.ContainsAny(path, "*?[") {
+			batch = true
+		} else if info, err := os.Stat(path); err == nil && info.IsDir() {
+			batch = true
+		}
+	}
+	if batch && cmd.Flag(outputFileFlag.name).Value.String() != "" {
+		exitOnErrorWithMessage(fmt.Sprintf("--%s takes a single file; use --%s for several", outputFileFlag.name, outDirFlag.name), jsonFormat)
+	}
+	return paths, batch
+}
+
+// expandBatch expands paths into the files of a batch, keeping files found in
+// directories only if match returns true.
+func expandBatch(cmd *cobra.Command, paths []string, match func(path string) bool) []utils.BatchFile {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	recursive, _ := cmd.Flags().GetBool(recursiveFlag.name)
+	files, err := utils.ExpandPaths(paths, recursive, match)
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	if len(files) == 0 {
+		exitOnErrorWithMessage("no files to process", jsonFormat)
+	}
+	return files
+}
+
+func runEncryptBatch(cmd *cobra.Command, paths []string, format string, opts []xipher.EncryptOption) {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	toXipherTxt, _ := cmd.Flags().GetBool(toXipherTxtFlag.name)
+	overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
+	compress, _ := cmd.Flags().GetBool(compressFlag.name)
+	storeMetadata, _ := cmd.Flags().GetBool(fileMetadataFlag.name)
+	workers, _ := cmd.Flags().GetInt(workersFlag.name)
+	outDir, _ := cmd.Flags().GetString(outDirFlag.name)
+	inPlace, _ := cmd.Flags().GetBool(inPlaceFlag.name)
+	shred, _ := cmd.Flags().GetBool(shredFlag.name)
+	allowExpired, _ := cmd.Flags().GetBool(allowExpiredFlag.name)
+	files := expandBatch(cmd, paths, func(path string) bool {
+		return !isEncryptedFilePath(path)
+	})
+	outputs, err := utils.BatchOutputPaths(files, outDir, func(name string) string {
+		return name + encryptedFileExt(format)
+	})
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	keyPwdStr, err := getKeyPwdStr(cmd)
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	results := utils.RunBatch(files, workers, func(file utils.BatchFile) (string, error) {
+		dstPath := outputs[file.Path]
+		if err := encryptFileTo(format, keyPwdStr, file.Path, dstPath, overwrite, compress, toXipherTxt, storeMetadata, inPlace, allowExpired, opts); err != nil {
+			return dstPath, err
+		}
+		if inPlace {
+			return dstPath, removeOriginal(file.Path, shred)
+		}
+		return dstPath, nil
+	})
+	printBatchResults(results, "encrypted", inPlace, jsonFormat)
+}
+
+func runDecryptBatch(cmd *cobra.Command, paths []string) {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
+	workers, _ := cmd.Flags().GetInt(workersFlag.name)
+	outDir, _ := cmd.Flags().GetString(outDirFlag.name)
+	inPlace, _ := cmd.Flags().GetBool(inPlaceFlag.name)
+	shred, _ := cmd.Flags().GetBool(shredFlag.name)
+	files := expandBatch(cmd, paths, func(path string) bool {
+		return isEncryptedFilePath(path)
+	})
+	outputs, err := utils.BatchOutputPaths(files, outDir, func(name string) string {
+		if trimmed := trimEncryptedFileExt(name); trimmed != name && trimmed != "" {
+			return trimmed
+		}
+		return name + ".decrypted"
+	})
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	secrets, err := resolveSecretKeys(cmd, true)
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	results := utils.RunBatch(files, workers, func(file utils.BatchFile) (string, error) {
+		dstPath := outputs[file.Path]
+		if err := decryptFileTo(secrets, file.Path, dstPath, overwrite, inPlace); err != nil {
+			return dstPath, err
+		}
+		if inPlace {
+			return dstPath, removeOriginal(file.Path, shred)
+		}
+		return dstPath, nil
+	})
+	printBatchResults(results, "decrypted", inPlace, jsonFormat)
+}
+
+// isEncryptedFilePath reports whether path has the extension of xipher or age files.
+func isEncryptedFilePath(path string) bool {
+	return strings.HasSuffix(path, xipherFileExt) || strings.HasSuffix(path, ageFileExt)
+}
+
+// trimEncryptedFileExt returns path without its xipher or age file extension.
+func trimEncryptedFileExt(path string) string {
+	if trimmed := strings.TrimSuffix(path, xipherFileExt); trimmed != path {
+		return trimmed
+	}
+	return strings.TrimSuffix(path, ageFileExt)
+}
+
+// createOutputFile prepares an AtomicFileWriter for dstPath, creating its
+// directory and refusing to replace an existing file unless overwrite is set.
+// The file only appears under dstPath once it has been written completely.
+func createOutputFile(dstPath string, overwrite bool, perm os.FileMode) (*utils.AtomicFileWriter, error) {
+	if _, err := os.Lstat(dstPath); err == nil && !overwrite {
+		return nil, fmt.Errorf("file already exists: %s", dstPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return nil, err
+	}
+	return utils.NewAtomicFileWriter(dstPath, perm)
+}
+
+// outputFileMode returns the permissions for the output of src: those of src
+// when replacing it in place, otherwise outputFilePerm.
+func outputFileMode(src *os.File, inPlace bool) (os.FileMode, error) {
+	if !inPlace {
+		return outputFilePerm, nil
+	}
+	stat, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Mode().Perm(), nil
+}
+
+// removeOriginal removes an input file replaced in place, shredding it first if requested.
+func removeOriginal(srcPath string, shred bool) error {
+	if err := utils.RemoveFile(srcPath, shred); err != nil {
+		return fmt.Errorf("output written but failed to remove %s: %w", srcPath, err)
+	}
+	return nil
+}
+
+func encryptFileTo(format, keyPwdStr, srcPath, dstPath string, overwrite, compress, encode, storeMetadata, inPlace, allowExpired bool, opts []xipher.EncryptOption) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if storeMetadata {
+		stat, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		opts = append(opts[:len(opts):len(opts)], xipher.WithFileInfo(xipher.NewFileInfo(stat)))
+	}
+	perm, err := outputFileMode(src, inPlace)
+	if err != nil {
+		return err
+	}
+	dst, err := createOutputFile(dstPath, overwrite, perm)
+	if err != nil {
+		return err
+	}
+	if err = encryptStreamAs(format, keyPwdStr, dst, src, compress, encode, allowExpired, opts); err == nil {
+		err = dst.Flush()
+	}
+	if err != nil {
+		dst.Discard()
+		return err
+	}
+	return dst.Close()
+}
+
+func decryptFileTo(secrets utils.Secrets, srcPath, dstPath string, overwrite, inPlace bool) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	reader, fileInfo, err := utils.NewFileDecryptingReaderForAny(secrets, src)
+	if err != nil {
+		return err
+	}
+	perm, err := outputFileMode(src, inPlace)
+	if err != nil {
+		return err
+	}
+	dst, err := createOutputFile(dstPath, overwrite, perm)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(dst, reader)
+	if err == nil {
+		err = checkFileSize(written, fileInfo)
+	}
+	if err == nil {
+		err = dst.Flush()
+	}
+	if err != nil {
+		dst.Discard()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if fileInfo != nil {
+		return restoreFileInfo(dstPath, fileInfo)
+	}
+	return nil
+}
+
+// printBatchResults prints the outcome of a batch and exits with
+// exitCodeGeneric if any file failed. With inPlace, the inputs of successful
+// files have been removed.
+func printBatchResults(results []utils.BatchResult, verb string, inPlace, jsonFormat bool) {
+	failed := 0
+	for i := range results {
+		result := &results[i]
+		if !result.OK {
+			failed++
+			result.Code, _ = errorCode(result.Err)
+		}
+		if !jsonFormat {
+			if result.OK {
+				fmt.Printf("%s %s -> %s\n", color.GreenString("OK    "), result.Path, result.Output)
+			} else {
+				fmt.Printf("%s %s: %s\n", color.RedString("FAILED"), result.Path, result.Error)
+			}
+		}
+	}
+	if jsonFormat {
+		fmt.Println(toJsonString(map[string]interface{}{
+			"files":     results,
+			"total":     len(results),
+			"succeeded": len(results) - failed,
+			"failed":    failed,
+			"inPlace":   inPlace,
+		}))
+	} else {
+		summary := fmt.Sprintf("%d of %d files %s", len(results)-failed, len(results), verb)
+		if inPlace {
+			summary += " in place"
+		}
+		if failed > 0 {
+			fmt.Println(color.RedString("%s, %d failed", summary, failed))
+		} else {
+			fmt.Println(color.GreenString(summary))
+		}
+	}
+	if failed > 0 {
+		os.Exit(exitCodeGeneric)
+	}
+}
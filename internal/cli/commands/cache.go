@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher/resolve"
+)
+
+func cacheCommand() *cobra.Command {
+	if cacheCmd == nil {
+		cacheCmd = &cobra.Command{
+			Use:   "cache",
+			Short: "Manage the cache of public keys fetched from URLs, domains and email addresses",
+			Long: `Public keys fetched from URLs, domains and email addresses are cached in
+xipher/keys.json in the user cache directory or the file named by the
+` + resolve.KeyCacheEnv + ` environment variable, for as long as the Cache-Control or
+Expires headers of the response allow, and then revalidated with its ETag or
+Last-Modified header. With encrypt --offline, cached keys are used however old
+they are, and still checked against the keys pinned for their URLs.`,
+			Run: func(cmd *cobra.Command, args []string) {
+				cmd.Help()
+			},
+		}
+		cacheCmd.AddCommand(cacheListCommand())
+		cacheCmd.AddCommand(cacheClearCommand())
+	}
+	return cacheCmd
+}
+
+func cacheListCommand() *cobra.Command {
+	if cacheListCmd == nil {
+		cacheListCmd = &cobra.Command{
+			Use:     "list",
+			Aliases: []string{"ls"},
+			Short:   "List the cached public keys",
+			Args:    cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				cache, err := resolve.LoadKeyCache("")
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				known, err := resolve.LoadKnownRecipients("")
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				pinned := make(map[string]bool, len(known.Recipients))
+				for _, pin := range known.Recipients {
+					pinned[pin.Fingerprint] = true
+				}
+				if jsonFormat {
+					entries := make([]map[string]interface{}, 0, len(cache.Entries))
+					for _, entry := range cache.Entries {
+						entries = append(entries, map[string]interface{}{
+							"url":         entry.URL,
+							"fingerprint": entry.Fingerprint,
+							"fetched":     entry.Fetched,
+							"freshUntil":  entry.FreshUntil,
+							"fresh":       entry.Fresh(),
+							"pinned":      pinned[entry.Fingerprint],
+						})
+					}
+					fmt.Println(toJsonString(map[string]interface{}{
+						"cache":   cache.Path(),
+						"entries": entries,
+					}))
+					return
+				}
+				if len(cache.Entries) == 0 {
+					fmt.Println("The key cache is empty:", color.HiBlackString(cache.Path()))
+					return
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				for _, entry := range cache.Entries {
+					freshness := "stale"
+					if entry.Fresh() {
+						freshness = "fresh until " + entry.FreshUntil.Local().Format(time.DateTime)
+					}
+					pin := ""
+					if pinned[entry.Fingerprint] {
+						pin = "pinned"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.URL, entry.Fingerprint, freshness, pin)
+				}
+				w.Flush()
+			},
+		}
+	}
+	return cacheListCmd
+}
+
+func cacheClearCommand() *cobra.Command {
+	if cacheClearCmd == nil {
+		cacheClearCmd = &cobra.Command{
+			Use:   "clear",
+			Short: "Remove every cached public key",
+			Long: `Remove every cached public key, so each is fetched again when it is next used.
+The keys pinned for URLs, domains and email addresses are kept.`,
+			Args: cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				cache, err := resolve.LoadKeyCache("")
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				cleared := len(cache.Entries)
+				cache.Clear()
+				if err = cache.Save(); err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(map[string]interface{}{"cleared": cleared}))
+					return
+				}
+				fmt.Println("Cleared", cleared, "cached public keys from", color.HiBlackString(cache.Path()))
+			},
+		}
+	}
+	return cacheClearCmd
+}
@@ -2,26 +2,82 @@ package commands
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/fatih/color"
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/utils"
+	"xipher.org/xipher/resolve"
 )
 
+// Exit codes and JSON error codes for failures scripts may want to tell apart.
+// Anything not listed here exits with exitCodeGeneric.
+const (
+	exitCodeGeneric            = 1
+	exitCodeWrongKey           = 2
+	exitCodeCorrupted          = 3
+	exitCodeTruncated          = 4
+	exitCodeUnsupportedVersion = 5
+	exitCodePasswordRequired   = 6
+	exitCodeKeyRequired        = 7
+	exitCodeKeyExpired         = 8
+	exitCodeKeyChanged         = 9
+)
+
+var errorCodes = []struct {
+	err      error
+	code     string
+	exitCode int
+}{
+	{xipher.ErrWrongKey, "wrong_key", exitCodeWrongKey},
+	{xipher.ErrTruncatedCiphertext, "truncated_ciphertext", exitCodeTruncated},
+	{xipher.ErrCorruptedCiphertext, "corrupted_ciphertext", exitCodeCorrupted},
+	{xipher.ErrInvalidCiphertext, "invalid_ciphertext", exitCodeCorrupted},
+	{xipher.ErrUnsupportedVersion, "unsupported_version", exitCodeUnsupportedVersion},
+	{xipher.ErrPasswordRequired, "password_required", exitCodePasswordRequired},
+	{xipher.ErrKeyRequired, "key_required", exitCodeKeyRequired},
+	{xipher.ErrKeyExpired, "key_expired", exitCodeKeyExpired},
+	{resolve.ErrKeyChanged, "key_changed", exitCodeKeyChanged},
+	{resolve.ErrUntrustedSigner, "untrusted_signer", exitCodeKeyChanged},
+	{resolve.ErrInvalidKeySignature, "invalid_signature", exitCodeCorrupted},
+	{resolve.ErrDNSFingerprintMismatch, "fingerprint_mismatch", exitCodeKeyChanged},
+	{resolve.ErrKeyNotCached, "key_not_cached", exitCodeGeneric},
+	{utils.ErrValuesTampered, "values_tampered", exitCodeCorrupted},
+	{utils.ErrSSHPassphraseRequired, "passphrase_required", exitCodePasswordRequired},
+}
+
+// errorCode returns the JSON code and exit code for err.
+func errorCode(err error) (string, int) {
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			return ec.code, ec.exitCode
+		}
+	}
+	return "error", exitCodeGeneric
+}
+
 func exitOnError(err error, jsonFormat bool) {
-	exitOnErrorWithMessage(err.Error(), jsonFormat)
+	code, exitCode := errorCode(err)
+	exitWithError(err.Error(), code, exitCode, jsonFormat)
 }
 
 func exitOnErrorWithMessage(errMessage string, jsonFormat bool) {
+	exitWithError(errMessage, "error", exitCodeGeneric, jsonFormat)
+}
+
+func exitWithError(errMessage, code string, exitCode int, jsonFormat bool) {
 	if jsonFormat {
 		errorMap := map[string]interface{}{
 			"error": errMessage,
+			"code":  code,
 		}
 		fmt.Fprintln(os.Stderr, toJsonString(errorMap))
 	} else {
 		fmt.Fprintln(os.Stderr, color.RedString(errMessage))
 	}
-	os.Exit(1)
+	os.Exit(exitCode)
 }
 
 func toJsonString(data interface{}) string {
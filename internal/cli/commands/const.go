@@ -1,19 +1,29 @@
 package commands
 
 import (
+	"runtime"
+
 	"github.com/spf13/cobra"
 	"xipher.org/xipher"
 )
 
 const (
-	xipherPubKeyFileExt = ".xpk"
-	envar_XIPHER_SECRET = "XIPHER_SECRET"
-	fileWriteThreshold  = 1024 * 1024
+	xipherPubKeyFileExt             = ".xpk"
+	envar_XIPHER_SECRET             = "XIPHER_SECRET"
+	envar_XIPHER_SSH_PASSPHRASE     = "XIPHER_SSH_PASSPHRASE"
+	envar_XIPHER_KEYRING_PASSPHRASE = "XIPHER_KEYRING_PASSPHRASE"
+	fileWriteThreshold              = 1024 * 1024
+	outputFilePerm                  = 0o644
+	padmeScheme                     = "padme"
+	formatXipher                    = "xipher"
+	formatAge                       = "age"
+	ageFileExt                      = ".age"
 )
 
 var (
-	secret        *string
-	xipherFileExt = "." + xipher.Info.AppNameLC
+	secret            *string
+	keyringPassphrase *string
+	xipherFileExt     = "." + xipher.Info.AppNameLC
 )
 
 var (
@@ -38,6 +48,12 @@ var (
 	// Encrypt Stream Command
 	encryptStreamCmd *cobra.Command
 
+	// Encrypt Directory Command
+	encryptDirCmd *cobra.Command
+
+	// Encrypt Values Command
+	encryptValuesCmd *cobra.Command
+
 	// Decrypt Command
 	decryptCmd *cobra.Command
 
@@ -50,8 +66,47 @@ var (
 	// Decrypt File Command
 	decryptFileCmd *cobra.Command
 
-	// KMS Command
-	kmsCmd *cobra.Command
+	// Decrypt Directory Command
+	decryptDirCmd *cobra.Command
+
+	// Decrypt Values Command
+	decryptValuesCmd *cobra.Command
+
+	// KMS Commands
+	kmsCmd     *cobra.Command
+	kmsSealCmd *cobra.Command
+
+	// Exec Command
+	execCmd *cobra.Command
+
+	// Git Filter Commands
+	gitFilterCmd         *cobra.Command
+	gitFilterCleanCmd    *cobra.Command
+	gitFilterSmudgeCmd   *cobra.Command
+	gitFilterTextconvCmd *cobra.Command
+
+	// Git Commands
+	gitCmd           *cobra.Command
+	gitInitFilterCmd *cobra.Command
+
+	// Verify Integrity Command
+	verifyIntegrityCmd *cobra.Command
+
+	// Keyring Commands
+	keysCmd        *cobra.Command
+	keysAddCmd     *cobra.Command
+	keysListCmd    *cobra.Command
+	keysRmCmd      *cobra.Command
+	keysTrustCmd   *cobra.Command
+	keysUntrustCmd *cobra.Command
+
+	// Serve Key Command
+	serveKeyCmd *cobra.Command
+
+	// Key Cache Commands
+	cacheCmd      *cobra.Command
+	cacheListCmd  *cobra.Command
+	cacheClearCmd *cobra.Command
 )
 
 type flagDef struct {
@@ -78,6 +133,24 @@ func (f *boolFlag) fields() (string, string, bool, string) {
 	return f.name, f.shorthand, f.value, f.usage
 }
 
+type intFlag struct {
+	flagDef
+	value int
+}
+
+func (f *intFlag) fields() (string, string, int, string) {
+	return f.name, f.shorthand, f.value, f.usage
+}
+
+type strSliceFlag struct {
+	flagDef
+	value []string
+}
+
+func (f *strSliceFlag) fields() (string, string, []string, string) {
+	return f.name, f.shorthand, f.value, f.usage
+}
+
 var (
 
 	// Version Flag
@@ -103,7 +176,63 @@ var (
 		flagDef: flagDef{
 			name:      "quantum-safe",
 			shorthand: "q",
-			usage:     "Use quantum-safe hybrid cryptography (X25519 + ML-KEM-1024)",
+			usage:     "Use quantum-safe hybrid cryptography (X25519 + ML-KEM-1024), same as --suite hybrid",
+		},
+	}
+
+	// Suite Flag
+	suiteFlag = strFlag{
+		flagDef: flagDef{
+			name:  "suite",
+			usage: "Key suite: x25519 (default), hybrid (X25519 + ML-KEM-1024), hybrid-768 (X25519 + ML-KEM-768) or mlkem (ML-KEM-1024)",
+		},
+	}
+
+	// Expires Flag
+	expiresFlag = strFlag{
+		flagDef: flagDef{
+			name:  "expires",
+			usage: "Expire the public key after a duration (e.g. 90d, 12w, 1y, 720h) or on a date (e.g. 2026-12-31)",
+		},
+	}
+
+	// Label Flag
+	labelFlag = strFlag{
+		flagDef: flagDef{
+			name:  "label",
+			usage: "Label to embed in the public key",
+		},
+	}
+
+	// Usage Flag
+	usageFlag = strFlag{
+		flagDef: flagDef{
+			name:  "usage",
+			usage: "Intended usage to embed in the public key (e.g. backup, email)",
+		},
+	}
+
+	// Pad Flag
+	padFlag = strFlag{
+		flagDef: flagDef{
+			name:  "pad",
+			usage: "Pad the ciphertext to hide the plaintext length: --pad for padme, or --pad=<size> to pad to a multiple of a block size such as 256, 4k or 1m",
+		},
+	}
+
+	// File Metadata Flag
+	fileMetadataFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "metadata",
+			usage: "Store the file name, size, permissions and modification time in the encrypted file",
+		},
+	}
+
+	// Allow Expired Key Flag
+	allowExpiredFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "allow-expired",
+			usage: "Encrypt to the public key even if it has expired",
 		},
 	}
 
@@ -129,15 +258,88 @@ var (
 		flagDef: flagDef{
 			name:      "key",
 			shorthand: "k",
-			usage:     "Public key, secret key, password, or a URL/domain serving a public key",
+			usage:     "Public key, ssh-ed25519 key, @alias from the keyring, github:<user>, secret key, password, or a URL/domain/email address serving a public key",
+		},
+	}
+
+	// Decrypt Key Flag
+	decryptKeyFlag = strFlag{
+		flagDef: flagDef{
+			name:      "key",
+			shorthand: "k",
+			usage:     "Secret key, or @alias of a secret key in the keyring, to decrypt with",
+		},
+	}
+
+	// Force Remove Flag
+	forceRemoveFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "force",
+			usage: "Remove secret keys from the keyring without asking for confirmation",
 		},
 	}
 
-	// Fetch Flag: treat the key value as a URL/domain and fetch the public key from it
-	fetchKeyFlag = boolFlag{
+	// Fetch Flag: treat the key value as a URL/domain/email address and fetch the public key from it
+	fetchKeyFlag = strFlag{
 		flagDef: flagDef{
 			name:  "fetch",
-			usage: "Fetch the public key by treating the key value as a URL or domain",
+			usage: "Fetch the public key by treating the key value as a URL, domain or email address: --fetch tries the well-known HTTPS path and then the _xipher DNS TXT record of a domain, --fetch=https or --fetch=dns uses only one",
+		},
+	}
+
+	// Offline Flag: resolve URL/domain/email keys from the key cache only
+	offlineFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "offline",
+			usage: "Resolve public keys of URLs, domains and email addresses from the key cache only, without network requests",
+		},
+	}
+
+	// CA File Flag
+	caFileFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "ca-file",
+			usage: "PEM bundle of CA certificates to trust, in addition to the system roots, when fetching public keys (repeatable)",
+		},
+	}
+
+	// Proxy Flag
+	proxyFlag = strFlag{
+		flagDef: flagDef{
+			name:  "proxy",
+			usage: "HTTP(S) or SOCKS5 proxy URL to fetch public keys through (default: from HTTPS_PROXY)",
+		},
+	}
+
+	// Client Certificate Flag
+	clientCertFlag = strFlag{
+		flagDef: flagDef{
+			name:  "client-cert",
+			usage: "PEM client certificate to present to key hosts that require mutual TLS (requires --client-key)",
+		},
+	}
+
+	// Client Key Flag
+	clientKeyFlag = strFlag{
+		flagDef: flagDef{
+			name:  "client-key",
+			usage: "PEM private key of the client certificate (requires --client-cert)",
+		},
+	}
+
+	// Fetch Timeout Flag
+	fetchTimeoutFlag = strFlag{
+		flagDef: flagDef{
+			name:  "fetch-timeout",
+			usage: "Time limit of each request fetching a public key, such as 30s (default: 10s)",
+		},
+	}
+
+	// Max Redirects Flag
+	maxRedirectsFlag = intFlag{
+		flagDef: flagDef{
+			name:  "max-redirects",
+			usage: "Redirects to follow when fetching a public key, or -1 for none (default: 5)",
 		},
 	}
 
@@ -168,6 +370,143 @@ var (
 		},
 	}
 
+	// Source Directory Flag
+	sourceDirFlag = strFlag{
+		flagDef: flagDef{
+			name:      "dir",
+			shorthand: "d",
+			usage:     "Path to the input directory",
+		},
+	}
+
+	// Include Flag
+	signsFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "signs",
+			usage: "Trust the ssh-ed25519 key to sign the published key documents of this key URL or domain (repeatable)",
+		},
+	}
+	includeFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "include",
+			usage: "Only include files matching this glob (repeatable; matched against the relative path or any name in it)",
+		},
+	}
+
+	// Exclude Flag
+	excludeFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "exclude",
+			usage: "Exclude files and directories matching this glob (repeatable; matched against the relative path or any name in it)",
+		},
+	}
+
+	// Include Keys Flag
+	includeKeysFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "include",
+			usage: "Only encrypt values whose key path matches this pattern (repeatable; dot-separated globs such as db.password or *.secret)",
+		},
+	}
+
+	// Exclude Keys Flag
+	excludeKeysFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "exclude",
+			usage: "Leave values whose key path matches this pattern in plaintext (repeatable; dot-separated globs)",
+		},
+	}
+
+	// Env File Flag
+	envFileFlag = strSliceFlag{
+		flagDef: flagDef{
+			name:  "env-file",
+			usage: "Encrypted dotenv file to load into the environment of the command (repeatable; later files take precedence)",
+		},
+	}
+
+	// Age Keys Flag
+	ageKeysFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "age",
+			usage: "Also show the age identity and recipient of the key (x25519 suite and secret keys only)",
+		},
+	}
+
+	// Output Format Flag
+	outputFormatFlag = strFlag{
+		flagDef: flagDef{
+			name:  "format",
+			usage: "Output format: xipher, or age for an age v1 file that age and rage can decrypt (ASCII armored with --xiphertext)",
+		},
+		value: formatXipher,
+	}
+
+	// Values Format Flag
+	valuesFormatFlag = strFlag{
+		flagDef: flagDef{
+			name:  "format",
+			usage: "Document format: yaml, json or dotenv (default: detected from the file name)",
+		},
+	}
+
+	// List Flag
+	listFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "list",
+			usage: "List the contents of the encrypted directory without extracting",
+		},
+	}
+
+	// Recursive Flag
+	recursiveFlag = boolFlag{
+		flagDef: flagDef{
+			name:      "recursive",
+			shorthand: "r",
+			usage:     "Process directories given as arguments recursively",
+		},
+	}
+
+	// Output Directory Flag
+	outDirFlag = strFlag{
+		flagDef: flagDef{
+			name:  "out-dir",
+			usage: "Directory to write the output files to, mirroring the input tree",
+		},
+	}
+
+	// In Place Flag
+	inPlaceFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "in-place",
+			usage: "Replace each input file with its output, written atomically, and remove the original",
+		},
+	}
+
+	// Values In Place Flag
+	valuesInPlaceFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "in-place",
+			usage: "Write the result back to the input file, atomically",
+		},
+	}
+
+	// Shred Flag
+	shredFlag = boolFlag{
+		flagDef: flagDef{
+			name:  "shred",
+			usage: "Overwrite originals removed by --in-place with random data first (best-effort)",
+		},
+	}
+
+	// SSH Key Flag
+	sshKeyFlag = strFlag{
+		flagDef: flagDef{
+			name:  "ssh-key",
+			usage: "Path to an OpenSSH private key (ssh-ed25519) to decrypt with",
+		},
+	}
+
 	// Output File Flag
 	outputFileFlag = strFlag{
 		flagDef: flagDef{
@@ -227,6 +566,48 @@ var (
 		},
 	}
 
+	// Workers Flag
+	workersFlag = intFlag{
+		flagDef: flagDef{
+			name:  "workers",
+			usage: "Number of files to process in parallel",
+		},
+		value: runtime.NumCPU(),
+	}
+
+	// Serve Name Flag
+	serveNameFlag = strFlag{
+		flagDef: flagDef{
+			name:  "name",
+			usage: "Display name to serve with the public keys (default: the keyring alias of @alias keys)",
+		},
+	}
+
+	// Serve Address Flag
+	serveAddrFlag = strFlag{
+		flagDef: flagDef{
+			name:  "addr",
+			usage: "Address to listen on",
+		},
+		value: ":8080",
+	}
+
+	// TLS Certificate Flag
+	tlsCertFlag = strFlag{
+		flagDef: flagDef{
+			name:  "tls-cert",
+			usage: "Path to the PEM certificate chain to serve HTTPS with (requires --tls-key)",
+		},
+	}
+
+	// TLS Key Flag
+	tlsKeyFlag = strFlag{
+		flagDef: flagDef{
+			name:  "tls-key",
+			usage: "Path to the PEM private key of the certificate (requires --tls-cert)",
+		},
+	}
+
 	// KMS Config Flag
 	kmsConfigFlag = strFlag{
 		flagDef: flagDef{
@@ -235,4 +616,29 @@ var (
 			usage:     "Path to the XKMS YAML configuration file",
 		},
 	}
+
+	// KMS Seal Key Flag
+	kmsSealKeyFlag = strFlag{
+		flagDef: flagDef{
+			name:      "key",
+			shorthand: "k",
+			usage:     "Public key, secret key or password to seal the seed under",
+		},
+	}
+
+	// KMS Seal Shares Flag
+	kmsSharesFlag = intFlag{
+		flagDef: flagDef{
+			name:  "shares",
+			usage: "Seal under a random unseal key split into this many Shamir shares",
+		},
+	}
+
+	// KMS Seal Threshold Flag
+	kmsThresholdFlag = intFlag{
+		flagDef: flagDef{
+			name:  "threshold",
+			usage: "Number of Shamir shares that unseal the seed (requires --shares)",
+		},
+	}
 )
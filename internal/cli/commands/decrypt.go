@@ -1,11 +1,16 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"xipher.org/xipher"
 	"xipher.org/xipher/internal/utils"
 )
 
@@ -19,9 +24,13 @@ func decryptCommand() *cobra.Command {
 				cmd.Help()
 			},
 		}
+		decryptCmd.PersistentFlags().StringP(decryptKeyFlag.fields())
+		decryptCmd.PersistentFlags().StringP(sshKeyFlag.fields())
 		decryptCmd.AddCommand(decryptTextCommand())
 		decryptCmd.AddCommand(decryptFileCommand())
 		decryptCmd.AddCommand(decryptStreamCommand())
+		decryptCmd.AddCommand(decryptDirCommand())
+		decryptCmd.AddCommand(decryptValuesCommand())
 	}
 	return decryptCmd
 }
@@ -43,16 +52,109 @@ func getSecretKeyOrPwd(interactive bool) (string, error) {
 	return *secret, nil
 }
 
+// getSecretFromSSHKeyFile loads the OpenSSH private key at path. A passphrase is
+// taken from the XIPHER_SSH_PASSPHRASE environment variable or, if interactive,
+// asked for.
+func getSecretFromSSHKeyFile(path string, interactive bool) (string, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret, err := utils.LoadSSHPrivateKey(pemBytes, []byte(os.Getenv(envar_XIPHER_SSH_PASSPHRASE)))
+	if !errors.Is(err, utils.ErrSSHPassphraseRequired) {
+		return secret, err
+	}
+	if !interactive {
+		return "", fmt.Errorf("%w: set it in the %s environment variable", err, envar_XIPHER_SSH_PASSPHRASE)
+	}
+	passphrase, err := getHiddenInputFromUser(fmt.Sprintf("Enter passphrase for %s: ", path))
+	if err != nil {
+		return "", err
+	}
+	return utils.LoadSSHPrivateKey(pemBytes, passphrase)
+}
+
 // resolveSecretKey returns the secret key to use for the operation. When the
-// --web-auth flag is set it launches the browser-assisted flow; otherwise it
-// falls back to the normal env-var / interactive prompt path.
+// --web-auth flag is set it launches the browser-assisted flow, and with
+// --ssh-key it loads the SSH private key; otherwise it takes --key or falls
+// back to the normal env-var / interactive prompt path. An @alias of a key in
+// the keyring is unlocked from the keyring; other input is a secret key or
+// password, even if it starts with @.
 func resolveSecretKey(cmd *cobra.Command, interactive bool) (string, error) {
 	webAuth, _ := cmd.Flags().GetBool(webAuthFlag.name)
 	if webAuth {
 		xipherURL, _ := cmd.Flags().GetString(xipherURLFlag.name)
 		return getSecretKeyFromWebAuth(xipherURL)
 	}
-	return getSecretKeyOrPwd(interactive)
+	if sshKeyPath, _ := cmd.Flags().GetString(sshKeyFlag.name); sshKeyPath != "" {
+		return getSecretFromSSHKeyFile(sshKeyPath, interactive)
+	}
+	secretKeyOrPwd, _ := cmd.Flags().GetString(decryptKeyFlag.name)
+	if secretKeyOrPwd == "" {
+		var err error
+		if secretKeyOrPwd, err = getSecretKeyOrPwd(interactive); err != nil {
+			return "", err
+		}
+	}
+	entry, err := utils.LookupKeyringRef(secretKeyOrPwd)
+	if err != nil || entry == nil {
+		return secretKeyOrPwd, err
+	}
+	passphrase, err := getKeyringPassphrase(interactive, false, true)
+	if err != nil {
+		return "", err
+	}
+	return entry.Unlock(passphrase)
+}
+
+// resolveSecretKeys is resolveSecretKey for the decrypt commands, which try
+// every secret key in the keyring that the keyring passphrase unlocks when no
+// secret is given by flag or environment variable. If none of them decrypts,
+// the secret key or password is asked for as usual, once for all files.
+// Non-interactively, the keyring is only used if its passphrase is in the
+// environment, and nothing is asked for.
+func resolveSecretKeys(cmd *cobra.Command, interactive bool) (utils.Secrets, error) {
+	if !secretKeyGiven(cmd) && (interactive || os.Getenv(envar_XIPHER_KEYRING_PASSPHRASE) != "") {
+		keyring, err := utils.LoadKeyring()
+		if err != nil {
+			return nil, err
+		}
+		if len(keyring.OwnedKeys()) > 0 {
+			passphrase, err := getKeyringPassphrase(interactive, false, true)
+			if err != nil {
+				return nil, err
+			}
+			secrets, err := keyring.UnlockOwnedKeys(passphrase)
+			if err != nil || !interactive {
+				return utils.SecretList(secrets...), err
+			}
+			fallback := sync.OnceValues(func() (string, error) {
+				return resolveSecretKey(cmd, interactive)
+			})
+			return func(yield func(string, error) bool) {
+				for _, secret := range secrets {
+					if !yield(secret, nil) {
+						return
+					}
+				}
+				yield(fallback())
+			}, nil
+		}
+	}
+	secretKeyOrPwd, err := resolveSecretKey(cmd, interactive)
+	if err != nil {
+		return nil, err
+	}
+	return utils.SecretList(secretKeyOrPwd), nil
+}
+
+// secretKeyGiven reports whether a secret key or password is given by flag or
+// the XIPHER_SECRET environment variable.
+func secretKeyGiven(cmd *cobra.Command) bool {
+	webAuth, _ := cmd.Flags().GetBool(webAuthFlag.name)
+	sshKeyPath, _ := cmd.Flags().GetString(sshKeyFlag.name)
+	keyFlag, _ := cmd.Flags().GetString(decryptKeyFlag.name)
+	return webAuth || sshKeyPath != "" || keyFlag != "" || os.Getenv(envar_XIPHER_SECRET) != ""
 }
 
 func decryptTextCommand() *cobra.Command {
@@ -64,11 +166,11 @@ func decryptTextCommand() *cobra.Command {
 			Run: func(cmd *cobra.Command, args []string) {
 				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
 				xipherText := cmd.Flag(ciphertextFlag.name).Value.String()
-				secretKeyOrPwd, err := resolveSecretKey(cmd, true)
+				secrets, err := resolveSecretKeys(cmd, true)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
-				data, err := utils.DecryptData(secretKeyOrPwd, xipherText)
+				data, err := utils.DecryptDataForAny(secrets, xipherText)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
@@ -92,22 +194,40 @@ func decryptTextCommand() *cobra.Command {
 func decryptFileCommand() *cobra.Command {
 	if decryptFileCmd == nil {
 		decryptFileCmd = &cobra.Command{
-			Use:     "file",
+			Use:     "file [path]...",
 			Aliases: []string{"f"},
-			Short:   "Decrypt an encrypted file",
+			Short:   "Decrypt an encrypted file, or a batch of files",
+			Long: `Decrypt the file given with --file. Several files, glob patterns and, with
+--recursive, directories of ` + xipherFileExt + ` and ` + ageFileExt + ` files can be given as arguments to
+decrypt them as a batch, in parallel, next to the originals or under --out-dir.
+With --in-place, each encrypted file is replaced by its decrypted copy. Files
+in the age v1 format, encrypted to an X25519 recipient or a passphrase, are
+decrypted with an AGE-SECRET-KEY identity, a xipher secret key or the passphrase.`,
 			Run: func(cmd *cobra.Command, args []string) {
 				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
 				overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
-				srcPath := cmd.Flag(sourceFileFlag.name).Value.String()
+				paths, batch := getInputPaths(cmd, args)
+				if batch {
+					runDecryptBatch(cmd, paths)
+					return
+				}
+				srcPath := paths[0]
 				dstPath := cmd.Flag(outputFileFlag.name).Value.String()
+				src, err := os.Open(srcPath)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				secrets, err := resolveSecretKeys(cmd, true)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				reader, fileInfo, err := utils.NewFileDecryptingReaderForAny(secrets, src)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
 				if dstPath == "" {
-					if idx := len(srcPath) - len(xipherFileExt); idx > 0 {
-						if srcPath[idx:] == xipherFileExt {
-							dstPath = srcPath[:idx]
-						}
-					}
+					dstPath = decryptedFilePath(srcPath, fileInfo)
 				}
-				var err error
 				for {
 					if _, err = os.Stat(dstPath); os.IsNotExist(err) {
 						break
@@ -126,26 +246,32 @@ func decryptFileCommand() *cobra.Command {
 						exitOnError(err, jsonFormat)
 					}
 				}
-				src, err := os.Open(srcPath)
+				dst, err := utils.NewAtomicFileWriter(dstPath, outputFilePerm)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
-				dst := utils.NewThresholdFileWriter(dstPath, fileWriteThreshold)
-				secretKeyOrPwd, err := resolveSecretKey(cmd, true)
-				if err != nil {
-					dst.Discard()
-					exitOnError(err, jsonFormat)
+				written, err := io.Copy(dst, reader)
+				if err == nil {
+					err = checkFileSize(written, fileInfo)
 				}
-				if err = utils.DecryptStream(secretKeyOrPwd, dst, src); err != nil {
+				if err != nil {
 					dst.Discard()
 					exitOnError(err, jsonFormat)
 				}
 				if err = dst.Close(); err != nil {
 					exitOnError(err, jsonFormat)
 				}
+				if fileInfo != nil {
+					if err = restoreFileInfo(dstPath, fileInfo); err != nil && !jsonFormat {
+						fmt.Println(color.YellowString("Could not restore file attributes: %v", err))
+					}
+				}
 				if jsonFormat {
 					resultMap := make(map[string]interface{})
 					resultMap["decryptedFile"] = dstPath
+					if fileInfo != nil {
+						resultMap["fileInfo"] = fileInfo
+					}
 					fmt.Println(toJsonString(resultMap))
 				} else {
 					fmt.Println("Decrypted file:", color.GreenString(dstPath))
@@ -155,7 +281,11 @@ func decryptFileCommand() *cobra.Command {
 		decryptFileCmd.Flags().BoolP(overwriteFlag.fields())
 		decryptFileCmd.Flags().StringP(sourceFileFlag.fields())
 		decryptFileCmd.Flags().StringP(outputFileFlag.fields())
-		decryptFileCmd.MarkFlagRequired(sourceFileFlag.name)
+		decryptFileCmd.Flags().BoolP(recursiveFlag.fields())
+		decryptFileCmd.Flags().StringP(outDirFlag.fields())
+		decryptFileCmd.Flags().IntP(workersFlag.fields())
+		decryptFileCmd.Flags().BoolP(inPlaceFlag.fields())
+		decryptFileCmd.Flags().BoolP(shredFlag.fields())
 		decryptFileCmd.Flags().BoolP(webAuthFlag.fields())
 		decryptFileCmd.Flags().StringP(xipherURLFlag.fields())
 	}
@@ -170,22 +300,16 @@ func decryptStreamCommand() *cobra.Command {
 			Short:   "Decrypt data from stdin to stdout",
 			Run: func(cmd *cobra.Command, args []string) {
 				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
-				webAuth, _ := cmd.Flags().GetBool(webAuthFlag.name)
-				var secretKeyOrPwd string
-				if webAuth {
-					xipherURL, _ := cmd.Flags().GetString(xipherURLFlag.name)
-					var err error
-					if secretKeyOrPwd, err = getSecretKeyFromWebAuth(xipherURL); err != nil {
-						exitOnError(err, jsonFormat)
-					}
-				} else {
-					secretKeyOrPwd, _ = getSecretKeyOrPwd(false)
-					if secretKeyOrPwd == "" {
-						exitOnErrorWithMessage(fmt.Sprintf(
-							"provide a secret key or password via the %s environment variable or use --web-auth", envar_XIPHER_SECRET), jsonFormat)
-					}
+				if !secretKeyGiven(cmd) && os.Getenv(envar_XIPHER_KEYRING_PASSPHRASE) == "" {
+					exitOnErrorWithMessage(fmt.Sprintf(
+						"provide a secret key or password via the %s environment variable or --%s, the keyring passphrase via %s, or use --%s or --web-auth",
+						envar_XIPHER_SECRET, decryptKeyFlag.name, envar_XIPHER_KEYRING_PASSPHRASE, sshKeyFlag.name), jsonFormat)
+				}
+				secrets, err := resolveSecretKeys(cmd, false)
+				if err != nil {
+					exitOnError(err, jsonFormat)
 				}
-				if err := utils.DecryptStream(secretKeyOrPwd, os.Stdout, os.Stdin); err != nil {
+				if err := utils.DecryptStreamForAny(secrets, os.Stdout, os.Stdin); err != nil {
 					exitOnError(err, jsonFormat)
 				}
 			},
@@ -195,3 +319,37 @@ func decryptStreamCommand() *cobra.Command {
 	}
 	return decryptStreamCmd
 }
+
+// decryptedFilePath returns the default output path for the encrypted file at
+// srcPath: the stored file name in the same directory if there is one,
+// otherwise srcPath without its extension.
+func decryptedFilePath(srcPath string, fileInfo *xipher.FileInfo) string {
+	if fileInfo != nil && fileInfo.Name != "" {
+		return filepath.Join(filepath.Dir(srcPath), fileInfo.Name)
+	}
+	if trimmed := trimEncryptedFileExt(srcPath); trimmed != srcPath && trimmed != "" {
+		return trimmed
+	}
+	return ""
+}
+
+// checkFileSize returns an error if the stored file size is known and differs
+// from the written number of bytes of the decrypted file.
+func checkFileSize(written int64, fileInfo *xipher.FileInfo) error {
+	if fileInfo == nil || fileInfo.Size < 0 || written == fileInfo.Size {
+		return nil
+	}
+	return fmt.Errorf("decrypted %d bytes, but the original file had %d", written, fileInfo.Size)
+}
+
+// restoreFileInfo applies the stored permissions and modification time to path.
+func restoreFileInfo(path string, fileInfo *xipher.FileInfo) error {
+	var errs []error
+	if fileInfo.Mode != 0 {
+		errs = append(errs, os.Chmod(path, fileInfo.Mode.Perm()))
+	}
+	if !fileInfo.ModTime.IsZero() {
+		errs = append(errs, os.Chtimes(path, fileInfo.ModTime, fileInfo.ModTime))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher/internal/utils"
+)
+
+func encryptDirCommand() *cobra.Command {
+	if encryptDirCmd == nil {
+		encryptDirCmd = &cobra.Command{
+			Use:     "dir",
+			Aliases: []string{"directory", "d"},
+			Short:   "Encrypt a directory as an encrypted tar archive",
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				toXipherTxt, _ := cmd.Flags().GetBool(toXipherTxtFlag.name)
+				overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
+				compress, _ := cmd.Flags().GetBool(compressFlag.name)
+				opts, err := getEncryptOptions(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				srcDir := filepath.Clean(cmd.Flag(sourceDirFlag.name).Value.String())
+				if info, err := os.Stat(srcDir); err != nil {
+					exitOnError(err, jsonFormat)
+				} else if !info.IsDir() {
+					exitOnErrorWithMessage(fmt.Sprintf("not a directory: %s", srcDir), jsonFormat)
+				}
+				dstPath := cmd.Flag(outputFileFlag.name).Value.String()
+				if dstPath == "" {
+					dstPath = srcDir + xipherFileExt
+				}
+				if _, err = os.Stat(dstPath); err == nil && !overwrite {
+					exitOnErrorWithMessage(fmt.Sprintf("file already exists: %s (use --%s to replace it)", dstPath, overwriteFlag.name), jsonFormat)
+				}
+				keyPwdStr, err := getKeyPwdStr(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				dst := utils.NewThresholdFileWriter(dstPath, fileWriteThreshold)
+				entries, err := utils.EncryptDir(keyPwdStr, dst, srcDir, getArchiveFilter(cmd), compress, toXipherTxt, opts...)
+				if err != nil {
+					dst.Discard()
+					exitOnError(err, jsonFormat)
+				}
+				if err = dst.Flush(); err != nil {
+					dst.Discard()
+					exitOnError(err, jsonFormat)
+				}
+				if err = dst.Close(); err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(map[string]interface{}{
+						"encryptedFile": dstPath,
+						"entries":       len(entries),
+					}))
+				} else {
+					fmt.Printf("Encrypted %d entries from %s\n", len(entries), srcDir)
+					fmt.Println("Encrypted file:", color.GreenString(dstPath))
+					fmt.Println("This encrypted file is safe to share over any medium.")
+				}
+			},
+		}
+		encryptDirCmd.Flags().StringP(sourceDirFlag.fields())
+		encryptDirCmd.Flags().StringP(outputFileFlag.fields())
+		encryptDirCmd.Flags().BoolP(overwriteFlag.fields())
+		encryptDirCmd.Flags().BoolP(toXipherTxtFlag.fields())
+		encryptDirCmd.Flags().BoolP(compressFlag.fields())
+		encryptDirCmd.Flags().StringSliceP(includeFlag.fields())
+		encryptDirCmd.Flags().StringSliceP(excludeFlag.fields())
+		encryptDirCmd.MarkFlagRequired(sourceDirFlag.name)
+		encryptDirCmd.Flags().BoolP(webAuthFlag.fields())
+		encryptDirCmd.Flags().StringP(xipherURLFlag.fields())
+	}
+	return encryptDirCmd
+}
+
+func decryptDirCommand() *cobra.Command {
+	if decryptDirCmd == nil {
+		decryptDirCmd = &cobra.Command{
+			Use:     "dir",
+			Aliases: []string{"directory", "d"},
+			Short:   "Decrypt and extract a directory encrypted with 'encrypt dir'",
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
+				list, _ := cmd.Flags().GetBool(listFlag.name)
+				srcPath := cmd.Flag(sourceFileFlag.name).Value.String()
+				dstDir := cmd.Flag(outputFileFlag.name).Value.String()
+				if dstDir == "" && !list {
+					if dstDir = strings.TrimSuffix(srcPath, xipherFileExt); dstDir == srcPath {
+						exitOnErrorWithMessage(fmt.Sprintf("set the output directory using --%s", outputFileFlag.name), jsonFormat)
+					}
+				}
+				src, err := os.Open(srcPath)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				defer src.Close()
+				secretKeyOrPwd, err := resolveSecretKey(cmd, true)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				var entries []utils.ArchiveEntry
+				if list {
+					entries, err = utils.ListEncryptedDir(secretKeyOrPwd, src, getArchiveFilter(cmd))
+				} else {
+					entries, err = utils.DecryptDir(secretKeyOrPwd, src, dstDir, getArchiveFilter(cmd), overwrite)
+				}
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					resultMap := map[string]interface{}{"entries": entries}
+					if !list {
+						resultMap["decryptedDir"] = dstDir
+					}
+					fmt.Println(toJsonString(resultMap))
+					return
+				}
+				if list {
+					for _, entry := range entries {
+						printArchiveEntry(entry)
+					}
+					fmt.Printf("%d entries\n", len(entries))
+				} else {
+					fmt.Printf("Extracted %d entries\n", len(entries))
+					fmt.Println("Decrypted directory:", color.GreenString(dstDir))
+				}
+			},
+		}
+		decryptDirCmd.Flags().StringP(sourceFileFlag.fields())
+		decryptDirCmd.Flags().StringP(outputFileFlag.fields())
+		decryptDirCmd.Flags().BoolP(overwriteFlag.fields())
+		decryptDirCmd.Flags().BoolP(listFlag.fields())
+		decryptDirCmd.Flags().StringSliceP(includeFlag.fields())
+		decryptDirCmd.Flags().StringSliceP(excludeFlag.fields())
+		decryptDirCmd.MarkFlagRequired(sourceFileFlag.name)
+		decryptDirCmd.Flags().BoolP(webAuthFlag.fields())
+		decryptDirCmd.Flags().StringP(xipherURLFlag.fields())
+	}
+	return decryptDirCmd
+}
+
+// getArchiveFilter returns the filter selected by --include and --exclude, or nil for none.
+func getArchiveFilter(cmd *cobra.Command) *utils.ArchiveFilter {
+	include, _ := cmd.Flags().GetStringSlice(includeFlag.name)
+	exclude, _ := cmd.Flags().GetStringSlice(excludeFlag.name)
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	return &utils.ArchiveFilter{Include: include, Exclude: exclude}
+}
+
+func printArchiveEntry(entry utils.ArchiveEntry) {
+	modTime := entry.ModTime.Local().Format("2006-01-02 15:04")
+	switch entry.Type {
+	case utils.EntryDir:
+		fmt.Printf("%s %10s %s %s\n", (entry.Mode | os.ModeDir).String(), "", modTime, color.BlueString(entry.Name+"/"))
+	case utils.EntrySymlink:
+		fmt.Printf("%s %10s %s %s -> %s\n", (entry.Mode | os.ModeSymlink).String(), "", modTime, color.CyanString(entry.Name), entry.Linkname)
+	default:
+		fmt.Printf("%s %10d %s %s\n", entry.Mode.String(), entry.Size, modTime, entry.Name)
+	}
+}
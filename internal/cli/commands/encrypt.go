@@ -1,13 +1,18 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"xipher.org/xipher"
 	"xipher.org/xipher/internal/utils"
+	"xipher.org/xipher/resolve"
 )
 
 func encryptCommand() *cobra.Command {
@@ -16,20 +21,113 @@ func encryptCommand() *cobra.Command {
 			Use:     "encrypt",
 			Aliases: []string{"encr", "enc", "en", "e"},
 			Short:   "Encrypt data",
+			PersistentPreRun: func(cmd *cobra.Command, args []string) {
+				offline, _ := cmd.Flags().GetBool(offlineFlag.name)
+				utils.SetKeyFetchOffline(offline)
+				if err := configureKeyFetch(cmd); err != nil {
+					jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+					exitOnError(err, jsonFormat)
+				}
+			},
 			Run: func(cmd *cobra.Command, args []string) {
 				cmd.Help()
 			},
 		}
 		encryptCmd.PersistentFlags().StringP(keyOrPwdFlag.fields())
-		encryptCmd.PersistentFlags().BoolP(fetchKeyFlag.fields())
+		encryptCmd.PersistentFlags().StringP(fetchKeyFlag.fields())
+		encryptCmd.PersistentFlags().Lookup(fetchKeyFlag.name).NoOptDefVal = string(resolve.ModeAuto)
+		encryptCmd.PersistentFlags().BoolP(offlineFlag.fields())
+		addKeyFetchFlags(encryptCmd)
 		encryptCmd.PersistentFlags().BoolP(ignorePasswordCheckFlag.fields())
+		encryptCmd.PersistentFlags().BoolP(allowExpiredFlag.fields())
+		encryptCmd.PersistentFlags().StringP(padFlag.fields())
+		encryptCmd.PersistentFlags().Lookup(padFlag.name).NoOptDefVal = padmeScheme
 		encryptCmd.AddCommand(encryptTextCommand())
 		encryptCmd.AddCommand(encryptFileCommand())
 		encryptCmd.AddCommand(encryptStreamCommand())
+		encryptCmd.AddCommand(encryptDirCommand())
+		encryptCmd.AddCommand(encryptValuesCommand())
 	}
 	return encryptCmd
 }
 
+// getEncryptOptions returns the encryption options selected by the command flags.
+func getEncryptOptions(cmd *cobra.Command) ([]xipher.EncryptOption, error) {
+	var opts []xipher.EncryptOption
+	if allowExpired, _ := cmd.Flags().GetBool(allowExpiredFlag.name); allowExpired {
+		opts = append(opts, xipher.AllowExpiredKey())
+	}
+	pad, _ := cmd.Flags().GetString(padFlag.name)
+	switch pad = strings.ToLower(strings.TrimSpace(pad)); pad {
+	case "", "none":
+	case padmeScheme:
+		opts = append(opts, xipher.PadPadme())
+	default:
+		size, err := parseByteSize(pad)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid --%s value %q: use %s or a block size such as 256, 4k or 1m", padFlag.name, pad, padmeScheme)
+		}
+		opts = append(opts, xipher.PadToMultiple(size))
+	}
+	return opts, nil
+}
+
+// getOutputFormat returns the output format selected with --format, rejecting
+// the options the age format has no room for.
+func getOutputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString(outputFormatFlag.name)
+	switch format = strings.ToLower(strings.TrimSpace(format)); format {
+	case "", formatXipher:
+		return formatXipher, nil
+	case formatAge:
+		for _, name := range []string{padFlag.name, compressFlag.name, fileMetadataFlag.name} {
+			if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+				return "", fmt.Errorf("--%s cannot be used with --%s=%s", name, outputFormatFlag.name, formatAge)
+			}
+		}
+		return formatAge, nil
+	}
+	return "", fmt.Errorf("invalid --%s value %q: use %s or %s", outputFormatFlag.name, format, formatXipher, formatAge)
+}
+
+// encryptedFileExt returns the extension of encrypted files in the given format.
+func encryptedFileExt(format string) string {
+	if format == formatAge {
+		return ageFileExt
+	}
+	return xipherFileExt
+}
+
+// encryptStreamAs encrypts src to dst in the given format. For age files, encode
+// selects the ASCII armor and compress and opts are not used.
+func encryptStreamAs(format, keyPwdStr string, dst io.Writer, src io.Reader, compress, encode, allowExpired bool, opts []xipher.EncryptOption) error {
+	if format == formatAge {
+		return utils.EncryptAgeStream(keyPwdStr, dst, src, encode, allowExpired)
+	}
+	return utils.EncryptStream(keyPwdStr, dst, src, compress, encode, opts...)
+}
+
+// parseByteSize parses a size in bytes with an optional k, m or g suffix.
+func parseByteSize(s string) (int, error) {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
 func getKeyPwdStr(cmd *cobra.Command) (string, error) {
 	// --web-auth short-circuits the normal key/password prompt: derive the key
 	// from the browser instead and use it directly as the encryption key.
@@ -39,8 +137,7 @@ func getKeyPwdStr(cmd *cobra.Command) (string, error) {
 		// self-encryption. Encrypting to someone else's public key needs no local
 		// secret key - --web-auth is meaningless and likely a mistake.
 		keyFlag := cmd.Flag(keyOrPwdFlag.name).Value.String()
-		fetchFlag, _ := cmd.Flags().GetBool(fetchKeyFlag.name)
-		if strings.HasPrefix(keyFlag, "XPK_") || fetchFlag {
+		if strings.HasPrefix(keyFlag, "XPK_") || cmd.Flags().Changed(fetchKeyFlag.name) {
 			return "", fmt.Errorf("--web-auth cannot be used when encrypting to a recipient public key")
 		}
 		xipherURL, _ := cmd.Flags().GetString(xipherURLFlag.name)
@@ -59,36 +156,45 @@ func getKeyPwdStr(cmd *cobra.Command) (string, error) {
 		keyFlagInput = true
 	}
 
-	// --fetch forces URL/domain resolution with no confirmation. Without it, a
-	// value that merely looks like a bare domain is ambiguous (it could be a
-	// password), so confirm before fetching it over the network.
-	fetchFlag, _ := cmd.Flags().GetBool(fetchKeyFlag.name)
-	if !fetchFlag && utils.LooksLikeDomain(keyPwdStr) {
+	// --fetch forces URL/domain/email resolution with no confirmation. Without
+	// it, a value that merely looks like a bare domain or an email address is
+	// ambiguous (it could be a password), so confirm before fetching it over
+	// the network.
+	fetchFlag := cmd.Flags().Changed(fetchKeyFlag.name)
+	fetchModeStr, _ := cmd.Flags().GetString(fetchKeyFlag.name)
+	fetchMode, err := resolve.ParseMode(fetchModeStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid --%s value: %w", fetchKeyFlag.name, err)
+	}
+	if !fetchFlag && resolve.LooksLikeDomain(keyPwdStr) {
 		if confirmInput(fmt.Sprintf("'%s' looks like a domain. Fetch the public key from it?", keyPwdStr)) {
 			fetchFlag = true
 		}
+	} else if !fetchFlag && resolve.LooksLikeEmail(keyPwdStr) {
+		if confirmInput(fmt.Sprintf("'%s' looks like an email address. Look up its public key at %s?", keyPwdStr, keyPwdStr[strings.LastIndex(keyPwdStr, "@")+1:])) {
+			fetchFlag = true
+		}
 	}
-	if fetchFlag {
-		pubKeyStr, name, err := utils.FetchPublicKeyFromURL(keyPwdStr)
+	if fetchFlag || resolve.IsKeyURL(keyPwdStr) {
+		resolved, err := utils.KeyResolver().ResolveWithMode(keyPwdStr, fetchMode)
 		if err != nil {
 			return "", err
 		}
-		if name != "" {
-			if jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name); !jsonFormat {
-				fmt.Println("Resolved recipient:", color.HiCyanString(name))
-			}
+		if jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name); !jsonFormat {
+			printResolvedKey(resolved)
 		}
-		return pubKeyStr, nil
+		return resolved.PublicKey, nil
 	}
 
 	keyPwdStr, isKey, name, err := utils.GetSanitisedKeyOrPwd(keyPwdStr)
 	if err != nil {
 		return "", err
 	}
-	if name != "" {
-		if jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name); !jsonFormat {
+	if jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name); !jsonFormat {
+		if name != "" {
 			fmt.Println("Resolved recipient:", color.HiCyanString(name))
 		}
+		printRecipientKeyMetadata(keyPwdStr)
 	}
 	if !isKey && !keyFlagInput {
 		ignoreFlag, _ := cmd.Flags().GetBool(ignorePasswordCheckFlag.name)
@@ -116,10 +222,18 @@ func encryptTextCommand() *cobra.Command {
 			Short:   "Encrypt a text string",
 			Run: func(cmd *cobra.Command, args []string) {
 				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				format, err := getOutputFormat(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
 				keyPwdStr, err := getKeyPwdStr(cmd)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
+				opts, err := getEncryptOptions(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
 				text, _ := cmd.Flags().GetString(textFlag.name)
 				var input []byte
 				switch text {
@@ -133,8 +247,15 @@ func encryptTextCommand() *cobra.Command {
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
-				ctStr, ctUrl, err := utils.EncryptData(keyPwdStr, input, true)
-				if err != nil {
+				var ctStr, ctUrl string
+				if format == formatAge {
+					var buf bytes.Buffer
+					allowExpired, _ := cmd.Flags().GetBool(allowExpiredFlag.name)
+					if err = utils.EncryptAgeStream(keyPwdStr, &buf, bytes.NewReader(input), true, allowExpired); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					ctStr = buf.String()
+				} else if ctStr, ctUrl, err = utils.EncryptData(keyPwdStr, input, true, opts...); err != nil {
 					exitOnError(err, jsonFormat)
 				}
 				if jsonFormat {
@@ -144,6 +265,9 @@ func encryptTextCommand() *cobra.Command {
 						resultMap["encryptedTextUrl"] = ctUrl
 					}
 					fmt.Println(toJsonString(resultMap))
+				} else if format == formatAge {
+					fmt.Print("Encrypted text:\n", color.GreenString(ctStr))
+					fmt.Println("This encrypted text can be decrypted with xipher, age or rage.")
 				} else {
 					fmt.Println("Encrypted text:", color.GreenString(ctStr))
 					if ctUrl != "" {
@@ -154,6 +278,7 @@ func encryptTextCommand() *cobra.Command {
 			},
 		}
 		encryptTxtCmd.Flags().StringP(textFlag.fields())
+		encryptTxtCmd.Flags().StringP(outputFormatFlag.fields())
 		encryptTxtCmd.Flags().BoolP(webAuthFlag.fields())
 		encryptTxtCmd.Flags().StringP(xipherURLFlag.fields())
 	}
@@ -163,21 +288,46 @@ func encryptTextCommand() *cobra.Command {
 func encryptFileCommand() *cobra.Command {
 	if encryptFileCmd == nil {
 		encryptFileCmd = &cobra.Command{
-			Use:     "file",
+			Use:     "file [path]...",
 			Aliases: []string{"f"},
-			Short:   "Encrypt a file",
+			Short:   "Encrypt a file, or a batch of files",
+			Long: `Encrypt the file given with --file. Several files, glob patterns and, with
+--recursive, directories can be given as arguments to encrypt them as a batch,
+in parallel, next to the originals or under --out-dir. With --in-place, each
+file is replaced by its encrypted copy, which is written atomically before the
+original is removed.`,
 			Run: func(cmd *cobra.Command, args []string) {
 				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
 				toXipherTxt, _ := cmd.Flags().GetBool(toXipherTxtFlag.name)
 				overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
-				srcPath := cmd.Flag(sourceFileFlag.name).Value.String()
+				format, err := getOutputFormat(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				opts, err := getEncryptOptions(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				paths, batch := getInputPaths(cmd, args)
+				if batch {
+					runEncryptBatch(cmd, paths, format, opts)
+					return
+				}
+				srcPath := paths[0]
 				src, err := os.Open(srcPath)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
+				if storeMetadata, _ := cmd.Flags().GetBool(fileMetadataFlag.name); storeMetadata {
+					stat, err := src.Stat()
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					opts = append(opts, xipher.WithFileInfo(xipher.NewFileInfo(stat)))
+				}
 				dstPath := cmd.Flag(outputFileFlag.name).Value.String()
 				if dstPath == "" {
-					dstPath = srcPath + xipherFileExt
+					dstPath = srcPath + encryptedFileExt(format)
 				}
 				for {
 					if _, err = os.Stat(dstPath); os.IsNotExist(err) {
@@ -197,14 +347,18 @@ func encryptFileCommand() *cobra.Command {
 						exitOnError(err, jsonFormat)
 					}
 				}
-				dst := utils.NewThresholdFileWriter(dstPath, fileWriteThreshold)
+				dst, err := utils.NewAtomicFileWriter(dstPath, outputFilePerm)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
 				keyPwdStr, err := getKeyPwdStr(cmd)
 				if err != nil {
 					dst.Discard()
 					exitOnError(err, jsonFormat)
 				}
 				compress, _ := cmd.Flags().GetBool(compressFlag.name)
-				if err = utils.EncryptStream(keyPwdStr, dst, src, compress, toXipherTxt); err != nil {
+				allowExpired, _ := cmd.Flags().GetBool(allowExpiredFlag.name)
+				if err = encryptStreamAs(format, keyPwdStr, dst, src, compress, toXipherTxt, allowExpired, opts); err != nil {
 					dst.Discard()
 					exitOnError(err, jsonFormat)
 				}
@@ -227,10 +381,16 @@ func encryptFileCommand() *cobra.Command {
 		}
 		encryptFileCmd.Flags().BoolP(overwriteFlag.fields())
 		encryptFileCmd.Flags().BoolP(toXipherTxtFlag.fields())
+		encryptFileCmd.Flags().StringP(outputFormatFlag.fields())
 		encryptFileCmd.Flags().StringP(sourceFileFlag.fields())
 		encryptFileCmd.Flags().StringP(outputFileFlag.fields())
 		encryptFileCmd.Flags().BoolP(compressFlag.fields())
-		encryptFileCmd.MarkFlagRequired(sourceFileFlag.name)
+		encryptFileCmd.Flags().BoolP(fileMetadataFlag.fields())
+		encryptFileCmd.Flags().BoolP(recursiveFlag.fields())
+		encryptFileCmd.Flags().StringP(outDirFlag.fields())
+		encryptFileCmd.Flags().IntP(workersFlag.fields())
+		encryptFileCmd.Flags().BoolP(inPlaceFlag.fields())
+		encryptFileCmd.Flags().BoolP(shredFlag.fields())
 		encryptFileCmd.Flags().BoolP(webAuthFlag.fields())
 		encryptFileCmd.Flags().StringP(xipherURLFlag.fields())
 	}
@@ -246,10 +406,17 @@ func encryptStreamCommand() *cobra.Command {
 			Run: func(cmd *cobra.Command, args []string) {
 				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
 				toXipherTxt, _ := cmd.Flags().GetBool(toXipherTxtFlag.name)
+				format, err := getOutputFormat(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				opts, err := getEncryptOptions(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
 				var keyPwdStr string
 				if webAuth, _ := cmd.Flags().GetBool(webAuthFlag.name); webAuth {
 					xipherURL, _ := cmd.Flags().GetString(xipherURLFlag.name)
-					var err error
 					if keyPwdStr, err = getSecretKeyFromWebAuth(xipherURL); err != nil {
 						exitOnError(err, jsonFormat)
 					}
@@ -267,18 +434,20 @@ func encryptStreamCommand() *cobra.Command {
 				// EncryptStream no longer fetches remote keys itself. The stream
 				// path is non-interactive, so this skips the confirmation prompts
 				// that getKeyPwdStr adds for the text/file commands.
-				keyPwdStr, err := utils.ResolveKeyForEncryption(keyPwdStr)
+				keyPwdStr, err = utils.ResolveKeyForEncryption(keyPwdStr)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
 				compress, _ := cmd.Flags().GetBool(compressFlag.name)
-				if err := utils.EncryptStream(keyPwdStr, os.Stdout, os.Stdin, compress, toXipherTxt); err != nil {
+				allowExpired, _ := cmd.Flags().GetBool(allowExpiredFlag.name)
+				if err := encryptStreamAs(format, keyPwdStr, os.Stdout, os.Stdin, compress, toXipherTxt, allowExpired, opts); err != nil {
 					exitOnError(err, jsonFormat)
 				}
 			},
 		}
 		encryptStreamCmd.Flags().BoolP(compressFlag.fields())
 		encryptStreamCmd.Flags().BoolP(toXipherTxtFlag.fields())
+		encryptStreamCmd.Flags().StringP(outputFormatFlag.fields())
 		encryptStreamCmd.Flags().BoolP(webAuthFlag.fields())
 		encryptStreamCmd.Flags().StringP(xipherURLFlag.fields())
 	}
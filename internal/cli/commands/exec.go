@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"xipher.org/xipher/internal/utils"
+)
+
+// exitCodeCommandNotFound is the exit code when the command to run cannot be started.
+const exitCodeCommandNotFound = 127
+
+func execCommand() *cobra.Command {
+	if execCmd == nil {
+		execCmd = &cobra.Command{
+			Use:   "exec --env-file <file> -- <command> [args]...",
+			Short: "Run a command with decrypted secrets in its environment",
+			Long: `Decrypt the dotenv files given with --env-file and run the command with their
+variables added to its environment. The files may be encrypted as a whole or
+have their values encrypted with 'encrypt values'. The plaintext is only held in
+memory and passed to the command; it runs in the foreground of the terminal, so
+Ctrl-C and Ctrl-Z reach it once, other signals xipher receives are forwarded to
+it, and its exit code is returned. ` + envar_XIPHER_SECRET + ` is removed from the environment of the command.`,
+			Args: cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				envFiles, _ := cmd.Flags().GetStringSlice(envFileFlag.name)
+				if len(envFiles) == 0 {
+					exitOnErrorWithMessage(fmt.Sprintf("set the secrets file using --%s", envFileFlag.name), jsonFormat)
+				}
+				secretKeyOrPwd, err := resolveSecretKey(cmd, true)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				var vars []string
+				for _, envFile := range envFiles {
+					data, err := os.ReadFile(envFile)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					fileVars, err := utils.DecryptDotenv(secretKeyOrPwd, data)
+					if err != nil {
+						exitOnError(fmt.Errorf("%s: %w", envFile, err), jsonFormat)
+					}
+					vars = append(vars, fileVars...)
+				}
+				os.Exit(runWithEnv(args, vars, jsonFormat))
+			},
+		}
+		execCmd.Flags().SetInterspersed(false)
+		execCmd.Flags().StringSliceP(envFileFlag.fields())
+		execCmd.Flags().StringP(decryptKeyFlag.fields())
+		execCmd.Flags().BoolP(webAuthFlag.fields())
+		execCmd.Flags().StringP(xipherURLFlag.fields())
+	}
+	return execCmd
+}
+
+// runWithEnv runs the command with vars added to the environment, forwarding
+// signals to it, and returns its exit code.
+func runWithEnv(args []string, vars []string, jsonFormat bool) int {
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = append(childEnviron(), vars...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	tty := prepareCommand(child)
+	if err := child.Start(); err != nil {
+		restoreTerminal(tty)
+		code, _ := errorCode(err)
+		exitWithError(err.Error(), code, exitCodeCommandNotFound, jsonFormat)
+	}
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+	exitCode, err := waitCommand(child, tty)
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	return exitCode
+}
+
+// childEnviron returns the environment of this process without the xipher secret.
+func childEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envar_XIPHER_SECRET+"=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
@@ -0,0 +1,37 @@
+//go:build !unix || aix
+
+package commands
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals are the signals passed on to commands run by exec. The
+// console sends Ctrl-C to every process attached to it, so on Windows, where
+// it cannot be forwarded, the command gets it from the console.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// prepareCommand returns the terminal the command is put in the foreground
+// of, which is none on this platform.
+func prepareCommand(*exec.Cmd) int {
+	return -1
+}
+
+// restoreTerminal does nothing: prepareCommand never takes the terminal.
+func restoreTerminal(int) {}
+
+// waitCommand waits for the command to finish and returns its exit code.
+func waitCommand(child *exec.Cmd, _ int) (int, error) {
+	if err := child.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, err
+		}
+	}
+	if code := child.ProcessState.ExitCode(); code >= 0 {
+		return code, nil
+	}
+	return exitCodeGeneric, nil
+}
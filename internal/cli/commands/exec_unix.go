@@ -0,0 +1,98 @@
+//go:build unix && !aix
+
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are the signals passed on to commands run by exec.
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// prepareCommand starts the command in a process group of its own, so that
+// the signals xipher forwards are the only ones it gets from xipher's group.
+// If xipher is in the foreground of its controlling terminal, the command is
+// put there in its place, so the terminal sends Ctrl-C, Ctrl-\ and Ctrl-Z to
+// the command alone. It returns the terminal, or -1 if there is none.
+func prepareCommand(child *exec.Cmd) int {
+	for fd, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		pgrp, err := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPGRP)
+		if err == nil && pgrp == processGroup() {
+			child.SysProcAttr = &syscall.SysProcAttr{Foreground: true, Ctty: fd}
+			return int(f.Fd())
+		}
+	}
+	child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return -1
+}
+
+// restoreTerminal puts the process group of xipher back in the foreground of
+// the terminal, if prepareCommand took it.
+func restoreTerminal(tty int) {
+	if tty >= 0 {
+		setForeground(tty, processGroup())
+	}
+}
+
+// processGroup returns the process group of xipher.
+func processGroup() int {
+	pgrp, _ := unix.Getpgid(0)
+	return pgrp
+}
+
+// setForeground puts the process group pgrp in the foreground of the terminal,
+// ignoring the SIGTTOU that stops a background process doing so.
+func setForeground(tty, pgrp int) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, pgrp)
+}
+
+// waitCommand waits for the command to finish and returns its exit code. In
+// the foreground of the terminal, a command stopped with Ctrl-Z stops xipher
+// too, giving the terminal back to the shell, and continues when xipher is
+// continued.
+func waitCommand(child *exec.Cmd, tty int) (int, error) {
+	options := 0
+	if tty >= 0 {
+		options = syscall.WUNTRACED
+		defer restoreTerminal(tty)
+	}
+	pid := child.Process.Pid
+	for {
+		var status syscall.WaitStatus
+		if _, err := syscall.Wait4(pid, &status, options, nil); err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if !status.Stopped() {
+			return exitCodeOf(status), nil
+		}
+		restoreTerminal(tty)
+		syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+		// Take the terminal back only if continued in the foreground (fg),
+		// not in the background (bg).
+		if pgrp, err := unix.IoctlGetInt(tty, unix.TIOCGPGRP); err == nil && pgrp == processGroup() {
+			setForeground(tty, pid)
+		}
+		syscall.Kill(-pid, syscall.SIGCONT)
+	}
+}
+
+// exitCodeOf returns the exit code of a finished command, following the shell
+// convention of 128 plus the signal number for commands killed by a signal.
+func exitCodeOf(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,28 @@
+//go:build unix && !aix
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunWithEnvForwardsSignals(t *testing.T) {
+	ready := filepath.Join(t.TempDir(), "ready")
+	script := `trap 'exit 42' INT; touch "$READY"; while :; do sleep 0.05; done`
+	go func() {
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(ready); err == nil {
+				// Like kill -INT from a supervisor: only xipher gets it.
+				syscall.Kill(os.Getpid(), syscall.SIGINT)
+				return
+			}
+		}
+	}()
+	if code := runWithEnv([]string{"sh", "-c", script}, []string{"READY=" + ready}, false); code != 42 {
+		t.Fatalf("exit code %d, want 42 from the INT trap of the command", code)
+	}
+}
@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/utils"
+)
+
+// gitFilterName is the name of the filter and diff driver in git config and .gitattributes.
+var gitFilterName = xipher.Info.AppNameLC
+
+func gitFilterCommand() *cobra.Command {
+	if gitFilterCmd == nil {
+		gitFilterCmd = &cobra.Command{
+			Use:   "git-filter",
+			Short: "Git clean/smudge filter and diff driver, see 'git init-filter'",
+			Long: `Filters run by git to keep files encrypted in the repository and decrypted in
+the working tree. They read the secret key from the ` + envar_XIPHER_SECRET + ` environment
+variable and are set up with '` + xipher.Info.AppNameLC + ` git init-filter'.`,
+			Run: func(cmd *cobra.Command, args []string) {
+				cmd.Help()
+			},
+		}
+		gitFilterCmd.AddCommand(gitFilterCleanCommand())
+		gitFilterCmd.AddCommand(gitFilterSmudgeCommand())
+		gitFilterCmd.AddCommand(gitFilterTextconvCommand())
+	}
+	return gitFilterCmd
+}
+
+func gitFilterCleanCommand() *cobra.Command {
+	if gitFilterCleanCmd == nil {
+		gitFilterCleanCmd = &cobra.Command{
+			Use:   "clean [path]",
+			Short: "Encrypt a file from stdin deterministically as git stages it",
+			Args:  cobra.MaximumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				secretKeyOrPwd, _ := getSecretKeyOrPwd(false)
+				if secretKeyOrPwd == "" {
+					exitOnErrorWithMessage(fmt.Sprintf("set the secret key in the %s environment variable to stage encrypted files", envar_XIPHER_SECRET), jsonFormat)
+				}
+				var path string
+				if len(args) > 0 {
+					path = filepath.ToSlash(args[0])
+				}
+				dst := bufio.NewWriter(os.Stdout)
+				err := utils.GitClean(secretKeyOrPwd, path, dst, os.Stdin)
+				if errors.Is(err, xipher.ErrDeterministicUnsupported) {
+					err = fmt.Errorf("%w: use a secret key (XSK_...) rather than a password", err)
+				}
+				if err == nil {
+					err = dst.Flush()
+				}
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+			},
+		}
+	}
+	return gitFilterCleanCmd
+}
+
+func gitFilterSmudgeCommand() *cobra.Command {
+	if gitFilterSmudgeCmd == nil {
+		gitFilterSmudgeCmd = &cobra.Command{
+			Use:   "smudge [path]",
+			Short: "Decrypt a file from stdin as git checks it out",
+			Long: `Decrypt a file from stdin as git checks it out. Without a secret key the file
+is checked out encrypted, so clones without the key still work.`,
+			Args: cobra.MaximumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				runGitSmudge(cmd, os.Stdin)
+			},
+		}
+	}
+	return gitFilterSmudgeCmd
+}
+
+func gitFilterTextconvCommand() *cobra.Command {
+	if gitFilterTextconvCmd == nil {
+		gitFilterTextconvCmd = &cobra.Command{
+			Use:   "textconv <file>",
+			Short: "Print the decrypted contents of a file for git diff",
+			Args:  cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				src, err := os.Open(args[0])
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				defer src.Close()
+				runGitSmudge(cmd, src)
+			},
+		}
+	}
+	return gitFilterTextconvCmd
+}
+
+// runGitSmudge decrypts src to stdout, or copies it unchanged if no secret key is set.
+func runGitSmudge(cmd *cobra.Command, src *os.File) {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	secretKeyOrPwd, _ := getSecretKeyOrPwd(false)
+	dst := bufio.NewWriter(os.Stdout)
+	var err error
+	if secretKeyOrPwd == "" {
+		_, err = dst.ReadFrom(src)
+	} else {
+		err = utils.GitSmudge(secretKeyOrPwd, dst, src)
+	}
+	if err == nil {
+		err = dst.Flush()
+	}
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+}
+
+func gitCommand() *cobra.Command {
+	if gitCmd == nil {
+		gitCmd = &cobra.Command{
+			Use:   "git",
+			Short: "Keep encrypted files in git repositories",
+			Run: func(cmd *cobra.Command, args []string) {
+				cmd.Help()
+			},
+		}
+		gitCmd.AddCommand(gitInitFilterCommand())
+	}
+	return gitCmd
+}
+
+func gitInitFilterCommand() *cobra.Command {
+	if gitInitFilterCmd == nil {
+		gitInitFilterCmd = &cobra.Command{
+			Use:   "init-filter [pattern]...",
+			Short: "Configure the git filter and diff driver in the current repository",
+			Long: `Configure the ` + gitFilterName + ` clean/smudge filter and diff driver in the git config of the
+current repository and add the given patterns to its .gitattributes, so that
+matching files are encrypted in the repository and decrypted in the working
+tree. Every clone needs this command run once, with the secret key in the
+` + envar_XIPHER_SECRET + ` environment variable when filters run.`,
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				root, err := gitOutput("rev-parse", "--show-toplevel")
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				app := xipher.Info.AppNameLC
+				config := [][2]string{
+					{"filter." + gitFilterName + ".clean", app + " git-filter clean %f"},
+					{"filter." + gitFilterName + ".smudge", app + " git-filter smudge %f"},
+					{"filter." + gitFilterName + ".required", "true"},
+					{"diff." + gitFilterName + ".textconv", app + " git-filter textconv"},
+					{"diff." + gitFilterName + ".binary", "true"},
+				}
+				for _, kv := range config {
+					if _, err := gitOutput("config", "--local", kv[0], kv[1]); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				}
+				attributesPath := filepath.Join(root, ".gitattributes")
+				added, err := addGitAttributes(attributesPath, args)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					if added == nil {
+						added = []string{}
+					}
+					fmt.Println(toJsonString(map[string]interface{}{
+						"filter":         gitFilterName,
+						"gitattributes":  attributesPath,
+						"addedPatterns":  added,
+						"configuredKeys": len(config),
+					}))
+					return
+				}
+				fmt.Println("Configured git filter and diff driver:", color.GreenString(gitFilterName))
+				for _, line := range added {
+					fmt.Println("Added to .gitattributes:", color.GreenString(line))
+				}
+				fmt.Printf("Set %s to a secret key (XSK_...) so git can encrypt and decrypt files.\n", envar_XIPHER_SECRET)
+			},
+		}
+	}
+	return gitInitFilterCmd
+}
+
+// gitOutput runs git with args and returns its trimmed output.
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// addGitAttributes adds a line assigning the filter and diff driver for each
+// pattern to the .gitattributes file at path, skipping lines already present,
+// and returns the lines added.
+func addGitAttributes(path string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		present[strings.Join(strings.Fields(line), " ")] = true
+	}
+	var added []string
+	for _, pattern := range patterns {
+		line := fmt.Sprintf("%s filter=%s diff=%s", pattern, gitFilterName, gitFilterName)
+		if !present[line] {
+			present[line] = true
+			added = append(added, line)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += strings.Join(added, "\n") + "\n"
+	return added, os.WriteFile(path, []byte(content), 0o644)
+}
@@ -83,7 +83,7 @@ func getPasswordOrSecretKeyFromUser(confirm, ignorePolicyCheck bool) ([]byte, er
 	if err != nil {
 		return nil, err
 	}
-	if xipher.IsSecretKeyStr(string(passwordOrSecretKey)) {
+	if xipher.IsSecretKeyStr(string(passwordOrSecretKey)) || xipher.IsAgeIdentityStr(string(passwordOrSecretKey)) {
 		return passwordOrSecretKey, nil
 	}
 	if !ignorePolicyCheck {
@@ -22,9 +22,19 @@ func keygenCommand() *cobra.Command {
 				publicKeyFilePath := cmd.Flag(publicKeyFileFlag.name).Value.String()
 				ignoreFlag, _ := cmd.Flags().GetBool(ignorePasswordCheckFlag.name)
 				autoGen, _ := cmd.Flags().GetBool(autoGenerateSecretKey.name)
-				quantumSafe, _ := cmd.Flags().GetBool(quantumSafeFlag.name)
+				suite, err := getSuite(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				meta, err := getKeyMetadata(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				showAge, _ := cmd.Flags().GetBool(ageKeysFlag.name)
+				if showAge && suite != xipher.SuiteECC {
+					exitOnErrorWithMessage(fmt.Sprintf("--%s requires the %s suite", ageKeysFlag.name, xipher.SuiteECC), jsonFormat)
+				}
 				var secret string
-				var err error
 				if autoGen {
 					var sk *xipher.SecretKey
 					if sk, err = xipher.NewSecretKey(); err != nil {
@@ -46,7 +56,7 @@ func keygenCommand() *cobra.Command {
 					}
 					secret = string(password)
 				}
-				pubKeyStr, pubKeyUrl, err := utils.GetPublicKey(secret, quantumSafe)
+				pubKeyStr, pubKeyUrl, err := utils.GetPublicKeyWithMetadata(secret, suite, meta)
 				if err != nil {
 					exitOnError(err, jsonFormat)
 				}
@@ -69,6 +79,31 @@ func keygenCommand() *cobra.Command {
 						fmt.Println("Public Key:", color.GreenString(pubKeyStr))
 					}
 				}
+				if jsonFormat {
+					resultMap["suite"] = suite.String()
+				} else {
+					fmt.Println("Suite:", color.HiBlackString(suite.String()))
+				}
+				if jsonFormat {
+					if metaMap := keyMetadataMap(&meta); len(metaMap) > 0 {
+						resultMap["metadata"] = metaMap
+					}
+				} else {
+					printKeyMetadata(&meta)
+				}
+				if showAge {
+					identity, recipient, err := utils.GetAgeKeys(secret)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					if jsonFormat {
+						resultMap["ageIdentity"] = identity
+						resultMap["ageRecipient"] = recipient
+					} else {
+						fmt.Println("age Identity:", color.HiBlackString(identity))
+						fmt.Println("age Recipient:", color.GreenString(recipient))
+					}
+				}
 				if pubKeyUrl != "" {
 					if jsonFormat {
 						resultMap["publicKeyUrl"] = pubKeyUrl
@@ -87,6 +122,32 @@ func keygenCommand() *cobra.Command {
 		keygenCmd.Flags().StringP(publicKeyFileFlag.fields())
 		keygenCmd.Flags().BoolP(autoGenerateSecretKey.fields())
 		keygenCmd.Flags().BoolP(quantumSafeFlag.fields())
+		keygenCmd.Flags().StringP(suiteFlag.fields())
+		keygenCmd.Flags().StringP(expiresFlag.fields())
+		keygenCmd.Flags().StringP(labelFlag.fields())
+		keygenCmd.Flags().StringP(usageFlag.fields())
+		keygenCmd.Flags().BoolP(ageKeysFlag.fields())
 	}
 	return keygenCmd
 }
+
+// getSuite returns the suite selected by --suite, or by the older --quantum-safe
+// flag, which is shorthand for the hybrid suite.
+func getSuite(cmd *cobra.Command) (xipher.Suite, error) {
+	quantumSafe, _ := cmd.Flags().GetBool(quantumSafeFlag.name)
+	suiteName, _ := cmd.Flags().GetString(suiteFlag.name)
+	if suiteName == "" {
+		if quantumSafe {
+			return xipher.SuiteHybrid, nil
+		}
+		return xipher.SuiteECC, nil
+	}
+	suite, err := xipher.ParseSuite(suiteName)
+	if err != nil {
+		return 0, err
+	}
+	if quantumSafe && !suite.IsQuantumSafe() {
+		return 0, fmt.Errorf("--%s conflicts with --%s %s", quantumSafeFlag.name, suiteFlag.name, suiteName)
+	}
+	return suite, nil
+}
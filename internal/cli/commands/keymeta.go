@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher"
+	"xipher.org/xipher/resolve"
+)
+
+// getKeyMetadata returns the public key metadata selected by --label, --usage and --expires.
+func getKeyMetadata(cmd *cobra.Command) (xipher.KeyMetadata, error) {
+	label, _ := cmd.Flags().GetString(labelFlag.name)
+	usage, _ := cmd.Flags().GetString(usageFlag.name)
+	expires, _ := cmd.Flags().GetString(expiresFlag.name)
+	meta := xipher.KeyMetadata{
+		Label: strings.TrimSpace(label),
+		Usage: strings.TrimSpace(usage),
+	}
+	if meta.Label == "" && meta.Usage == "" && expires == "" {
+		return meta, nil
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	meta.Created = now
+	if expires != "" {
+		notAfter, err := parseExpiry(expires, now)
+		if err != nil {
+			return meta, err
+		}
+		if !notAfter.After(now) {
+			return meta, fmt.Errorf("--%s must be in the future", expiresFlag.name)
+		}
+		meta.NotAfter = notAfter
+	}
+	return meta, nil
+}
+
+// parseExpiry parses an expiry given as a duration from now (90d, 12w, 1y or
+// any Go duration such as 720h) or as an absolute date or RFC 3339 time.
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 1 {
+		if n, err := strconv.Atoi(value[:len(value)-1]); err == nil && n > 0 {
+			switch value[len(value)-1] {
+			case 'd':
+				return now.AddDate(0, 0, n), nil
+			case 'w':
+				return now.AddDate(0, 0, 7*n), nil
+			case 'y':
+				return now.AddDate(n, 0, 0), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q: use a duration such as 90d, 12w, 1y or 720h, or a date such as 2026-12-31", value)
+}
+
+// keyMetadataMap returns the metadata fields that are set, for JSON output.
+func keyMetadataMap(meta *xipher.KeyMetadata) map[string]interface{} {
+	metaMap := make(map[string]interface{})
+	if meta == nil {
+		return metaMap
+	}
+	if meta.Label != "" {
+		metaMap["label"] = meta.Label
+	}
+	if meta.Usage != "" {
+		metaMap["usage"] = meta.Usage
+	}
+	if !meta.Created.IsZero() {
+		metaMap["created"] = meta.Created.Format(time.RFC3339)
+	}
+	if !meta.NotAfter.IsZero() {
+		metaMap["notAfter"] = meta.NotAfter.Format(time.RFC3339)
+		metaMap["expired"] = meta.IsExpired(time.Now())
+	}
+	return metaMap
+}
+
+// printKeyMetadata prints the metadata fields that are set.
+func printKeyMetadata(meta *xipher.KeyMetadata) {
+	if meta == nil {
+		return
+	}
+	if meta.Label != "" {
+		fmt.Println("Label:", color.HiCyanString(meta.Label))
+	}
+	if meta.Usage != "" {
+		fmt.Println("Usage:", color.HiBlackString(meta.Usage))
+	}
+	if !meta.Created.IsZero() {
+		fmt.Println("Created:", color.HiBlackString(meta.Created.Local().Format(time.RFC3339)))
+	}
+	if !meta.NotAfter.IsZero() {
+		expires := meta.NotAfter.Local().Format(time.RFC3339)
+		if meta.IsExpired(time.Now()) {
+			fmt.Println("Expires:", color.RedString(expires+" (expired)"))
+		} else {
+			fmt.Println("Expires:", color.YellowString(expires))
+		}
+	}
+}
+
+// printRecipientKeyMetadata prints the metadata of keyStr if it is a public key that carries any.
+func printRecipientKeyMetadata(keyStr string) {
+	if !xipher.IsPubKeyStr(keyStr) {
+		return
+	}
+	pubKey, err := xipher.ParsePublicKeyStr(keyStr)
+	if err != nil {
+		return
+	}
+	printKeyMetadata(pubKey.Metadata())
+}
+
+// printResolvedKey prints the key selected from a published key document, with
+// its signer and expiry, followed by the metadata of the key.
+func printResolvedKey(resolved *resolve.Key) {
+	if resolved.Name != "" {
+		fmt.Println("Resolved recipient:", color.HiCyanString(resolved.Name))
+	}
+	fmt.Println("Selected:", color.HiBlackString(resolved.Selection()+" "+resolved.Fingerprint))
+	if resolved.Signed() {
+		signer := resolved.SignerFingerprint
+		if resolved.SignerAlias != "" {
+			signer = fmt.Sprintf("@%s (%s)", resolved.SignerAlias, resolved.SignerFingerprint)
+		}
+		fmt.Println("Signed by:", color.GreenString(signer))
+	}
+	if !resolved.Expires.IsZero() {
+		fmt.Println("Document expires:", color.YellowString(resolved.Expires.Local().Format(time.RFC3339)))
+	}
+	printRecipientKeyMetadata(resolved.PublicKey)
+}
@@ -0,0 +1,407 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/utils"
+	"xipher.org/xipher/resolve"
+)
+
+func keysCommand() *cobra.Command {
+	if keysCmd == nil {
+		keysCmd = &cobra.Command{
+			Use:     "keys",
+			Aliases: []string{"keyring"},
+			Short:   "Manage the local keyring of public keys and your own secret keys",
+			Long: `The keyring stores contacts' public keys and your own secret keys under
+aliases, in xipher/keyring.json in the user config directory or the file named by
+the ` + utils.KeyringEnv + ` environment variable. Secret keys are stored encrypted with
+a passphrase, taken from the ` + envar_XIPHER_KEYRING_PASSPHRASE + ` environment variable
+or asked for.
+
+Use --key @alias to encrypt to a key in the keyring, or to decrypt with one of
+your own. Encrypting to an @alias that is not in the keyring fails rather than
+using it as a password; decrypting with one uses it as a password.
+Without a secret key or password, decrypt tries every secret key the keyring
+passphrase unlocks, and asks for a secret key or password if none of them
+decrypts.
+
+Public keys resolved from a URL, domain or email address are pinned the first
+time they are seen, in xipher/known_recipients.json or the file named by the
+` + resolve.KnownRecipientsEnv + ` environment variable. Encryption fails if the key
+served later has a different fingerprint, until it is accepted with keys trust.
+A signed published key document pins its signing key too: later documents must
+be signed by it, or by an ssh-ed25519 signing key added to the keyring with
+--signs for the URL or its domain, and may then rotate to a new key.
+
+Public keys are fetched with the system roots and the proxy of HTTPS_PROXY,
+unless the resolver section of xipher/config.json in the user config directory,
+or the file named by the ` + utils.ConfigEnv + ` environment variable, or the --ca-file,
+--proxy, --client-cert, --client-key, --fetch-timeout and --max-redirects flags
+of keys and encrypt configure otherwise, e.g.
+  {"resolver": {"caFiles": ["corp-ca.pem"], "proxy": "http://proxy.corp:3128"}}`,
+			PersistentPreRun: func(cmd *cobra.Command, args []string) {
+				if err := configureKeyFetch(cmd); err != nil {
+					jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+					exitOnError(err, jsonFormat)
+				}
+			},
+			Run: func(cmd *cobra.Command, args []string) {
+				cmd.Help()
+			},
+		}
+		addKeyFetchFlags(keysCmd)
+		keysCmd.AddCommand(keysAddCommand())
+		keysCmd.AddCommand(keysListCommand())
+		keysCmd.AddCommand(keysRmCommand())
+		keysCmd.AddCommand(keysTrustCommand())
+		keysCmd.AddCommand(keysUntrustCommand())
+	}
+	return keysCmd
+}
+
+func keysAddCommand() *cobra.Command {
+	if keysAddCmd == nil {
+		keysAddCmd = &cobra.Command{
+			Use:   "add <alias> [key]",
+			Short: "Add a public key, or one of your secret keys, to the keyring",
+			Long: `Add the key under the alias. A public key may be an XPK_ public key, an
+ssh-ed25519 key, an age recipient, github:<user> or an https:// URL serving a
+public key. XSK_ secret keys and AGE-SECRET-KEY identities are stored encrypted
+with the keyring passphrase, along with their public key for --suite. With
+--auto, a new secret key is generated. Without a key, it is asked for.
+
+With --signs, an ssh-ed25519 key is trusted to sign the published key documents
+of the given key URLs and domains, and so to rotate the keys pinned for them; a
+domain covers its subdomains and the email addresses at it.`,
+			Args: cobra.RangeArgs(1, 2),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				autoGen, _ := cmd.Flags().GetBool(autoGenerateSecretKey.name)
+				ignoreFlag, _ := cmd.Flags().GetBool(ignorePasswordCheckFlag.name)
+				signs, _ := cmd.Flags().GetStringSlice(signsFlag.name)
+				suite, err := getSuite(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				keyring, err := utils.LoadKeyring()
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				var key string
+				switch {
+				case len(args) == 2:
+					key = args[1]
+				case autoGen:
+					sk, err := xipher.NewSecretKey()
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					if key, err = sk.String(); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				default:
+					input, err := getHiddenInputFromUser("Enter a public key or secret key: ")
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					key = string(input)
+				}
+				var entry *utils.KeyringEntry
+				if xipher.IsSecretKeyStr(key) || xipher.IsAgeIdentityStr(key) {
+					passphrase, err := getKeyringPassphrase(true, true, ignoreFlag)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					entry, err = keyring.AddSecretKey(args[0], key, passphrase, suite)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				} else {
+					pubKeyStr, isKey, _, err := utils.GetSanitisedKeyOrPwd(key)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					if !isKey {
+						exitOnErrorWithMessage("not a public key or secret key; passwords cannot be added to the keyring", jsonFormat)
+					}
+					if entry, err = keyring.AddPublicKey(args[0], pubKeyStr); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				}
+				if len(signs) > 0 {
+					if err = entry.TrustAsSigner(signs...); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				}
+				if err = keyring.Save(); err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(keyringEntryMap(entry)))
+					return
+				}
+				fmt.Println("Added:", color.HiCyanString(entry.Alias))
+				fmt.Println("Fingerprint:", color.GreenString(entry.Fingerprint))
+				fmt.Println("Public Key:", color.HiBlackString(entry.PublicKey))
+				if entry.Owned() {
+					fmt.Println("The secret key is stored encrypted with the keyring passphrase.")
+				}
+				if len(entry.Signs) > 0 {
+					fmt.Println("Trusted to sign for:", strings.Join(entry.Signs, ", "))
+				}
+			},
+		}
+		keysAddCmd.Flags().BoolP(autoGenerateSecretKey.fields())
+		keysAddCmd.Flags().BoolP(quantumSafeFlag.fields())
+		keysAddCmd.Flags().StringP(suiteFlag.fields())
+		keysAddCmd.Flags().BoolP(ignorePasswordCheckFlag.fields())
+		keysAddCmd.Flags().StringSliceP(signsFlag.fields())
+	}
+	return keysAddCmd
+}
+
+func keysListCommand() *cobra.Command {
+	if keysListCmd == nil {
+		keysListCmd = &cobra.Command{
+			Use:     "list",
+			Aliases: []string{"ls"},
+			Short:   "List the keys in the keyring",
+			Args:    cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				keyring, err := utils.LoadKeyring()
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				known, err := resolve.LoadKnownRecipients("")
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					keys := make([]map[string]interface{}, 0, len(keyring.Keys))
+					for i := range keyring.Keys {
+						keys = append(keys, keyringEntryMap(&keyring.Keys[i]))
+					}
+					fmt.Println(toJsonString(map[string]interface{}{
+						"keyring": keyring.Path(),
+						"keys":    keys,
+						"pinned":  known.Recipients,
+					}))
+					return
+				}
+				if len(keyring.Keys) == 0 {
+					fmt.Println("The keyring is empty:", color.HiBlackString(keyring.Path()))
+				} else {
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					for i := range keyring.Keys {
+						entry := &keyring.Keys[i]
+						owned := ""
+						if entry.Owned() {
+							owned = "secret key"
+						}
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "@"+entry.Alias, entry.Fingerprint, keyringEntrySuite(entry), owned)
+					}
+					w.Flush()
+				}
+				if len(known.Recipients) > 0 {
+					fmt.Println()
+					fmt.Println("Pinned public keys:")
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					for _, pin := range known.Recipients {
+						signer := ""
+						if pin.SignerFingerprint != "" {
+							signer = "signed by " + pin.SignerFingerprint
+						}
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pin.URL, pin.Fingerprint, pin.FirstSeen.Format(time.DateOnly), signer)
+					}
+					w.Flush()
+				}
+			},
+		}
+	}
+	return keysListCmd
+}
+
+func keysRmCommand() *cobra.Command {
+	if keysRmCmd == nil {
+		keysRmCmd = &cobra.Command{
+			Use:     "rm <alias>...",
+			Aliases: []string{"remove"},
+			Short:   "Remove keys from the keyring",
+			Args:    cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				force, _ := cmd.Flags().GetBool(forceRemoveFlag.name)
+				keyring, err := utils.LoadKeyring()
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				removed := make([]string, 0, len(args))
+				for _, alias := range args {
+					entry, err := keyring.Get(alias)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					if entry.Owned() && !force {
+						if jsonFormat {
+							exitOnErrorWithMessage(fmt.Sprintf("%s holds a secret key: use --%s to remove it", entry.Alias, forceRemoveFlag.name), jsonFormat)
+						}
+						if !confirmInput(fmt.Sprintf("%s holds a secret key that cannot be recovered once removed. Remove it?", entry.Alias)) {
+							exitOnErrorWithMessage("aborted", jsonFormat)
+						}
+					}
+					alias = entry.Alias
+					if err = keyring.Remove(alias); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					removed = append(removed, alias)
+				}
+				if err = keyring.Save(); err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(map[string]interface{}{"removed": removed}))
+					return
+				}
+				for _, alias := range removed {
+					fmt.Println("Removed:", color.YellowString(alias))
+				}
+			},
+		}
+		keysRmCmd.Flags().BoolP(forceRemoveFlag.fields())
+	}
+	return keysRmCmd
+}
+
+func keysTrustCommand() *cobra.Command {
+	if keysTrustCmd == nil {
+		keysTrustCmd = &cobra.Command{
+			Use:   "trust <url>...",
+			Short: "Pin the public key a URL, domain or email address serves now, replacing an earlier pin",
+			Long: `Fetch the public key served at each URL or domain, or discovered for each
+email address, and pin it, along with the key its document is signed with,
+replacing any key pinned earlier. Confirm the fingerprint shown with the
+recipient over another channel before encrypting to a key that has changed.`,
+			Args: cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				pins := make([]*resolve.KnownRecipient, 0, len(args))
+				for _, keyURL := range args {
+					pin, err := utils.KeyResolver().Trust(keyURL)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					pins = append(pins, pin)
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(map[string]interface{}{"pinned": pins}))
+					return
+				}
+				for _, pin := range pins {
+					fmt.Println("Pinned:", color.HiCyanString(pin.URL))
+					fmt.Println("Fingerprint:", color.GreenString(pin.Fingerprint))
+					if pin.SignerFingerprint != "" {
+						fmt.Println("Signed by:", color.GreenString(pin.SignerFingerprint))
+					}
+				}
+			},
+		}
+	}
+	return keysTrustCmd
+}
+
+func keysUntrustCommand() *cobra.Command {
+	if keysUntrustCmd == nil {
+		keysUntrustCmd = &cobra.Command{
+			Use:   "untrust <url>...",
+			Short: "Remove the pinned public key of a URL, domain or email address",
+			Long: `Remove the pin of each URL, domain or email address. The key it serves
+next is pinned again on first use.`,
+			Args: cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				for _, keyURL := range args {
+					if err := utils.KeyResolver().Untrust(keyURL); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(map[string]interface{}{"unpinned": args}))
+					return
+				}
+				for _, keyURL := range args {
+					fmt.Println("Unpinned:", color.YellowString(keyURL))
+				}
+			},
+		}
+	}
+	return keysUntrustCmd
+}
+
+// keyringEntryMap returns the JSON representation of a keyring entry, without
+// its encrypted secret key.
+func keyringEntryMap(entry *utils.KeyringEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"alias":       entry.Alias,
+		"fingerprint": entry.Fingerprint,
+		"publicKey":   entry.PublicKey,
+		"suite":       keyringEntrySuite(entry),
+		"owned":       entry.Owned(),
+		"signs":       entry.Signs,
+		"added":       entry.Added,
+	}
+}
+
+// keyringEntrySuite returns the suite name of the public key of a keyring entry.
+func keyringEntrySuite(entry *utils.KeyringEntry) string {
+	suite, err := entry.Suite()
+	if err != nil {
+		return "invalid"
+	}
+	return suite.String()
+}
+
+// getKeyringPassphrase returns the passphrase of the secret keys in the
+// keyring, from the XIPHER_KEYRING_PASSPHRASE environment variable or, if
+// interactive, asked for. A new passphrase is confirmed and, unless
+// ignorePolicyCheck is set, checked against the password policy.
+func getKeyringPassphrase(interactive, isNew, ignorePolicyCheck bool) (string, error) {
+	if keyringPassphrase != nil {
+		return *keyringPassphrase, nil
+	}
+	passphrase := os.Getenv(envar_XIPHER_KEYRING_PASSPHRASE)
+	if passphrase == "" {
+		if !interactive {
+			return "", fmt.Errorf("the keyring passphrase is required: set it in the %s environment variable", envar_XIPHER_KEYRING_PASSPHRASE)
+		}
+		input, err := getHiddenInputFromUser("Enter the keyring passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		passphrase = string(input)
+		if isNew {
+			confirm, err := getHiddenInputFromUser("Confirm the keyring passphrase: ")
+			if err != nil {
+				return "", err
+			}
+			if string(confirm) != passphrase {
+				return "", fmt.Errorf("passphrases do not match")
+			}
+		}
+	}
+	if isNew && !ignorePolicyCheck {
+		if err := pwdCheck(passphrase); err != nil {
+			return "", err
+		}
+	}
+	keyringPassphrase = &passphrase
+	return passphrase, nil
+}
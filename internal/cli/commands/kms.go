@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"xipher.org/xipher/internal/kms"
 )
@@ -28,10 +29,122 @@ func kmsCommand() *cobra.Command {
 			},
 		}
 		kmsCmd.Flags().StringP(kmsConfigFlag.fields())
+		kmsCmd.AddCommand(kmsSealCommand())
 	}
 	return kmsCmd
 }
 
+func kmsSealCommand() *cobra.Command {
+	if kmsSealCmd == nil {
+		kmsSealCmd = &cobra.Command{
+			Use:   "seal <seed-file>...",
+			Short: "Seal XKMS master seed files",
+			Long: `Seal plaintext master seed files with xipher, so the sealed files can stay on
+disk and the seeds are unsealed at every start with the unseal section of the
+XKMS configuration. The seed files are left in place; delete them once the
+sealed files are deployed. Each seed file is sealed to <seed-file>.sealed, or
+to --out when a single one is given. Seal the seed files of all the epochs in
+seeds.epochs together, as they are unsealed with the same key.
+
+The seeds are sealed under the public key, secret key or password given with
+--key or prompted for, and unsealed with the secret key or the password from an
+env var, a file or stdin. With --shares and --threshold, they are instead
+sealed under a random unseal key split into Shamir shares, one for each
+operator listed in unseal.shamir.operators, who unseal the seeds by submitting
+their shares to POST /api/v1/unseal. The unseal key itself is not kept.`,
+			Args: cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				keyOrPwd := cmd.Flag(kmsSealKeyFlag.name).Value.String()
+				shares, _ := cmd.Flags().GetInt(kmsSharesFlag.name)
+				threshold, _ := cmd.Flags().GetInt(kmsThresholdFlag.name)
+				overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
+				outPath := cmd.Flag(outputFileFlag.name).Value.String()
+				if outPath != "" && len(args) > 1 {
+					exitOnErrorWithMessage(fmt.Sprintf("--%s takes a single seed file", outputFileFlag.name), jsonFormat)
+				}
+
+				var unsealShares []string
+				switch {
+				case shares > 0 || threshold > 0:
+					if keyOrPwd != "" {
+						exitOnErrorWithMessage(fmt.Sprintf("--%s cannot be used with --%s", kmsSealKeyFlag.name, kmsSharesFlag.name), jsonFormat)
+					}
+					var err error
+					if keyOrPwd, unsealShares, err = kms.SplitUnsealKey(shares, threshold); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				case keyOrPwd == "":
+					input, err := getPasswordOrSecretKeyFromUser(true, false)
+					if err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					keyOrPwd = string(input)
+				}
+
+				// Seal every seed before writing any, so a bad seed file leaves
+				// no sealed files under a key whose shares were never shown.
+				sealed := make([]string, len(args))
+				dstPaths := make([]string, len(args))
+				for i, seedPath := range args {
+					var err error
+					if sealed[i], err = kms.SealSeed(seedPath, keyOrPwd); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+					dstPaths[i] = seedPath + ".sealed"
+				}
+				if outPath != "" {
+					dstPaths[0] = outPath
+				}
+				for i, dstPath := range dstPaths {
+					if err := writeSealedSeed(dstPath, sealed[i], overwrite); err != nil {
+						exitOnError(err, jsonFormat)
+					}
+				}
+
+				if jsonFormat {
+					out := map[string]interface{}{"sealed": dstPaths}
+					if unsealShares != nil {
+						out["threshold"] = threshold
+						out["shares"] = unsealShares
+					}
+					fmt.Println(toJsonString(out))
+					return
+				}
+				for _, dstPath := range dstPaths {
+					fmt.Println("Sealed seed written to", color.GreenString(dstPath))
+				}
+				if unsealShares != nil {
+					fmt.Printf("Give each operator one share; any %d of them unseal the seeds:\n", threshold)
+					for _, share := range unsealShares {
+						fmt.Println(color.HiBlackString(share))
+					}
+				}
+			},
+		}
+		kmsSealCmd.Flags().StringP(kmsSealKeyFlag.fields())
+		kmsSealCmd.Flags().IntP(kmsSharesFlag.fields())
+		kmsSealCmd.Flags().IntP(kmsThresholdFlag.fields())
+		kmsSealCmd.Flags().StringP(outputFileFlag.fields())
+		kmsSealCmd.Flags().BoolP(overwriteFlag.fields())
+		kmsSealCmd.Flags().BoolP(jsonFlag.fields())
+	}
+	return kmsSealCmd
+}
+
+// writeSealedSeed writes a sealed seed to dstPath, readable only by its owner.
+func writeSealedSeed(dstPath, sealed string, overwrite bool) error {
+	dst, err := createOutputFile(dstPath, overwrite, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintln(dst, sealed); err != nil {
+		dst.Discard()
+		return err
+	}
+	return dst.Close()
+}
+
 func runKMS(configPath string) error {
 	cfg, err := kms.LoadConfig(configPath)
 	if err != nil {
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/utils"
+	"xipher.org/xipher/resolve"
+)
+
+func serveKeyCommand() *cobra.Command {
+	if serveKeyCmd == nil {
+		serveKeyCmd = &cobra.Command{
+			Use:   "serve-key [path=]<key>...",
+			Short: "Publish public keys over HTTP(S) for others to fetch",
+			Long: `Serve public keys as published key documents, where encrypt --key fetches
+them from. Each key is an XPK_ public key, an @alias from the keyring or the path
+of a ` + xipherPubKeyFileExt + ` file. A key given without a path is the key of the host, served at
+/.well-known/xipher for example.com. A key given as alice=<key> is served at
+/alice and /alice/.well-known/xipher for example.com/alice, and at the paths
+looked up for alice@example.com.
+
+Keys are served with CORS headers, so any web page may read them, and cache
+headers. Serve them over HTTPS with --tls-cert and --tls-key, or behind a
+reverse proxy terminating TLS: keys are only ever fetched from https:// URLs.`,
+			Example: `  xipher serve-key @me --name "Alice" --tls-cert cert.pem --tls-key key.pem
+  xipher serve-key alice=@alice bob=bob.xpk --addr :8080`,
+			Args: cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				name, _ := cmd.Flags().GetString(serveNameFlag.name)
+				keys, err := getServedKeys(args, name)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				server, err := resolve.NewKeyServer(keys...)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				addr, _ := cmd.Flags().GetString(serveAddrFlag.name)
+				certFile, _ := cmd.Flags().GetString(tlsCertFlag.name)
+				keyFile, _ := cmd.Flags().GetString(tlsKeyFlag.name)
+				if (certFile == "") != (keyFile == "") {
+					exitOnError(fmt.Errorf("--%s and --%s must be given together", tlsCertFlag.name, tlsKeyFlag.name), jsonFormat)
+				}
+				for _, key := range keys {
+					// NewKeyServer has checked the keys parse.
+					pubKey, _ := xipher.ParsePublicKeyStr(key.PublicKey)
+					fingerprint, _ := pubKey.Fingerprint()
+					fmt.Fprintf(os.Stderr, "Serving %s at %s\n", color.HiCyanString(fingerprint), strings.Join(key.ServedPaths(), ", "))
+				}
+				if err := runKeyServer(server, addr, certFile, keyFile); err != nil {
+					exitOnError(err, jsonFormat)
+				}
+			},
+		}
+		serveKeyCmd.Flags().StringP(serveNameFlag.fields())
+		serveKeyCmd.Flags().StringP(serveAddrFlag.fields())
+		serveKeyCmd.Flags().StringP(tlsCertFlag.fields())
+		serveKeyCmd.Flags().StringP(tlsKeyFlag.fields())
+	}
+	return serveKeyCmd
+}
+
+// getServedKeys parses the [path=]<key> arguments of serve-key. Keys are named
+// name, or their keyring alias if name is empty.
+func getServedKeys(args []string, name string) ([]resolve.ServedKey, error) {
+	keys := make([]resolve.ServedKey, 0, len(args))
+	for _, arg := range args {
+		path, keyStr, found := strings.Cut(arg, "=")
+		if !found || xipher.IsPubKeyStr(arg) {
+			path, keyStr = "", arg
+		}
+		key := resolve.ServedKey{Path: path, Name: name}
+		switch {
+		case utils.IsKeyringRef(keyStr):
+			keyring, err := utils.LoadKeyring()
+			if err != nil {
+				return nil, err
+			}
+			entry, err := keyring.Get(keyStr)
+			if err != nil {
+				return nil, err
+			}
+			key.PublicKey = entry.PublicKey
+			if key.Name == "" {
+				key.Name = entry.Alias
+			}
+		case xipher.IsPubKeyStr(strings.TrimSpace(keyStr)):
+			key.PublicKey = strings.TrimSpace(keyStr)
+		default:
+			data, err := os.ReadFile(keyStr)
+			if err != nil {
+				return nil, fmt.Errorf("%s is neither a public key, an @alias nor a readable file: %w", keyStr, err)
+			}
+			key.PublicKey = strings.TrimSpace(string(data))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// runKeyServer serves handler on addr, over TLS if certFile and keyFile are
+// given, until interrupted.
+func runKeyServer(handler http.Handler, addr, certFile, keyFile string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if certFile != "" {
+			err = srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+
+	scheme := "http"
+	if certFile != "" {
+		scheme = "https"
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s://%s\n", scheme, addr)
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutCtx)
+	}
+}
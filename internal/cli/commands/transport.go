@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+	"xipher.org/xipher/internal/utils"
+	"xipher.org/xipher/resolve"
+)
+
+// addKeyFetchFlags adds the flags configuring how public keys are fetched to
+// cmd and its subcommands.
+func addKeyFetchFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSliceP(caFileFlag.fields())
+	cmd.PersistentFlags().StringP(proxyFlag.fields())
+	cmd.PersistentFlags().StringP(clientCertFlag.fields())
+	cmd.PersistentFlags().StringP(clientKeyFlag.fields())
+	cmd.PersistentFlags().StringP(fetchTimeoutFlag.fields())
+	cmd.PersistentFlags().IntP(maxRedirectsFlag.fields())
+}
+
+// configureKeyFetch sets up the client public keys are fetched with from the
+// resolver section of the configuration file, overridden by the flags added by
+// addKeyFetchFlags.
+func configureKeyFetch(cmd *cobra.Command) error {
+	config, err := utils.LoadConfig()
+	if err != nil {
+		return err
+	}
+	transport := config.Resolver
+	flags := cmd.Flags()
+	if flags.Changed(caFileFlag.name) {
+		transport.CAFiles, _ = flags.GetStringSlice(caFileFlag.name)
+	}
+	if flags.Changed(proxyFlag.name) {
+		transport.Proxy, _ = flags.GetString(proxyFlag.name)
+	}
+	if flags.Changed(clientCertFlag.name) {
+		transport.ClientCert, _ = flags.GetString(clientCertFlag.name)
+	}
+	if flags.Changed(clientKeyFlag.name) {
+		transport.ClientKey, _ = flags.GetString(clientKeyFlag.name)
+	}
+	if flags.Changed(fetchTimeoutFlag.name) {
+		transport.Timeout, _ = flags.GetString(fetchTimeoutFlag.name)
+	}
+	if flags.Changed(maxRedirectsFlag.name) {
+		transport.MaxRedirects, _ = flags.GetInt(maxRedirectsFlag.name)
+	}
+	if transport.IsZero() {
+		return nil
+	}
+	client, err := resolve.NewHTTPClient(transport)
+	if err != nil {
+		return err
+	}
+	utils.SetKeyFetchClient(client)
+	return nil
+}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher/internal/utils"
+)
+
+func encryptValuesCommand() *cobra.Command {
+	if encryptValuesCmd == nil {
+		encryptValuesCmd = &cobra.Command{
+			Use:     "values [path]",
+			Aliases: []string{"vals", "v"},
+			Short:   "Encrypt the values of a YAML, JSON or dotenv file, leaving the keys readable",
+			Long: `Encrypt the values of a YAML, JSON or dotenv document, replacing each with an
+encrypted string while keys, order and comments stay readable for review. Use
+--include and --exclude to choose values by key path. A MAC over all values,
+encrypted or not, detects values that were moved, removed, changed or copied
+from another file.
+The result is written to standard output unless --out or --in-place is set.`,
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				opts, err := getEncryptOptions(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				srcPath, format, data := readValuesInput(cmd, args)
+				keyPwdStr, err := getKeyPwdStr(cmd)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				include, _ := cmd.Flags().GetStringSlice(includeKeysFlag.name)
+				exclude, _ := cmd.Flags().GetStringSlice(excludeKeysFlag.name)
+				out, paths, err := utils.EncryptValues(keyPwdStr, data, format, &utils.ValuesFilter{Include: include, Exclude: exclude}, opts...)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				writeValuesOutput(cmd, srcPath, out, paths, "encrypted")
+			},
+		}
+		addValuesFlags(encryptValuesCmd)
+		encryptValuesCmd.Flags().StringSliceP(includeKeysFlag.fields())
+		encryptValuesCmd.Flags().StringSliceP(excludeKeysFlag.fields())
+	}
+	return encryptValuesCmd
+}
+
+func decryptValuesCommand() *cobra.Command {
+	if decryptValuesCmd == nil {
+		decryptValuesCmd = &cobra.Command{
+			Use:     "values [path]",
+			Aliases: []string{"vals", "v"},
+			Short:   "Decrypt the values of a file encrypted with 'encrypt values'",
+			Long: `Decrypt the values of a YAML, JSON or dotenv document encrypted with
+'encrypt values' and remove its xipher metadata. Fails if the MAC shows that
+values were moved, removed, changed or copied from another file. The result is
+written to standard output unless --out or --in-place is set.`,
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				srcPath, format, data := readValuesInput(cmd, args)
+				secretKeyOrPwd, err := resolveSecretKey(cmd, true)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				out, paths, err := utils.DecryptValues(secretKeyOrPwd, data, format)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				writeValuesOutput(cmd, srcPath, out, paths, "decrypted")
+			},
+		}
+		addValuesFlags(decryptValuesCmd)
+	}
+	return decryptValuesCmd
+}
+
+func addValuesFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP(sourceFileFlag.fields())
+	cmd.Flags().StringP(outputFileFlag.fields())
+	cmd.Flags().BoolP(valuesInPlaceFlag.fields())
+	cmd.Flags().BoolP(overwriteFlag.fields())
+	cmd.Flags().StringP(valuesFormatFlag.fields())
+	cmd.Flags().BoolP(webAuthFlag.fields())
+	cmd.Flags().StringP(xipherURLFlag.fields())
+}
+
+// readValuesInput reads the document given with --file or as an argument, or
+// from standard input for "-", and returns its path, format and contents.
+func readValuesInput(cmd *cobra.Command, args []string) (string, utils.ValuesFormat, []byte) {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	srcPath := cmd.Flag(sourceFileFlag.name).Value.String()
+	if srcPath == "" && len(args) > 0 {
+		srcPath = args[0]
+	}
+	if srcPath == "" || len(args) > 1 || len(args) == 1 && args[0] != srcPath {
+		exitOnErrorWithMessage(fmt.Sprintf("set a single input file using --%s or as an argument", sourceFileFlag.name), jsonFormat)
+	}
+	inPlace, _ := cmd.Flags().GetBool(valuesInPlaceFlag.name)
+	if inPlace && (srcPath == "-" || cmd.Flag(outputFileFlag.name).Value.String() != "") {
+		exitOnErrorWithMessage(fmt.Sprintf("--%s needs an input file and cannot be used with --%s", valuesInPlaceFlag.name, outputFileFlag.name), jsonFormat)
+	}
+	formatName, _ := cmd.Flags().GetString(valuesFormatFlag.name)
+	format, err := utils.ParseValuesFormat(formatName, srcPath)
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	var data []byte
+	if srcPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(srcPath)
+	}
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	return srcPath, format, data
+}
+
+// writeValuesOutput writes the document to --out, back to srcPath with
+// --in-place, or otherwise to standard output.
+func writeValuesOutput(cmd *cobra.Command, srcPath string, out []byte, paths []string, verb string) {
+	jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+	dstPath := cmd.Flag(outputFileFlag.name).Value.String()
+	overwrite, _ := cmd.Flags().GetBool(overwriteFlag.name)
+	if inPlace, _ := cmd.Flags().GetBool(valuesInPlaceFlag.name); inPlace {
+		dstPath, overwrite = srcPath, true
+	}
+	if paths == nil {
+		paths = []string{}
+	}
+	if dstPath == "" {
+		if jsonFormat {
+			fmt.Println(toJsonString(map[string]interface{}{
+				"document": string(out),
+				verb:       paths,
+			}))
+		} else {
+			os.Stdout.Write(out)
+		}
+		return
+	}
+	perm := os.FileMode(outputFilePerm)
+	if info, err := os.Stat(srcPath); err == nil && dstPath == srcPath {
+		perm = info.Mode().Perm()
+	}
+	dst, err := createOutputFile(dstPath, overwrite, perm)
+	if err == nil {
+		if _, err = dst.Write(out); err != nil {
+			dst.Discard()
+		} else {
+			err = dst.Close()
+		}
+	}
+	if err != nil {
+		exitOnError(err, jsonFormat)
+	}
+	if jsonFormat {
+		fmt.Println(toJsonString(map[string]interface{}{
+			"file": dstPath,
+			verb:   paths,
+		}))
+	} else {
+		fmt.Printf("%s %d values: %s\n", strings.ToUpper(verb[:1])+verb[1:], len(paths), strings.Join(paths, ", "))
+		fmt.Println("Output file:", color.GreenString(dstPath))
+	}
+}
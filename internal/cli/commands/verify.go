@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/utils"
+)
+
+// verifyResult is the outcome of verifying a single file.
+type verifyResult struct {
+	Path           string `json:"path"`
+	OK             bool   `json:"ok"`
+	Error          string `json:"error,omitempty"`
+	Code           string `json:"code,omitempty"`
+	CiphertextType string `json:"ciphertextType,omitempty"`
+	CiphertextSize int64  `json:"ciphertextSize"`
+	PlaintextSize  int64  `json:"plaintextSize"`
+	Chunks         int    `json:"chunks"`
+	Compressed     bool   `json:"compressed"`
+	Framed         bool   `json:"framed"`
+	Padded         bool   `json:"padded"`
+}
+
+func verifyIntegrityCommand() *cobra.Command {
+	if verifyIntegrityCmd == nil {
+		verifyIntegrityCmd = &cobra.Command{
+			Use:     "verify-integrity <path>...",
+			Aliases: []string{"verify"},
+			Short:   "Check that encrypted files are intact and decryptable, without writing plaintext",
+			Long: `Authenticate every chunk of each ciphertext with the secret key or password,
+discarding the plaintext. Files are verified as given; directories are searched
+recursively for ` + xipherFileExt + ` files.`,
+			Args: cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				jsonFormat, _ := cmd.Flags().GetBool(jsonFlag.name)
+				workers, _ := cmd.Flags().GetInt(workersFlag.name)
+				files, err := utils.ExpandPaths(args, true, func(path string) bool {
+					return strings.HasSuffix(path, xipherFileExt)
+				})
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				if len(files) == 0 {
+					exitOnErrorWithMessage(fmt.Sprintf("no %s files found", xipherFileExt), jsonFormat)
+				}
+				secretKeyOrPwd, err := resolveSecretKey(cmd, true)
+				if err != nil {
+					exitOnError(err, jsonFormat)
+				}
+				results := verifyFiles(secretKeyOrPwd, files, workers)
+				failed := 0
+				for _, result := range results {
+					if !result.OK {
+						failed++
+					}
+					if !jsonFormat {
+						if result.OK {
+							fmt.Printf("%s %s (%d bytes)\n", color.GreenString("OK    "), result.Path, result.PlaintextSize)
+						} else {
+							fmt.Printf("%s %s: %s\n", color.RedString("FAILED"), result.Path, result.Error)
+						}
+					}
+				}
+				if jsonFormat {
+					fmt.Println(toJsonString(map[string]interface{}{
+						"files":    results,
+						"total":    len(results),
+						"verified": len(results) - failed,
+						"failed":   failed,
+					}))
+				} else {
+					summary := fmt.Sprintf("%d of %d files verified", len(results)-failed, len(results))
+					if failed > 0 {
+						fmt.Println(color.RedString("%s, %d failed", summary, failed))
+					} else {
+						fmt.Println(color.GreenString(summary))
+					}
+				}
+				if failed > 0 {
+					os.Exit(exitCodeGeneric)
+				}
+			},
+		}
+		verifyIntegrityCmd.Flags().IntP(workersFlag.fields())
+		verifyIntegrityCmd.Flags().StringP(decryptKeyFlag.fields())
+		verifyIntegrityCmd.Flags().BoolP(webAuthFlag.fields())
+		verifyIntegrityCmd.Flags().StringP(xipherURLFlag.fields())
+	}
+	return verifyIntegrityCmd
+}
+
+// verifyFiles verifies files using the given number of workers and returns the
+// results in the order of files.
+func verifyFiles(secretKeyOrPwd string, files []utils.BatchFile, workers int) []verifyResult {
+	index := make(map[string]int, len(files))
+	for i, file := range files {
+		index[file.Path] = i
+	}
+	reports := make([]*xipher.IntegrityReport, len(files))
+	batchResults := utils.RunBatch(files, workers, func(file utils.BatchFile) (string, error) {
+		report, err := verifyFile(secretKeyOrPwd, file.Path)
+		reports[index[file.Path]] = report
+		return "", err
+	})
+	results := make([]verifyResult, len(files))
+	for i, batchResult := range batchResults {
+		result := verifyResult{Path: batchResult.Path, OK: batchResult.OK, Error: batchResult.Error}
+		if !result.OK {
+			result.Code, _ = errorCode(batchResult.Err)
+		} else if report := reports[i]; report != nil {
+			result.CiphertextType = report.CiphertextType.String()
+			result.CiphertextSize = report.CiphertextSize
+			result.PlaintextSize = report.PlaintextSize
+			result.Chunks = report.Chunks
+			result.Compressed = report.Compressed
+			result.Framed = report.Framed
+			result.Padded = report.Padded
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// verifyFile authenticates the ciphertext in the file at path.
+func verifyFile(secretKeyOrPwd, path string) (*xipher.IntegrityReport, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return utils.VerifyStream(secretKeyOrPwd, src)
+}
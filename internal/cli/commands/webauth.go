@@ -49,7 +49,7 @@ func getSecretKeyFromWebAuth(baseURL string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("encoding ephemeral key: %w", err)
 	}
-	ephemeralPubKey, _, err := utils.GetPublicKey(ephemeralSecret, false)
+	ephemeralPubKey, _, err := utils.GetPublicKey(ephemeralSecret, xipher.SuiteECC)
 	if err != nil {
 		return "", fmt.Errorf("deriving ephemeral public key: %w", err)
 	}
@@ -24,9 +24,16 @@ func XipherCommand() *cobra.Command {
 		xipherCmd.Flags().BoolP(versionFlag.fields())
 		xipherCmd.AddCommand(versionCommand())
 		xipherCmd.AddCommand(keygenCommand())
+		xipherCmd.AddCommand(keysCommand())
+		xipherCmd.AddCommand(cacheCommand())
 		xipherCmd.AddCommand(encryptCommand())
 		xipherCmd.AddCommand(decryptCommand())
+		xipherCmd.AddCommand(verifyIntegrityCommand())
+		xipherCmd.AddCommand(serveKeyCommand())
 		xipherCmd.AddCommand(kmsCommand())
+		xipherCmd.AddCommand(execCommand())
+		xipherCmd.AddCommand(gitFilterCommand())
+		xipherCmd.AddCommand(gitCommand())
 	}
 	return xipherCmd
 }
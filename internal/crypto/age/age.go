@@ -0,0 +1,147 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+// Recipient wraps a file key into one or more stanzas of the header.
+type Recipient interface {
+	Wrap(fileKey []byte) ([]*Stanza, error)
+}
+
+// Identity unwraps the file key from the stanzas of the header. It returns
+// ErrIncorrectIdentity if none of the stanzas are addressed to it.
+type Identity interface {
+	Unwrap(stanzas []*Stanza) ([]byte, error)
+}
+
+// Encrypt returns a WriteCloser that encrypts data to the recipients and writes
+// an age file to dst. Close must be called to write the last chunk; it does not
+// close dst.
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errNoRecipients
+	}
+	for _, r := range recipients {
+		if _, ok := r.(*ScryptRecipient); ok && len(recipients) != 1 {
+			return nil, errScryptNotAlone
+		}
+	}
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	h := &header{}
+	for _, r := range recipients {
+		stanzas, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		h.recipients = append(h.recipients, stanzas...)
+	}
+	var headerNoMAC bytes.Buffer
+	if err := h.marshalWithoutMAC(&headerNoMAC); err != nil {
+		return nil, err
+	}
+	mac, err := headerMAC(fileKey, headerNoMAC.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	h.mac = mac
+	if err := h.marshal(dst); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, streamNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(nonce); err != nil {
+		return nil, err
+	}
+	payloadKey, err := streamKey(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamWriter(payloadKey, dst)
+}
+
+// Decrypt reads the header of the age file in src, unwraps the file key with
+// the first identity that matches, and returns a Reader of the plaintext.
+// ASCII armored files must be wrapped with NewArmoredReader first.
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, ErrIncorrectIdentity
+	}
+	r := bufio.NewReader(src)
+	h, headerNoMAC, err := parseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var fileKey []byte
+	for _, id := range identities {
+		fileKey, err = id.Unwrap(h.recipients)
+		if errors.Is(err, ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if fileKey == nil {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(fileKey) != fileKeySize {
+		return nil, fmt.Errorf("%w: invalid file key", errInvalidHeader)
+	}
+	mac, err := headerMAC(fileKey, headerNoMAC)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, h.mac) {
+		return nil, errHeaderMAC
+	}
+	nonce := make([]byte, streamNonceSize)
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, fmt.Errorf("%w: age payload nonce missing", xcp.ErrTruncated)
+	}
+	payloadKey, err := streamKey(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(payloadKey, r)
+}
+
+func streamKey(fileKey, nonce []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, fileKey, nonce, "payload", chacha20poly1305.KeySize)
+}
+
+// IsAgeFile reports whether data starts like an age file, binary or ASCII armored.
+func IsAgeFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(intro)) || IsArmored(data)
+}
+
+// IsRecipient reports whether s looks like an X25519 recipient.
+func IsRecipient(s string) bool {
+	hrp, _, err := bech32Decode(s)
+	return err == nil && hrp == RecipientPrefix
+}
+
+// IsIdentity reports whether s looks like an X25519 identity.
+func IsIdentity(s string) bool {
+	hrp, _, err := bech32Decode(s)
+	return err == nil && hrp == strings.ToLower(IdentityPrefix)
+}
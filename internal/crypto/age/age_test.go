@@ -0,0 +1,283 @@
+package age
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+// testVector is a file in the testkit format of the age test vectors: headers
+// describing the expected outcome, a blank line and the age file.
+type testVector struct {
+	expect      string
+	payloadHash string
+	identities  []Identity
+	armored     bool
+	file        []byte
+}
+
+func parseTestVector(t *testing.T, data []byte) *testVector {
+	t.Helper()
+	v := &testVector{}
+	compressed := false
+	for {
+		line, rest, ok := bytes.Cut(data, []byte("\n"))
+		if !ok {
+			t.Fatal("test vector without a body")
+		}
+		data = rest
+		if len(line) == 0 {
+			break
+		}
+		key, value, _ := strings.Cut(string(line), ": ")
+		switch key {
+		case "expect":
+			v.expect = value
+		case "payload":
+			v.payloadHash = value
+		case "identity":
+			id, err := ParseX25519Identity(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.identities = append(v.identities, id)
+		case "passphrase":
+			id, err := NewScryptIdentity(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.identities = append(v.identities, id)
+		case "armored":
+			v.armored = value == "yes"
+		case "compressed":
+			compressed = value == "zlib"
+		case "file key", "comment":
+		default:
+			t.Fatalf("unknown test vector header %q", key)
+		}
+	}
+	v.file = data
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.file, err = io.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return v
+}
+
+// TestVectors runs the testkit vectors in testdata, which were produced by an
+// independent implementation of the age format. Vectors from the age project's
+// testkit can be dropped into the same directory.
+func TestVectors(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no test vectors found")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := parseTestVector(t, data)
+			var src io.Reader = bytes.NewReader(v.file)
+			if v.armored {
+				src = NewArmoredReader(src)
+			}
+			plaintext, err := decryptAll(src, v.identities...)
+			switch v.expect {
+			case "success":
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if sum := sha256.Sum256(plaintext); hex.EncodeToString(sum[:]) != v.payloadHash {
+					t.Fatalf("payload hash mismatch")
+				}
+			case "no match":
+				if !errors.Is(err, ErrIncorrectIdentity) && !errors.Is(err, ErrIncorrectPassphrase) {
+					t.Fatalf("expected no matching identity, got %v", err)
+				}
+			case "HMAC failure":
+				if !errors.Is(err, errHeaderMAC) {
+					t.Fatalf("expected a header MAC failure, got %v", err)
+				}
+			case "header failure", "armor failure", "payload failure":
+				if err == nil {
+					t.Fatalf("expected a %s", v.expect)
+				}
+				if errors.Is(err, errHeaderMAC) || errors.Is(err, ErrIncorrectIdentity) {
+					t.Fatalf("expected a %s, got %v", v.expect, err)
+				}
+			default:
+				t.Fatalf("unknown expectation %q", v.expect)
+			}
+		})
+	}
+}
+
+func decryptAll(src io.Reader, identities ...Identity) ([]byte, error) {
+	r, err := Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func encryptAll(t *testing.T, plaintext []byte, armored bool, recipients ...Recipient) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var dst io.Writer = &buf
+	var armor io.WriteCloser
+	if armored {
+		armor = NewArmoredWriter(&buf)
+		dst = armor
+	}
+	w, err := Encrypt(dst, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if armored {
+		if err := armor.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	identity, err := NewX25519Identity(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scryptRecipient, err := NewScryptRecipient("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scryptRecipient.SetWorkFactor(10)
+	scryptIdentity, err := NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		recipient Recipient
+		identity  Identity
+	}{
+		{identity.Recipient(), identity},
+		{scryptRecipient, scryptIdentity},
+	}
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 2*chunkSize + 100} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+		for _, c := range cases {
+			for _, armored := range []bool{false, true} {
+				file := encryptAll(t, plaintext, armored, c.recipient)
+				if IsAgeFile(file) == false || IsArmored(file) != armored {
+					t.Fatalf("size %d: file not detected as age (armored %v)", size, armored)
+				}
+				var src io.Reader = bytes.NewReader(file)
+				if armored {
+					src = NewArmoredReader(src)
+				}
+				decrypted, err := decryptAll(src, c.identity)
+				if err != nil {
+					t.Fatalf("size %d, armored %v: %v", size, armored, err)
+				}
+				if !bytes.Equal(decrypted, plaintext) {
+					t.Fatalf("size %d, armored %v: round trip mismatch", size, armored)
+				}
+			}
+		}
+	}
+}
+
+func TestScryptNotAlone(t *testing.T) {
+	scryptRecipient, _ := NewScryptRecipient("password")
+	identity, _ := NewX25519Identity(make([]byte, 32))
+	if _, err := Encrypt(io.Discard, scryptRecipient, identity.Recipient()); !errors.Is(err, errScryptNotAlone) {
+		t.Fatalf("expected errScryptNotAlone, got %v", err)
+	}
+}
+
+func TestTruncatedAtChunkBoundary(t *testing.T) {
+	identity, _ := NewX25519Identity(bytes.Repeat([]byte{1}, 32))
+	file := encryptAll(t, make([]byte, chunkSize+10), false, identity.Recipient())
+	truncated := file[:len(file)-(10+16)]
+	if _, err := decryptAll(bytes.NewReader(truncated), identity); !errors.Is(err, xcp.ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestKeyEncoding(t *testing.T) {
+	const identityStr = "AGE-SECRET-KEY-1XMWWC06LY3EE5RYTXM9MFLAZ2U56JJJ36S0MYPDRWSVLUL66MV4QX3S7F6"
+	identity, err := ParseX25519Identity(identityStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.String() != identityStr {
+		t.Errorf("identity round trip: got %s", identity)
+	}
+	recipientStr := identity.Recipient().String()
+	if !strings.HasPrefix(recipientStr, "age1") || !IsRecipient(recipientStr) || IsIdentity(recipientStr) {
+		t.Errorf("unexpected recipient %s", recipientStr)
+	}
+	recipient, err := ParseX25519Recipient(recipientStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recipient.Bytes(), identity.Recipient().Bytes()) {
+		t.Error("recipient round trip mismatch")
+	}
+	if !IsIdentity(identityStr) || !IsIdentity(strings.ToLower(identityStr)) {
+		t.Error("identity not detected")
+	}
+	invalid := []string{
+		identityStr[:len(identityStr)-1] + "7",               // Bad checksum
+		strings.ToLower(identityStr[:20]) + identityStr[20:], // Mixed case
+		recipientStr,
+	}
+	for _, s := range invalid {
+		if _, err := ParseX25519Identity(s); err == nil {
+			t.Errorf("parsed invalid identity %s", s)
+		}
+	}
+	if _, err := ParseX25519Recipient(identityStr); err == nil {
+		t.Error("parsed an identity as a recipient")
+	}
+}
+
+func TestArmorWithoutFinalLineFeed(t *testing.T) {
+	identity, _ := NewX25519Identity(bytes.Repeat([]byte{2}, 32))
+	file := encryptAll(t, []byte("pasted"), true, identity.Recipient())
+	trimmed := bytes.TrimRight(file, "\n")
+	if pt, err := decryptAll(NewArmoredReader(bytes.NewReader(trimmed)), identity); err != nil || string(pt) != "pasted" {
+		t.Fatalf("decrypt = %q, %v", pt, err)
+	}
+	if _, err := decryptAll(NewArmoredReader(bytes.NewReader(trimmed[:len(trimmed)-5])), identity); err == nil {
+		t.Fatal("decrypted armor with a truncated footer")
+	}
+}
@@ -0,0 +1,199 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+const (
+	armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	armorFooter = "-----END AGE ENCRYPTED FILE-----"
+
+	// maxArmorTrailer is how much trailing whitespace is accepted after the armor footer.
+	maxArmorTrailer = 1024
+)
+
+// lineWrapper inserts a line feed every columnsPerLine bytes written.
+type lineWrapper struct {
+	dst    io.Writer
+	column int
+}
+
+func (w *lineWrapper) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), columnsPerLine-w.column)]
+		written, err := w.dst.Write(chunk)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+		if w.column += len(chunk); w.column == columnsPerLine {
+			if _, err := w.dst.Write([]byte("\n")); err != nil {
+				return n, err
+			}
+			w.column = 0
+		}
+	}
+	return n, nil
+}
+
+type armoredWriter struct {
+	dst     io.Writer
+	wrapper *lineWrapper
+	encoder io.WriteCloser
+	started bool
+}
+
+// NewArmoredWriter returns a WriteCloser that writes data to dst in the ASCII
+// armored (PEM-like) age format. Close writes the footer and does not close dst.
+func NewArmoredWriter(dst io.Writer) io.WriteCloser {
+	wrapper := &lineWrapper{dst: dst}
+	return &armoredWriter{
+		dst:     dst,
+		wrapper: wrapper,
+		encoder: base64.NewEncoder(base64.StdEncoding, wrapper),
+	}
+}
+
+func (w *armoredWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	_, err := io.WriteString(w.dst, armorHeader+"\n")
+	return err
+}
+
+func (w *armoredWriter) Write(p []byte) (int, error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return w.encoder.Write(p)
+}
+
+func (w *armoredWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.encoder.Close(); err != nil {
+		return err
+	}
+	footer := armorFooter + "\n"
+	if w.wrapper.column != 0 {
+		footer = "\n" + footer
+	}
+	_, err := io.WriteString(w.dst, footer)
+	return err
+}
+
+type armoredReader struct {
+	r        *bufio.Reader
+	started  bool
+	lastLine bool // Whether a short or padded line, which must be the last, was read
+	unread   []byte
+	done     bool
+	err      error
+}
+
+// NewArmoredReader returns a Reader that decodes an ASCII armored age file from
+// src. Whitespace is allowed before the header and after the footer.
+func NewArmoredReader(src io.Reader) io.Reader {
+	return &armoredReader{r: bufio.NewReader(src)}
+}
+
+func (r *armoredReader) Read(p []byte) (int, error) {
+	for len(r.unread) == 0 && !r.done && r.err == nil {
+		r.err = r.readLine()
+	}
+	if len(r.unread) > 0 {
+		n := copy(p, r.unread)
+		r.unread = r.unread[n:]
+		return n, nil
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+func (r *armoredReader) nextLine() (string, error) {
+	line, err := r.r.ReadString('\n')
+	switch {
+	case errors.Is(err, io.EOF) && line == "":
+		return "", fmt.Errorf("%w: age armor ends early", xcp.ErrTruncated)
+	case errors.Is(err, io.EOF):
+		// The footer may end the input without a line feed, as in pasted text.
+	case err != nil:
+		return "", err
+	default:
+		line = line[:len(line)-1]
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+func (r *armoredReader) readLine() error {
+	if !r.started {
+		r.started = true
+		for {
+			c, err := r.r.ReadByte()
+			if err != nil {
+				return fmt.Errorf("%w: missing header", errInvalidArmor)
+			}
+			if !isSpace(c) {
+				r.r.UnreadByte()
+				break
+			}
+		}
+		line, err := r.nextLine()
+		if err != nil {
+			return err
+		}
+		if line != armorHeader {
+			return fmt.Errorf("%w: invalid header", errInvalidArmor)
+		}
+		return nil
+	}
+	line, err := r.nextLine()
+	if err != nil {
+		return err
+	}
+	if line == armorFooter {
+		r.done = true
+		trailer, err := io.ReadAll(io.LimitReader(r.r, maxArmorTrailer+1))
+		if err != nil {
+			return err
+		}
+		if len(trailer) > maxArmorTrailer || len(bytes.TrimLeft(trailer, " \t\r\n")) != 0 {
+			return fmt.Errorf("%w: trailing data after the footer", errInvalidArmor)
+		}
+		return nil
+	}
+	if r.lastLine || len(line) > columnsPerLine {
+		return fmt.Errorf("%w: invalid line length", errInvalidArmor)
+	}
+	r.lastLine = len(line) < columnsPerLine || bytes.HasSuffix([]byte(line), []byte("="))
+	if r.unread, err = base64.StdEncoding.Strict().DecodeString(line); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArmor, err)
+	}
+	return nil
+}
+
+// IsArmored reports whether data starts like an ASCII armored age file.
+func IsArmored(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armorHeader))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
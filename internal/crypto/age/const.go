@@ -0,0 +1,57 @@
+// Package age implements the age v1 file format (age-encryption.org/v1) with
+// X25519 and scrypt recipients, for interoperability with age and rage.
+package age
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+const (
+	intro          = "age-encryption.org/v1\n"
+	stanzaPrefix   = "-> "
+	footerPrefix   = "---"
+	columnsPerLine = 64
+	bytesPerLine   = columnsPerLine / 4 * 3
+
+	fileKeySize     = 16
+	streamNonceSize = 16
+	chunkSize       = 64 * 1024
+	encChunkSize    = chunkSize + chacha20poly1305.Overhead
+	lastChunkFlag   = 0x01
+
+	// RecipientPrefix is the bech32 prefix of X25519 recipients.
+	RecipientPrefix = "age"
+	// IdentityPrefix is the bech32 prefix of X25519 identities.
+	IdentityPrefix = "AGE-SECRET-KEY-"
+
+	x25519Label = "age-encryption.org/v1/X25519"
+	scryptLabel = "age-encryption.org/v1/scrypt"
+
+	scryptSaltSize = 16
+	// DefaultWorkFactor is the scrypt work factor (log2 of N) used to encrypt.
+	DefaultWorkFactor = 18
+	// MaxWorkFactor is the highest scrypt work factor accepted when decrypting.
+	MaxWorkFactor = 22
+)
+
+var (
+	// ErrIncorrectIdentity is returned when none of the identities match a recipient of the file.
+	ErrIncorrectIdentity = fmt.Errorf("%w: no identity matched any of the recipients", xcp.ErrWrongKey)
+	// ErrIncorrectPassphrase is returned when the passphrase does not match a scrypt recipient.
+	ErrIncorrectPassphrase = fmt.Errorf("%w: incorrect passphrase", xcp.ErrWrongKey)
+
+	errInvalidHeader    = fmt.Errorf("%w: invalid age header", xcp.ErrCorrupted)
+	errHeaderMAC        = fmt.Errorf("%w: age header MAC mismatch", xcp.ErrCorrupted)
+	errTrailingData     = fmt.Errorf("%w: trailing data after the end of the age payload", xcp.ErrCorrupted)
+	errEmptyLastChunk   = fmt.Errorf("%w: empty final chunk in the age payload", xcp.ErrCorrupted)
+	errInvalidArmor     = fmt.Errorf("%w: invalid age armor", xcp.ErrCorrupted)
+	errWorkFactor       = fmt.Errorf("%w: scrypt work factor too high", xcp.ErrUnsupported)
+	errScryptNotAlone   = fmt.Errorf("%w: an scrypt recipient must be the only one", xcp.ErrCorrupted)
+	errNoRecipients     = fmt.Errorf("no age recipients")
+	errInvalidRecipient = fmt.Errorf("invalid age recipient")
+	errInvalidIdentity  = fmt.Errorf("invalid age identity")
+)
@@ -0,0 +1,176 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+// b64 is the unpadded, canonical base64 used in age headers.
+var b64 = base64.RawStdEncoding.Strict()
+
+// Stanza is a recipient stanza of an age header: a type, its arguments and a
+// body that usually holds the wrapped file key.
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// header is a parsed age header.
+type header struct {
+	recipients []*Stanza
+	mac        []byte
+}
+
+func (s *Stanza) marshal(w io.Writer) error {
+	line := stanzaPrefix + s.Type
+	for _, arg := range s.Args {
+		line += " " + arg
+	}
+	if _, err := io.WriteString(w, line+"\n"); err != nil {
+		return err
+	}
+	body := b64.EncodeToString(s.Body)
+	for len(body) >= columnsPerLine {
+		if _, err := io.WriteString(w, body[:columnsPerLine]+"\n"); err != nil {
+			return err
+		}
+		body = body[columnsPerLine:]
+	}
+	// The final line is always shorter than a full line, so it may be empty.
+	_, err := io.WriteString(w, body+"\n")
+	return err
+}
+
+// marshalWithoutMAC writes the header up to and including the "---" the MAC is computed over.
+func (h *header) marshalWithoutMAC(w io.Writer) error {
+	if _, err := io.WriteString(w, intro); err != nil {
+		return err
+	}
+	for _, s := range h.recipients {
+		if err := s.marshal(w); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, footerPrefix)
+	return err
+}
+
+func (h *header) marshal(w io.Writer) error {
+	if err := h.marshalWithoutMAC(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, " "+b64.EncodeToString(h.mac)+"\n")
+	return err
+}
+
+// headerMAC returns the MAC of the marshalled header, up to and including "---".
+func headerMAC(fileKey, headerNoMAC []byte) ([]byte, error) {
+	hmacKey, err := hkdf.Key(sha256.New, fileKey, nil, "header", sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(headerNoMAC)
+	return mac.Sum(nil), nil
+}
+
+// readHeaderLine reads a line of the header, including its line feed.
+func readHeaderLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil, fmt.Errorf("%w: age header ends early", xcp.ErrTruncated)
+	case errors.Is(err, bufio.ErrBufferFull):
+		return nil, fmt.Errorf("%w: line too long", errInvalidHeader)
+	case err != nil:
+		return nil, err
+	}
+	return bytes.Clone(line), nil
+}
+
+// isArg reports whether s is a valid stanza argument: one or more visible ASCII characters.
+func isArg(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeader reads an age header from r, returning it along with the bytes
+// its MAC is computed over. r is left at the start of the payload.
+func parseHeader(r *bufio.Reader) (*header, []byte, error) {
+	var raw bytes.Buffer
+	line, err := readHeaderLine(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(line) != intro {
+		return nil, nil, fmt.Errorf("%w: unknown version or not an age file", errInvalidHeader)
+	}
+	raw.Write(line)
+	h := &header{}
+	for {
+		if line, err = readHeaderLine(r); err != nil {
+			return nil, nil, err
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if rest, ok := strings.CutPrefix(text, footerPrefix); ok {
+			encMAC, ok := strings.CutPrefix(rest, " ")
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: malformed closing line", errInvalidHeader)
+			}
+			if h.mac, err = b64.DecodeString(encMAC); err != nil || len(h.mac) != sha256.Size {
+				return nil, nil, fmt.Errorf("%w: malformed MAC", errInvalidHeader)
+			}
+			raw.WriteString(footerPrefix)
+			return h, raw.Bytes(), nil
+		}
+		rest, ok := strings.CutPrefix(text, stanzaPrefix)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: unexpected line", errInvalidHeader)
+		}
+		raw.Write(line)
+		args := strings.Split(rest, " ")
+		for _, arg := range args {
+			if !isArg(arg) {
+				return nil, nil, fmt.Errorf("%w: malformed stanza", errInvalidHeader)
+			}
+		}
+		s := &Stanza{Type: args[0], Args: args[1:]}
+		for {
+			if line, err = readHeaderLine(r); err != nil {
+				return nil, nil, err
+			}
+			raw.Write(line)
+			text := strings.TrimSuffix(string(line), "\n")
+			if len(text) > columnsPerLine {
+				return nil, nil, fmt.Errorf("%w: stanza body line too long", errInvalidHeader)
+			}
+			body, err := b64.DecodeString(text)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: malformed stanza body", errInvalidHeader)
+			}
+			s.Body = append(s.Body, body...)
+			if len(text) < columnsPerLine {
+				break
+			}
+		}
+		h.recipients = append(h.recipients, s)
+	}
+}
@@ -0,0 +1,118 @@
+package age
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ScryptRecipient encrypts a file to a passphrase. It must be the only
+// recipient of a file.
+type ScryptRecipient struct {
+	password   []byte
+	workFactor int
+}
+
+// NewScryptRecipient returns a recipient for a passphrase, with the default work factor.
+func NewScryptRecipient(password string) (*ScryptRecipient, error) {
+	if password == "" {
+		return nil, fmt.Errorf("%w: empty passphrase", errInvalidRecipient)
+	}
+	return &ScryptRecipient{password: []byte(password), workFactor: DefaultWorkFactor}, nil
+}
+
+// SetWorkFactor sets the scrypt work factor to 2^logN. It panics if logN is not between 1 and 30.
+func (r *ScryptRecipient) SetWorkFactor(logN int) {
+	if logN < 1 || logN > 30 {
+		panic("age: invalid scrypt work factor")
+	}
+	r.workFactor = logN
+}
+
+// Wrap encrypts the file key with a key derived from the passphrase.
+func (r *ScryptRecipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	salt := make([]byte, scryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := scryptKey(r.password, salt, r.workFactor)
+	if err != nil {
+		return nil, err
+	}
+	body, err := aeadEncrypt(key, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return []*Stanza{{
+		Type: "scrypt",
+		Args: []string{b64.EncodeToString(salt), strconv.Itoa(r.workFactor)},
+		Body: body,
+	}}, nil
+}
+
+// ScryptIdentity decrypts files encrypted to a passphrase.
+type ScryptIdentity struct {
+	password      []byte
+	maxWorkFactor int
+}
+
+// NewScryptIdentity returns an identity for a passphrase, accepting work
+// factors up to MaxWorkFactor.
+func NewScryptIdentity(password string) (*ScryptIdentity, error) {
+	if password == "" {
+		return nil, fmt.Errorf("%w: empty passphrase", errInvalidIdentity)
+	}
+	return &ScryptIdentity{password: []byte(password), maxWorkFactor: MaxWorkFactor}, nil
+}
+
+// SetMaxWorkFactor sets the highest scrypt work factor accepted, as log2 of N.
+func (i *ScryptIdentity) SetMaxWorkFactor(logN int) {
+	i.maxWorkFactor = logN
+}
+
+// Unwrap returns the file key from the scrypt stanza, which must be the only one.
+func (i *ScryptIdentity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.Type == "scrypt" && len(stanzas) != 1 {
+			return nil, errScryptNotAlone
+		}
+	}
+	if len(stanzas) != 1 || stanzas[0].Type != "scrypt" {
+		return nil, ErrIncorrectIdentity
+	}
+	s := stanzas[0]
+	if len(s.Args) != 2 {
+		return nil, fmt.Errorf("%w: invalid scrypt recipient stanza", errInvalidHeader)
+	}
+	salt, err := b64.DecodeString(s.Args[0])
+	if err != nil || len(salt) != scryptSaltSize {
+		return nil, fmt.Errorf("%w: invalid scrypt salt", errInvalidHeader)
+	}
+	logN, err := strconv.Atoi(s.Args[1])
+	if err != nil || logN <= 0 || s.Args[1] != strconv.Itoa(logN) {
+		return nil, fmt.Errorf("%w: invalid scrypt work factor", errInvalidHeader)
+	}
+	if logN > i.maxWorkFactor {
+		return nil, fmt.Errorf("%w: %d, the maximum is %d", errWorkFactor, logN, i.maxWorkFactor)
+	}
+	if len(s.Body) != fileKeySize+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("%w: invalid scrypt recipient body", errInvalidHeader)
+	}
+	key, err := scryptKey(i.password, salt, logN)
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := aeadDecrypt(key, s.Body)
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return fileKey, nil
+}
+
+func scryptKey(password, salt []byte, logN int) ([]byte, error) {
+	labeledSalt := append([]byte(scryptLabel), salt...)
+	return scrypt.Key(password, labeledSalt, 1<<logN, 8, 1, chacha20poly1305.KeySize)
+}
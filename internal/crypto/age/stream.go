@@ -0,0 +1,184 @@
+package age
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+// The age payload is encrypted with the STREAM construction: 64 KiB chunks of
+// ChaCha20-Poly1305, each with a nonce made of an 11-byte big-endian counter
+// and a flag marking the last chunk.
+
+type streamNonce [chacha20poly1305.NonceSize]byte
+
+func (n *streamNonce) increment() error {
+	for i := len(n) - 2; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("age stream counter overflow")
+}
+
+func (n *streamNonce) withLast(last bool) []byte {
+	if last {
+		n[len(n)-1] = lastChunkFlag
+	} else {
+		n[len(n)-1] = 0
+	}
+	return n[:]
+}
+
+type streamWriter struct {
+	aead  cipher.AEAD
+	dst   io.Writer
+	buf   []byte
+	out   []byte
+	nonce streamNonce
+	err   error
+}
+
+func newStreamWriter(key []byte, dst io.Writer) (*streamWriter, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		aead: aead,
+		dst:  dst,
+		buf:  make([]byte, 0, chunkSize),
+		out:  make([]byte, 0, encChunkSize),
+	}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only written once more data follows, since the last
+		// chunk has to be marked as such.
+		if len(w.buf) == chunkSize {
+			if w.err = w.flushChunk(false); w.err != nil {
+				return n, w.err
+			}
+		}
+		k := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func (w *streamWriter) flushChunk(last bool) error {
+	w.out = w.aead.Seal(w.out[:0], w.nonce.withLast(last), w.buf, nil)
+	if _, err := w.dst.Write(w.out); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return w.nonce.increment()
+}
+
+// Close writes the last chunk. It does not close dst.
+func (w *streamWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.flushChunk(true)
+	if w.err != nil {
+		return w.err
+	}
+	w.err = fmt.Errorf("age stream writer closed")
+	return nil
+}
+
+type streamReader struct {
+	aead   cipher.AEAD
+	src    io.Reader
+	buf    []byte
+	out    []byte
+	unread []byte
+	nonce  streamNonce
+	chunks uint64
+	done   bool
+	err    error
+}
+
+func newStreamReader(key []byte, src io.Reader) (*streamReader, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		aead: aead,
+		src:  src,
+		buf:  make([]byte, encChunkSize),
+		out:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.unread) == 0 && !r.done && r.err == nil {
+		r.err = r.readChunk()
+	}
+	if len(r.unread) > 0 {
+		n := copy(p, r.unread)
+		r.unread = r.unread[n:]
+		return n, nil
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+func (r *streamReader) readChunk() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: age payload ends before its last chunk", xcp.ErrTruncated)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	}
+	if n < chacha20poly1305.Overhead {
+		return fmt.Errorf("%w: age payload chunk too short", xcp.ErrTruncated)
+	}
+	in := r.buf[:n]
+	r.out, err = r.aead.Open(r.out[:0], r.nonce.withLast(last), in, nil)
+	if err != nil && !last {
+		// A full-size chunk may be the last one.
+		last = true
+		r.out, err = r.aead.Open(r.out[:0], r.nonce.withLast(last), in, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: age payload chunk %d failed authentication", xcp.ErrCorrupted, r.chunks)
+	}
+	if last && len(r.out) == 0 && r.chunks > 0 {
+		return errEmptyLastChunk
+	}
+	r.chunks++
+	if err := r.nonce.increment(); err != nil {
+		return err
+	}
+	if last {
+		var extra [1]byte
+		if m, _ := io.ReadFull(r.src, extra[:]); m > 0 {
+			return errTrailingData
+		}
+		r.done = true
+	}
+	r.unread = r.out
+	return nil
+}
@@ -0,0 +1,181 @@
+package age
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// X25519Recipient is the standard age public key. Files encrypted to it can be
+// decrypted with the matching X25519Identity.
+type X25519Recipient struct {
+	theirPublicKey *ecdh.PublicKey
+}
+
+// NewX25519Recipient returns a recipient for a 32-byte X25519 public key.
+func NewX25519Recipient(publicKey []byte) (*X25519Recipient, error) {
+	pub, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, errInvalidRecipient
+	}
+	return &X25519Recipient{theirPublicKey: pub}, nil
+}
+
+// ParseX25519Recipient parses a bech32 encoded recipient, such as "age1...".
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRecipient, err)
+	}
+	if hrp != RecipientPrefix {
+		return nil, fmt.Errorf("%w: unexpected type %q", errInvalidRecipient, hrp)
+	}
+	return NewX25519Recipient(data)
+}
+
+// Bytes returns the X25519 public key of the recipient.
+func (r *X25519Recipient) Bytes() []byte {
+	return r.theirPublicKey.Bytes()
+}
+
+// String returns the bech32 encoding of the recipient.
+func (r *X25519Recipient) String() string {
+	s, _ := bech32Encode(RecipientPrefix, r.theirPublicKey.Bytes())
+	return s
+}
+
+// Wrap encrypts the file key to the recipient with an ephemeral X25519 key.
+func (r *X25519Recipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := ephemeral.ECDH(r.theirPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	ourPublicKey := ephemeral.PublicKey().Bytes()
+	wrappingKey, err := x25519WrappingKey(sharedSecret, ourPublicKey, r.theirPublicKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	body, err := aeadEncrypt(wrappingKey, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return []*Stanza{{
+		Type: "X25519",
+		Args: []string{b64.EncodeToString(ourPublicKey)},
+		Body: body,
+	}}, nil
+}
+
+// X25519Identity is the standard age private key, which decrypts files
+// encrypted to its X25519Recipient.
+type X25519Identity struct {
+	secretKey *ecdh.PrivateKey
+}
+
+// NewX25519Identity returns an identity for a 32-byte X25519 scalar.
+func NewX25519Identity(secretKey []byte) (*X25519Identity, error) {
+	key, err := ecdh.X25519().NewPrivateKey(secretKey)
+	if err != nil {
+		return nil, errInvalidIdentity
+	}
+	return &X25519Identity{secretKey: key}, nil
+}
+
+// ParseX25519Identity parses a bech32 encoded identity, such as "AGE-SECRET-KEY-1...".
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidIdentity, err)
+	}
+	if hrp != strings.ToLower(IdentityPrefix) {
+		return nil, fmt.Errorf("%w: unexpected type %q", errInvalidIdentity, hrp)
+	}
+	return NewX25519Identity(data)
+}
+
+// Bytes returns the X25519 scalar of the identity.
+func (i *X25519Identity) Bytes() []byte {
+	return i.secretKey.Bytes()
+}
+
+// Recipient returns the recipient matching the identity.
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{theirPublicKey: i.secretKey.PublicKey()}
+}
+
+// String returns the bech32 encoding of the identity.
+func (i *X25519Identity) String() string {
+	s, _ := bech32Encode(IdentityPrefix, i.secretKey.Bytes())
+	return s
+}
+
+// Unwrap returns the file key from the X25519 stanza addressed to the identity.
+func (i *X25519Identity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	ourPublicKey := i.secretKey.PublicKey().Bytes()
+	for _, s := range stanzas {
+		if s.Type != "X25519" {
+			continue
+		}
+		if len(s.Args) != 1 {
+			return nil, fmt.Errorf("%w: invalid X25519 recipient stanza", errInvalidHeader)
+		}
+		ephemeral, err := b64.DecodeString(s.Args[0])
+		if err != nil || len(ephemeral) != 32 {
+			return nil, fmt.Errorf("%w: invalid X25519 ephemeral key", errInvalidHeader)
+		}
+		if len(s.Body) != fileKeySize+chacha20poly1305.Overhead {
+			return nil, fmt.Errorf("%w: invalid X25519 recipient body", errInvalidHeader)
+		}
+		theirPublicKey, err := ecdh.X25519().NewPublicKey(ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid X25519 ephemeral key", errInvalidHeader)
+		}
+		// ECDH fails on an all-zero shared secret, from a low-order ephemeral key.
+		sharedSecret, err := i.secretKey.ECDH(theirPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid X25519 ephemeral key", errInvalidHeader)
+		}
+		wrappingKey, err := x25519WrappingKey(sharedSecret, ephemeral, ourPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if fileKey, err := aeadDecrypt(wrappingKey, s.Body); err == nil {
+			return fileKey, nil
+		}
+	}
+	return nil, ErrIncorrectIdentity
+}
+
+func x25519WrappingKey(sharedSecret, ephemeral, recipient []byte) ([]byte, error) {
+	salt := make([]byte, 0, len(ephemeral)+len(recipient))
+	salt = append(append(salt, ephemeral...), recipient...)
+	return hkdf.Key(sha256.New, sharedSecret, salt, x25519Label, chacha20poly1305.KeySize)
+}
+
+// aeadEncrypt encrypts the file key with a key used only once, hence the zero nonce.
+func aeadEncrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func aeadDecrypt(key, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
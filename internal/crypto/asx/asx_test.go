@@ -2,12 +2,15 @@ package asx
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/rand"
+	"errors"
 	"io"
 	"testing"
 
 	"xipher.org/xipher/internal/crypto/ecc"
 	"xipher.org/xipher/internal/crypto/kyb"
+	"xipher.org/xipher/internal/crypto/xcp"
 )
 
 func getTestData(t *testing.T) []byte {
@@ -68,11 +71,11 @@ func TestECCRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error serialising public key: %v", err)
 	}
-	if pubKeyBytes[0] != algoECC {
-		t.Fatalf("expected public key algorithm byte %d, got %d", algoECC, pubKeyBytes[0])
+	if pubKeyBytes[0] != AlgoECC {
+		t.Fatalf("expected public key algorithm byte %d, got %d", AlgoECC, pubKeyBytes[0])
 	}
 	for _, compress := range []bool{false, true} {
-		roundTrip(t, privKey, pubKey, algoECC, compress)
+		roundTrip(t, privKey, pubKey, AlgoECC, compress)
 	}
 }
 
@@ -89,11 +92,11 @@ func TestKyberRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error serialising public key: %v", err)
 	}
-	if pubKeyBytes[0] != algoKyber {
-		t.Fatalf("expected public key algorithm byte %d, got %d", algoKyber, pubKeyBytes[0])
+	if pubKeyBytes[0] != AlgoKyber {
+		t.Fatalf("expected public key algorithm byte %d, got %d", AlgoKyber, pubKeyBytes[0])
 	}
 	for _, compress := range []bool{false, true} {
-		roundTrip(t, privKey, pubKey, algoKyber, compress)
+		roundTrip(t, privKey, pubKey, AlgoKyber, compress)
 	}
 }
 
@@ -110,15 +113,44 @@ func TestHybridRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error serialising public key: %v", err)
 	}
-	if pubKeyBytes[0] != algoHybrid {
-		t.Fatalf("expected public key algorithm byte %d, got %d", algoHybrid, pubKeyBytes[0])
+	if pubKeyBytes[0] != AlgoHybrid {
+		t.Fatalf("expected public key algorithm byte %d, got %d", AlgoHybrid, pubKeyBytes[0])
 	}
 	// 1 algo byte + X25519 public key (32) + ML-KEM-1024 public key (1568) = 1601 bytes.
 	if wantLen := 1 + ecc.KeyLength + kyb.PublicKeyLength; len(pubKeyBytes) != wantLen {
 		t.Fatalf("expected hybrid public key length %d, got %d", wantLen, len(pubKeyBytes))
 	}
 	for _, compress := range []bool{false, true} {
-		roundTrip(t, privKey, pubKey, algoHybrid, compress)
+		roundTrip(t, privKey, pubKey, AlgoHybrid, compress)
+	}
+}
+
+func TestHybrid768RoundTrip(t *testing.T) {
+	privKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatalf("error generating private key: %v", err)
+	}
+	pubKey, err := privKey.PublicKeyHybrid768()
+	if err != nil {
+		t.Fatalf("error deriving hybrid-768 public key: %v", err)
+	}
+	pubKeyBytes, err := pubKey.Bytes()
+	if err != nil {
+		t.Fatalf("error serialising public key: %v", err)
+	}
+	// 1 algo byte + X25519 public key (32) + ML-KEM-768 public key (1184) = 1217 bytes.
+	if wantLen := 1 + ecc.KeyLength + kyb.PublicKeyLength768; len(pubKeyBytes) != wantLen {
+		t.Fatalf("expected hybrid-768 public key length %d, got %d", wantLen, len(pubKeyBytes))
+	}
+	parsedPubKey, err := ParsePublicKey(pubKeyBytes)
+	if err != nil {
+		t.Fatalf("error parsing hybrid-768 public key: %v", err)
+	}
+	if algo, _ := parsedPubKey.Algorithm(); algo != AlgoHybrid768 {
+		t.Fatalf("expected algorithm %d, got %d", AlgoHybrid768, algo)
+	}
+	for _, compress := range []bool{false, true} {
+		roundTrip(t, privKey, parsedPubKey, AlgoHybrid768, compress)
 	}
 }
 
@@ -142,7 +174,7 @@ func TestHybridParsedPublicKeyRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error parsing hybrid public key: %v", err)
 	}
-	roundTrip(t, privKey, parsedPubKey, algoHybrid, true)
+	roundTrip(t, privKey, parsedPubKey, AlgoHybrid, true)
 }
 
 // TestHybridTruncatedCiphertextFails ensures a hybrid record truncated within its
@@ -175,3 +207,66 @@ func TestHybridTruncatedCiphertextFails(t *testing.T) {
 		t.Fatal("expected error decrypting truncated hybrid ciphertext, got nil")
 	}
 }
+
+func TestSSHEd25519RoundTrip(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ed25519 key: %v", err)
+	}
+	privKey, err := NewPrivateKeySSHEd25519(edPriv.Seed())
+	if err != nil {
+		t.Fatalf("error creating ssh private key: %v", err)
+	}
+	pubKey, err := NewPublicKeySSHEd25519(edPub)
+	if err != nil {
+		t.Fatalf("error creating ssh public key: %v", err)
+	}
+	// The converted public key must match the one derived from the private scalar.
+	scalarPub, err := privKey.sshPrivKey.PublicKey()
+	if err != nil {
+		t.Fatalf("error deriving x25519 public key: %v", err)
+	}
+	if !bytes.Equal(scalarPub.Bytes(), pubKey.sPub.ePub.Bytes()) {
+		t.Fatal("x25519 key converted from the ed25519 public key does not match the private key")
+	}
+	pubKeyBytes, err := pubKey.Bytes()
+	if err != nil {
+		t.Fatalf("error serialising public key: %v", err)
+	}
+	parsedPubKey, err := ParsePublicKey(pubKeyBytes)
+	if err != nil {
+		t.Fatalf("error parsing ssh public key: %v", err)
+	}
+	for _, compress := range []bool{false, true} {
+		roundTrip(t, privKey, parsedPubKey, AlgoSSHEd25519, compress)
+	}
+
+	// Ciphertext for an SSH key is not decryptable with other keys and vice versa.
+	var sshCt, eccCt bytes.Buffer
+	w, _ := pubKey.NewEncryptingWriter(&sshCt, false)
+	w.Write([]byte("ssh"))
+	w.Close()
+	otherKey, _ := NewPrivateKey()
+	if _, err := otherKey.NewDecryptingReader(bytes.NewReader(sshCt.Bytes())); !errors.Is(err, xcp.ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey decrypting ssh ciphertext with another key, got %v", err)
+	}
+	eccPubKey, _ := otherKey.PublicKeyECC()
+	w, _ = eccPubKey.NewEncryptingWriter(&eccCt, false)
+	w.Write([]byte("ecc"))
+	w.Close()
+	if _, err := privKey.NewDecryptingReader(bytes.NewReader(eccCt.Bytes())); !errors.Is(err, xcp.ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey decrypting ecc ciphertext with an ssh key, got %v", err)
+	}
+}
+
+func TestSSHEd25519InvalidPublicKey(t *testing.T) {
+	identity := make([]byte, ed25519.PublicKeySize)
+	identity[0] = 1 // y = 1 is the identity point, which has no X25519 form
+	notOnCurve := make([]byte, ed25519.PublicKeySize)
+	notOnCurve[0] = 2 // y = 2 has no matching x
+	for name, key := range map[string][]byte{"identity": identity, "not on curve": notOnCurve, "short": identity[:31]} {
+		if _, err := NewPublicKeySSHEd25519(key); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
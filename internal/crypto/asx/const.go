@@ -5,6 +5,7 @@ import (
 
 	"xipher.org/xipher/internal/crypto/ecc"
 	"xipher.org/xipher/internal/crypto/kyb"
+	"xipher.org/xipher/internal/crypto/xcp"
 )
 
 const (
@@ -13,15 +14,27 @@ const (
 	// MinPublicKeyLength is the minimum length allowed for the public key
 	MinPublicKeyLength = ecc.KeyLength + 1 // +1 for the algorithm type
 
-	// Algorithm Types
-	algoECC    uint8 = 0
-	algoKyber  uint8 = 1
-	algoHybrid uint8 = 2
+	// Algorithm types, stored as the leading byte of public keys and ciphertext
+
+	// AlgoECC is X25519.
+	AlgoECC uint8 = 0
+	// AlgoKyber is ML-KEM-1024.
+	AlgoKyber uint8 = 1
+	// AlgoHybrid is X25519 combined with ML-KEM-1024.
+	AlgoHybrid uint8 = 2
+	// AlgoHybrid768 is X25519 combined with ML-KEM-768.
+	AlgoHybrid768 uint8 = 3
+	// AlgoSSHEd25519 is X25519 with the key converted from an SSH Ed25519 key.
+	AlgoSSHEd25519 uint8 = 4
 )
 
 var (
 	errInvalidPrivateKeyLength = fmt.Errorf("invalid private key lengths [please use %d bytes]", PrivateKeyLength)
 	errInvalidPublicKeyLength  = fmt.Errorf("invalid public key lengths [please use a minimum of %d bytes]", MinPublicKeyLength)
 	errInvalidPublicKey        = fmt.Errorf("invalid public key")
-	errInvalidAlgorithm        = fmt.Errorf("invalid algorithm")
+	errInvalidAlgorithm        = fmt.Errorf("%w: unknown algorithm", xcp.ErrUnsupported)
+	errInvalidSSHKey           = fmt.Errorf("invalid ssh-ed25519 key")
+	errSSHKeyRequired          = fmt.Errorf("%w: encrypted for an SSH key", xcp.ErrWrongKey)
+	errNotSSHCiphertext        = fmt.Errorf("%w: not encrypted for an SSH key", xcp.ErrWrongKey)
+	errNotX25519Ciphertext     = fmt.Errorf("%w: not encrypted for an X25519 key", xcp.ErrWrongKey)
 )
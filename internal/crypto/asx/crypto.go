@@ -1,26 +1,38 @@
 package asx
 
 import (
+	"fmt"
 	"io"
+
+	"xipher.org/xipher/internal/crypto/xcp"
 )
 
 // NewEncryptingWriter returns a new WriteCloser that encrypts data with the public key and writes to dst.
-func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (io.WriteCloser, error) {
+func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool, opts ...xcp.WriterOption) (io.WriteCloser, error) {
 	if publicKey.ePub != nil {
-		if _, err := dst.Write([]byte{algoECC}); err != nil {
+		if _, err := dst.Write([]byte{AlgoECC}); err != nil {
 			return nil, err
 		}
-		return publicKey.ePub.NewEncryptingWriter(dst, compress)
+		return publicKey.ePub.NewEncryptingWriter(dst, compress, opts...)
 	} else if publicKey.kPub != nil {
-		if _, err := dst.Write([]byte{algoKyber}); err != nil {
+		if _, err := dst.Write([]byte{AlgoKyber}); err != nil {
 			return nil, err
 		}
-		return publicKey.kPub.NewEncryptingWriter(dst, compress)
+		return publicKey.kPub.NewEncryptingWriter(dst, compress, opts...)
 	} else if publicKey.hPub != nil {
-		if _, err := dst.Write([]byte{algoHybrid}); err != nil {
+		algo := AlgoHybrid
+		if publicKey.hPub.Is768() {
+			algo = AlgoHybrid768
+		}
+		if _, err := dst.Write([]byte{algo}); err != nil {
+			return nil, err
+		}
+		return publicKey.hPub.NewEncryptingWriter(dst, compress, opts...)
+	} else if publicKey.sPub != nil {
+		if _, err := dst.Write([]byte{AlgoSSHEd25519}); err != nil {
 			return nil, err
 		}
-		return publicKey.hPub.NewEncryptingWriter(dst, compress)
+		return publicKey.sPub.newEncryptingWriter(dst, compress, opts...)
 	} else {
 		return nil, errInvalidPublicKey
 	}
@@ -30,29 +42,60 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (i
 func (privateKey *PrivateKey) NewDecryptingReader(src io.Reader) (io.Reader, error) {
 	algoBytes := make([]byte, 1)
 	if _, err := io.ReadFull(src, algoBytes); err != nil {
-		return nil, err
+		return nil, headerReadError(err)
 	}
 	var algo uint8 = algoBytes[0]
+	if privateKey.IsSSHEd25519() != (algo == AlgoSSHEd25519) {
+		if algo == AlgoSSHEd25519 {
+			return nil, errSSHKeyRequired
+		}
+		return nil, errNotSSHCiphertext
+	}
+	if privateKey.x25519Only && algo != AlgoECC {
+		return nil, errNotX25519Ciphertext
+	}
 	switch algo {
-	case algoECC:
+	case AlgoECC:
 		eccPrivKey, err := privateKey.getEccPrivKey()
 		if err != nil {
 			return nil, err
 		}
-		return eccPrivKey.NewDecryptingReader(src)
-	case algoKyber:
+		r, err := eccPrivKey.NewDecryptingReader(src)
+		return r, headerReadError(err)
+	case AlgoKyber:
 		kybPrivKey, err := privateKey.getKybPrivKey()
 		if err != nil {
 			return nil, err
 		}
-		return kybPrivKey.NewDecryptingReader(src)
-	case algoHybrid:
+		r, err := kybPrivKey.NewDecryptingReader(src)
+		return r, headerReadError(err)
+	case AlgoHybrid:
 		hybPrivKey, err := privateKey.getHybPrivKey()
 		if err != nil {
 			return nil, err
 		}
-		return hybPrivKey.NewDecryptingReader(src)
+		r, err := hybPrivKey.NewDecryptingReader(src)
+		return r, headerReadError(err)
+	case AlgoHybrid768:
+		hybPrivKey, err := privateKey.getHyb768PrivKey()
+		if err != nil {
+			return nil, err
+		}
+		r, err := hybPrivKey.NewDecryptingReader(src)
+		return r, headerReadError(err)
+	case AlgoSSHEd25519:
+		r, err := privateKey.newSSHDecryptingReader(src)
+		return r, headerReadError(err)
 	default:
 		return nil, errInvalidAlgorithm
 	}
 }
+
+// headerReadError reports a short read of the key encapsulation header as
+// truncation, so callers see the same error no matter which algorithm failed.
+func headerReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", xcp.ErrTruncated, err)
+	}
+	return err
+}
@@ -11,13 +11,19 @@ import (
 
 // PrivateKey represents a private key.
 type PrivateKey struct {
-	key        []byte
-	eccPrivKey *ecc.PrivateKey
-	kybPrivKey *kyb.PrivateKey
-	hybPrivKey *hyb.PrivateKey
-	pubKeyECC  *PublicKey
-	pubKeyKyb  *PublicKey
-	pubKeyHyb  *PublicKey
+	key           []byte
+	eccPrivKey    *ecc.PrivateKey
+	kybPrivKey    *kyb.PrivateKey
+	kyb768PrivKey *kyb.PrivateKey
+	hybPrivKey    *hyb.PrivateKey
+	hyb768PrivKey *hyb.PrivateKey
+	pubKeyECC     *PublicKey
+	pubKeyKyb     *PublicKey
+	pubKeyHyb     *PublicKey
+	pubKeyHyb768  *PublicKey
+	sshPrivKey    *ecc.PrivateKey // Set for keys created from an SSH Ed25519 key
+	pubKeySSH     *PublicKey
+	x25519Only    bool // Set for keys created from a raw X25519 scalar
 }
 
 // PublicKey represents a public key.
@@ -25,6 +31,7 @@ type PublicKey struct {
 	ePub *ecc.PublicKey
 	kPub *kyb.PublicKey
 	hPub *hyb.PublicKey
+	sPub *sshPublicKey
 }
 
 // Bytes returns the bytes of the private key.
@@ -74,6 +81,32 @@ func (privateKey *PrivateKey) getKybPrivKey() (*kyb.PrivateKey, error) {
 	return privateKey.kybPrivKey, nil
 }
 
+func (privateKey *PrivateKey) getKyb768PrivKey() (*kyb.PrivateKey, error) {
+	if privateKey.kyb768PrivKey == nil {
+		kybPrivKey, err := kyb.NewPrivateKey768ForSeed(privateKey.key)
+		if err != nil {
+			return nil, err
+		}
+		privateKey.kyb768PrivKey = kybPrivKey
+	}
+	return privateKey.kyb768PrivKey, nil
+}
+
+func (privateKey *PrivateKey) getHyb768PrivKey() (*hyb.PrivateKey, error) {
+	if privateKey.hyb768PrivKey == nil {
+		eccPrivKey, err := privateKey.getEccPrivKey()
+		if err != nil {
+			return nil, err
+		}
+		kybPrivKey, err := privateKey.getKyb768PrivKey()
+		if err != nil {
+			return nil, err
+		}
+		privateKey.hyb768PrivKey = hyb.NewPrivateKey(eccPrivKey, kybPrivKey)
+	}
+	return privateKey.hyb768PrivKey, nil
+}
+
 func (privateKey *PrivateKey) getHybPrivKey() (*hyb.PrivateKey, error) {
 	if privateKey.hybPrivKey == nil {
 		eccPrivKey, err := privateKey.getEccPrivKey()
@@ -92,8 +125,7 @@ func (privateKey *PrivateKey) getHybPrivKey() (*hyb.PrivateKey, error) {
 // PublicKey returns the ecc public key corresponding to the private key. The public key is derived from the private key.
 func (privateKey *PrivateKey) PublicKeyECC() (*PublicKey, error) {
 	if privateKey.pubKeyECC == nil {
-		eccPrivKeyBytes := sha256.Sum256(privateKey.key)
-		eccPrivKey, err := ecc.ParsePrivateKey(eccPrivKeyBytes[:])
+		eccPrivKey, err := privateKey.getEccPrivKey()
 		if err != nil {
 			return nil, err
 		}
@@ -144,17 +176,61 @@ func (privateKey *PrivateKey) PublicKeyHybrid() (*PublicKey, error) {
 	return privateKey.pubKeyHyb, nil
 }
 
-// Bytes returns the public key as bytes.
-func (publicKey *PublicKey) Bytes() ([]byte, error) {
+// PublicKeyHybrid768 returns the hybrid (ECC + Kyber-768) public key corresponding to the private key. The public key is derived from the private key.
+func (privateKey *PrivateKey) PublicKeyHybrid768() (*PublicKey, error) {
+	if privateKey.pubKeyHyb768 == nil {
+		eccPubKey, err := privateKey.PublicKeyECC()
+		if err != nil {
+			return nil, err
+		}
+		kybPrivKey, err := privateKey.getKyb768PrivKey()
+		if err != nil {
+			return nil, err
+		}
+		kybPubKey, err := kybPrivKey.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		privateKey.pubKeyHyb768 = &PublicKey{
+			hPub: hyb.NewPublicKey(eccPubKey.ePub, kybPubKey),
+		}
+	}
+	return privateKey.pubKeyHyb768, nil
+}
+
+// Algorithm returns the algorithm type of the public key.
+func (publicKey *PublicKey) Algorithm() (uint8, error) {
 	if publicKey.ePub != nil {
-		return append([]byte{algoECC}, publicKey.ePub.Bytes()...), nil
+		return AlgoECC, nil
 	} else if publicKey.kPub != nil {
-		kybPubKeyBytes := publicKey.kPub.Bytes()
-		return append([]byte{algoKyber}, kybPubKeyBytes...), nil
+		return AlgoKyber, nil
 	} else if publicKey.hPub != nil {
-		return append([]byte{algoHybrid}, publicKey.hPub.Bytes()...), nil
+		if publicKey.hPub.Is768() {
+			return AlgoHybrid768, nil
+		}
+		return AlgoHybrid, nil
+	} else if publicKey.sPub != nil {
+		return AlgoSSHEd25519, nil
 	} else {
-		return nil, errInvalidPublicKey
+		return 0, errInvalidPublicKey
+	}
+}
+
+// Bytes returns the public key as bytes.
+func (publicKey *PublicKey) Bytes() ([]byte, error) {
+	algo, err := publicKey.Algorithm()
+	if err != nil {
+		return nil, err
+	}
+	switch algo {
+	case AlgoECC:
+		return append([]byte{algo}, publicKey.ePub.Bytes()...), nil
+	case AlgoKyber:
+		return append([]byte{algo}, publicKey.kPub.Bytes()...), nil
+	case AlgoSSHEd25519:
+		return append([]byte{algo}, publicKey.sPub.edPub...), nil
+	default:
+		return append([]byte{algo}, publicKey.hPub.Bytes()...), nil
 	}
 }
 
@@ -164,7 +240,7 @@ func ParsePublicKey(key []byte) (*PublicKey, error) {
 		return nil, errInvalidPublicKeyLength
 	}
 	switch key[0] {
-	case algoECC:
+	case AlgoECC:
 		eccPubKey, err := ecc.ParsePublicKey(key[1:])
 		if err != nil {
 			return nil, err
@@ -172,7 +248,7 @@ func ParsePublicKey(key []byte) (*PublicKey, error) {
 		return &PublicKey{
 			ePub: eccPubKey,
 		}, nil
-	case algoKyber:
+	case AlgoKyber:
 		kybPubKey, err := kyb.ParsePublicKey(key[1:])
 		if err != nil {
 			return nil, err
@@ -180,7 +256,7 @@ func ParsePublicKey(key []byte) (*PublicKey, error) {
 		return &PublicKey{
 			kPub: kybPubKey,
 		}, nil
-	case algoHybrid:
+	case AlgoHybrid:
 		hybPubKey, err := hyb.ParsePublicKey(key[1:])
 		if err != nil {
 			return nil, err
@@ -188,6 +264,16 @@ func ParsePublicKey(key []byte) (*PublicKey, error) {
 		return &PublicKey{
 			hPub: hybPubKey,
 		}, nil
+	case AlgoHybrid768:
+		hybPubKey, err := hyb.ParsePublicKey768(key[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &PublicKey{
+			hPub: hybPubKey,
+		}, nil
+	case AlgoSSHEd25519:
+		return NewPublicKeySSHEd25519(key[1:])
 	default:
 		return nil, errInvalidPublicKey
 	}
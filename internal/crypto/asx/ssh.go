@@ -0,0 +1,178 @@
+package asx
+
+import (
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"math/big"
+
+	"xipher.org/xipher/internal/crypto/ecc"
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+// sshLabel is the domain-separation label for keys derived for SSH Ed25519
+// recipients. It must differ from any other construction's label.
+const sshLabel = "xipher/ssh-ed25519-x25519/v1"
+
+var (
+	// fieldPrime is the prime 2^255 - 19 of the field Curve25519 and Ed25519 are defined over.
+	fieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	// edwardsD is the constant d = -121665/121666 of the Ed25519 curve equation.
+	edwardsD = new(big.Int).Mod(new(big.Int).Mul(big.NewInt(-121665), new(big.Int).ModInverse(big.NewInt(121666), fieldPrime)), fieldPrime)
+)
+
+// sshPublicKey is an SSH Ed25519 public key along with its X25519 form.
+type sshPublicKey struct {
+	edPub []byte
+	ePub  *ecc.PublicKey
+}
+
+// edwardsToMontgomery converts an Ed25519 public key to the X25519 public key
+// of the same point, u = (1 + y) / (1 - y), the birational map used by age and
+// libsodium. It rejects encodings that are not points on the curve.
+func edwardsToMontgomery(edPub []byte) ([]byte, error) {
+	if len(edPub) != ed25519.PublicKeySize {
+		return nil, errInvalidSSHKey
+	}
+	le := make([]byte, len(edPub))
+	for i, b := range edPub {
+		le[len(edPub)-1-i] = b
+	}
+	le[0] &= 0x7f // The top bit holds the sign of x
+	y := new(big.Int).SetBytes(le)
+	one := big.NewInt(1)
+	if y.Cmp(fieldPrime) >= 0 || y.Cmp(one) == 0 {
+		return nil, errInvalidSSHKey
+	}
+	// The point exists if x^2 = (y^2 - 1) / (d y^2 + 1) has a square root.
+	y2 := new(big.Int).Mul(y, y)
+	num := new(big.Int).Sub(y2, one)
+	den := new(big.Int).Add(new(big.Int).Mul(edwardsD, y2), one)
+	x2 := new(big.Int).Mul(num, new(big.Int).ModInverse(den.Mod(den, fieldPrime), fieldPrime))
+	x2.Mod(x2, fieldPrime)
+	legendreExp := new(big.Int).Rsh(new(big.Int).Sub(fieldPrime, one), 1)
+	if x2.Sign() != 0 && new(big.Int).Exp(x2, legendreExp, fieldPrime).Cmp(one) != 0 {
+		return nil, errInvalidSSHKey
+	}
+	oneMinusY := new(big.Int).Sub(one, y)
+	u := new(big.Int).Add(one, y)
+	u.Mul(u, new(big.Int).ModInverse(oneMinusY.Mod(oneMinusY, fieldPrime), fieldPrime))
+	u.Mod(u, fieldPrime)
+	ub := u.FillBytes(make([]byte, ecc.KeyLength))
+	for i, j := 0, len(ub)-1; i < j; i, j = i+1, j-1 {
+		ub[i], ub[j] = ub[j], ub[i]
+	}
+	return ub, nil
+}
+
+// NewPublicKeySSHEd25519 returns the public key for an SSH Ed25519 public key.
+func NewPublicKeySSHEd25519(edPub []byte) (*PublicKey, error) {
+	x25519Pub, err := edwardsToMontgomery(edPub)
+	if err != nil {
+		return nil, err
+	}
+	eccPubKey, err := ecc.ParsePublicKey(x25519Pub)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{
+		sPub: &sshPublicKey{
+			edPub: append([]byte(nil), edPub...),
+			ePub:  eccPubKey,
+		},
+	}, nil
+}
+
+// NewPrivateKeySSHEd25519 returns the private key for the 32-byte seed of an
+// SSH Ed25519 private key. It only decrypts data encrypted for the matching
+// SSH public key.
+func NewPrivateKeySSHEd25519(seed []byte) (*PrivateKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errInvalidSSHKey
+	}
+	// The X25519 scalar is the clamped first half of the hashed seed, as for Ed25519 signing.
+	h := sha512.Sum512(seed)
+	sshPrivKey, err := ecc.ParsePrivateKey(h[:ecc.KeyLength])
+	if err != nil {
+		return nil, err
+	}
+	edPub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	pubKeySSH, err := NewPublicKeySSHEd25519(edPub)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{
+		key:        append([]byte(nil), seed...),
+		sshPrivKey: sshPrivKey,
+		pubKeySSH:  pubKeySSH,
+	}, nil
+}
+
+// IsSSHEd25519 reports whether the private key was created from an SSH Ed25519 key.
+func (privateKey *PrivateKey) IsSSHEd25519() bool {
+	return privateKey.sshPrivKey != nil
+}
+
+// PublicKeySSHEd25519 returns the SSH Ed25519 public key of a private key created with NewPrivateKeySSHEd25519.
+func (privateKey *PrivateKey) PublicKeySSHEd25519() (*PublicKey, error) {
+	if privateKey.pubKeySSH == nil {
+		return nil, errInvalidSSHKey
+	}
+	return privateKey.pubKeySSH, nil
+}
+
+// deriveSSHKey derives the symmetric key from the X25519 shared secret, binding
+// the ephemeral key, the recipient's X25519 key and its Ed25519 key into it.
+func deriveSSHKey(sharedKey, ephPubKey []byte, sPub *sshPublicKey) ([]byte, error) {
+	ikm := make([]byte, 0, len(sharedKey)+len(ephPubKey)+ecc.KeyLength+len(sPub.edPub))
+	ikm = append(ikm, sharedKey...)
+	ikm = append(ikm, ephPubKey...)
+	ikm = append(ikm, sPub.ePub.Bytes()...)
+	ikm = append(ikm, sPub.edPub...)
+	return hkdf.Key(sha256.New, ikm, nil, sshLabel, xcp.KeyLength)
+}
+
+// newEncryptingWriter encrypts for the SSH public key, writing the X25519
+// ephemeral public key followed by the symmetric ciphertext.
+func (sPub *sshPublicKey) newEncryptingWriter(dst io.Writer, compress bool, opts ...xcp.WriterOption) (io.WriteCloser, error) {
+	ephPubKey, sharedKey, err := sPub.ePub.Encapsulate()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveSSHKey(sharedKey, ephPubKey, sPub)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dst.Write(ephPubKey); err != nil {
+		return nil, err
+	}
+	cipher, err := xcp.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewEncryptingWriter(dst, compress, opts...)
+}
+
+// newSSHDecryptingReader reads the ephemeral public key from src and returns a
+// reader that decrypts the rest with the SSH private key.
+func (privateKey *PrivateKey) newSSHDecryptingReader(src io.Reader) (io.Reader, error) {
+	ephPubKey := make([]byte, ecc.KeyLength)
+	if _, err := io.ReadFull(src, ephPubKey); err != nil {
+		return nil, err
+	}
+	sharedKey, err := privateKey.sshPrivKey.Decapsulate(ephPubKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveSSHKey(sharedKey, ephPubKey, privateKey.pubKeySSH.sPub)
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := xcp.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return decrypter.NewDecryptingReader(src)
+}
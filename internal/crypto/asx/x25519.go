@@ -0,0 +1,27 @@
+package asx
+
+import "xipher.org/xipher/internal/crypto/ecc"
+
+// NewPrivateKeyX25519 returns the private key for a raw X25519 scalar, such as
+// that of an age identity. It only decrypts data encrypted with AlgoECC and
+// only derives its ECC public key.
+func NewPrivateKeyX25519(scalar []byte) (*PrivateKey, error) {
+	eccPrivKey, err := ecc.ParsePrivateKey(append([]byte(nil), scalar...))
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{
+		key:        eccPrivKey.Bytes(),
+		eccPrivKey: eccPrivKey,
+		x25519Only: true,
+	}, nil
+}
+
+// X25519 returns the X25519 scalar the private key uses for AlgoECC.
+func (privateKey *PrivateKey) X25519() ([]byte, error) {
+	eccPrivKey, err := privateKey.getEccPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	return eccPrivKey.Bytes(), nil
+}
@@ -7,7 +7,7 @@ import (
 )
 
 // NewEncryptingWriter returns a new WriteCloser that encrypts data with the public key and writes to dst.
-func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (io.WriteCloser, error) {
+func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool, opts ...xcp.WriterOption) (io.WriteCloser, error) {
 	ephPubKey, sharedKey, err := publicKey.Encapsulate()
 	if err != nil {
 		return nil, err
@@ -19,7 +19,7 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (i
 	if err != nil {
 		return nil, err
 	}
-	return cipher.NewEncryptingWriter(dst, compress)
+	return cipher.NewEncryptingWriter(dst, compress, opts...)
 }
 
 // NewDecryptingReader returns a new Reader that reads and decrypts data with the private key from src.
@@ -15,25 +15,36 @@ import (
 // HKDF-SHA256). It must differ from any other construction's label.
 const hybLabel = "xipher/hybrid-x25519-mlkem1024/v1"
 
+// hybLabel768 is the domain-separation label for the X25519 + ML-KEM-768 combiner.
+const hybLabel768 = "xipher/hybrid-x25519-mlkem768/v1"
+
 // deriveKey combines the ECC and Kyber shared secrets into a single symmetric key
 // using an X-Wing-style HKDF-SHA256 combiner. The transcript (the X25519 ephemeral
 // public key, the recipient's X25519 public key, and the ML-KEM ciphertext) is
 // bound into the key material so the derived key is tied to this exact exchange.
-func deriveKey(eccSS, kybSS, eccEph, recipientEccPub, kybCt []byte) ([]byte, error) {
+func deriveKey(label string, eccSS, kybSS, eccEph, recipientEccPub, kybCt []byte) ([]byte, error) {
 	ikm := make([]byte, 0, len(eccSS)+len(kybSS)+len(eccEph)+len(recipientEccPub)+len(kybCt))
 	ikm = append(ikm, eccSS...)
 	ikm = append(ikm, kybSS...)
 	ikm = append(ikm, eccEph...)
 	ikm = append(ikm, recipientEccPub...)
 	ikm = append(ikm, kybCt...)
-	return hkdf.Key(sha256.New, ikm, nil, hybLabel, xcp.KeyLength)
+	return hkdf.Key(sha256.New, ikm, nil, label, xcp.KeyLength)
+}
+
+// label returns the combiner label for the ML-KEM parameter set of kPub.
+func label(kPub *kyb.PublicKey) string {
+	if kPub.Is768() {
+		return hybLabel768
+	}
+	return hybLabel
 }
 
 // NewEncryptingWriter returns a new WriteCloser that encrypts data with the hybrid
 // public key and writes to dst. It encapsulates against both the ECC and Kyber
 // public keys, writes the X25519 ephemeral public key followed by the ML-KEM
 // ciphertext, then streams the symmetric ciphertext under the combined key.
-func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (io.WriteCloser, error) {
+func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool, opts ...xcp.WriterOption) (io.WriteCloser, error) {
 	eccEph, eccSS, err := publicKey.ePub.Encapsulate()
 	if err != nil {
 		return nil, err
@@ -42,7 +53,7 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (i
 	if err != nil {
 		return nil, err
 	}
-	key, err := deriveKey(eccSS, kybSS, eccEph, publicKey.ePub.Bytes(), kybCt)
+	key, err := deriveKey(label(publicKey.kPub), eccSS, kybSS, eccEph, publicKey.ePub.Bytes(), kybCt)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +67,7 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (i
 	if err != nil {
 		return nil, err
 	}
-	return cipher.NewEncryptingWriter(dst, compress)
+	return cipher.NewEncryptingWriter(dst, compress, opts...)
 }
 
 // NewDecryptingReader returns a new Reader that reads and decrypts data with the
@@ -68,7 +79,7 @@ func (privateKey *PrivateKey) NewDecryptingReader(src io.Reader) (io.Reader, err
 	if _, err := io.ReadFull(src, eccEph); err != nil {
 		return nil, err
 	}
-	kybCt := make([]byte, kyb.CiphertextLength)
+	kybCt := make([]byte, privateKey.kybPriv.CiphertextLength())
 	if _, err := io.ReadFull(src, kybCt); err != nil {
 		return nil, err
 	}
@@ -84,7 +95,11 @@ func (privateKey *PrivateKey) NewDecryptingReader(src io.Reader) (io.Reader, err
 	if err != nil {
 		return nil, err
 	}
-	key, err := deriveKey(eccSS, kybSS, eccEph, eccPub.Bytes(), kybCt)
+	kybPub, err := privateKey.kybPriv.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(label(kybPub), eccSS, kybSS, eccEph, eccPub.Bytes(), kybCt)
 	if err != nil {
 		return nil, err
 	}
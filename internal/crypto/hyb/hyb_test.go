@@ -167,3 +167,44 @@ func TestWrongPrivateKeyFails(t *testing.T) {
 		t.Fatal("expected decryption with wrong private key to fail, got nil")
 	}
 }
+
+// TestRoundTrip768 covers the X25519 + ML-KEM-768 variant, including parsing
+// the serialised public key.
+func TestRoundTrip768(t *testing.T) {
+	eccPriv, err := ecc.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("error generating ECC private key: %v", err)
+	}
+	eccPub, err := eccPriv.PublicKey()
+	if err != nil {
+		t.Fatalf("error deriving ECC public key: %v", err)
+	}
+	kybPriv, err := kyb.NewPrivateKey768ForSeed(randomBytes(t, kyb.PrivateKeyLength))
+	if err != nil {
+		t.Fatalf("error generating Kyber private key: %v", err)
+	}
+	kybPub, err := kybPriv.PublicKey()
+	if err != nil {
+		t.Fatalf("error deriving Kyber public key: %v", err)
+	}
+	privKey := NewPrivateKey(eccPriv, kybPriv)
+	pubKey, err := ParsePublicKey768(NewPublicKey(eccPub, kybPub).Bytes())
+	if err != nil {
+		t.Fatalf("error parsing public key: %v", err)
+	}
+	if !pubKey.Is768() || len(pubKey.Bytes()) != PublicKeyLength768 {
+		t.Fatalf("expected hybrid-768 public key of %d bytes", PublicKeyLength768)
+	}
+	data := randomBytes(t, 4096)
+	r, err := privKey.NewDecryptingReader(bytes.NewReader(encrypt(t, pubKey, data, false)))
+	if err != nil {
+		t.Fatalf("error creating decrypting reader: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading decrypted data: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("round-trip mismatch")
+	}
+}
@@ -1,11 +1,11 @@
 // Package hyb implements a hybrid key encapsulation mechanism that combines
-// classical X25519 (ECC) with post-quantum ML-KEM-1024 (Kyber). The two shared
-// secrets are bound together with an X-Wing-style HKDF combiner so that the
-// derived symmetric key remains secure as long as either primitive holds.
+// classical X25519 (ECC) with post-quantum ML-KEM-1024 or ML-KEM-768 (Kyber).
+// The two shared secrets are bound together with an X-Wing-style HKDF combiner
+// so that the derived symmetric key remains secure as long as either primitive holds.
 //
-// This construction is X-Wing-style but is NOT RFC X-Wing: it targets
-// ML-KEM-1024 (rather than ML-KEM-768) and uses HKDF-SHA256 (rather than
-// SHA3-256). It carries its own domain-separation label accordingly.
+// This construction is X-Wing-style but is NOT RFC X-Wing: it uses HKDF-SHA256
+// (rather than SHA3-256), and also supports ML-KEM-1024. Each parameter set
+// carries its own domain-separation label accordingly.
 package hyb
 
 import (
@@ -19,9 +19,15 @@ const (
 	// PublicKeyLength is the length of the hybrid public key: the X25519 public
 	// key concatenated with the ML-KEM-1024 public key.
 	PublicKeyLength = ecc.KeyLength + kyb.PublicKeyLength
+	// PublicKeyLength768 is the length of the hybrid public key: the X25519 public
+	// key concatenated with the ML-KEM-768 public key.
+	PublicKeyLength768 = ecc.KeyLength + kyb.PublicKeyLength768
 )
 
-var errInvalidPublicKeyLength = fmt.Errorf("invalid public key length [please use %d bytes]", PublicKeyLength)
+var (
+	errInvalidPublicKeyLength    = fmt.Errorf("invalid public key length [please use %d bytes]", PublicKeyLength)
+	errInvalidPublicKeyLength768 = fmt.Errorf("invalid public key length [please use %d bytes]", PublicKeyLength768)
+)
 
 // PublicKey represents a hybrid public key combining ECC and Kyber public keys.
 type PublicKey struct {
@@ -52,11 +58,16 @@ func NewPrivateKey(eccPriv *ecc.PrivateKey, kybPriv *kyb.PrivateKey) *PrivateKey
 }
 
 // Bytes returns the hybrid public key as the X25519 public key followed by the
-// ML-KEM-1024 public key.
+// ML-KEM public key.
 func (publicKey *PublicKey) Bytes() []byte {
 	return append(publicKey.ePub.Bytes(), publicKey.kPub.Bytes()...)
 }
 
+// Is768 reports whether the public key uses ML-KEM-768 rather than ML-KEM-1024.
+func (publicKey *PublicKey) Is768() bool {
+	return publicKey.kPub.Is768()
+}
+
 // ParsePublicKey parses a hybrid public key from its byte representation.
 // The input must be exactly PublicKeyLength bytes: the X25519 public key
 // followed by the ML-KEM-1024 public key.
@@ -77,3 +88,23 @@ func ParsePublicKey(key []byte) (*PublicKey, error) {
 		kPub: kPub,
 	}, nil
 }
+
+// ParsePublicKey768 parses an X25519 + ML-KEM-768 hybrid public key from its byte
+// representation. The input must be exactly PublicKeyLength768 bytes.
+func ParsePublicKey768(key []byte) (*PublicKey, error) {
+	if len(key) != PublicKeyLength768 {
+		return nil, errInvalidPublicKeyLength768
+	}
+	ePub, err := ecc.ParsePublicKey(key[:ecc.KeyLength])
+	if err != nil {
+		return nil, err
+	}
+	kPub, err := kyb.ParsePublicKey768(key[ecc.KeyLength:])
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{
+		ePub: ePub,
+		kPub: kPub,
+	}, nil
+}
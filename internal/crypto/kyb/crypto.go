@@ -7,7 +7,7 @@ import (
 )
 
 // NewEncryptingWriter returns a new WriteCloser that encrypts data with the public key and writes to dst.
-func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (io.WriteCloser, error) {
+func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool, opts ...xcp.WriterOption) (io.WriteCloser, error) {
 	keyEnc, sharedKey, err := publicKey.Encapsulate()
 	if err != nil {
 		return nil, err
@@ -19,12 +19,12 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress bool) (i
 	if err != nil {
 		return nil, err
 	}
-	return cipher.NewEncryptingWriter(dst, compress)
+	return cipher.NewEncryptingWriter(dst, compress, opts...)
 }
 
 // NewDecryptingReader returns a new Reader that reads and decrypts data with the private key from src.
 func (privateKey *PrivateKey) NewDecryptingReader(src io.Reader) (io.Reader, error) {
-	keyEnc := make([]byte, CiphertextLength)
+	keyEnc := make([]byte, privateKey.ctLength)
 	if _, err := io.ReadFull(src, keyEnc); err != nil {
 		return nil, err
 	}
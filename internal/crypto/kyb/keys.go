@@ -13,23 +13,41 @@ const (
 	PublicKeyLength = mlkem.EncapsulationKeySize1024
 	// CiphertextLength is the length of the Kyber-1024 encapsulated key (ciphertext).
 	CiphertextLength = mlkem.CiphertextSize1024
+	// PublicKeyLength768 is the length of the Kyber-768 public key.
+	PublicKeyLength768 = mlkem.EncapsulationKeySize768
+	// CiphertextLength768 is the length of the Kyber-768 encapsulated key (ciphertext).
+	CiphertextLength768 = mlkem.CiphertextSize768
 )
 
 var (
-	errInvalidPrivateKeyLength = fmt.Errorf("invalid private key lengths [please use %d bytes]", PrivateKeyLength)
-	errInvalidPublicKeyLength  = fmt.Errorf("invalid public key lengths [please use %d bytes]", PublicKeyLength)
+	errInvalidPrivateKeyLength   = fmt.Errorf("invalid private key lengths [please use %d bytes]", PrivateKeyLength)
+	errInvalidPublicKeyLength    = fmt.Errorf("invalid public key lengths [please use %d bytes]", PublicKeyLength)
+	errInvalidPublicKeyLength768 = fmt.Errorf("invalid public key lengths [please use %d bytes]", PublicKeyLength768)
 )
 
+// encapsulationKey is implemented by the ML-KEM-768 and ML-KEM-1024 encapsulation keys.
+type encapsulationKey interface {
+	Bytes() []byte
+	Encapsulate() (sharedKey, ciphertext []byte)
+}
+
+// decapsulationKey is implemented by the ML-KEM-768 and ML-KEM-1024 decapsulation keys.
+type decapsulationKey interface {
+	Decapsulate(ciphertext []byte) (sharedKey []byte, err error)
+}
+
 // PrivateKey represents a private key.
 type PrivateKey struct {
 	seed      []byte
-	sk        *mlkem.DecapsulationKey1024
+	sk        decapsulationKey
+	ctLength  int
 	publicKey *PublicKey
 }
 
 // PublicKey represents a public key.
 type PublicKey struct {
-	pk *mlkem.EncapsulationKey1024
+	pk       encapsulationKey
+	ctLength int
 }
 
 // Bytes returns the bytes of the private key.
@@ -46,7 +64,7 @@ func NewPrivateKey() (*PrivateKey, error) {
 	return NewPrivateKeyForSeed(key)
 }
 
-// NewPrivateKeyForSeed returns the instance private key for given bytes. Please use exactly 64 bytes.
+// NewPrivateKeyForSeed returns the ML-KEM-1024 private key for given bytes. Please use exactly 64 bytes.
 func NewPrivateKeyForSeed(keySeed []byte) (*PrivateKey, error) {
 	if len(keySeed) != PrivateKeyLength {
 		return nil, errInvalidPrivateKeyLength
@@ -56,26 +74,47 @@ func NewPrivateKeyForSeed(keySeed []byte) (*PrivateKey, error) {
 		return nil, err
 	}
 	return &PrivateKey{
-		seed: keySeed,
-		sk:   sk,
+		seed:     keySeed,
+		sk:       sk,
+		ctLength: CiphertextLength,
 		publicKey: &PublicKey{
-			pk: sk.EncapsulationKey(),
+			pk:       sk.EncapsulationKey(),
+			ctLength: CiphertextLength,
+		},
+	}, nil
+}
+
+// NewPrivateKey768ForSeed returns the ML-KEM-768 private key for given bytes. Please use exactly 64 bytes.
+func NewPrivateKey768ForSeed(keySeed []byte) (*PrivateKey, error) {
+	if len(keySeed) != PrivateKeyLength {
+		return nil, errInvalidPrivateKeyLength
+	}
+	sk, err := mlkem.NewDecapsulationKey768(keySeed)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{
+		seed:     keySeed,
+		sk:       sk,
+		ctLength: CiphertextLength768,
+		publicKey: &PublicKey{
+			pk:       sk.EncapsulationKey(),
+			ctLength: CiphertextLength768,
 		},
 	}, nil
 }
 
 // PublicKey returns the public key corresponding to the private key. The public key is derived from the private key.
 func (privateKey *PrivateKey) PublicKey() (*PublicKey, error) {
-	if privateKey.publicKey == nil {
-		privateKey.sk.EncapsulationKey()
-		privateKey.publicKey = &PublicKey{
-			pk: privateKey.sk.EncapsulationKey(),
-		}
-	}
 	return privateKey.publicKey, nil
 }
 
-// ParsePublicKey returns the instance of public key for given bytes. Please use exactly 32 bytes.
+// CiphertextLength returns the length of the encapsulated keys this private key decapsulates.
+func (privateKey *PrivateKey) CiphertextLength() int {
+	return privateKey.ctLength
+}
+
+// ParsePublicKey returns the ML-KEM-1024 public key for given bytes. Please use exactly PublicKeyLength bytes.
 func ParsePublicKey(keyBytes []byte) (*PublicKey, error) {
 	if len(keyBytes) != PublicKeyLength {
 		return nil, errInvalidPublicKeyLength
@@ -85,7 +124,23 @@ func ParsePublicKey(keyBytes []byte) (*PublicKey, error) {
 		return nil, err
 	}
 	return &PublicKey{
-		pk: pk,
+		pk:       pk,
+		ctLength: CiphertextLength,
+	}, nil
+}
+
+// ParsePublicKey768 returns the ML-KEM-768 public key for given bytes. Please use exactly PublicKeyLength768 bytes.
+func ParsePublicKey768(keyBytes []byte) (*PublicKey, error) {
+	if len(keyBytes) != PublicKeyLength768 {
+		return nil, errInvalidPublicKeyLength768
+	}
+	pk, err := mlkem.NewEncapsulationKey768(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{
+		pk:       pk,
+		ctLength: CiphertextLength768,
 	}, nil
 }
 
@@ -94,7 +149,12 @@ func (publicKey *PublicKey) Bytes() []byte {
 	return publicKey.pk.Bytes()
 }
 
-// Encapsulate performs ML-KEM-1024 encapsulation against the public key.
+// Is768 reports whether the public key is an ML-KEM-768 key rather than ML-KEM-1024.
+func (publicKey *PublicKey) Is768() bool {
+	return publicKey.ctLength == CiphertextLength768
+}
+
+// Encapsulate performs ML-KEM encapsulation against the public key.
 // It returns the encapsulated key (ciphertext, to be sent to the recipient)
 // along with the derived shared secret.
 func (publicKey *PublicKey) Encapsulate() (keyEnc, sharedKey []byte, err error) {
@@ -102,7 +162,7 @@ func (publicKey *PublicKey) Encapsulate() (keyEnc, sharedKey []byte, err error)
 	return keyEnc, sharedKey, nil
 }
 
-// Decapsulate recovers the shared secret from an ML-KEM-1024 encapsulated key using the private key.
+// Decapsulate recovers the shared secret from an ML-KEM encapsulated key using the private key.
 func (privateKey *PrivateKey) Decapsulate(keyEnc []byte) (sharedKey []byte, err error) {
 	return privateKey.sk.Decapsulate(keyEnc)
 }
@@ -110,3 +110,40 @@ func TestDecapsulateInvalidCiphertext(t *testing.T) {
 		t.Error("expected error decapsulating wrong-length ciphertext, got nil")
 	}
 }
+
+// TestKyber768Agreement verifies the ML-KEM-768 parameter set derived from the
+// same seed encapsulates and decapsulates with its own sizes.
+func TestKyber768Agreement(t *testing.T) {
+	privKey, err := NewPrivateKey768ForSeed(testSeed(t))
+	if err != nil {
+		t.Fatalf("error creating private key: %v", err)
+	}
+	pubKey, err := privKey.PublicKey()
+	if err != nil {
+		t.Fatalf("error deriving public key: %v", err)
+	}
+	if !pubKey.Is768() || len(pubKey.Bytes()) != PublicKeyLength768 {
+		t.Fatalf("expected ML-KEM-768 public key of %d bytes, got %d", PublicKeyLength768, len(pubKey.Bytes()))
+	}
+	parsed, err := ParsePublicKey768(pubKey.Bytes())
+	if err != nil {
+		t.Fatalf("error parsing public key: %v", err)
+	}
+	keyEnc, encSharedKey, err := parsed.Encapsulate()
+	if err != nil {
+		t.Fatalf("error encapsulating: %v", err)
+	}
+	if len(keyEnc) != CiphertextLength768 || privKey.CiphertextLength() != CiphertextLength768 {
+		t.Fatalf("expected ciphertext length %d, got %d", CiphertextLength768, len(keyEnc))
+	}
+	decSharedKey, err := privKey.Decapsulate(keyEnc)
+	if err != nil {
+		t.Fatalf("error decapsulating: %v", err)
+	}
+	if !bytes.Equal(encSharedKey, decSharedKey) {
+		t.Fatal("encapsulated and decapsulated shared secrets do not match")
+	}
+	if _, err := ParsePublicKey(pubKey.Bytes()); err == nil {
+		t.Fatal("expected ML-KEM-1024 parser to reject an ML-KEM-768 key")
+	}
+}
@@ -4,49 +4,117 @@ import (
 	"bytes"
 	"compress/zlib"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
 
+// Stream flags, stored in the byte that follows the nonce.
+const (
+	// flagCompress marks a zlib-compressed stream.
+	flagCompress byte = 0x01
+	// flagFramed marks a stream whose chunks use a counter nonce and carry the
+	// stream flags and a final-chunk marker as additional data. Streams without
+	// it (written by older versions) reuse the nonce for every chunk and cannot
+	// detect truncation at a chunk boundary.
+	flagFramed byte = 0x02
+	// flagPadded marks a stream whose chunks are prefixed with the length of the
+	// data they carry and padded with zeros, see WithPadding.
+	flagPadded byte = 0x04
+	// flagHeader marks a stream whose plaintext starts with a length-prefixed
+	// header, see WithHeader.
+	flagHeader byte = 0x08
+
+	knownFlags = flagCompress | flagFramed | flagPadded | flagHeader
+)
+
 type Writer struct {
 	aead    cipher.AEAD
 	dst     io.Writer
 	buf     bytes.Buffer
 	nonce   []byte
+	flags   byte
+	counter uint64
 	zWriter *zlib.Writer
+	pad     PadFunc
+	written int64
+	header  []byte
+
+	nonceKey     []byte // Key of the synthetic nonce, nil for a given or random nonce
+	nonceContext []byte // Context bound into the synthetic nonce
+	deferred     bool   // Whether the nonce and flags are yet to be written
 }
 
 // NewEncryptingWriter returns a new io.WriteCloser that encrypts data with the cipher and writes to dst.
-func (cipher *SymmetricCipher) NewEncryptingWriter(dst io.Writer, compress bool) (io.WriteCloser, error) {
-	nonce := make([]byte, nonceLength)
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
+func (cipher *SymmetricCipher) NewEncryptingWriter(dst io.Writer, compress bool, opts ...WriterOption) (io.WriteCloser, error) {
+	return cipher.newWriter(dst, compress, opts...)
+}
+
+// WithNonce encrypts the stream with the given NonceLength-byte nonce instead of
+// a random one. A nonce must never be used for two different plaintexts with the
+// same key, so it should be derived from the key and the whole plaintext.
+func WithNonce(nonce []byte) WriterOption {
+	return func(w *Writer) {
+		w.nonce = nonce
 	}
-	if _, err := dst.Write(nonce); err != nil {
-		return nil, err
+}
+
+// WithSyntheticNonce derives the nonce of the stream from key and everything the
+// stream seals: context, the stream flags, the padded length and the
+// (compressed) plaintext, header included. Equal plaintexts encrypted with the
+// same context and options then give equal ciphertexts, and a nonce is never
+// reused for different contents. The stream is buffered in memory and only
+// written on Close. key must be independent of the cipher key.
+func WithSyntheticNonce(key, context []byte) WriterOption {
+	return func(w *Writer) {
+		w.nonceKey = key
+		w.nonceContext = context
 	}
-	return cipher.newWriter(nonce, dst, compress)
 }
 
-func (cipher *SymmetricCipher) newWriter(nonce []byte, dst io.Writer, compress bool) (*Writer, error) {
+func (cipher *SymmetricCipher) newWriter(dst io.Writer, compress bool, opts ...WriterOption) (*Writer, error) {
 	ciphWriter := &Writer{
 		aead:  *cipher.aead,
 		dst:   dst,
 		buf:   bytes.Buffer{},
-		nonce: nonce,
+		flags: flagFramed,
 	}
-	if compress {
-		if _, err := dst.Write([]byte{1}); err != nil {
+	for _, opt := range opts {
+		opt(ciphWriter)
+	}
+	switch {
+	case ciphWriter.nonceKey != nil:
+		if ciphWriter.nonce != nil {
+			return nil, fmt.Errorf("encryption failed: a nonce and a synthetic nonce are both set")
+		}
+		ciphWriter.deferred = true
+	case ciphWriter.nonce == nil:
+		ciphWriter.nonce = make([]byte, nonceLength)
+		if _, err := rand.Read(ciphWriter.nonce); err != nil {
 			return nil, err
 		}
+	case len(ciphWriter.nonce) != nonceLength:
+		return nil, fmt.Errorf("encryption failed: invalid nonce length %d (want %d)", len(ciphWriter.nonce), nonceLength)
+	}
+	if compress {
+		ciphWriter.flags |= flagCompress
 		zWriter, err := zlib.NewWriterLevel(&ciphWriter.buf, zlib.BestCompression)
 		if err != nil {
 			return nil, err
 		}
 		ciphWriter.zWriter = zWriter
-	} else {
-		if _, err := dst.Write([]byte{0}); err != nil {
+	}
+	if !ciphWriter.deferred {
+		if err := ciphWriter.writePrefix(); err != nil {
+			return nil, err
+		}
+	}
+	if ciphWriter.flags&flagHeader != 0 {
+		if err := ciphWriter.writeHeader(); err != nil {
 			return nil, err
 		}
 	}
@@ -62,46 +130,169 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 	if err != nil {
 		return n, fmt.Errorf("encryption failed: %w", err)
 	}
-	return n, w.flush(ptBlockSize)
+	return n, w.flush()
 }
 
-func (w *Writer) flush(minBufSize int) error {
-	for w.buf.Len() >= minBufSize {
-		block := w.buf.Next(ptBlockSize)
-		ct := w.aead.Seal(nil, w.nonce, block, nil)
-		if _, err := w.dst.Write(ct); err != nil {
-			return fmt.Errorf("encryption failed: %w", err)
+// writePrefix writes the nonce and the flags that start the stream.
+func (w *Writer) writePrefix() error {
+	if _, err := w.dst.Write(w.nonce); err != nil {
+		return err
+	}
+	_, err := w.dst.Write([]byte{w.flags})
+	return err
+}
+
+// syntheticNonce derives the nonce of a buffered stream from the nonce key and
+// everything the stream seals.
+func (w *Writer) syntheticNonce() []byte {
+	length := int64(w.buf.Len())
+	padded := length
+	if w.pad != nil {
+		padded = max(w.pad(length), length)
+	}
+	mac := hmac.New(sha256.New, w.nonceKey)
+	mac.Write(binary.AppendUvarint(nil, uint64(len(w.nonceContext))))
+	mac.Write(w.nonceContext)
+	mac.Write([]byte{w.flags})
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(padded)))
+	mac.Write(w.buf.Bytes())
+	return mac.Sum(nil)[:nonceLength]
+}
+
+// flush seals full chunks while more data is buffered behind them, so the
+// last chunk is always left for Close to seal as the final one. Streams with
+// a synthetic nonce are kept buffered until Close.
+func (w *Writer) flush() error {
+	if w.deferred {
+		return nil
+	}
+	for w.buf.Len() > w.dataSize() {
+		if err := w.seal(w.buf.Next(w.dataSize()), false); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// Close flushes the last chunk. It does not close the underlying Writer.
+// dataSize returns the number of data bytes carried by a full chunk.
+func (w *Writer) dataSize() int {
+	if w.pad != nil {
+		return ptBlockSize - padHeaderLength
+	}
+	return ptBlockSize
+}
+
+func (w *Writer) seal(block []byte, final bool) error {
+	w.written += int64(len(block))
+	if w.pad != nil {
+		block = padFrame(block, 0)
+	}
+	return w.sealChunk(block, final)
+}
+
+func (w *Writer) sealChunk(block []byte, final bool) error {
+	ct := w.aead.Seal(nil, chunkNonce(w.nonce, w.counter), block, chunkAD(w.flags, final))
+	w.counter++
+	if _, err := w.dst.Write(ct); err != nil {
+		return fmt.Errorf("encryption failed: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and seals the final chunk. It does not close the underlying Writer.
 func (w *Writer) Close() error {
 	if w.zWriter != nil {
 		if err := w.zWriter.Close(); err != nil {
 			return fmt.Errorf("encryption failed: %w", err)
 		}
 	}
-	return w.flush(1)
+	if w.deferred {
+		w.nonce, w.deferred = w.syntheticNonce(), false
+		if err := w.writePrefix(); err != nil {
+			return fmt.Errorf("encryption failed: %w", err)
+		}
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.pad == nil {
+		return w.seal(w.buf.Next(ptBlockSize), true)
+	}
+	// Fill the last data chunk with padding first and carry on with chunks of
+	// padding only, so the ciphertext size depends only on the padded length.
+	length := w.written + int64(w.buf.Len())
+	fill := max(w.pad(length)-length, 0)
+	for {
+		data := w.buf.Next(w.dataSize())
+		n := int(min(fill, int64(w.dataSize()-len(data))))
+		fill -= int64(n)
+		w.written += int64(len(data))
+		if err := w.sealChunk(padFrame(data, n), fill == 0); err != nil {
+			return err
+		}
+		if fill == 0 {
+			return nil
+		}
+	}
+}
+
+// chunkNonce returns the nonce for the chunk at index counter: the stream nonce
+// with its last 8 bytes XORed with the big-endian counter.
+func chunkNonce(nonce []byte, counter uint64) []byte {
+	n := bytes.Clone(nonce)
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	for i := range c {
+		n[len(n)-8+i] ^= c[i]
+	}
+	return n
+}
+
+// chunkAD returns the additional data that binds a chunk to the stream flags
+// and to its position as the final chunk or not.
+func chunkAD(flags byte, final bool) []byte {
+	if final {
+		return []byte{flags, 1}
+	}
+	return []byte{flags, 0}
+}
+
+// Stats describes a stream read by a decrypting reader.
+type Stats struct {
+	Chunks     int  // Number of authenticated chunks
+	Compressed bool // Whether the stream is compressed
+	Framed     bool // Whether the stream carries a final-chunk marker
+	Padded     bool // Whether the stream is padded to hide its length
 }
 
 type Reader struct {
-	aead  cipher.AEAD
-	src   io.Reader
-	buf   bytes.Buffer
-	nonce []byte
+	aead    cipher.AEAD
+	src     io.Reader
+	buf     bytes.Buffer
+	nonce   []byte
+	flags   byte
+	chunks  int
+	counter uint64
+	eof     bool
 }
 
 // NewDecryptingReader returns a new io.Reader that decrypts src with the cipher
 func (cipher *SymmetricCipher) NewDecryptingReader(src io.Reader) (io.Reader, error) {
 	nonce := make([]byte, nonceLength)
 	if _, err := io.ReadFull(src, nonce); err != nil {
-		return nil, err
+		return nil, headerReadError(err)
 	}
 	return cipher.newReader(nonce, src)
 }
 
+// headerReadError reports a short read of the stream header as truncation.
+func headerReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	return err
+}
+
 func (cipher *SymmetricCipher) newReader(nonce []byte, src io.Reader) (io.Reader, error) {
 	ciphReader := &Reader{
 		aead:  *cipher.aead,
@@ -109,37 +300,157 @@ func (cipher *SymmetricCipher) newReader(nonce []byte, src io.Reader) (io.Reader
 		buf:   bytes.Buffer{},
 		nonce: nonce,
 	}
-	compressFlag := make([]byte, 1)
-	if _, err := io.ReadFull(src, compressFlag); err != nil {
-		return nil, err
+	flags := make([]byte, 1)
+	if _, err := io.ReadFull(src, flags); err != nil {
+		return nil, headerReadError(err)
+	}
+	if flags[0]&^knownFlags != 0 {
+		return nil, fmt.Errorf("%w: stream flags %#x", ErrUnsupported, flags[0])
+	}
+	ciphReader.flags = flags[0]
+	var reader io.Reader = ciphReader
+	if flags[0]&flagCompress != 0 {
+		zReader, err := zlib.NewReader(ciphReader)
+		if err != nil {
+			return nil, decompressionError(err)
+		}
+		reader = &decompressingReader{zReader, ciphReader}
+	}
+	if flags[0]&flagHeader != 0 {
+		reader = &headerReader{r: reader}
 	}
-	if compressFlag[0] == 0 {
-		return io.NopCloser(ciphReader), nil
+	return reader, nil
+}
+
+// decompressingReader tags errors raised by the zlib layer so they can be told
+// apart from authentication failures in the chunks underneath it.
+type decompressingReader struct {
+	r      io.Reader
+	chunks *Reader
+}
+
+func (d *decompressingReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err == io.EOF {
+		// zlib stops at its checksum; the chunk stream must end there too.
+		var trailing int64
+		if trailing, err = io.Copy(io.Discard, d.chunks); err == nil {
+			if trailing > 0 {
+				return n, fmt.Errorf("%w: %w: trailing data", ErrDecompression, ErrCorrupted)
+			}
+			return n, io.EOF
+		}
 	}
-	zReader, err := zlib.NewReader(ciphReader)
 	if err != nil {
-		return nil, err
+		err = decompressionError(err)
+	}
+	return n, err
+}
+
+// Stats returns statistics about the chunks read so far.
+func (d *decompressingReader) Stats() Stats {
+	return d.chunks.Stats()
+}
+
+// decompressionError classifies a zlib error. Errors that came up from the
+// chunk layer are returned untouched; anything else means the authenticated
+// plaintext did not inflate, either because the stream ended early or because
+// it is malformed.
+func decompressionError(err error) error {
+	switch {
+	case errors.Is(err, ErrWrongKey), errors.Is(err, ErrCorrupted), errors.Is(err, ErrTruncated):
+		return err
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: %w", ErrDecompression, ErrTruncated)
+	default:
+		return fmt.Errorf("%w: %w: %w", ErrDecompression, ErrCorrupted, err)
 	}
-	return zReader, nil
 }
 
 func (r *Reader) Read(p []byte) (int, error) {
-	if r.buf.Len() > len(p) {
+	if r.buf.Len() > len(p) || r.eof {
 		return r.buf.Read(p)
 	}
+	// Chunks of a padded stream may carry no data, so keep reading until
+	// there is some.
+	for {
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+		if r.buf.Len() > 0 || r.eof {
+			return r.buf.Read(p)
+		}
+	}
+}
+
+// Stats returns statistics about the chunks read so far.
+func (r *Reader) Stats() Stats {
+	return Stats{
+		Chunks:     r.chunks,
+		Compressed: r.flags&flagCompress != 0,
+		Framed:     r.flags&flagFramed != 0,
+		Padded:     r.flags&flagPadded != 0,
+	}
+}
+
+// readChunk reads, authenticates and buffers the next chunk. It sets eof once
+// the stream has ended.
+func (r *Reader) readChunk() error {
 	var block [ctBlockSize]byte
 	n, err := io.ReadFull(r.src, block[:])
 	switch err {
 	case nil, io.ErrUnexpectedEOF:
-		pt, err := r.aead.Open(nil, r.nonce, block[:n], nil)
-		if err != nil {
-			return 0, fmt.Errorf("decryption failed: %w", err)
-		}
-		r.buf.Write(pt)
-		return r.buf.Read(p)
 	case io.EOF:
-		return r.buf.Read(p)
+		if r.flags&flagFramed != 0 {
+			// The final chunk was never seen.
+			return ErrTruncated
+		}
+		r.eof = true
+		return nil
 	default:
-		return 0, fmt.Errorf("decryption failed: %w", err)
+		return fmt.Errorf("decryption failed: %w", err)
+	}
+	if n < r.aead.Overhead() || n == r.aead.Overhead() && r.flags&flagFramed == 0 {
+		return ErrTruncated
 	}
+	var pt []byte
+	if r.flags&flagFramed == 0 {
+		pt, err = r.aead.Open(nil, r.nonce, block[:n], nil)
+	} else {
+		nonce := chunkNonce(r.nonce, r.counter)
+		// Only the final chunk can be short; a full one may be either.
+		if n == ctBlockSize {
+			pt, err = r.aead.Open(nil, nonce, block[:n], chunkAD(r.flags, false))
+		}
+		if n < ctBlockSize || err != nil {
+			if pt, err = r.aead.Open(nil, nonce, block[:n], chunkAD(r.flags, true)); err == nil {
+				r.eof = true
+			}
+		}
+		r.counter++
+	}
+	if err != nil {
+		if r.chunks == 0 {
+			return ErrWrongKey
+		}
+		return ErrCorrupted
+	}
+	if r.flags&flagPadded != 0 {
+		if pt, err = unpadFrame(pt); err != nil {
+			return err
+		}
+	}
+	r.chunks++
+	r.buf.Write(pt)
+	if r.eof {
+		var trailing [1]byte
+		switch _, err := io.ReadFull(r.src, trailing[:]); err {
+		case io.EOF:
+		case nil:
+			return fmt.Errorf("%w: trailing data after final chunk", ErrCorrupted)
+		default:
+			return fmt.Errorf("decryption failed: %w", err)
+		}
+	}
+	return nil
 }
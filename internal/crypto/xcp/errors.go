@@ -0,0 +1,26 @@
+package xcp
+
+import "errors"
+
+// Errors shared by every layer of the stream format (xcp and the asx/ecc/kyb/hyb
+// key layers built on top of it). The xipher package re-exports them so callers
+// can match them with errors.Is regardless of which layer reported the failure.
+var (
+	// ErrWrongKey is returned when the first chunk of a stream fails
+	// authentication. AEAD cannot tell a wrong key from a tampered first chunk,
+	// but in practice this almost always means the key does not match.
+	ErrWrongKey = errors.New("decryption failed: wrong key")
+	// ErrCorrupted is returned when a chunk after the first fails authentication
+	// or the stream is otherwise malformed, i.e. the key was right but the
+	// ciphertext has been altered.
+	ErrCorrupted = errors.New("decryption failed: ciphertext corrupted")
+	// ErrTruncated is returned when the ciphertext ends before a complete header
+	// or chunk could be read.
+	ErrTruncated = errors.New("decryption failed: ciphertext truncated")
+	// ErrUnsupported is returned when the ciphertext uses a format, flag or
+	// algorithm that this version does not understand.
+	ErrUnsupported = errors.New("decryption failed: unsupported version")
+	// ErrDecompression marks failures raised while inflating an authenticated,
+	// compressed stream. It is always combined with ErrCorrupted or ErrTruncated.
+	ErrDecompression = errors.New("decompression failed")
+)
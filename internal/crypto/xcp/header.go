@@ -0,0 +1,72 @@
+package xcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxHeaderLength is the maximum length of a stream header.
+const MaxHeaderLength = 1<<16 - 1
+
+// WithHeader starts the plaintext of the stream with header, an
+// application-defined record that is compressed, padded and authenticated
+// along with the data. Decrypting readers strip it from the data and return
+// it from their Header method.
+func WithHeader(header []byte) WriterOption {
+	return func(w *Writer) {
+		w.header = header
+		w.flags |= flagHeader
+	}
+}
+
+// writeHeader writes the length-prefixed header through the writer.
+func (w *Writer) writeHeader() error {
+	if len(w.header) > MaxHeaderLength {
+		return fmt.Errorf("encryption failed: header too long: %d bytes (max %d)", len(w.header), MaxHeaderLength)
+	}
+	if _, err := w.Write(binary.BigEndian.AppendUint16(nil, uint16(len(w.header)))); err != nil {
+		return err
+	}
+	_, err := w.Write(w.header)
+	return err
+}
+
+// headerReader strips the header from the start of a stream's plaintext.
+type headerReader struct {
+	r      io.Reader
+	header []byte
+	read   bool
+	err    error
+}
+
+// Header returns the header of the stream, reading it if no data has been read yet.
+func (hr *headerReader) Header() ([]byte, error) {
+	if !hr.read {
+		hr.read = true
+		var length [2]byte
+		if _, hr.err = io.ReadFull(hr.r, length[:]); hr.err == nil {
+			hr.header = make([]byte, binary.BigEndian.Uint16(length[:]))
+			_, hr.err = io.ReadFull(hr.r, hr.header)
+		}
+		if hr.err == io.EOF || hr.err == io.ErrUnexpectedEOF {
+			hr.err = fmt.Errorf("%w: stream ends within its header", ErrCorrupted)
+		}
+	}
+	return hr.header, hr.err
+}
+
+func (hr *headerReader) Read(p []byte) (int, error) {
+	if _, err := hr.Header(); err != nil {
+		return 0, err
+	}
+	return hr.r.Read(p)
+}
+
+// Stats returns statistics about the chunks read so far.
+func (hr *headerReader) Stats() Stats {
+	if sr, ok := hr.r.(interface{ Stats() Stats }); ok {
+		return sr.Stats()
+	}
+	return Stats{}
+}
@@ -8,6 +8,7 @@ import (
 
 const (
 	KeyLength           = chacha20poly1305.KeySize
+	NonceLength         = nonceLength
 	nonceLength         = chacha20poly1305.NonceSizeX
 	CipherTextMinLength = nonceLength + chacha20poly1305.Overhead
 	ptBlockSize         = 64 * 1024
@@ -0,0 +1,76 @@
+package xcp
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// padHeaderLength is the size of the data length prefix of every chunk in a
+// padded stream.
+const padHeaderLength = 4
+
+// PadFunc returns the padded length of a stream carrying n bytes of data. It
+// must return at least n.
+type PadFunc func(n int64) int64
+
+// WriterOption configures an encrypting writer.
+type WriterOption func(*Writer)
+
+// WithPadding pads the stream to pad(n) bytes for n bytes of (compressed) data,
+// so that the ciphertext size reveals only the padded length. Each chunk of a
+// padded stream is prefixed with the length of the data it carries; the rest
+// of the chunk is zeros.
+func WithPadding(pad PadFunc) WriterOption {
+	return func(w *Writer) {
+		w.pad = pad
+		w.flags |= flagPadded
+	}
+}
+
+// Padme returns the length of n after Padmé padding, which leaks at most
+// O(log log n) bits of the length and costs at most 12% overhead.
+func Padme(n int64) int64 {
+	if n < 2 {
+		return n
+	}
+	e := bits.Len64(uint64(n)) - 1
+	s := bits.Len64(uint64(e))
+	mask := int64(1)<<(e-s) - 1
+	return (n + mask) &^ mask
+}
+
+// PadToMultiple returns a PadFunc that rounds lengths up to a multiple of size.
+func PadToMultiple(size int64) PadFunc {
+	return func(n int64) int64 {
+		if size <= 1 || n%size == 0 && n > 0 {
+			return n
+		}
+		return (n/size + 1) * size
+	}
+}
+
+// padFrame returns the chunk plaintext carrying data followed by fill zeros.
+func padFrame(data []byte, fill int) []byte {
+	frame := make([]byte, padHeaderLength, padHeaderLength+len(data)+fill)
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	frame = append(frame, data...)
+	return append(frame, make([]byte, fill)...)
+}
+
+// unpadFrame returns the data carried by a padded chunk.
+func unpadFrame(frame []byte) ([]byte, error) {
+	if len(frame) < padHeaderLength {
+		return nil, ErrCorrupted
+	}
+	dataLength := int(binary.BigEndian.Uint32(frame))
+	if dataLength > len(frame)-padHeaderLength {
+		return nil, ErrCorrupted
+	}
+	data, fill := frame[padHeaderLength:padHeaderLength+dataLength], frame[padHeaderLength+dataLength:]
+	for _, b := range fill {
+		if b != 0 {
+			return nil, ErrCorrupted
+		}
+	}
+	return data, nil
+}
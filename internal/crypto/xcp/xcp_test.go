@@ -3,6 +3,7 @@ package xcp
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"io"
 	"testing"
 )
@@ -128,8 +129,8 @@ func TestDecryptWithWrongKeyFails(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error creating reader: %v", err)
 	}
-	if _, err := io.ReadAll(r); err == nil {
-		t.Fatal("expected authentication failure decrypting with wrong key, got nil")
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey decrypting with wrong key, got %v", err)
 	}
 }
 
@@ -161,3 +162,307 @@ func TestTamperedCiphertextFails(t *testing.T) {
 		t.Fatal("expected error decrypting tampered ciphertext, got nil")
 	}
 }
+
+func TestErrorClassification(t *testing.T) {
+	cipher := newTestCipher(t)
+	data := randomBytes(t, 2*ptBlockSize+100)
+
+	var buf bytes.Buffer
+	w, err := cipher.NewEncryptingWriter(&buf, false)
+	if err != nil {
+		t.Fatalf("error creating writer: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("error writing: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	ct := buf.Bytes()
+
+	decrypt := func(ct []byte) error {
+		r, err := cipher.NewDecryptingReader(bytes.NewReader(ct))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	// A bit flip in a chunk after the first means the key was right.
+	tampered := bytes.Clone(ct)
+	tampered[len(tampered)-1] ^= 0x01
+	if err := decrypt(tampered); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for tampered later chunk, got %v", err)
+	}
+
+	// Cut inside the nonce.
+	if err := decrypt(ct[:nonceLength/2]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated for short header, got %v", err)
+	}
+
+	// Unknown stream flags.
+	unsupported := bytes.Clone(ct)
+	unsupported[nonceLength] = 0x80
+	if err := decrypt(unsupported); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for unknown flags, got %v", err)
+	}
+}
+
+// encryptLegacy writes data in the unframed format of older versions, where
+// every chunk is sealed with the stream nonce and no final chunk is marked.
+func encryptLegacy(t *testing.T, cipher *SymmetricCipher, data []byte) []byte {
+	t.Helper()
+	nonce := randomBytes(t, nonceLength)
+	ct := append(bytes.Clone(nonce), 0)
+	for len(data) > 0 {
+		block := data[:min(len(data), ptBlockSize)]
+		data = data[len(block):]
+		ct = (*cipher.aead).Seal(ct, nonce, block, nil)
+	}
+	return ct
+}
+
+func TestLegacyStreamDecrypts(t *testing.T) {
+	cipher := newTestCipher(t)
+	data := randomBytes(t, 2*ptBlockSize+10)
+	r, err := cipher.NewDecryptingReader(bytes.NewReader(encryptLegacy(t, cipher, data)))
+	if err != nil {
+		t.Fatalf("error creating reader: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error decrypting legacy stream: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("legacy round-trip mismatch")
+	}
+	if stats := r.(*Reader).Stats(); stats.Framed || stats.Chunks != 3 {
+		t.Errorf("unexpected stats for legacy stream: %+v", stats)
+	}
+}
+
+func TestFramedStreamDetectsTruncationAndReordering(t *testing.T) {
+	cipher := newTestCipher(t)
+	for _, size := range []int{0, ptBlockSize, 2*ptBlockSize + 10} {
+		for _, compress := range []bool{false, true} {
+			data := randomBytes(t, size)
+			var buf bytes.Buffer
+			w, err := cipher.NewEncryptingWriter(&buf, compress)
+			if err != nil {
+				t.Fatalf("error creating writer: %v", err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("error closing: %v", err)
+			}
+			ct := buf.Bytes()
+			decrypt := func(ct []byte) error {
+				r, err := cipher.NewDecryptingReader(bytes.NewReader(ct))
+				if err != nil {
+					return err
+				}
+				_, err = io.ReadAll(r)
+				return err
+			}
+			header := nonceLength + 1
+			if len(ct) > header+ctBlockSize {
+				// Drop everything after the first chunk, on a chunk boundary.
+				if err := decrypt(ct[:header+ctBlockSize]); !errors.Is(err, ErrTruncated) {
+					t.Errorf("size=%d compress=%v: expected ErrTruncated at chunk boundary, got %v", size, compress, err)
+				}
+			}
+			if len(ct) >= header+2*ctBlockSize {
+				// Swap the first two chunks.
+				swapped := bytes.Clone(ct)
+				copy(swapped[header:], ct[header+ctBlockSize:header+2*ctBlockSize])
+				copy(swapped[header+ctBlockSize:], ct[header:header+ctBlockSize])
+				if decrypt(swapped) == nil {
+					t.Errorf("size=%d compress=%v: expected error for reordered chunks", size, compress)
+				}
+			}
+			if err := decrypt(ct[:header]); !errors.Is(err, ErrTruncated) {
+				t.Errorf("size=%d compress=%v: expected ErrTruncated without chunks, got %v", size, compress, err)
+			}
+			if err := decrypt(append(bytes.Clone(ct), 0)); err == nil {
+				t.Errorf("size=%d compress=%v: expected error for trailing data", size, compress)
+			}
+		}
+	}
+}
+
+func encryptWith(t *testing.T, cipher *SymmetricCipher, data []byte, compress bool, opts ...WriterOption) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := cipher.NewEncryptingWriter(&buf, compress, opts...)
+	if err != nil {
+		t.Fatalf("error creating encrypting writer: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPadme(t *testing.T) {
+	for n, want := range map[int64]int64{0: 0, 1: 1, 7: 7, 9: 10, 100: 104, 1000: 1024, 65537: 67584} {
+		if got := Padme(n); got != want {
+			t.Errorf("Padme(%d) = %d, want %d", n, got, want)
+		}
+	}
+	for n := int64(1); n < 1<<20; n = n*3 + 1 {
+		if got := Padme(n); got < n || float64(got-n) > 0.12*float64(n)+1 {
+			t.Errorf("Padme(%d) = %d out of bounds", n, got)
+		}
+	}
+}
+
+func TestPaddedRoundTrip(t *testing.T) {
+	cipher := newTestCipher(t)
+	pads := map[string]PadFunc{
+		"padme":   Padme,
+		"bucket":  PadToMultiple(1000),
+		"chunks":  PadToMultiple(3*ptBlockSize + 17),
+		"nothing": func(n int64) int64 { return n },
+	}
+	for name, pad := range pads {
+		for _, size := range []int{0, 1, 999, ptBlockSize - padHeaderLength, ptBlockSize, 2*ptBlockSize + 5} {
+			for _, compress := range []bool{false, true} {
+				data := randomBytes(t, size)
+				ct := encryptWith(t, cipher, data, compress, WithPadding(pad))
+				r, err := cipher.NewDecryptingReader(bytes.NewReader(ct))
+				if err != nil {
+					t.Fatalf("%s/%d: error creating decrypting reader: %v", name, size, err)
+				}
+				out, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("%s/%d/%v: error decrypting: %v", name, size, compress, err)
+				}
+				if !bytes.Equal(out, data) {
+					t.Errorf("%s/%d/%v: round trip mismatch", name, size, compress)
+				}
+				if stats := r.(interface{ Stats() Stats }).Stats(); !stats.Padded {
+					t.Errorf("%s/%d/%v: stats do not report padding", name, size, compress)
+				}
+			}
+		}
+	}
+}
+
+func TestPaddingHidesLength(t *testing.T) {
+	cipher := newTestCipher(t)
+	pad := WithPadding(PadToMultiple(256))
+	want := len(encryptWith(t, cipher, []byte("a"), false, pad))
+	for _, size := range []int{0, 10, 200, 252} {
+		if got := len(encryptWith(t, cipher, randomBytes(t, size), false, pad)); got != want {
+			t.Errorf("padded ciphertext of %d bytes is %d bytes long, want %d", size, got, want)
+		}
+	}
+	if got := len(encryptWith(t, cipher, randomBytes(t, 257), false, pad)); got == want {
+		t.Errorf("ciphertext of 257 bytes not padded to the next bucket")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	cipher := newTestCipher(t)
+	header := []byte("header record")
+	for _, compress := range []bool{false, true} {
+		data := randomBytes(t, ptBlockSize+3)
+		ct := encryptWith(t, cipher, data, compress, WithHeader(header), WithPadding(Padme))
+		r, err := cipher.NewDecryptingReader(bytes.NewReader(ct))
+		if err != nil {
+			t.Fatalf("error creating decrypting reader: %v", err)
+		}
+		got, err := r.(interface{ Header() ([]byte, error) }).Header()
+		if err != nil || !bytes.Equal(got, header) {
+			t.Errorf("header = %q, %v", got, err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(out, data) {
+			t.Errorf("data after header mismatch: %v", err)
+		}
+		if stats := r.(interface{ Stats() Stats }).Stats(); !stats.Padded || stats.Compressed != compress {
+			t.Errorf("stats = %+v", stats)
+		}
+	}
+	// Reading without calling Header skips it.
+	ct := encryptWith(t, cipher, []byte("data"), false, WithHeader(header))
+	r, err := cipher.NewDecryptingReader(bytes.NewReader(ct))
+	if err != nil {
+		t.Fatalf("error creating decrypting reader: %v", err)
+	}
+	if out, err := io.ReadAll(r); err != nil || string(out) != "data" {
+		t.Errorf("read = %q, %v", out, err)
+	}
+}
+
+func TestWithNonce(t *testing.T) {
+	cipher := newTestCipher(t)
+	nonce := randomBytes(t, NonceLength)
+	data := []byte("deterministic")
+	ct1 := encryptWith(t, cipher, data, true, WithNonce(nonce))
+	ct2 := encryptWith(t, cipher, data, true, WithNonce(nonce))
+	if !bytes.Equal(ct1, ct2) {
+		t.Errorf("ciphertexts with the same nonce differ")
+	}
+	if !bytes.Equal(ct1[:NonceLength], nonce) {
+		t.Errorf("stream does not start with the given nonce")
+	}
+	r, err := cipher.NewDecryptingReader(bytes.NewReader(ct1))
+	if err != nil {
+		t.Fatalf("error creating decrypting reader: %v", err)
+	}
+	if out, err := io.ReadAll(r); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("read = %q, %v", out, err)
+	}
+	if _, err := cipher.NewEncryptingWriter(io.Discard, false, WithNonce(nonce[1:])); err == nil {
+		t.Errorf("expected an error for a short nonce")
+	}
+}
+
+func TestWithSyntheticNonce(t *testing.T) {
+	cipher := newTestCipher(t)
+	key := randomBytes(t, 32)
+	data := bytes.Repeat([]byte("deterministic "), 10000)
+	encrypt := func(data []byte, compress bool, context string, opts ...WriterOption) []byte {
+		return encryptWith(t, cipher, data, compress, append(opts, WithSyntheticNonce(key, []byte(context)))...)
+	}
+	ct := encrypt(data, true, "a.txt")
+	if !bytes.Equal(ct, encrypt(data, true, "a.txt")) {
+		t.Errorf("ciphertexts of the same stream differ")
+	}
+	r, err := cipher.NewDecryptingReader(bytes.NewReader(ct))
+	if err != nil {
+		t.Fatalf("error creating decrypting reader: %v", err)
+	}
+	if out, err := io.ReadAll(r); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("read mismatch: %v", err)
+	}
+	changed := bytes.Clone(data)
+	changed[len(changed)-1] ^= 1
+	variants := map[string][]byte{
+		"data":         encrypt(changed, true, "a.txt"),
+		"context":      encrypt(data, true, "b.txt"),
+		"compression":  encrypt(data, false, "a.txt"),
+		"padding":      encrypt(data, true, "a.txt", WithPadding(PadToMultiple(4096))),
+		"padded size":  encrypt(data, true, "a.txt", WithPadding(PadToMultiple(8192))),
+		"header":       encrypt(data, true, "a.txt", WithHeader([]byte("info"))),
+		"other header": encrypt(data, true, "a.txt", WithHeader([]byte("more"))),
+	}
+	nonces := map[string]string{string(ct[:NonceLength]): "base"}
+	for name, variant := range variants {
+		nonce := string(variant[:NonceLength])
+		if other, ok := nonces[nonce]; ok {
+			t.Errorf("%s: same nonce as %s", name, other)
+		}
+		nonces[nonce] = name
+	}
+	if _, err := cipher.NewEncryptingWriter(io.Discard, false, WithNonce(randomBytes(t, NonceLength)), WithSyntheticNonce(key, nil)); err == nil {
+		t.Errorf("expected an error for a nonce and a synthetic nonce")
+	}
+}
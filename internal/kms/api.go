@@ -24,7 +24,14 @@ const (
 	providerParamProvider = "provider"
 )
 
+// handleHealth reports "ok", or "sealed" with 503 Service Unavailable while the
+// master seeds await Shamir unsealing.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.masterSeeds(); !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "sealed")
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "ok")
 }
@@ -408,15 +415,21 @@ func (s *Server) handlePublicKeyService(w http.ResponseWriter, r *http.Request)
 	s.servePublicKey(w, r, entityService, "Service")
 }
 
-// servePublicKey derives the entity's secret key from its identity (taken
-// straight from the path, no auth) and serves the corresponding public key in
-// the xipher resolver JSON format. The key kind (ECC vs post-quantum hybrid)
+// servePublicKey derives the entity's secret key of the active seed epoch from
+// its identity (taken straight from the path, no auth) and serves the
+// corresponding public key in the xipher resolver JSON format. The key kind (ECC vs post-quantum hybrid)
 // follows the post_quantum config. Public keys are safe to expose openly.
 // The {provider} path segment selects which provider's issuer URL is used in
 // derivation, ensuring keys are scoped to a specific provider.
 func (s *Server) servePublicKey(w http.ResponseWriter, r *http.Request, entityType, label string) {
 	allowPublicCORS(w)
 
+	seeds, ok := s.masterSeeds()
+	if !ok {
+		http.Error(w, errSealed, http.StatusServiceUnavailable)
+		return
+	}
+
 	providerID := r.PathValue("provider")
 	auth := s.authByID(providerID)
 	if auth == nil {
@@ -430,7 +443,8 @@ func (s *Server) servePublicKey(w http.ResponseWriter, r *http.Request, entityTy
 		return
 	}
 
-	seed, err := deriveSeed(s.seed, auth.cfg.ID, entityType, entityID)
+	active := seeds[0]
+	seed, err := deriveEpochSeed(active.seed, active.epoch, auth.cfg.ID, entityType, entityID)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -440,7 +454,11 @@ func (s *Server) servePublicKey(w http.ResponseWriter, r *http.Request, entityTy
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	pub, err := sk.PublicKey(s.cfg.PostQuantum)
+	suite := xipher.SuiteECC
+	if s.cfg.PostQuantum {
+		suite = xipher.SuiteHybrid
+	}
+	pub, err := sk.PublicKey(suite)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -464,6 +482,12 @@ func (s *Server) servePublicKey(w http.ResponseWriter, r *http.Request, entityTy
 func (s *Server) serveCredential(w http.ResponseWriter, r *http.Request, entityType, groupName string) {
 	ctx := r.Context()
 
+	seeds, ok := s.masterSeeds()
+	if !ok {
+		http.Error(w, errSealed, http.StatusServiceUnavailable)
+		return
+	}
+
 	rawToken := s.extractToken(r)
 	if rawToken == "" {
 		http.Error(w, "missing token", http.StatusUnauthorized)
@@ -484,13 +508,7 @@ func (s *Server) serveCredential(w http.ResponseWriter, r *http.Request, entityT
 		return
 	}
 
-	seed, err := deriveSeed(s.seed, auth.cfg.ID, entityType, entityID)
-	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	cred, err := s.buildCredential(seed, entityType, entityID, name)
+	cred, err := s.deriveCredential(seeds, auth.cfg.ID, entityType, entityID, name)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -544,24 +562,64 @@ func (s *Server) resolveEntityID(auth *authenticator, claims map[string]any, ent
 	}
 }
 
+// deriveCredential derives the credential of the entity from the master seed
+// of each epoch: the active epoch's in the credential itself, the others' in
+// its Epochs.
+func (s *Server) deriveCredential(seeds []epochSeed, providerID, entityType, entityID, name string) (*credential, error) {
+	var cred *credential
+	for _, e := range seeds {
+		seed, err := deriveEpochSeed(e.seed, e.epoch, providerID, entityType, entityID)
+		if err != nil {
+			return nil, err
+		}
+		if cred == nil {
+			if cred, err = s.buildCredential(seed, entityType, entityID, name); err != nil {
+				return nil, err
+			}
+			cred.Epoch = e.epoch
+			continue
+		}
+		seedStr, keyStr, err := s.encodeSeed(seed)
+		if err != nil {
+			return nil, err
+		}
+		cred.Epochs = append(cred.Epochs, epochCredential{Epoch: e.epoch, Seed: seedStr, Key: keyStr})
+	}
+	return cred, nil
+}
+
 // buildCredential encodes the derived seed into the fields enabled by config.
 func (s *Server) buildCredential(seed []byte, entityType, entityID, name string) (*credential, error) {
-	cred := &credential{Type: entityType, ID: entityID, Name: name, Timeout: s.cfg.Credential.Timeout}
+	seedStr, keyStr, err := s.encodeSeed(seed)
+	if err != nil {
+		return nil, err
+	}
+	return &credential{
+		Seed:    seedStr,
+		Key:     keyStr,
+		Type:    entityType,
+		ID:      entityID,
+		Name:    name,
+		Timeout: s.cfg.Credential.Timeout,
+	}, nil
+}
+
+// encodeSeed returns the base64 seed and the XSK_ key of a derived seed, each
+// only if enabled by config.
+func (s *Server) encodeSeed(seed []byte) (seedStr, keyStr string, err error) {
 	if s.cfg.Credential.Seed {
-		cred.Seed = base64.StdEncoding.EncodeToString(seed)
+		seedStr = base64.StdEncoding.EncodeToString(seed)
 	}
 	if s.cfg.Credential.Key {
 		sk, err := secretKeyFromSeed(seed)
 		if err != nil {
-			return nil, err
+			return "", "", err
 		}
-		keyStr, err := sk.String()
-		if err != nil {
-			return nil, err
+		if keyStr, err = sk.String(); err != nil {
+			return "", "", err
 		}
-		cred.Key = keyStr
 	}
-	return cred, nil
+	return seedStr, keyStr, nil
 }
 
 // handleCancel aborts an in-flight browser flow from the consent page. It
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 
@@ -44,6 +45,68 @@ func (s secretSource) resolve() (string, error) {
 	}
 }
 
+// unsealConfig selects how a sealed seed file is unsealed at startup: with the
+// unseal key or password from an environment variable or a file, from the
+// first line of stdin, or from k-of-n Shamir shares submitted by operators to
+// the unseal endpoint. At most one is configured.
+type unsealConfig struct {
+	Key    secretSource `yaml:",inline"`
+	Stdin  bool         `yaml:"stdin"`
+	Shamir struct {
+		// Threshold is the number of shares that unseal the seed.
+		Threshold int `yaml:"threshold"`
+		// Operators are the users allowed to submit a share, each as the ID
+		// of their provider and their identity per its user claim, e.g.
+		// "corp-sso:alice@example.com".
+		Operators []string `yaml:"operators"`
+	} `yaml:"shamir"`
+}
+
+// configured reports whether an unseal method is configured.
+func (u *unsealConfig) configured() bool {
+	return u.Key.Env != "" || u.Key.File != "" || u.Stdin || u.Shamir.Threshold != 0
+}
+
+// validate checks that at most one unseal method is configured, and that the
+// Shamir threshold can be met by the operators, each a user of one of the
+// providers with a user claim.
+func (u *unsealConfig) validate(providers []OIDCProviderConfig) error {
+	methods := 0
+	for _, set := range []bool{u.Key.Env != "", u.Key.File != "", u.Stdin, u.Shamir.Threshold != 0} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return fmt.Errorf("unseal: configure only one of env, file, stdin or shamir")
+	}
+	if u.Shamir.Threshold == 0 {
+		return nil
+	}
+	if u.Shamir.Threshold < 2 || u.Shamir.Threshold > maxShamirShares {
+		return fmt.Errorf("unseal.shamir.threshold must be between 2 and %d", maxShamirShares)
+	}
+	seen := make(map[string]bool, len(u.Shamir.Operators))
+	for _, op := range u.Shamir.Operators {
+		providerID, user, _ := strings.Cut(op, ":")
+		if user == "" || seen[op] {
+			return fmt.Errorf("unseal.shamir.operators must list distinct identities as <provider>:<user>")
+		}
+		seen[op] = true
+		i := slices.IndexFunc(providers, func(p OIDCProviderConfig) bool { return p.ID == providerID })
+		if i < 0 {
+			return fmt.Errorf("unseal.shamir.operators: %q: unknown provider %q", op, providerID)
+		}
+		if providers[i].Claims.User == "" {
+			return fmt.Errorf("unseal.shamir.operators: %q: provider %q has no claims.user to identify operators", op, providerID)
+		}
+	}
+	if len(u.Shamir.Operators) < u.Shamir.Threshold {
+		return fmt.Errorf("unseal.shamir.operators must list at least threshold (%d) operators", u.Shamir.Threshold)
+	}
+	return nil
+}
+
 // OIDCProviderConfig holds configuration for a single OIDC provider, including
 // its own claim mapping. Each provider may expose a different subset of entity
 // types depending on which claims it includes in its tokens.
@@ -84,6 +147,8 @@ type rawConfig struct {
 		Port int    `yaml:"port"`
 	} `yaml:"server"`
 	SeedFile   string                        `yaml:"seed_file"`
+	Seeds      seedsConfig                   `yaml:"seeds"`
+	Unseal     unsealConfig                  `yaml:"unseal"`
 	PubKeyPath string                        `yaml:"pubkey_path"`
 	Providers  map[string]OIDCProviderConfig `yaml:"providers"`
 	AuthHeader struct {
@@ -116,6 +181,14 @@ type Config struct {
 	}
 	SeedFile string
 
+	// Seeds configures versioned master seeds, one per epoch, in place of
+	// SeedFile, which is otherwise the seed of epoch 0.
+	Seeds seedsConfig
+
+	// Unseal selects how a sealed seed file, one encrypted with xipher kms seal,
+	// is unsealed. Unset for plaintext seed files.
+	Unseal unsealConfig
+
 	// PubKeyPath is the URL path prefix under which the public-key (xpk)
 	// discovery endpoints are served. Defaults to "/xpk/" when unset. Always
 	// normalized to a leading and trailing slash. This is routing only and does
@@ -230,6 +303,8 @@ func LoadConfig(path string) (*Config, error) {
 
 	c := &Config{
 		SeedFile:    raw.SeedFile,
+		Seeds:       raw.Seeds,
+		Unseal:      raw.Unseal,
 		PubKeyPath:  normalizePathPrefix(raw.PubKeyPath),
 		Providers:   providers,
 		PostQuantum: raw.PostQuantum,
@@ -270,8 +345,11 @@ func (c *Config) validate() error {
 	if c.Server.Port == 0 {
 		return fmt.Errorf("server.port is required")
 	}
-	if c.SeedFile == "" {
-		return fmt.Errorf("seed_file is required")
+	if err := c.validateSeeds(); err != nil {
+		return err
+	}
+	if err := c.Unseal.validate(c.Providers); err != nil {
+		return err
 	}
 	if len(c.Providers) == 0 {
 		return fmt.Errorf("at least one provider is required")
@@ -317,6 +395,11 @@ func (c *Config) validate() error {
 	if c.Login.RedirectDelay < 0 || c.Login.RedirectDelay > 60 {
 		return fmt.Errorf("login.redirect_delay must be between 0 and 60 seconds")
 	}
+	return c.validateXipherHomeURL()
+}
+
+// validateXipherHomeURL checks xipher_urls.default is an absolute URL, if set.
+func (c *Config) validateXipherHomeURL() error {
 	if c.XipherHomeURL != "" {
 		u, err := url.Parse(c.XipherHomeURL)
 		if err != nil || u.Scheme == "" || u.Host == "" {
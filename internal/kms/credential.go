@@ -34,6 +34,23 @@ func deriveSeed(master []byte, providerID, entityType, entityID string) ([]byte,
 	return seed, nil
 }
 
+// deriveEpochSeed derives the seed of the given entity from the master seed of
+// epoch as deriveSeed does. Epoch 0, the only one before seeds were versioned,
+// derives exactly the seeds deriveSeed does, so keys issued then stay valid;
+// later epochs bind the epoch into the info string as well.
+func deriveEpochSeed(master []byte, epoch int, providerID, entityType, entityID string) ([]byte, error) {
+	if epoch == 0 {
+		return deriveSeed(master, providerID, entityType, entityID)
+	}
+	info := fmt.Sprintf("xkms@%d:%s:%s:%s", epoch, providerID, entityType, entityID)
+	r := hkdf.New(sha256.New, master, nil, []byte(info))
+	seed := make([]byte, credentialSeedLength)
+	if _, err := io.ReadFull(r, seed); err != nil {
+		return nil, fmt.Errorf("deriving seed: %w", err)
+	}
+	return seed, nil
+}
+
 // credential is the derived material returned to a caller, encoded per config.
 type credential struct {
 	Seed string `json:"seed,omitempty"` // base64 of the 64-byte seed
@@ -46,6 +63,18 @@ type credential struct {
 	// field is always emitted — the app treats a missing field as 0 too, but
 	// sending it explicitly avoids relying on that default.
 	Timeout int `json:"timeout"`
+	// Epoch is the seed epoch of Seed and Key, the active one.
+	Epoch int `json:"epoch"`
+	// Epochs are the seeds and keys of the other epochs that are not retired,
+	// newest first, so data encrypted to their public keys still decrypts.
+	Epochs []epochCredential `json:"epochs,omitempty"`
+}
+
+// epochCredential is the derived material of an earlier seed epoch.
+type epochCredential struct {
+	Epoch int    `json:"epoch"`
+	Seed  string `json:"seed,omitempty"`
+	Key   string `json:"key,omitempty"`
 }
 
 // secretKeyFromSeed builds a xipher SecretKey from a 64-byte derived seed.
@@ -0,0 +1,88 @@
+package kms
+
+import (
+	"fmt"
+	"slices"
+)
+
+// seedsConfig configures versioned master seeds, one per epoch, so the master
+// seed can be rotated without orphaning data encrypted to the keys derived
+// from an earlier one. The public-key endpoints serve the keys of the active
+// epoch; credentials carry the keys of every epoch that is not retired.
+// Retired epochs are no longer loaded: their seed files, if still listed, are
+// not read.
+type seedsConfig struct {
+	// Active is the epoch whose keys are served and returned first.
+	Active int `yaml:"active"`
+	// Epochs maps each epoch to its seed file.
+	Epochs map[int]string `yaml:"epochs"`
+	// Retired lists the epochs whose keys are no longer issued.
+	Retired []int `yaml:"retired"`
+}
+
+// seedEpoch is the seed file of an epoch.
+type seedEpoch struct {
+	Epoch int
+	File  string
+}
+
+// epochSeed is the master seed of an epoch.
+type epochSeed struct {
+	epoch int
+	seed  []byte
+}
+
+// validateSeeds checks the seeds config against the seed_file shorthand: exactly
+// one of them gives the seeds, and the active epoch has a seed and is not
+// retired.
+func (c *Config) validateSeeds() error {
+	if len(c.Seeds.Epochs) == 0 {
+		if c.SeedFile == "" {
+			return fmt.Errorf("seed_file or seeds.epochs is required")
+		}
+		if c.Seeds.Active != 0 || len(c.Seeds.Retired) != 0 {
+			return fmt.Errorf("seeds.active and seeds.retired need seeds.epochs")
+		}
+		return nil
+	}
+	if c.SeedFile != "" {
+		return fmt.Errorf("configure only one of seed_file or seeds.epochs")
+	}
+	for epoch, file := range c.Seeds.Epochs {
+		if epoch < 0 {
+			return fmt.Errorf("seeds.epochs: epoch %d must not be negative", epoch)
+		}
+		if file == "" {
+			return fmt.Errorf("seeds.epochs: epoch %d has no seed file", epoch)
+		}
+	}
+	if _, ok := c.Seeds.Epochs[c.Seeds.Active]; !ok {
+		return fmt.Errorf("seeds.active: epoch %d is not in seeds.epochs", c.Seeds.Active)
+	}
+	if slices.Contains(c.Seeds.Retired, c.Seeds.Active) {
+		return fmt.Errorf("seeds.active: epoch %d is retired", c.Seeds.Active)
+	}
+	return nil
+}
+
+// seedEpochs returns the seed files of the epochs that are not retired, the
+// active epoch first and then the others newest first. A lone seed_file is
+// epoch 0.
+func (c *Config) seedEpochs() []seedEpoch {
+	if len(c.Seeds.Epochs) == 0 {
+		return []seedEpoch{{Epoch: 0, File: c.SeedFile}}
+	}
+	epochs := []seedEpoch{{Epoch: c.Seeds.Active, File: c.Seeds.Epochs[c.Seeds.Active]}}
+	var others []int
+	for epoch := range c.Seeds.Epochs {
+		if epoch != c.Seeds.Active && !slices.Contains(c.Seeds.Retired, epoch) {
+			others = append(others, epoch)
+		}
+	}
+	slices.Sort(others)
+	slices.Reverse(others)
+	for _, epoch := range others {
+		epochs = append(epochs, seedEpoch{Epoch: epoch, File: c.Seeds.Epochs[epoch]})
+	}
+	return epochs
+}
@@ -5,10 +5,12 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -123,11 +125,14 @@ func testServer(master []byte) *Server {
 			RedirectURI: "https://xkms.example.com/callback",
 		},
 	}
-	return &Server{
+	s := &Server{
 		cfg:   &Config{},
 		auths: []*authenticator{auth},
-		seed:  master,
 	}
+	if master != nil {
+		s.seeds = []epochSeed{{seed: master}}
+	}
+	return s
 }
 
 func TestServePublicKey(t *testing.T) {
@@ -364,3 +369,451 @@ func TestHandleRootLaunchesXipherHomeURL(t *testing.T) {
 		t.Fatalf("query-bearing root Location = %q", got)
 	}
 }
+
+func TestShamir(t *testing.T) {
+	secret := make([]byte, 64)
+	rand.Read(secret)
+	shares, err := shamirSplit(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pick := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var subset [][]byte
+		for _, i := range pick {
+			decoded, err := parseShareString(shareString(shares[i]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			subset = append(subset, decoded)
+		}
+		got, err := shamirCombine(subset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("shares %v did not recover the secret", pick)
+		}
+	}
+	if got, _ := shamirCombine(shares[:2]); bytes.Equal(got, secret) {
+		t.Fatal("fewer shares than the threshold recovered the secret")
+	}
+	if _, err := shamirCombine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Fatal("expected error for duplicated shares")
+	}
+	if _, err := shamirSplit(secret, 2, 3); err == nil {
+		t.Fatal("expected error for threshold above shares")
+	}
+	if _, err := parseShareString("0-abcd"); err == nil {
+		t.Fatal("expected error for share with x = 0")
+	}
+}
+
+// sealTestSeed writes a random plaintext seed to dir and seals it in place under
+// keyOrPwd, returning the raw seed and the sealed file path.
+func sealTestSeed(t *testing.T, dir, keyOrPwd string) ([]byte, string) {
+	t.Helper()
+	raw := make([]byte, 64)
+	rand.Read(raw)
+	p := filepath.Join(dir, "seed")
+	if err := os.WriteFile(p, []byte(hex.EncodeToString(raw)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealSeed(p, keyOrPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(sealed+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return raw, p
+}
+
+// openTestSeed opens the seed file at path as the seed of epoch 0.
+func openTestSeed(path string, unseal *unsealConfig) ([]byte, []sealedEpoch, error) {
+	seeds, sealed, err := openSeeds([]seedEpoch{{File: path}}, unseal)
+	if seeds == nil {
+		return nil, sealed, err
+	}
+	return seeds[0].seed, sealed, err
+}
+
+func TestOpenSealedSeed(t *testing.T) {
+	sk, _ := xipher.NewSecretKey()
+	unsealKey, _ := sk.String()
+
+	t.Run("unseals from env and keeps file", func(t *testing.T) {
+		raw, p := sealTestSeed(t, t.TempDir(), unsealKey)
+		t.Setenv("XKMS_TEST_UNSEAL_KEY", unsealKey)
+		unseal := &unsealConfig{Key: secretSource{Env: "XKMS_TEST_UNSEAL_KEY"}}
+		seed, sealed, err := openTestSeed(p, unseal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(seed, raw) || sealed != nil {
+			t.Fatal("unsealed seed mismatch")
+		}
+		if _, err := os.Stat(p); err != nil {
+			t.Fatal("sealed seed file deleted after load")
+		}
+	})
+
+	t.Run("unseals from file", func(t *testing.T) {
+		dir := t.TempDir()
+		raw, p := sealTestSeed(t, dir, unsealKey)
+		keyFile := filepath.Join(dir, "unseal-key")
+		os.WriteFile(keyFile, []byte(unsealKey+"\n"), 0600)
+		seed, _, err := openTestSeed(p, &unsealConfig{Key: secretSource{File: keyFile}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(seed, raw) {
+			t.Fatal("unsealed seed mismatch")
+		}
+	})
+
+	t.Run("unseals with a password from stdin", func(t *testing.T) {
+		password := "correct-Horse-battery-staple-42"
+		raw, p := sealTestSeed(t, t.TempDir(), password)
+		defer func(r io.Reader) { unsealInput = r }(unsealInput)
+		unsealInput = strings.NewReader(password + "\n")
+		seed, _, err := openTestSeed(p, &unsealConfig{Stdin: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(seed, raw) {
+			t.Fatal("unsealed seed mismatch")
+		}
+	})
+
+	t.Run("rejects wrong key", func(t *testing.T) {
+		_, p := sealTestSeed(t, t.TempDir(), unsealKey)
+		other, _ := xipher.NewSecretKey()
+		otherKey, _ := other.String()
+		t.Setenv("XKMS_TEST_UNSEAL_KEY", otherKey)
+		if _, _, err := openTestSeed(p, &unsealConfig{Key: secretSource{Env: "XKMS_TEST_UNSEAL_KEY"}}); err == nil {
+			t.Fatal("expected error for wrong unseal key")
+		}
+	})
+
+	t.Run("keeps shamir sealed seed sealed", func(t *testing.T) {
+		_, p := sealTestSeed(t, t.TempDir(), unsealKey)
+		unseal := &unsealConfig{}
+		unseal.Shamir.Threshold = 2
+		seed, sealed, err := openTestSeed(p, unseal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seed != nil || len(sealed) != 1 || !xipher.IsCTStr(sealed[0].ciphertext) {
+			t.Fatal("expected the seed to stay sealed")
+		}
+	})
+
+	t.Run("rejects sealed seed without unseal", func(t *testing.T) {
+		_, p := sealTestSeed(t, t.TempDir(), unsealKey)
+		if _, _, err := openTestSeed(p, &unsealConfig{}); err == nil {
+			t.Fatal("expected error for sealed seed without unseal config")
+		}
+	})
+
+	t.Run("rejects plaintext seed with unseal", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "seed")
+		raw := make([]byte, 64)
+		rand.Read(raw)
+		os.WriteFile(p, raw, 0600)
+		if _, _, err := openTestSeed(p, &unsealConfig{Stdin: true}); err == nil {
+			t.Fatal("expected error for plaintext seed with unseal config")
+		}
+		if _, err := os.Stat(p); err != nil {
+			t.Fatal("plaintext seed file deleted after failed load")
+		}
+	})
+}
+
+func TestUnsealWithShares(t *testing.T) {
+	unsealKey, shares, err := SplitUnsealKey(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, p := sealTestSeed(t, t.TempDir(), unsealKey)
+	sealed, _ := os.ReadFile(p)
+
+	s := testServer(nil)
+	s.cfg.Unseal.Shamir.Threshold = 2
+	s.cfg.Unseal.Shamir.Operators = []string{"test-provider:alice@example.com", "test-provider:bob@example.com", "test-provider:carol@example.com"}
+	s.sealed = &sealedSeed{
+		epochs: []sealedEpoch{{ciphertext: strings.TrimSpace(string(sealed))}},
+		shares: make(map[string][]byte),
+	}
+
+	health := func() int {
+		rec := httptest.NewRecorder()
+		s.handleHealth(rec, httptest.NewRequest("GET", "/health", nil))
+		return rec.Code
+	}
+	if code := health(); code != http.StatusServiceUnavailable {
+		t.Fatalf("sealed health status %d", code)
+	}
+	req := httptest.NewRequest("GET", "/xpk/test-provider/user/alice@example.com/.well-known/xipher", nil)
+	req.SetPathValue("provider", "test-provider")
+	req.SetPathValue("id", "alice@example.com")
+	rec := httptest.NewRecorder()
+	s.servePublicKey(rec, req, entityUser, "User")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("sealed public key status %d", rec.Code)
+	}
+
+	if _, err := s.submitShare("test-provider", "mallory@example.com", shares[0]); err != errNotOperator {
+		t.Fatalf("expected errNotOperator, got %v", err)
+	}
+	// The same user of another provider is not the operator.
+	if _, err := s.submitShare("other-provider", "alice@example.com", shares[0]); err != errNotOperator {
+		t.Fatalf("expected errNotOperator for another provider, got %v", err)
+	}
+
+	// Two shares of a different key do not unseal, and are discarded.
+	_, otherShares, _ := SplitUnsealKey(3, 2)
+	s.submitShare("test-provider", "alice@example.com", otherShares[0])
+	if _, err := s.submitShare("test-provider", "bob@example.com", otherShares[1]); err != errUnsealFailed {
+		t.Fatalf("expected errUnsealFailed, got %v", err)
+	}
+
+	status, err := s.submitShare("test-provider", "alice@example.com", shares[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Sealed || status.Progress != 1 || status.Threshold != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	// Resubmitting replaces the operator's share rather than counting twice.
+	if status, _ = s.submitShare("test-provider", "alice@example.com", shares[0]); status.Progress != 1 {
+		t.Fatalf("resubmitted share counted twice: %+v", status)
+	}
+	if status, err = s.submitShare("test-provider", "carol@example.com", shares[2]); err != nil || status.Sealed {
+		t.Fatalf("expected unsealed, got %+v, %v", status, err)
+	}
+	if seeds, ok := s.masterSeeds(); !ok || !bytes.Equal(seeds[0].seed, raw) {
+		t.Fatal("unsealed seed mismatch")
+	}
+	if code := health(); code != http.StatusOK {
+		t.Fatalf("unsealed health status %d", code)
+	}
+}
+
+func TestUnsealConfigValidation(t *testing.T) {
+	providers := []OIDCProviderConfig{{ID: "corp-sso"}, {ID: "github"}}
+	providers[0].Claims.User = "email"
+	providers[1].Claims.Service = "sub"
+
+	u := &unsealConfig{Key: secretSource{Env: "XKMS_UNSEAL_KEY"}, Stdin: true}
+	if err := u.validate(providers); err == nil {
+		t.Fatal("expected error for two unseal methods")
+	}
+	u = &unsealConfig{}
+	u.Shamir.Threshold = 2
+	u.Shamir.Operators = []string{"corp-sso:alice@example.com", "corp-sso:alice@example.com"}
+	if err := u.validate(providers); err == nil {
+		t.Fatal("expected error for duplicated operators")
+	}
+	u.Shamir.Operators = []string{"corp-sso:alice@example.com"}
+	if err := u.validate(providers); err == nil {
+		t.Fatal("expected error for fewer operators than the threshold")
+	}
+	for _, op := range []string{"alice@example.com", "corp-sso:", "okta:alice@example.com", "github:alice"} {
+		u.Shamir.Operators = []string{"corp-sso:bob@example.com", op}
+		if err := u.validate(providers); err == nil {
+			t.Fatalf("expected error for operator %q", op)
+		}
+	}
+	u.Shamir.Operators = []string{"corp-sso:alice@example.com", "corp-sso:bob@example.com"}
+	if err := u.validate(providers); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeriveEpochSeedStable(t *testing.T) {
+	master := make([]byte, 64)
+	for i := range master {
+		master[i] = byte(i)
+	}
+	// Golden derivations: changing them orphans every ciphertext encrypted to a
+	// key XKMS has issued.
+	golden := map[int]string{
+		0: "ccac6e201f0293aff5a5e46a4be60040ecc706affc6a7f45b63329ba401ad7eac33f4f706280c1920cc7d8dfdc100a6e5d00921953951da5a97d071f8856f049",
+		1: "3afdfa01a6d73ed2216c8d7cece5633805fdd08284295cd005a7b26e7472f59ae65dc90a4f79782cca2df559b276b6d2a4d8adc2d46fea48e03f6d63aae6929a",
+	}
+	for epoch, want := range golden {
+		seed, err := deriveEpochSeed(master, epoch, "corp", entityUser, "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(seed); got != want {
+			t.Errorf("epoch %d derivation changed:\n got %s\nwant %s", epoch, got, want)
+		}
+	}
+	legacy, _ := deriveSeed(master, "corp", entityUser, "alice@example.com")
+	if zero, _ := deriveEpochSeed(master, 0, "corp", entityUser, "alice@example.com"); !bytes.Equal(zero, legacy) {
+		t.Fatal("epoch 0 does not derive the unversioned seed")
+	}
+	one, _ := deriveEpochSeed(master, 1, "corp", entityUser, "alice@example.com")
+	two, _ := deriveEpochSeed(master, 2, "corp", entityUser, "alice@example.com")
+	if bytes.Equal(one, two) || bytes.Equal(one, legacy) {
+		t.Fatal("epochs collide for the same master seed")
+	}
+}
+
+func TestSeedEpochsConfig(t *testing.T) {
+	c := &Config{SeedFile: "/run/seed"}
+	if err := c.validateSeeds(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.seedEpochs(); len(got) != 1 || got[0] != (seedEpoch{Epoch: 0, File: "/run/seed"}) {
+		t.Fatalf("seed_file epochs = %v", got)
+	}
+
+	c = &Config{}
+	c.Seeds.Active = 2
+	c.Seeds.Epochs = map[int]string{0: "/run/seed.0", 1: "/run/seed.1", 2: "/run/seed.2", 3: "/run/seed.3"}
+	c.Seeds.Retired = []int{1}
+	if err := c.validateSeeds(); err != nil {
+		t.Fatal(err)
+	}
+	want := []seedEpoch{{2, "/run/seed.2"}, {3, "/run/seed.3"}, {0, "/run/seed.0"}}
+	if got := c.seedEpochs(); !slices.Equal(got, want) {
+		t.Fatalf("seed epochs = %v, want %v", got, want)
+	}
+
+	c.Seeds.Retired = []int{2}
+	if err := c.validateSeeds(); err == nil {
+		t.Fatal("expected error for a retired active epoch")
+	}
+	c.Seeds.Retired = nil
+	c.Seeds.Active = 4
+	if err := c.validateSeeds(); err == nil {
+		t.Fatal("expected error for an active epoch without a seed")
+	}
+	c.Seeds.Active = 2
+	c.SeedFile = "/run/seed"
+	if err := c.validateSeeds(); err == nil {
+		t.Fatal("expected error for both seed_file and seeds.epochs")
+	}
+}
+
+func TestLoadConfigSeedEpochs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xkms.yaml")
+	cfg := []byte(`
+server:
+  port: 8080
+seeds:
+  active: 1
+  epochs:
+    0: /run/secrets/xkms.seed.0
+    1: /run/secrets/xkms.seed.1
+  retired: []
+providers:
+  corp:
+    name: Corporate
+    issuer_url: https://sso.example.com
+    client_id: xkms
+    redirect_uri: https://xkms.example.com/callback
+    claims:
+      user: email
+auth_header:
+  type: bearer
+credential:
+  key: true
+xipher_urls:
+  default: https://xipher.org/app
+`)
+	if err := os.WriteFile(path, cfg, 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []seedEpoch{{1, "/run/secrets/xkms.seed.1"}, {0, "/run/secrets/xkms.seed.0"}}
+	if got := c.seedEpochs(); !slices.Equal(got, want) {
+		t.Fatalf("seed epochs = %v, want %v", got, want)
+	}
+}
+
+func TestOpenSeedEpochs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, data, 0600)
+		return p
+	}
+	raw0, raw1 := make([]byte, 64), make([]byte, 64)
+	rand.Read(raw0)
+	rand.Read(raw1)
+	p0 := write("seed.0", raw0)
+	p1 := write("seed.1", []byte("tooshort"))
+
+	epochs := []seedEpoch{{1, p1}, {0, p0}}
+	if _, _, err := openSeeds(epochs, &unsealConfig{}); err == nil {
+		t.Fatal("expected error for an invalid seed")
+	}
+	if _, err := os.Stat(p0); err != nil {
+		t.Fatal("valid seed file deleted although another seed is invalid")
+	}
+
+	write("seed.1", raw1)
+	seeds, _, err := openSeeds(epochs, &unsealConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) != 2 || seeds[0].epoch != 1 || !bytes.Equal(seeds[0].seed, raw1) || seeds[1].epoch != 0 || !bytes.Equal(seeds[1].seed, raw0) {
+		t.Fatal("loaded seeds mismatch")
+	}
+}
+
+func TestCredentialEpochs(t *testing.T) {
+	masters := make([][]byte, 3)
+	for i := range masters {
+		masters[i] = make([]byte, 64)
+		rand.Read(masters[i])
+	}
+	// Epoch 0 was the only one before rotation; its keys must keep decrypting.
+	legacy := testServer(masters[0])
+	legacy.cfg.Credential.Key = true
+	servedKey := func(s *Server) string {
+		req := httptest.NewRequest("GET", "/xpk/test-provider/user/alice@example.com/.well-known/xipher", nil)
+		req.SetPathValue("provider", "test-provider")
+		req.SetPathValue("id", "alice@example.com")
+		rec := httptest.NewRecorder()
+		s.servePublicKey(rec, req, entityUser, "User")
+		var out map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &out)
+		return out["publicKey"]
+	}
+	oldCiphertext, err := xipher.EncryptText(servedKey(legacy), []byte("before rotation"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := testServer(nil)
+	s.cfg.Credential.Key = true
+	s.seeds = []epochSeed{{2, masters[2]}, {1, masters[1]}, {0, masters[0]}}
+	newCiphertext, err := xipher.EncryptText(servedKey(s), []byte("after rotation"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err := s.deriveCredential(s.seeds, testProviderID, entityUser, "alice@example.com", "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Epoch != 2 || len(cred.Epochs) != 2 || cred.Epochs[0].Epoch != 1 || cred.Epochs[1].Epoch != 0 {
+		t.Fatalf("unexpected credential epochs: %+v", cred)
+	}
+	if text, err := xipher.DecryptText(cred.Key, newCiphertext); err != nil || string(text) != "after rotation" {
+		t.Fatalf("active epoch key does not decrypt: %v", err)
+	}
+	if text, err := xipher.DecryptText(cred.Epochs[1].Key, oldCiphertext); err != nil || string(text) != "before rotation" {
+		t.Fatalf("epoch 0 key does not decrypt: %v", err)
+	}
+	if _, err := xipher.DecryptText(cred.Key, oldCiphertext); err == nil {
+		t.Fatal("active epoch key decrypted epoch 0 data")
+	}
+}
@@ -1,12 +1,17 @@
 package kms
 
 import (
+	"bufio"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"strings"
+
+	"xipher.org/xipher"
 )
 
 // minSeedLength is the minimum length, in raw bytes, of the master seed.
@@ -19,6 +24,9 @@ const minSeedLength = 64
 // near 0) while accepting genuine random seeds.
 const minSeedEntropyBits = 4.5
 
+// unsealInput is where an unseal key configured with unseal.stdin is read from.
+var unsealInput io.Reader = os.Stdin
+
 // loadSeed reads the seed file, decodes it if it is hex/base64 encoded,
 // validates length and entropy, deletes the file, and returns the raw bytes.
 //
@@ -29,14 +37,15 @@ func loadSeed(path string) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading seed file %q: %w", path, err)
 	}
+	return loadPlainSeed(path, raw)
+}
 
+// loadPlainSeed validates the plaintext seed read from path and deletes the
+// file, see loadSeed.
+func loadPlainSeed(path string, raw []byte) ([]byte, error) {
 	seed := decodeSeed(raw)
-
-	if len(seed) < minSeedLength {
-		return nil, fmt.Errorf("seed too short: need at least %d bytes, got %d", minSeedLength, len(seed))
-	}
-	if e := shannonEntropy(seed); e < minSeedEntropyBits {
-		return nil, fmt.Errorf("seed entropy too low: %.2f bits/byte (need >= %.1f); seed must be high-entropy random data", e, minSeedEntropyBits)
+	if err := checkSeed(seed); err != nil {
+		return nil, err
 	}
 
 	// Delete the file so the seed does not persist on disk after startup.
@@ -46,6 +55,176 @@ func loadSeed(path string) ([]byte, error) {
 	return seed, nil
 }
 
+// openSeeds reads the seed files of epochs. Plaintext seeds are loaded as
+// loadSeed does, once all of them are valid. Sealed seeds, XCT_ ciphertexts
+// written by xipher kms seal, are kept on disk so the next start unseals them
+// again, and are unsealed with the key or password unseal reads from its env
+// var, file or stdin. With Shamir unsealing, the sealed seeds are returned as
+// is, to be unsealed by the shares operators submit. Seeds are returned in the
+// order of epochs.
+func openSeeds(epochs []seedEpoch, unseal *unsealConfig) ([]epochSeed, []sealedEpoch, error) {
+	raws := make([][]byte, len(epochs))
+	var sealed []sealedEpoch
+	for i, e := range epochs {
+		raw, err := os.ReadFile(e.File)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading seed file %q: %w", e.File, err)
+		}
+		ciphertext := strings.TrimSpace(string(raw))
+		switch {
+		case !xipher.IsCTStr(ciphertext) && unseal.configured():
+			return nil, nil, fmt.Errorf("seed file %q is not sealed but unseal is configured; seal it with xipher kms seal", e.File)
+		case !xipher.IsCTStr(ciphertext):
+			if err := checkSeed(decodeSeed(raw)); err != nil {
+				return nil, nil, fmt.Errorf("seed file %q: %w", e.File, err)
+			}
+		case !unseal.configured():
+			return nil, nil, fmt.Errorf("seed file %q is sealed but unseal is not configured", e.File)
+		default:
+			sealed = append(sealed, sealedEpoch{epoch: e.Epoch, ciphertext: ciphertext})
+		}
+		raws[i] = raw
+	}
+
+	if sealed == nil {
+		seeds := make([]epochSeed, len(epochs))
+		for i, e := range epochs {
+			seed, err := loadPlainSeed(e.File, raws[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			seeds[i] = epochSeed{epoch: e.Epoch, seed: seed}
+		}
+		return seeds, nil, nil
+	}
+	if unseal.Shamir.Threshold != 0 {
+		return nil, sealed, nil
+	}
+	var keyOrPwd string
+	var err error
+	if unseal.Stdin {
+		keyOrPwd, err = readUnsealInput()
+	} else {
+		keyOrPwd, err = unseal.Key.resolve()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading unseal key: %w", err)
+	}
+	seeds, err := unsealSeeds(sealed, keyOrPwd)
+	return seeds, nil, err
+}
+
+// unsealSeeds unseals the sealed seeds of epochs with keyOrPwd, all or none.
+func unsealSeeds(sealed []sealedEpoch, keyOrPwd string) ([]epochSeed, error) {
+	seeds := make([]epochSeed, len(sealed))
+	for i, e := range sealed {
+		seed, err := unsealSeed(e.ciphertext, keyOrPwd)
+		if err != nil {
+			zeroSeeds(seeds)
+			return nil, fmt.Errorf("epoch %d: %w", e.epoch, err)
+		}
+		seeds[i] = epochSeed{epoch: e.epoch, seed: seed}
+	}
+	return seeds, nil
+}
+
+// zeroSeeds zeroes the master seeds of epochs in memory.
+func zeroSeeds(seeds []epochSeed) {
+	for _, e := range seeds {
+		clear(e.seed)
+	}
+}
+
+// readUnsealInput reads the unseal key or password from the first line of
+// unsealInput.
+func readUnsealInput() (string, error) {
+	line, err := bufio.NewReader(unsealInput).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("reading stdin: %w", err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return "", fmt.Errorf("stdin is empty")
+	}
+	return line, nil
+}
+
+// unsealSeed decrypts a sealed seed with its unseal key or password and
+// validates it.
+func unsealSeed(ciphertext, keyOrPwd string) ([]byte, error) {
+	seed, err := xipher.DecryptText(keyOrPwd, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("unsealing seed: %w", err)
+	}
+	if err := checkSeed(seed); err != nil {
+		clear(seed)
+		return nil, err
+	}
+	return seed, nil
+}
+
+// checkSeed validates the length and entropy of a raw seed.
+func checkSeed(seed []byte) error {
+	if len(seed) < minSeedLength {
+		return fmt.Errorf("seed too short: need at least %d bytes, got %d", minSeedLength, len(seed))
+	}
+	if e := shannonEntropy(seed); e < minSeedEntropyBits {
+		return fmt.Errorf("seed entropy too low: %.2f bits/byte (need >= %.1f); seed must be high-entropy random data", e, minSeedEntropyBits)
+	}
+	return nil
+}
+
+// SealSeed validates the plaintext seed file at path, leaving it in place, and
+// returns it sealed under keyOrPwd: an XPK_ public key, an XSK_ secret key or
+// a password. The sealed seed is unsealed with the secret key or the password.
+func SealSeed(path, keyOrPwd string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading seed file %q: %w", path, err)
+	}
+	if xipher.IsCTStr(strings.TrimSpace(string(raw))) {
+		return "", fmt.Errorf("seed file %q is already sealed", path)
+	}
+	seed := decodeSeed(raw)
+	if err := checkSeed(seed); err != nil {
+		return "", err
+	}
+	return xipher.EncryptText(keyOrPwd, seed, false)
+}
+
+// SplitUnsealKey generates a random unseal key to seal a seed with SealSeed,
+// and splits it into shares for the operators listed in unseal.shamir, any
+// threshold of which unseal the seed through the unseal endpoint.
+func SplitUnsealKey(shares, threshold int) (string, []string, error) {
+	seed := make([]byte, credentialSeedLength)
+	defer clear(seed)
+	if _, err := rand.Read(seed); err != nil {
+		return "", nil, err
+	}
+	unsealKey, err := unsealKeyFromSeed(seed)
+	if err != nil {
+		return "", nil, err
+	}
+	split, err := shamirSplit(seed, shares, threshold)
+	if err != nil {
+		return "", nil, err
+	}
+	encoded := make([]string, len(split))
+	for i, share := range split {
+		encoded[i] = shareString(share)
+	}
+	return unsealKey, encoded, nil
+}
+
+// unsealKeyFromSeed returns the XSK_ unseal key of the random bytes split
+// into shares by SplitUnsealKey.
+func unsealKeyFromSeed(seed []byte) (string, error) {
+	sk, err := secretKeyFromSeed(seed)
+	if err != nil {
+		return "", err
+	}
+	return sk.String()
+}
+
 // decodeSeed extrapolates the raw seed bytes. If the trimmed content is valid
 // hex or base64, it is decoded; otherwise the bytes are used verbatim.
 func decodeSeed(raw []byte) []byte {
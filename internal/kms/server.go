@@ -29,17 +29,24 @@ type Server struct {
 	cfg   *Config
 	auths []*authenticator // one per provider, same order as cfg.Providers
 
-	seed []byte
+	// seedMu guards seeds and sealed. seeds are the master seeds of the epochs
+	// that are not retired, the active epoch first; they are nil while the seed
+	// files are sealed awaiting Shamir shares, see unseal.go.
+	seedMu sync.RWMutex
+	seeds  []epochSeed
+	sealed *sealedSeed
 
 	mu     sync.Mutex
 	states map[string]providerState
 }
 
-// NewServer builds a Xipher KMS (XKMS) server: loads the master seed (clearing
-// the seed file), performs OIDC discovery for each configured provider, and
-// prepares the HTTP handlers.
+// NewServer builds a Xipher KMS (XKMS) server: loads the master seed of each
+// epoch (clearing plaintext seed files, or unsealing sealed ones), performs
+// OIDC discovery for each configured provider, and prepares the HTTP handlers.
+// Seeds sealed for Shamir unsealing stay sealed until operators submit enough
+// shares.
 func NewServer(ctx context.Context, cfg *Config) (*Server, error) {
-	seed, err := loadSeed(cfg.SeedFile)
+	seeds, sealed, err := openSeeds(cfg.seedEpochs(), &cfg.Unseal)
 	if err != nil {
 		return nil, err
 	}
@@ -51,16 +58,20 @@ func NewServer(ctx context.Context, cfg *Config) (*Server, error) {
 		}
 		auths[i] = a
 	}
-	return &Server{
+	s := &Server{
 		cfg:    cfg,
 		auths:  auths,
-		seed:   seed,
+		seeds:  seeds,
 		states: make(map[string]providerState),
-	}, nil
+	}
+	if sealed != nil {
+		s.sealed = &sealedSeed{epochs: sealed, shares: make(map[string][]byte)}
+	}
+	return s, nil
 }
 
 // Run starts the HTTP server and blocks until ctx is cancelled, then shuts
-// down gracefully and zeroes the in-memory seed.
+// down gracefully and zeroes the in-memory seeds.
 func (s *Server) Run(ctx context.Context) error {
 	defer s.zeroSeed()
 
@@ -76,6 +87,9 @@ func (s *Server) Run(ctx context.Context) error {
 	mux.HandleFunc("POST /api/v1/credential/user", s.handleCredentialUser)
 	mux.HandleFunc("POST /api/v1/credential/group/{name}", s.handleCredentialGroup)
 	mux.HandleFunc("POST /api/v1/credential/service", s.handleCredentialService)
+	if s.cfg.Unseal.Shamir.Threshold != 0 {
+		mux.HandleFunc("POST /api/v1/unseal", s.handleUnseal)
+	}
 
 	// Public, unauthenticated public-key endpoints (xipher resolver format).
 	// Path: {pubkey_path}{provider}/{type}/{id}/.well-known/xipher
@@ -111,11 +125,22 @@ func (s *Server) Run(ctx context.Context) error {
 }
 
 func (s *Server) zeroSeed() {
-	for i := range s.seed {
-		s.seed[i] = 0
+	s.seedMu.Lock()
+	defer s.seedMu.Unlock()
+	zeroSeeds(s.seeds)
+	if s.sealed != nil {
+		s.sealed.clearShares()
 	}
 }
 
+// masterSeeds returns the master seeds of the epochs that are not retired, the
+// active epoch first, reporting false while they are sealed.
+func (s *Server) masterSeeds() ([]epochSeed, bool) {
+	s.seedMu.RLock()
+	defer s.seedMu.RUnlock()
+	return s.seeds, s.seeds != nil
+}
+
 // putState stores a provider state under a fresh opaque id and returns the id.
 func (s *Server) putState(st providerState) (string, error) {
 	id, err := randomToken(16)
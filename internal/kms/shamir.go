@@ -0,0 +1,128 @@
+package kms
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Shamir's secret sharing over GF(2^8), with the AES reducing polynomial
+// x^8 + x^4 + x^3 + x + 1. Each byte of the secret is the constant term of its
+// own random polynomial of degree threshold-1; a share is the x coordinate it
+// was evaluated at followed by the evaluations, one per secret byte.
+
+const maxShamirShares = 255
+
+var (
+	errBadShamirParams = errors.New("shamir: need 2 <= threshold <= shares <= 255")
+	errBadShares       = errors.New("shamir: shares are malformed, duplicated or of different lengths")
+)
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) to the
+// generator 3.
+var gfExp, gfLog = func() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = byte(i)
+		// Multiply by the generator 3: x*2 ^ x, reduced.
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	return
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// shamirSplit splits secret into n shares, any threshold of which recover it
+// with shamirCombine.
+func shamirSplit(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || n < threshold || n > maxShamirShares {
+		return nil, errBadShamirParams
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+	coeffs := make([]byte, threshold)
+	defer clear(coeffs)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			// Horner's rule from the highest coefficient down.
+			var y byte
+			for k := threshold - 1; k >= 0; k-- {
+				y = gfMul(y, share[0]) ^ coeffs[k]
+			}
+			share[j+1] = y
+		}
+	}
+	return shares, nil
+}
+
+// shamirCombine recovers the secret from threshold or more shares by Lagrange
+// interpolation at x = 0. Fewer shares than the threshold recover garbage,
+// which the caller detects when the secret fails to decrypt.
+func shamirCombine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errBadShares
+	}
+	length := len(shares[0])
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != length || length < 2 || share[0] == 0 || seen[share[0]] {
+			return nil, errBadShares
+		}
+		seen[share[0]] = true
+	}
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		// The Lagrange basis polynomial of share i at 0: the product of
+		// x_j / (x_j - x_i), where subtraction is xor.
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[0], other[0]^share[0]))
+			}
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(share[k+1], basis)
+		}
+	}
+	return secret, nil
+}
+
+// shareString encodes a share for an operator to hold, e.g. "3-0a1b...".
+func shareString(share []byte) string {
+	return fmt.Sprintf("%d-%x", share[0], share[1:])
+}
+
+// parseShareString decodes a share encoded by shareString.
+func parseShareString(s string) ([]byte, error) {
+	var x int
+	var y []byte
+	if n, err := fmt.Sscanf(s, "%d-%x", &x, &y); err != nil || n != 2 || x < 1 || x > maxShamirShares || len(y) == 0 {
+		return nil, errBadShares
+	}
+	return append([]byte{byte(x)}, y...), nil
+}
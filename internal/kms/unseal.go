@@ -0,0 +1,142 @@
+package kms
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// errSealed is the response to key and credential requests while the master
+// seeds are sealed.
+const errSealed = "xkms is sealed"
+
+var (
+	errNotOperator  = errors.New("not an unseal operator")
+	errUnsealFailed = errors.New("shares do not unseal the seeds; submit them again")
+)
+
+// sealedEpoch is the sealed seed of an epoch.
+type sealedEpoch struct {
+	epoch      int
+	ciphertext string
+}
+
+// sealedSeed is the seed files of the epochs sealed under a Shamir-split
+// unseal key, held with the shares operators have submitted so far, keyed by
+// operator.
+type sealedSeed struct {
+	epochs []sealedEpoch
+	shares map[string][]byte
+}
+
+func (sealed *sealedSeed) clearShares() {
+	for operator, share := range sealed.shares {
+		clear(share)
+		delete(sealed.shares, operator)
+	}
+}
+
+// unsealStatus is the response of the unseal endpoint.
+type unsealStatus struct {
+	Sealed    bool `json:"sealed"`
+	Progress  int  `json:"progress,omitempty"`
+	Threshold int  `json:"threshold,omitempty"`
+}
+
+// handleUnseal accepts a share of the unseal key, {"share": "..."}, from an
+// operator listed in unseal.shamir.operators, identified by the provider that
+// verified the token and its user claim. A share submitted again by the same operator replaces
+// their previous one. Once the threshold is met the seeds are unsealed; if the
+// shares do not unseal them, they are all discarded.
+func (s *Server) handleUnseal(w http.ResponseWriter, r *http.Request) {
+	rawToken := s.extractToken(r)
+	if rawToken == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+	claims, authIdx, err := verifyAny(r.Context(), rawToken, s.auths)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	auth := s.auths[authIdx]
+	var user string
+	if auth.cfg.Claims.User != "" {
+		user = stringClaim(claims, auth.cfg.Claims.User)
+	}
+
+	var body struct {
+		Share string `json:"share"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status, err := s.submitShare(auth.cfg.ID, user, body.Share)
+	switch {
+	case errors.Is(err, errNotOperator):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// submitShare records the share of the operator user of the provider
+// providerID, and unseals the seeds once the threshold of shares is met. The
+// same user of another provider is another identity, and not an operator
+// unless listed as such.
+func (s *Server) submitShare(providerID, user, share string) (*unsealStatus, error) {
+	operator := providerID + ":" + user
+	if user == "" || !slices.Contains(s.cfg.Unseal.Shamir.Operators, operator) {
+		return nil, errNotOperator
+	}
+	threshold := s.cfg.Unseal.Shamir.Threshold
+
+	s.seedMu.Lock()
+	defer s.seedMu.Unlock()
+	if s.seeds != nil {
+		return &unsealStatus{Sealed: false}, nil
+	}
+	decoded, err := parseShareString(share)
+	if err != nil {
+		return nil, err
+	}
+	if previous, ok := s.sealed.shares[operator]; ok {
+		clear(previous)
+	}
+	s.sealed.shares[operator] = decoded
+	if len(s.sealed.shares) < threshold {
+		return &unsealStatus{Sealed: true, Progress: len(s.sealed.shares), Threshold: threshold}, nil
+	}
+
+	seeds, err := s.combineShares()
+	s.sealed.clearShares()
+	if err != nil {
+		return nil, errUnsealFailed
+	}
+	s.seeds, s.sealed = seeds, nil
+	return &unsealStatus{Sealed: false}, nil
+}
+
+// combineShares recovers the unseal key from the submitted shares and unseals
+// the seeds with it.
+func (s *Server) combineShares() ([]epochSeed, error) {
+	shares := make([][]byte, 0, len(s.sealed.shares))
+	for _, share := range s.sealed.shares {
+		shares = append(shares, share)
+	}
+	key, err := shamirCombine(shares)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	unsealKey, err := unsealKeyFromSeed(key)
+	if err != nil {
+		return nil, err
+	}
+	return unsealSeeds(s.sealed.epochs, unsealKey)
+}
@@ -32,8 +32,8 @@ func xipherNewSecretKey(secretKey **C.char, secretKeyLength *C.int, errMessage *
 	}
 }
 
-func xipherGetPublicKey(secretKeyOrPassword *C.char, quantumSafe C.int, publicKey **C.char, publicKeyLength *C.int, errMessage **C.char, errLength *C.int) {
-	if pubKey, _, err := utils.GetPublicKey(C.GoString(secretKeyOrPassword), quantumSafe != 0); err != nil {
+func xipherGetPublicKey(secretKeyOrPassword *C.char, suite C.int, publicKey **C.char, publicKeyLength *C.int, errMessage **C.char, errLength *C.int) {
+	if pubKey, _, err := utils.GetPublicKey(C.GoString(secretKeyOrPassword), xipher.Suite(suite)); err != nil {
 		*publicKey = nil
 		*publicKeyLength = 0
 		*errMessage = C.CString(err.Error())
@@ -48,8 +48,8 @@ func xipherGetPublicKey(secretKeyOrPassword *C.char, quantumSafe C.int, publicKe
 
 func xipherEncryptData(keyOrPassword *C.char, data *C.char, cipherText **C.char, cipherTextLength *C.int, errMessage **C.char, errLength *C.int) {
 	dataBytes := C.GoBytes(unsafe.Pointer(data), C.int(len(C.GoString(data))))
-	// Resolve URL/domain key references before encrypting; EncryptData no longer
-	// fetches remote keys itself (the HTTP path was moved out for the WASM build).
+	// Resolve URL/domain key references before encrypting; EncryptText never
+	// fetches remote keys itself.
 	keyOrPwd, err := utils.ResolveKeyForEncryption(C.GoString(keyOrPassword))
 	if err != nil {
 		*cipherText = nil
@@ -58,7 +58,7 @@ func xipherEncryptData(keyOrPassword *C.char, data *C.char, cipherText **C.char,
 		*errLength = C.int(len(err.Error()))
 		return
 	}
-	if ct, _, err := utils.EncryptData(keyOrPwd, dataBytes, true); err != nil {
+	if ct, err := xipher.EncryptText(keyOrPwd, dataBytes, true); err != nil {
 		*cipherText = nil
 		*cipherTextLength = 0
 		*errMessage = C.CString(err.Error())
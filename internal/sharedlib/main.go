@@ -11,11 +11,14 @@ func XipherNewSecretKey(secretKey **C.char, secretKeyLength *C.int, errMessage *
 	xipherNewSecretKey(secretKey, secretKeyLength, errMessage, errLength)
 }
 
-// XipherGetPublicKey generates a new public key from a secret key or password
+// XipherGetPublicKey generates a new public key from a secret key or password.
+// suite selects the algorithm: 0 = X25519, 1 = X25519 + ML-KEM-1024,
+// 2 = X25519 + ML-KEM-768, 3 = ML-KEM-1024. Values 0 and 1 match the former
+// quantumSafe flag.
 //
 //export XipherGetPublicKey
-func XipherGetPublicKey(secretKeyOrPassword *C.char, quantumSafe C.int, publicKey **C.char, publicKeyLength *C.int, errMessage **C.char, errLength *C.int) {
-	xipherGetPublicKey(secretKeyOrPassword, quantumSafe, publicKey, publicKeyLength, errMessage, errLength)
+func XipherGetPublicKey(secretKeyOrPassword *C.char, suite C.int, publicKey **C.char, publicKeyLength *C.int, errMessage **C.char, errLength *C.int) {
+	xipherGetPublicKey(secretKeyOrPassword, suite, publicKey, publicKeyLength, errMessage, errLength)
 }
 
 // XipherEncryptData encrypts data with a given public key, secret key or password
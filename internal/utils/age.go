@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"xipher.org/xipher"
+	"xipher.org/xipher/internal/crypto/age"
+)
+
+// ageSniffLength is how much of the input is read to tell age files from xipher ciphertext.
+const ageSniffLength = 64
+
+// ageRecipient returns the age recipient for keyOrPwd: an age X25519 recipient,
+// a xipher SuiteECC public key, a xipher secret key (for its SuiteECC public
+// key) or a password, which is used with an scrypt recipient; an unresolved key
+// URL is xipher.ErrInvalidPublicKey. Public keys past
+// their expiry are rejected with xipher.ErrKeyExpired unless allowExpired is set.
+func ageRecipient(keyOrPwd string, allowExpired bool) (age.Recipient, error) {
+	if xipher.IsAgeRecipientStr(keyOrPwd) {
+		return age.ParseX25519Recipient(keyOrPwd)
+	}
+	if xipher.IsSSHPublicKeyStr(keyOrPwd) {
+		return nil, fmt.Errorf("%w: ssh-ed25519 recipients are not supported", xipher.ErrAgeKeyUnsupported)
+	}
+	input, err := xipher.ParseKeyInput(keyOrPwd)
+	if err != nil {
+		return nil, err
+	}
+	pubKey := input.PublicKey
+	switch input.Kind {
+	case xipher.KeyInputPublicKey:
+		if meta := pubKey.Metadata(); meta != nil && meta.IsExpired(time.Now()) && !allowExpired {
+			return nil, fmt.Errorf("%w on %s", xipher.ErrKeyExpired, meta.NotAfter.Format(time.RFC3339))
+		}
+	case xipher.KeyInputSecretKey:
+		if pubKey, err = input.SecretKey.PublicKey(xipher.SuiteECC); err != nil {
+			return nil, err
+		}
+	case xipher.KeyInputURL:
+		return nil, xipher.ErrInvalidPublicKey
+	default:
+		return age.NewScryptRecipient(input.Value)
+	}
+	recipient, err := pubKey.AgeRecipient()
+	if err != nil {
+		return nil, err
+	}
+	return age.ParseX25519Recipient(recipient)
+}
+
+// ageIdentity returns the age identity for secretKeyOrPwd: an age X25519
+// identity, a xipher secret key (for its X25519 part) or a password, which is
+// used with an scrypt identity.
+func ageIdentity(secretKeyOrPwd string) (age.Identity, error) {
+	switch {
+	case xipher.IsAgeIdentityStr(secretKeyOrPwd):
+		return age.ParseX25519Identity(secretKeyOrPwd)
+	case xipher.IsSecretKeyStr(secretKeyOrPwd):
+		secretKey, err := xipher.ParseSecretKeyStr(secretKeyOrPwd)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := secretKey.AgeIdentity()
+		if err != nil {
+			return nil, err
+		}
+		return age.ParseX25519Identity(identity)
+	case IsSSHPrivateKey(secretKeyOrPwd):
+		return nil, fmt.Errorf("%w: ssh-ed25519 identities are not supported", xipher.ErrAgeKeyUnsupported)
+	case secretKeyOrPwd == "":
+		return nil, xipher.ErrInvalidPassword
+	}
+	return age.NewScryptIdentity(secretKeyOrPwd)
+}
+
+// GetAgeKeys returns the age identity and recipient of a secret key or an age
+// identity. Password-based keys have no age equivalent.
+func GetAgeKeys(secretKeyOrPwd string) (identity, recipient string, err error) {
+	secretKey, err := secretKeyFromSecret(secretKeyOrPwd)
+	if err != nil {
+		return "", "", err
+	}
+	if identity, err = secretKey.AgeIdentity(); err != nil {
+		return "", "", err
+	}
+	pubKey, err := secretKey.PublicKey(xipher.SuiteECC)
+	if err != nil {
+		return "", "", err
+	}
+	if recipient, err = pubKey.AgeRecipient(); err != nil {
+		return "", "", err
+	}
+	return identity, recipient, nil
+}
+
+type ageWriter struct {
+	io.WriteCloser
+	armor io.WriteCloser
+}
+
+func (w *ageWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if w.armor != nil {
+		return w.armor.Close()
+	}
+	return nil
+}
+
+// NewAgeEncryptingWriter returns a WriteCloser that encrypts to keyOrPwd in the
+// age v1 format, ASCII armored if armor is set, so that age and rage can decrypt
+// it. keyOrPwd may be an age recipient, a xipher SuiteECC public key, a secret
+// key or a password. Close must be called to finish the file; it does not close dst.
+func NewAgeEncryptingWriter(keyOrPwd string, dst io.Writer, armor, allowExpired bool) (io.WriteCloser, error) {
+	recipient, err := ageRecipient(keyOrPwd, allowExpired)
+	if err != nil {
+		return nil, err
+	}
+	w := &ageWriter{}
+	if armor {
+		w.armor = age.NewArmoredWriter(dst)
+		dst = w.armor
+	}
+	if w.WriteCloser, err = age.Encrypt(dst, recipient); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// EncryptAgeStream encrypts src to keyOrPwd in the age format and writes it to dst.
+func EncryptAgeStream(keyOrPwd string, dst io.Writer, src io.Reader, armor, allowExpired bool) error {
+	encryptingWriter, err := NewAgeEncryptingWriter(keyOrPwd, dst, armor, allowExpired)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(encryptingWriter, src); err != nil {
+		return err
+	}
+	return encryptingWriter.Close()
+}
+
+// sniffAge wraps src in a buffered reader and reports whether it holds an age
+// file, binary or ASCII armored.
+func sniffAge(src io.Reader) (*bufio.Reader, bool, bool) {
+	br := bufio.NewReader(src)
+	prefix, _ := br.Peek(ageSniffLength)
+	return br, age.IsAgeFile(prefix), age.IsArmored(prefix)
+}
+
+// newAgeDecryptingReader decrypts the age file in src with secretKeyOrPwd.
+func newAgeDecryptingReader(secretKeyOrPwd string, src io.Reader, armored bool) (io.Reader, error) {
+	identity, err := ageIdentity(secretKeyOrPwd)
+	if err != nil {
+		return nil, err
+	}
+	if armored {
+		src = age.NewArmoredReader(src)
+	}
+	return age.Decrypt(src, identity)
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xipher.org/xipher"
+)
+
+func TestAgeEncryption(t *testing.T) {
+	skStr := newTestSecretKey(t)
+	sk, err := xipher.ParseSecretKeyStr(skStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := sk.AgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eccPubKey, _ := sk.PublicKey(xipher.SuiteECC)
+	pubKeyStr, _ := eccPubKey.String()
+	recipient, _ := eccPubKey.AgeRecipient()
+	plaintext := bytes.Repeat([]byte("age interop "), 10000)
+
+	for _, key := range []string{recipient, pubKeyStr, skStr} {
+		for _, armor := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := EncryptAgeStream(key, &buf, bytes.NewReader(plaintext), armor, false); err != nil {
+				t.Fatalf("EncryptAgeStream(%.12s, armor %v): %v", key, armor, err)
+			}
+			prefix := "age-encryption.org/v1\n"
+			if armor {
+				prefix = "-----BEGIN AGE ENCRYPTED FILE-----\n"
+			}
+			if !strings.HasPrefix(buf.String(), prefix) {
+				t.Fatalf("unexpected age file start %q", buf.String()[:20])
+			}
+			for _, secret := range []string{identity, skStr} {
+				var out bytes.Buffer
+				if err := DecryptStream(secret, &out, bytes.NewReader(buf.Bytes())); err != nil {
+					t.Fatalf("DecryptStream(%.12s): %v", secret, err)
+				}
+				if !bytes.Equal(out.Bytes(), plaintext) {
+					t.Fatalf("round trip mismatch for %.12s", key)
+				}
+			}
+		}
+	}
+
+	// xipher ciphertext for an age recipient decrypts with the age identity.
+	ctStr, _, err := EncryptData(recipient, []byte("xipher format"), true)
+	if err != nil {
+		t.Fatalf("EncryptData to age recipient: %v", err)
+	}
+	if pt, err := DecryptData(identity, ctStr); err != nil || string(pt) != "xipher format" {
+		t.Errorf("DecryptData with age identity = %q, %v", pt, err)
+	}
+	if _, isKey, _, _ := GetSanitisedKeyOrPwd(recipient); !isKey {
+		t.Error("GetSanitisedKeyOrPwd: age recipient not recognised as a key")
+	}
+
+	hybPubKey, _ := sk.PublicKey(xipher.SuiteHybrid)
+	hybPubKeyStr, _ := hybPubKey.String()
+	if _, err := NewAgeEncryptingWriter(hybPubKeyStr, &bytes.Buffer{}, false, false); !errors.Is(err, xipher.ErrAgeKeyUnsupported) {
+		t.Errorf("hybrid public key: expected ErrAgeKeyUnsupported, got %v", err)
+	}
+	other := newTestSecretKey(t)
+	var buf bytes.Buffer
+	if err := EncryptAgeStream(recipient, &buf, strings.NewReader("secret"), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecryptStream(other, &bytes.Buffer{}, &buf); !errors.Is(err, xipher.ErrWrongKey) {
+		t.Errorf("other key: expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestAgePassword(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncryptAgeStream("correct horse battery staple", &buf, strings.NewReader("for a passphrase"), true, false); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := DecryptStream("correct horse battery staple", &out, &buf); err != nil || out.String() != "for a passphrase" {
+		t.Errorf("DecryptStream = %q, %v", out.String(), err)
+	}
+}
+
+// TestAgeVector decrypts a test vector of the age package through the same
+// path the CLI uses.
+func TestAgeVector(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "crypto", "age", "testdata", "x25519"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, file, _ := bytes.Cut(data, []byte("\n\n"))
+	var identity string
+	for _, line := range strings.Split(string(headers), "\n") {
+		if value, ok := strings.CutPrefix(line, "identity: "); ok {
+			identity = value
+		}
+	}
+	var out bytes.Buffer
+	if err := DecryptStream(identity, &out, bytes.NewReader(file)); err != nil || out.String() != "age" {
+		t.Errorf("DecryptStream = %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,559 @@
+package utils
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"xipher.org/xipher"
+)
+
+// archiveContentType is the content type recorded in the file info of encrypted directories.
+const archiveContentType = "application/x-tar"
+
+// Archive entry types.
+const (
+	EntryFile    = "file"
+	EntryDir     = "dir"
+	EntrySymlink = "symlink"
+)
+
+var errUnsafeArchivePath = errors.New("unsafe path in archive")
+
+// ArchiveFilter selects archive entries by their slash-separated path relative
+// to the archive root. A pattern matches an entry if it matches the path, or,
+// for patterns without a slash, the base name of the entry or of any directory
+// containing it. Patterns use path.Match syntax.
+type ArchiveFilter struct {
+	Include []string // If set, only files and symlinks matching one of these are kept
+	Exclude []string // Entries matching any of these are dropped, directories with their contents
+}
+
+// matchPattern reports whether pattern matches name or one of its parent directories.
+func matchPattern(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	for candidate := name; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+		if ok, _ := path.Match(pattern, candidate); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(candidate)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// excluded reports whether name matches an exclude pattern.
+func (filter *ArchiveFilter) excluded(name string) bool {
+	if filter == nil {
+		return false
+	}
+	for _, pattern := range filter.Exclude {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether a file or symlink at name is selected by the filter.
+func (filter *ArchiveFilter) included(name string) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.excluded(name) {
+		return false
+	}
+	if len(filter.Include) == 0 {
+		return true
+	}
+	for _, pattern := range filter.Include {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepDir reports whether a directory entry is kept. With include patterns,
+// directories are only created as parents of the entries that are kept.
+func (filter *ArchiveFilter) keepDir(name string) bool {
+	return filter == nil || len(filter.Include) == 0 && !filter.excluded(name)
+}
+
+// ArchiveEntry describes an entry of a directory archive.
+type ArchiveEntry struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Size     int64       `json:"size"`
+	Mode     fs.FileMode `json:"mode"`
+	ModTime  time.Time   `json:"modTime"`
+	Linkname string      `json:"linkname,omitempty"`
+}
+
+func newArchiveEntry(hdr *tar.Header) ArchiveEntry {
+	entry := ArchiveEntry{
+		Name:     strings.TrimSuffix(hdr.Name, "/"),
+		Size:     hdr.Size,
+		Mode:     fs.FileMode(hdr.Mode).Perm(),
+		ModTime:  hdr.ModTime,
+		Linkname: hdr.Linkname,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		entry.Type = EntryDir
+	case tar.TypeSymlink:
+		entry.Type = EntrySymlink
+	default:
+		entry.Type = EntryFile
+	}
+	return entry
+}
+
+// WriteArchive writes the tree under dir to dst as a tar archive and returns
+// the entries written. Symlinks are stored as links and never followed; other
+// special files such as devices and sockets are skipped.
+func WriteArchive(dst io.Writer, dir string, filter *ArchiveFilter) ([]ArchiveEntry, error) {
+	tw := tar.NewWriter(dst)
+	var entries []ArchiveEntry
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			if filter.excluded(name) {
+				return fs.SkipDir
+			}
+			if !filter.keepDir(name) {
+				return nil
+			}
+		case d.Type().IsRegular(), d.Type()&fs.ModeSymlink != 0:
+			if !filter.included(name) {
+				return nil
+			}
+		default:
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(filePath); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Mode = int64(info.Mode().Perm())
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			f, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		entries = append(entries, newArchiveEntry(hdr))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, tw.Close()
+}
+
+// archiveEntryPath validates the name of an archive entry and returns it as a
+// clean, relative, slash-separated path.
+func archiveEntryPath(name string) (string, error) {
+	clean := path.Clean(strings.TrimSuffix(name, "/"))
+	if name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") ||
+		strings.ContainsAny(name, "\\\x00") || filepath.VolumeName(clean) != "" {
+		return "", fmt.Errorf("%w: %q", errUnsafeArchivePath, name)
+	}
+	return clean, nil
+}
+
+// checkSymlinkTarget rejects symlinks that are absolute or point outside the
+// extraction directory.
+func checkSymlinkTarget(name, target string) error {
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) || strings.ContainsAny(target, "\\\x00") {
+		return fmt.Errorf("%w: symlink %q points to %q", errUnsafeArchivePath, name, target)
+	}
+	resolved := path.Join(path.Dir(name), target)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("%w: symlink %q points outside the directory to %q", errUnsafeArchivePath, name, target)
+	}
+	return nil
+}
+
+// checkEntryParents rejects an entry whose parent path goes through a symlink,
+// e.g. one extracted earlier from the archive: checkSymlinkTarget resolves link
+// targets against the path text, which no longer matches where the link lands
+// once a parent is a link.
+func checkEntryParents(root *os.Root, name string) error {
+	parent := ""
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "." {
+			break
+		}
+		parent = path.Join(parent, elem)
+		info, err := root.Lstat(filepath.FromSlash(parent))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %q is inside the symlink %q", errUnsafeArchivePath, name, parent)
+		}
+	}
+	return nil
+}
+
+// ListArchive reads the tar archive in src and returns its entries.
+func ListArchive(src io.Reader, filter *ArchiveFilter) ([]ArchiveEntry, error) {
+	return readArchive(src, filter, nil)
+}
+
+// ExtractArchive extracts the tar archive in src into dir, creating dir if
+// needed, and returns the entries extracted. All writes go through an os.Root
+// so entries cannot escape dir, even through symlinks; entries with unsafe
+// paths, symlinks pointing outside dir and entries inside symlinks are
+// rejected. Existing files are only
+// replaced if overwrite is set.
+func ExtractArchive(src io.Reader, dir string, filter *ArchiveFilter, overwrite bool) ([]ArchiveEntry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	var dirs []ArchiveEntry
+	entries, err := readArchive(src, filter, func(entry ArchiveEntry, r io.Reader) error {
+		if err := checkEntryParents(root, entry.Name); err != nil {
+			return err
+		}
+		name := filepath.FromSlash(entry.Name)
+		if parent := filepath.Dir(name); parent != "." {
+			if err := root.MkdirAll(parent, 0o755); err != nil {
+				return err
+			}
+		}
+		switch entry.Type {
+		case EntryDir:
+			if err := root.MkdirAll(name, 0o700); err != nil {
+				return err
+			}
+			dirs = append(dirs, entry)
+			return nil
+		case EntrySymlink:
+			if overwrite {
+				if err := root.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+			}
+			return root.Symlink(entry.Linkname, name)
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if overwrite {
+			if info, err := root.Lstat(name); err == nil && !info.Mode().IsRegular() {
+				return fmt.Errorf("cannot overwrite %s: not a regular file", entry.Name)
+			}
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := root.OpenFile(name, flags, 0o600)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+		return restoreEntry(root, name, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Restore directories last, deepest first, so that writing their contents
+	// neither fails on read-only modes nor bumps their modification times.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := restoreEntry(root, filepath.FromSlash(dirs[i].Name), dirs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// restoreEntry applies the permissions and modification time of entry.
+func restoreEntry(root *os.Root, name string, entry ArchiveEntry) error {
+	if err := root.Chmod(name, entry.Mode.Perm()); err != nil {
+		return err
+	}
+	return root.Chtimes(name, entry.ModTime, entry.ModTime)
+}
+
+// readArchive reads the entries of the tar archive in src that the filter
+// keeps, calling extract for each if it is not nil. Entry paths are validated
+// whether or not they are extracted.
+func readArchive(src io.Reader, filter *ArchiveFilter, extract func(ArchiveEntry, io.Reader) error) ([]ArchiveEntry, error) {
+	tr := tar.NewReader(src)
+	var entries []ArchiveEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+		default:
+			continue
+		}
+		name, err := archiveEntryPath(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Name = name
+		entry := newArchiveEntry(hdr)
+		if entry.Type == EntryDir && !filter.keepDir(name) || entry.Type != EntryDir && !filter.included(name) {
+			continue
+		}
+		if entry.Type == EntrySymlink {
+			if err := checkSymlinkTarget(name, entry.Linkname); err != nil {
+				return nil, err
+			}
+		}
+		if extract != nil {
+			if err := extract(entry, tr); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// EncryptDir encrypts the tree under dir as a tar archive and writes the
+// ciphertext to dst. The ciphertext records the directory name in its file
+// info.
+func EncryptDir(keyOrPwd string, dst io.Writer, dir string, filter *ArchiveFilter, compress, encode bool, opts ...xipher.EncryptOption) ([]ArchiveEntry, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	fileInfo := xipher.NewFileInfo(info)
+	fileInfo.Size = -1
+	fileInfo.ContentType = archiveContentType
+	opts = append(opts, xipher.WithFileInfo(fileInfo))
+	encryptingWriter, err := NewEncryptingWriter(keyOrPwd, dst, compress, encode, opts...)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := WriteArchive(encryptingWriter, dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	return entries, encryptingWriter.Close()
+}
+
+// DecryptDir decrypts a directory encrypted with EncryptDir and extracts it into
+// dir. The archive is extracted into a temporary directory next to dir and only
+// moved into place once the whole ciphertext has been authenticated, so nothing
+// is written to dir if decryption fails. If dir exists, the entries are merged
+// into it; existing files are only replaced if overwrite is set.
+func DecryptDir(secretKeyOrPwd string, src io.Reader, dir string, filter *ArchiveFilter, overwrite bool) ([]ArchiveEntry, error) {
+	reader, _, err := NewFileDecryptingReader(secretKeyOrPwd, src)
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Clean(dir)
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".xipher-*")
+	if err != nil {
+		return nil, err
+	}
+	defer removeExtracted(tmpDir)
+	entries, err := ExtractArchive(reader, tmpDir, filter, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	// Read to the end so the final chunk is authenticated too.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmpDir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := moveExtracted(tmpDir, dir, overwrite); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// moveExtracted moves the tree extracted into src to dst. If dst does not exist
+// src is renamed to it, otherwise the entries of src are merged into dst:
+// directories missing from dst are moved whole, and files and symlinks replace
+// those in dst if overwrite is set. All conflicts are checked before anything is
+// moved, and directories in dst are never followed through symlinks.
+func moveExtracted(src, dst string, overwrite bool) error {
+	info, err := os.Lstat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Rename(src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot extract into %s: not a directory", dst)
+	}
+	err = filepath.WalkDir(src, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || p == src {
+			return err
+		}
+		name, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		existing, err := os.Lstat(filepath.Join(dst, name))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case err != nil:
+			return err
+		case entry.IsDir():
+			if !existing.IsDir() {
+				return fmt.Errorf("cannot overwrite %s: not a directory", name)
+			}
+			return nil
+		case !overwrite:
+			return fmt.Errorf("%s: %w", filepath.Join(dst, name), fs.ErrExist)
+		case existing.IsDir() || entry.Type().IsRegular() && !existing.Mode().IsRegular():
+			return fmt.Errorf("cannot overwrite %s: not a regular file", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var merged []ArchiveEntry
+	err = filepath.WalkDir(src, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || p == src {
+			return err
+		}
+		name, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, name)
+		if !entry.IsDir() {
+			return os.Rename(p, target)
+		}
+		if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+			if err := os.Rename(p, target); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		// Entries are moved out of this directory, which needs write access
+		// even if the archive made it read-only.
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		merged = append(merged, ArchiveEntry{Name: name, Mode: info.Mode().Perm(), ModTime: info.ModTime()})
+		return os.Chmod(p, info.Mode().Perm()|0o700)
+	})
+	if err != nil {
+		return err
+	}
+	// Moving entries into the merged directories bumped their modification
+	// times, so restore their attributes, deepest first.
+	for i := len(merged) - 1; i >= 0; i-- {
+		target := filepath.Join(dst, merged[i].Name)
+		if err := os.Chmod(target, merged[i].Mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, merged[i].ModTime, merged[i].ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExtracted removes what is left of an extracted tree, making its
+// directories writable first in case the archive made them read-only.
+func removeExtracted(dir string) error {
+	filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			os.Chmod(p, 0o700)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// ListEncryptedDir decrypts a directory encrypted with EncryptDir and returns
+// its entries without extracting them.
+func ListEncryptedDir(secretKeyOrPwd string, src io.Reader, filter *ArchiveFilter) ([]ArchiveEntry, error) {
+	reader, _, err := NewFileDecryptingReader(secretKeyOrPwd, src)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ListArchive(reader, filter)
+	if err != nil {
+		return nil, err
+	}
+	// Read to the end so the final chunk is authenticated too.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
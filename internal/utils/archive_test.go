@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"xipher.org/xipher"
+)
+
+// newTestTree creates a small directory tree and returns its path.
+func newTestTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":              "alpha",
+		"docs/b.md":          "bravo",
+		"docs/deep/c.txt":    "charlie",
+		"node_modules/x.js":  "x-ray",
+		"scripts/run.sh":     "#!/bin/sh\n",
+		"empty/.placeholder": "",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "scripts", "run.sh"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../a.txt", filepath.Join(dir, "docs", "link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func entryNames(entries []ArchiveEntry) []string {
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestEncryptDirRoundTrip(t *testing.T) {
+	src := newTestTree(t)
+	sk, err := xipher.NewSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	skStr, err := sk.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ct bytes.Buffer
+	written, err := EncryptDir(skStr, &ct, src, nil, true, false)
+	if err != nil {
+		t.Fatalf("EncryptDir: %v", err)
+	}
+	listed, err := ListEncryptedDir(skStr, bytes.NewReader(ct.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("ListEncryptedDir: %v", err)
+	}
+	if !slices.Equal(entryNames(listed), entryNames(written)) {
+		t.Errorf("listed %v, wrote %v", entryNames(listed), entryNames(written))
+	}
+	dst := filepath.Join(t.TempDir(), "out")
+	if _, err := DecryptDir(skStr, bytes.NewReader(ct.Bytes()), dst, nil, false); err != nil {
+		t.Fatalf("DecryptDir: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "docs", "deep", "c.txt")); err != nil || string(data) != "charlie" {
+		t.Errorf("c.txt = %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "scripts", "run.sh")); err != nil || info.Mode().Perm() != 0o750 {
+		t.Errorf("run.sh mode = %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "docs", "link")); err != nil || target != "../a.txt" {
+		t.Errorf("link = %q, %v", target, err)
+	}
+	if _, err := DecryptDir(skStr, bytes.NewReader(ct.Bytes()), dst, nil, false); err == nil {
+		t.Errorf("extracting over existing files without overwrite succeeded")
+	}
+	if _, err := DecryptDir(skStr, bytes.NewReader(ct.Bytes()), dst, nil, true); err != nil {
+		t.Errorf("extracting with overwrite: %v", err)
+	}
+}
+
+func TestDecryptDirAtomic(t *testing.T) {
+	src := newTestTree(t)
+	if err := os.Chmod(filepath.Join(src, "docs", "deep"), 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(src, "docs", "deep"), 0o700) })
+	sk, err := xipher.NewSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	skStr, err := sk.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ct bytes.Buffer
+	if _, err := EncryptDir(skStr, &ct, src, nil, true, false); err != nil {
+		t.Fatalf("EncryptDir: %v", err)
+	}
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "out")
+	corrupted := bytes.Clone(ct.Bytes())
+	corrupted[len(corrupted)-1] ^= 1
+	if _, err := DecryptDir(skStr, bytes.NewReader(corrupted), dst, nil, false); err == nil {
+		t.Fatal("DecryptDir of a corrupted ciphertext succeeded")
+	}
+	if left, err := os.ReadDir(parent); err != nil || len(left) != 0 {
+		t.Fatalf("failed DecryptDir left %v, %v", left, err)
+	}
+
+	if _, err := DecryptDir(skStr, bytes.NewReader(ct.Bytes()), dst, nil, false); err != nil {
+		t.Fatalf("DecryptDir: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(dst, "docs", "deep"), 0o700) })
+	if err := os.WriteFile(filepath.Join(dst, "a.txt"), []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptDir(skStr, bytes.NewReader(corrupted), dst, nil, true); err == nil {
+		t.Fatal("DecryptDir of a corrupted ciphertext succeeded")
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "a.txt")); err != nil || string(data) != "local" {
+		t.Errorf("failed DecryptDir changed a.txt to %q, %v", data, err)
+	}
+	if _, err := DecryptDir(skStr, bytes.NewReader(ct.Bytes()), dst, nil, true); err != nil {
+		t.Fatalf("merging with overwrite: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "a.txt")); err != nil || string(data) != "alpha" {
+		t.Errorf("a.txt = %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "docs", "deep")); err != nil || info.Mode().Perm() != 0o500 {
+		t.Errorf("docs/deep mode = %v, %v", info, err)
+	}
+	if left, err := os.ReadDir(parent); err != nil || len(left) != 1 {
+		t.Errorf("DecryptDir left %v, %v", left, err)
+	}
+}
+
+func TestArchiveFilter(t *testing.T) {
+	src := newTestTree(t)
+	var buf bytes.Buffer
+	entries, err := WriteArchive(&buf, src, &ArchiveFilter{Exclude: []string{"node_modules", "*.md"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "docs", "docs/deep", "docs/deep/c.txt", "docs/link", "empty", "empty/.placeholder", "scripts", "scripts/run.sh"}
+	if got := entryNames(entries); !slices.Equal(got, want) {
+		t.Errorf("exclude: got %v, want %v", got, want)
+	}
+	listed, err := ListArchive(bytes.NewReader(buf.Bytes()), &ArchiveFilter{Include: []string{"*.txt", "scripts"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"a.txt", "docs/deep/c.txt", "scripts/run.sh"}
+	if got := entryNames(listed); !slices.Equal(got, want) {
+		t.Errorf("include: got %v, want %v", got, want)
+	}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	cases := map[string][]*tar.Header{
+		"parent":        {{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0o644}},
+		"nested parent": {{Name: "a/../../evil.txt", Typeflag: tar.TypeReg, Mode: 0o644}},
+		"absolute":      {{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg, Mode: 0o644}},
+		"absolute link": {{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+		"escaping link": {{Name: "a/link", Typeflag: tar.TypeSymlink, Linkname: "../../outside"}},
+		"backslash":     {{Name: `..\evil.txt`, Typeflag: tar.TypeReg, Mode: 0o644}},
+		// s/s2 -> .. looks like it points to s/.., but s is a link to the
+		// directory itself, so it would land as s2 -> .. outside it.
+		"chained link": {
+			{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "s/s2", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		},
+		"file in link": {
+			{Name: "d/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "d"},
+			{Name: "s/evil.txt", Typeflag: tar.TypeReg, Mode: 0o644},
+		},
+	}
+	for name, hdrs := range cases {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range hdrs {
+			hdr.ModTime = time.Now()
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		dir := filepath.Join(t.TempDir(), "out")
+		if _, err := ExtractArchive(bytes.NewReader(buf.Bytes()), dir, nil, false); !errors.Is(err, errUnsafeArchivePath) {
+			t.Errorf("%s: expected errUnsafeArchivePath, got %v", name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "s2")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: s2 was extracted: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFileWriter writes to a temporary file in the directory of the
+// destination and renames it to the destination on Close, so the destination
+// never holds a partially written file, even if the process is interrupted.
+type AtomicFileWriter struct {
+	filePath string
+	file     *os.File
+	done     bool
+}
+
+// NewAtomicFileWriter creates the temporary file for filePath with the given permissions.
+func NewAtomicFileWriter(filePath string, perm fs.FileMode) (*AtomicFileWriter, error) {
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for %s: %w", filePath, err)
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &AtomicFileWriter{filePath: filePath, file: file}, nil
+}
+
+func (aw *AtomicFileWriter) Write(p []byte) (int, error) {
+	if aw.done {
+		return 0, fmt.Errorf("writer has been closed")
+	}
+	return aw.file.Write(p)
+}
+
+// Flush syncs the data written so far to disk.
+func (aw *AtomicFileWriter) Flush() error {
+	if aw.done {
+		return fmt.Errorf("writer has been closed")
+	}
+	return aw.file.Sync()
+}
+
+// Discard removes the temporary file, leaving the destination untouched.
+func (aw *AtomicFileWriter) Discard() error {
+	if aw.done {
+		return nil
+	}
+	aw.done = true
+	aw.file.Close()
+	return os.Remove(aw.file.Name())
+}
+
+// Close syncs the temporary file, renames it to the destination, replacing any
+// existing file, and syncs the directory so the rename is durable.
+func (aw *AtomicFileWriter) Close() error {
+	if aw.done {
+		return nil
+	}
+	if err := aw.file.Sync(); err != nil {
+		aw.Discard()
+		return err
+	}
+	aw.done = true
+	if err := aw.file.Close(); err != nil {
+		os.Remove(aw.file.Name())
+		return err
+	}
+	if err := os.Rename(aw.file.Name(), aw.filePath); err != nil {
+		os.Remove(aw.file.Name())
+		return err
+	}
+	syncDir(filepath.Dir(aw.filePath))
+	return nil
+}
+
+// syncDir syncs a directory to persist renames in it. It is best-effort, as
+// some platforms cannot sync directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// RemoveFile removes the file at filePath. If shred is set, the contents are
+// first overwritten with random data and synced. Shredding is best-effort:
+// journaling and copy-on-write file systems, SSD wear levelling, snapshots and
+// backups may all keep copies of the original data.
+func RemoveFile(filePath string, shred bool) error {
+	if shred {
+		if err := overwriteFile(filePath); err != nil {
+			return err
+		}
+	}
+	return os.Remove(filePath)
+}
+
+// overwriteFile overwrites the contents of the regular file at filePath with random data.
+func overwriteFile(filePath string) error {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cannot shred %s: not a regular file", filePath)
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.CopyN(file, rand.Reader, info.Size()); err != nil {
+		return err
+	}
+	return file.Sync()
+}
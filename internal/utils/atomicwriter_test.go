@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out.txt")
+	if err := os.WriteFile(target, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	aw, err := NewAtomicFileWriter(target, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aw.Write([]byte("new contents")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("destination changed before Close: %q", data)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new contents" {
+		t.Errorf("destination = %q after Close", data)
+	}
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("destination mode = %v, %v", info, err)
+	}
+
+	aw, err = NewAtomicFileWriter(target, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Write([]byte("partial"))
+	if err := aw.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new contents" {
+		t.Errorf("destination = %q after Discard", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestRemoveFileShred(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(target, []byte("top secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := overwriteFile(target); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); len(data) != len("top secret") || string(data) == "top secret" {
+		t.Errorf("file not overwritten: %q", data)
+	}
+	if err := RemoveFile(target, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("file not removed: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BatchFile is an input file of a batch operation.
+type BatchFile struct {
+	Path string // Path of the input file
+	Rel  string // Path relative to the directory argument it was found in, or its base name
+}
+
+// BatchResult is the outcome of processing a single file of a batch.
+type BatchResult struct {
+	Path   string `json:"path"`
+	Output string `json:"output,omitempty"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Err    error  `json:"-"`
+}
+
+// ExpandPaths expands the given paths into the files of a batch. Glob patterns
+// are expanded; directories are walked if recursive is set and rejected
+// otherwise. Files found in directories are kept only if match returns true,
+// while files named explicitly are always kept. A file is listed only once.
+func ExpandPaths(args []string, recursive bool, match func(path string) bool) ([]BatchFile, error) {
+	var files []BatchFile
+	seen := make(map[string]bool)
+	add := func(file BatchFile) {
+		if abs, err := filepath.Abs(file.Path); err == nil && !seen[abs] {
+			seen[abs] = true
+			files = append(files, file)
+		}
+	}
+	for _, arg := range args {
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			paths = matches
+		}
+		for _, p := range paths {
+			info, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(BatchFile{Path: p, Rel: filepath.Base(p)})
+				continue
+			}
+			if !recursive {
+				return nil, fmt.Errorf("%s is a directory (use --recursive)", p)
+			}
+			err = filepath.WalkDir(p, func(filePath string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.Type().IsRegular() || match != nil && !match(filePath) {
+					return nil
+				}
+				rel, err := filepath.Rel(p, filePath)
+				if err != nil {
+					return err
+				}
+				add(BatchFile{Path: filePath, Rel: rel})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// BatchOutputPath returns the output path for file: next to the input if
+// outDir is empty, otherwise at the same relative path under outDir. The
+// output name is the input name transformed by rename.
+func BatchOutputPath(file BatchFile, outDir string, rename func(name string) string) string {
+	if outDir == "" {
+		return filepath.Join(filepath.Dir(file.Path), rename(filepath.Base(file.Path)))
+	}
+	return filepath.Join(outDir, filepath.Dir(file.Rel), rename(filepath.Base(file.Rel)))
+}
+
+// BatchOutputPaths returns the output path of every file, as given by
+// BatchOutputPath, keyed by the path of the file. It fails if two files map to
+// the same output, or if the output of one file is another file of the batch,
+// before anything is written.
+func BatchOutputPaths(files []BatchFile, outDir string, rename func(name string) string) (map[string]string, error) {
+	outputs := make(map[string]string, len(files))
+	inputs := make(map[string]string, len(files))
+	for _, file := range files {
+		abs, err := filepath.Abs(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		inputs[abs] = file.Path
+	}
+	owners := make(map[string]string, len(files))
+	for _, file := range files {
+		output := BatchOutputPath(file, outDir, rename)
+		abs, err := filepath.Abs(output)
+		if err != nil {
+			return nil, err
+		}
+		if owner, ok := owners[abs]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", owner, file.Path, output)
+		}
+		if input, ok := inputs[abs]; ok {
+			return nil, fmt.Errorf("the output of %s would replace the input %s", file.Path, input)
+		}
+		owners[abs] = file.Path
+		outputs[file.Path] = output
+	}
+	return outputs, nil
+}
+
+// RunBatch calls process for every file using the given number of workers and
+// returns the results in the order of files.
+func RunBatch(files []BatchFile, workers int, process func(file BatchFile) (output string, err error)) []BatchResult {
+	results := make([]BatchResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				output, err := process(files[i])
+				results[i] = BatchResult{Path: files[i].Path, Output: output, OK: err == nil, Err: err}
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandPaths(t *testing.T) {
+	dir := newTestTree(t)
+	if _, err := ExpandPaths([]string{dir}, false, nil); err == nil {
+		t.Errorf("directory accepted without recursive")
+	}
+	isText := func(path string) bool { return strings.HasSuffix(path, ".txt") }
+	files, err := ExpandPaths([]string{dir, filepath.Join(dir, "*.txt"), filepath.Join(dir, "docs", "b.md")}, true, isText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, file := range files {
+		rels = append(rels, filepath.ToSlash(file.Rel))
+	}
+	slices.Sort(rels)
+	if want := []string{"a.txt", "b.md", "docs/deep/c.txt"}; !slices.Equal(rels, want) {
+		t.Errorf("rels = %v, want %v", rels, want)
+	}
+	if _, err := ExpandPaths([]string{filepath.Join(dir, "*.none")}, false, nil); err == nil {
+		t.Errorf("glob without matches accepted")
+	}
+}
+
+func TestBatchOutputPath(t *testing.T) {
+	file := BatchFile{Path: filepath.Join("in", "docs", "a.txt"), Rel: filepath.Join("docs", "a.txt")}
+	addExt := func(name string) string { return name + ".xipher" }
+	if got, want := BatchOutputPath(file, "", addExt), filepath.Join("in", "docs", "a.txt.xipher"); got != want {
+		t.Errorf("in place: got %s, want %s", got, want)
+	}
+	if got, want := BatchOutputPath(file, "out", addExt), filepath.Join("out", "docs", "a.txt.xipher"); got != want {
+		t.Errorf("out dir: got %s, want %s", got, want)
+	}
+}
+
+func TestBatchOutputPaths(t *testing.T) {
+	addExt := func(name string) string { return name + ".xipher" }
+	files := []BatchFile{
+		{Path: filepath.Join("a", "x"), Rel: "x"},
+		{Path: filepath.Join("b", "y"), Rel: "y"},
+	}
+	outputs, err := BatchOutputPaths(files, "out", addExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := outputs[files[1].Path], filepath.Join("out", "y.xipher"); got != want {
+		t.Errorf("output of %s = %s, want %s", files[1].Path, got, want)
+	}
+	files[1] = BatchFile{Path: filepath.Join("b", "x"), Rel: "x"}
+	if _, err := BatchOutputPaths(files, "out", addExt); err == nil {
+		t.Errorf("a/x and b/x mapped to the same output without error")
+	}
+	if _, err := BatchOutputPaths(files, "", addExt); err != nil {
+		t.Errorf("outputs next to inputs: %v", err)
+	}
+	files[1] = BatchFile{Path: filepath.Join("a", "x.xipher"), Rel: "x.xipher"}
+	if _, err := BatchOutputPaths(files, "", addExt); err == nil {
+		t.Errorf("output replacing another input accepted")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	var files []BatchFile
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, BatchFile{Path: p, Rel: name})
+	}
+	errOdd := errors.New("odd")
+	results := RunBatch(files, 3, func(file BatchFile) (string, error) {
+		if file.Rel == "b" || file.Rel == "d" {
+			return "", errOdd
+		}
+		return file.Path + ".out", nil
+	})
+	for i, result := range results {
+		if result.Path != files[i].Path {
+			t.Errorf("result %d is for %s, want %s", i, result.Path, files[i].Path)
+		}
+		if failed := files[i].Rel == "b" || files[i].Rel == "d"; result.OK == failed || failed && !errors.Is(result.Err, errOdd) {
+			t.Errorf("result %d = %+v", i, result)
+		}
+	}
+}
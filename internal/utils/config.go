@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"xipher.org/xipher/resolve"
+)
+
+const (
+	// ConfigEnv is the environment variable naming the configuration file to
+	// use instead of xipher/config.json in the user config directory.
+	ConfigEnv = "XIPHER_CONFIG"
+
+	configDirName  = "xipher"
+	configDirPerm  = 0o700
+	configFilePerm = 0o600
+	configFileName = "config.json"
+)
+
+// Config is the configuration file of the CLI, a JSON file such as
+//
+//	{"resolver": {"caFiles": ["corp-ca.pem"], "proxy": "http://proxy.corp:3128", "timeout": "30s"}}
+type Config struct {
+	// Resolver configures the HTTP client public keys are fetched with.
+	Resolver resolve.TransportConfig `json:"resolver"`
+}
+
+// ConfigPath returns the path of the configuration file: the value of
+// ConfigEnv if it is set, otherwise xipher/config.json in the user config
+// directory.
+func ConfigPath() (string, error) {
+	return configFilePath(ConfigEnv, configFileName)
+}
+
+// LoadConfig reads the configuration file. A configuration file that does not
+// exist is empty. Relative paths of files it names are relative to its
+// directory.
+func LoadConfig() (*Config, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if _, err = readConfigFile(path, config); err != nil {
+		return nil, fmt.Errorf("failed to read the configuration: %w", err)
+	}
+	resolvePath := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(filepath.Dir(path), file)
+	}
+	for i, caFile := range config.Resolver.CAFiles {
+		config.Resolver.CAFiles[i] = resolvePath(caFile)
+	}
+	config.Resolver.ClientCert = resolvePath(config.Resolver.ClientCert)
+	config.Resolver.ClientKey = resolvePath(config.Resolver.ClientKey)
+	return config, nil
+}
+
+// configFilePath returns the path of a file in the xipher directory of the user
+// config directory, or the value of the environment variable env if it is set.
+func configFilePath(env, fileName string) (string, error) {
+	if path := os.Getenv(env); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user config directory: %w", err)
+	}
+	return filepath.Join(configDir, configDirName, fileName), nil
+}
+
+// readConfigFile decodes the JSON file at path into v. It reports false,
+// leaving v unchanged, if the file does not exist.
+func readConfigFile(path string, v any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// writeConfigFile atomically writes v as JSON to path, readable only by the
+// user, creating its directory if needed.
+func writeConfigFile(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), configDirPerm); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	writer, err := NewAtomicFileWriter(path, configFilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(append(data, '\n')); err != nil {
+		writer.Discard()
+		return err
+	}
+	return writer.Close()
+}
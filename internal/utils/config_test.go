@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	t.Setenv(ConfigEnv, path)
+	if config, err := LoadConfig(); err != nil || !config.Resolver.IsZero() {
+		t.Fatalf("missing config = %+v, %v", config, err)
+	}
+	data := `{"resolver": {"caFiles": ["corp-ca.pem", "/etc/ssl/other.pem"], "proxy": "http://proxy.corp:3128", "timeout": "30s", "maxRedirects": 2}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := config.Resolver
+	if resolver.CAFiles[0] != filepath.Join(dir, "corp-ca.pem") || resolver.CAFiles[1] != "/etc/ssl/other.pem" ||
+		resolver.Proxy != "http://proxy.corp:3128" || resolver.Timeout != "30s" || resolver.MaxRedirects != 2 {
+		t.Errorf("config = %+v", resolver)
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"errors"
 	"strings"
+	"sync"
 
 	"xipher.org/xipher"
 )
@@ -15,7 +16,11 @@ var (
 	// xipherWebURL is the web app base URL with a guaranteed trailing slash, so
 	// fragment URLs (base + "#" + payload) match those the web app emits from its
 	// served root, e.g. "https://xipher.org/#XPK_...".
-	xipherWebURL         = strings.TrimRight(xipher.Info.Web, "/") + "/"
-	pwdSecretKeyMap      = make(map[string]*xipher.SecretKey)
-	errInvalidCipherText = errors.New("invalid ciphertext")
+	xipherWebURL      = strings.TrimRight(xipher.Info.Web, "/") + "/"
+	pwdSecretKeyMap   = make(map[string]*xipher.SecretKey)
+	pwdSecretKeyMapMu sync.Mutex
+	sshSecretKeyMap   = make(map[string]*xipher.SecretKey)
+	sshSecretKeyMapMu sync.Mutex
 )
+
+var errNoSecrets = errors.New("no secret key or password to decrypt with")
@@ -1,65 +1,49 @@
 package utils
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"io"
-	"net/url"
+	"iter"
 	"strings"
 
 	"xipher.org/xipher"
+	"xipher.org/xipher/internal/crypto/age"
 )
 
-func getSanitisedValue(strOrUrl string, patternVerifier func(string) bool) string {
-	if u, err := url.Parse(strOrUrl); err == nil {
-		if fragment := u.Fragment; fragment != "" {
-			trimmedFragment := strings.TrimSpace(fragment)
-			if patternVerifier(trimmedFragment) {
-				return trimmedFragment
-			}
-		}
-		for _, values := range u.Query() {
-			for _, value := range values {
-				trimmedValue := strings.TrimSpace(value)
-				if patternVerifier(trimmedValue) {
-					return trimmedValue
-				}
-			}
-		}
-	}
-	return strings.TrimSpace(strOrUrl)
-}
-
 // NewEncryptingWriter builds an encrypting writer for keyOrPwd, which may be a
-// public key, secret key, password, or a URL/text carrying an embedded key in
-// its fragment/query. It does NOT fetch remote key URLs - that resolution lives
+// public key, an ssh-ed25519 public key, an age recipient, secret key, password, or a URL/text
+// carrying an embedded key in its fragment/query. It does NOT fetch remote key URLs - that resolution lives
 // in ResolveKeyForEncryption (resolver.go) so the network/HTTP stack stays out
 // of callers like the WASM build that never fetch. Callers needing URL/domain
-// resolution should resolve first and pass the resolved value here.
-func NewEncryptingWriter(keyOrPwd string, dst io.Writer, compress, encode bool) (encryptingWriteCloser io.WriteCloser, err error) {
-	keyOrPwd = getSanitisedValue(keyOrPwd, xipher.IsPubKeyStr)
-	if xipher.IsPubKeyStr(keyOrPwd) {
-		var pubKey *xipher.PublicKey
-		if pubKey, err = xipher.ParsePublicKeyStr(keyOrPwd); err != nil {
-			return nil, err
-		}
-		return pubKey.NewEncryptingWriter(dst, compress, encode)
-	} else {
-		var secretKey *xipher.SecretKey
-		if xipher.IsSecretKeyStr(keyOrPwd) {
-			if secretKey, err = xipher.ParseSecretKeyStr(keyOrPwd); err != nil {
-				return nil, err
-			}
-		} else {
-			if secretKey, err = xipher.NewSecretKeyForPassword([]byte(keyOrPwd)); err != nil {
-				return nil, err
-			}
-		}
-		return secretKey.NewEncryptingWriter(dst, compress, encode)
+// resolution should resolve first and pass the resolved value here: as with
+// xipher.EncryptText, a URL left unresolved fails with
+// xipher.ErrInvalidPublicKey rather than being used as a password, and
+// anything else xipher.ParseKeyInput does not parse as a key is a password.
+func NewEncryptingWriter(keyOrPwd string, dst io.Writer, compress, encode bool, opts ...xipher.EncryptOption) (io.WriteCloser, error) {
+	input, err := xipher.ParseKeyInput(keyOrPwd)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case input.PublicKey != nil:
+		return input.PublicKey.NewEncryptingWriter(dst, compress, encode, opts...)
+	case input.SecretKey != nil:
+		return input.SecretKey.NewEncryptingWriter(dst, compress, encode, opts...)
+	case input.Kind == xipher.KeyInputURL:
+		return nil, xipher.ErrInvalidPublicKey
+	}
+	// Cached so that a batch of files derives the password key only once.
+	secretKey, err := getCachedSecretKeyForPwd(input.Value)
+	if err != nil {
+		return nil, err
 	}
+	return secretKey.NewEncryptingWriter(dst, compress, encode, opts...)
 }
 
-func EncryptStream(keyOrPwd string, dst io.Writer, src io.Reader, compress, encode bool) error {
-	encryptingWriter, err := NewEncryptingWriter(keyOrPwd, dst, compress, encode)
+func EncryptStream(keyOrPwd string, dst io.Writer, src io.Reader, compress, encode bool, opts ...xipher.EncryptOption) error {
+	encryptingWriter, err := NewEncryptingWriter(keyOrPwd, dst, compress, encode, opts...)
 	if err != nil {
 		return err
 	}
@@ -69,16 +53,16 @@ func EncryptStream(keyOrPwd string, dst io.Writer, src io.Reader, compress, enco
 	return encryptingWriter.Close()
 }
 
-func encryptData(keyOrPwd string, data []byte, compress bool) (string, error) {
+func encryptData(keyOrPwd string, data []byte, compress bool, opts ...xipher.EncryptOption) (string, error) {
 	var buf bytes.Buffer
-	if err := EncryptStream(keyOrPwd, &buf, bytes.NewReader(data), compress, true); err != nil {
+	if err := EncryptStream(keyOrPwd, &buf, bytes.NewReader(data), compress, true, opts...); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
 }
 
-func EncryptData(keyOrPwd string, data []byte, compress bool) (ctStr string, ctUrl string, err error) {
-	if ctStr, err = encryptData(keyOrPwd, data, compress); err == nil {
+func EncryptData(keyOrPwd string, data []byte, compress bool, opts ...xipher.EncryptOption) (ctStr string, ctUrl string, err error) {
+	if ctStr, err = encryptData(keyOrPwd, data, compress, opts...); err == nil {
 		ctUrl = xipherWebURL + "#" + ctStr
 		if len(ctUrl) > urlMaxLength {
 			ctUrl = ""
@@ -87,7 +71,13 @@ func EncryptData(keyOrPwd string, data []byte, compress bool) (ctStr string, ctU
 	return
 }
 
+// NewDecryptingReader returns a Reader of the plaintext of src, which may be
+// xipher ciphertext or an age file.
 func NewDecryptingReader(secretKeyOrPwd string, src io.Reader) (io.Reader, error) {
+	src, isAge, armored := sniffAge(src)
+	if isAge {
+		return newAgeDecryptingReader(secretKeyOrPwd, src, armored)
+	}
 	secretKey, err := secretKeyFromSecret(secretKeyOrPwd)
 	if err != nil {
 		return nil, err
@@ -95,6 +85,135 @@ func NewDecryptingReader(secretKeyOrPwd string, src io.Reader) (io.Reader, error
 	return secretKey.NewDecryptingReader(src)
 }
 
+// NewFileDecryptingReader is NewDecryptingReader that also returns the file
+// info stored in the ciphertext, or nil if there is none.
+func NewFileDecryptingReader(secretKeyOrPwd string, src io.Reader) (io.Reader, *xipher.FileInfo, error) {
+	src, isAge, armored := sniffAge(src)
+	if isAge {
+		r, err := newAgeDecryptingReader(secretKeyOrPwd, src, armored)
+		return r, nil, err
+	}
+	secretKey, err := secretKeyFromSecret(secretKeyOrPwd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secretKey.NewFileDecryptingReader(src)
+}
+
+// Secrets yields the secret keys or passwords to try in turn. An error ends the
+// trial and is returned, so a secret can be asked for only once the ones
+// before it have failed.
+type Secrets iter.Seq2[string, error]
+
+// SecretList returns the Secrets that yield secrets in order.
+func SecretList(secrets ...string) Secrets {
+	return func(yield func(string, error) bool) {
+		for _, secret := range secrets {
+			if !yield(secret, nil) {
+				return
+			}
+		}
+	}
+}
+
+// NewFileDecryptingReaderForAny is NewFileDecryptingReader with the first of
+// secrets that decrypts src. The bytes of src read while trying a secret are
+// kept to be read again with the next one, so src need not be seekable; that
+// is the header and the first chunk.
+func NewFileDecryptingReaderForAny(secrets Secrets, src io.Reader) (io.Reader, *xipher.FileInfo, error) {
+	rr := &rewindReader{r: src}
+	err := errNoSecrets
+	for secret, secretErr := range secrets {
+		if secretErr != nil {
+			return nil, nil, secretErr
+		}
+		rr.rewind()
+		var (
+			reader   io.Reader
+			fileInfo *xipher.FileInfo
+		)
+		if reader, fileInfo, err = NewFileDecryptingReader(secret, rr); err == nil {
+			// Wrong keys of asymmetric ciphertext only fail on the first chunk.
+			br := bufio.NewReader(reader)
+			if _, err = br.Peek(1); err == nil || err == io.EOF {
+				rr.stop()
+				return br, fileInfo, nil
+			}
+		}
+		if !isWrongSecret(err) {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
+}
+
+// DecryptStreamForAny is DecryptStream with the first of secrets that decrypts src.
+func DecryptStreamForAny(secrets Secrets, dst io.Writer, src io.Reader) error {
+	decryptingReader, _, err := NewFileDecryptingReaderForAny(secrets, src)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, decryptingReader)
+	return err
+}
+
+// DecryptDataForAny is DecryptData with the first of secrets that decrypts ctStr.
+func DecryptDataForAny(secrets Secrets, ctStr string) ([]byte, error) {
+	err := errNoSecrets
+	for secret, secretErr := range secrets {
+		if secretErr != nil {
+			return nil, secretErr
+		}
+		var data []byte
+		if data, err = DecryptData(secret, ctStr); err == nil || !isWrongSecret(err) {
+			return data, err
+		}
+	}
+	return nil, err
+}
+
+// isWrongSecret reports whether err means another secret may decrypt the ciphertext.
+func isWrongSecret(err error) bool {
+	return errors.Is(err, xipher.ErrWrongKey) || errors.Is(err, xipher.ErrKeyRequired) ||
+		errors.Is(err, xipher.ErrPasswordRequired) || errors.Is(err, xipher.ErrAgeKeyUnsupported)
+}
+
+// rewindReader records what is read from r until stopped, so that it can be
+// read again from the start.
+type rewindReader struct {
+	r       io.Reader
+	buf     []byte
+	off     int
+	stopped bool
+}
+
+func (rr *rewindReader) Read(p []byte) (int, error) {
+	if rr.off < len(rr.buf) {
+		n := copy(p, rr.buf[rr.off:])
+		rr.off += n
+		return n, nil
+	}
+	if rr.stopped {
+		rr.buf = nil
+		return rr.r.Read(p)
+	}
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	rr.off += n
+	return n, err
+}
+
+// rewind makes the recorded bytes be read again.
+func (rr *rewindReader) rewind() {
+	rr.off = 0
+}
+
+// stop stops recording; the bytes already recorded and not read again are
+// still returned first.
+func (rr *rewindReader) stop() {
+	rr.stopped = true
+}
+
 func DecryptStream(secretKeyOrPwd string, dst io.Writer, src io.Reader) error {
 	decryptingReader, err := NewDecryptingReader(secretKeyOrPwd, src)
 	if err != nil {
@@ -106,10 +225,19 @@ func DecryptStream(secretKeyOrPwd string, dst io.Writer, src io.Reader) error {
 	return nil
 }
 
+// DecryptData decrypts an XCT_ ciphertext string, which may be embedded in a
+// URL, or an ASCII armored age file.
 func DecryptData(secretKeyOrPwd string, ctStr string) ([]byte, error) {
-	sanitisedCTStr := getSanitisedValue(ctStr, xipher.IsCTStr)
-	if !xipher.IsCTStr(sanitisedCTStr) {
-		return nil, errInvalidCipherText
+	if age.IsArmored([]byte(ctStr)) {
+		var buf bytes.Buffer
+		if err := DecryptStream(secretKeyOrPwd, &buf, strings.NewReader(ctStr)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	sanitisedCTStr, err := xipher.ExtractCiphertext(ctStr)
+	if err != nil {
+		return nil, err
 	}
 	var buf bytes.Buffer
 	if err := DecryptStream(secretKeyOrPwd, &buf, strings.NewReader(sanitisedCTStr)); err != nil {
@@ -117,3 +245,13 @@ func DecryptData(secretKeyOrPwd string, ctStr string) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// VerifyStream authenticates the ciphertext in src with the given secret key or
+// password without writing any plaintext.
+func VerifyStream(secretKeyOrPwd string, src io.Reader) (*xipher.IntegrityReport, error) {
+	secretKey, err := secretKeyFromSecret(secretKeyOrPwd)
+	if err != nil {
+		return nil, err
+	}
+	return secretKey.VerifyStream(src)
+}
@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"xipher.org/xipher"
+)
+
+// Quoting styles of dotenv values, recorded for encrypted values.
+const (
+	dotenvPlain     = "plain"
+	dotenvDouble    = "double"
+	dotenvMultiline = "multiline" // Double-quoted with literal line breaks
+	dotenvSingle    = "single"
+
+	// dotenvMetaPrefix is the prefix of the metadata variables in dotenv documents.
+	dotenvMetaPrefix = "XIPHER_VALUES_"
+)
+
+// dotenvLine is a line of a dotenv document. Lines without a variable, such as
+// blank lines and comments, only have raw set.
+type dotenvLine struct {
+	raw     string
+	export  bool // Whether the variable is prefixed with "export"
+	key     string
+	value   string // Unquoted value
+	quote   string // Quoting style of the value
+	comment string // Text after the value, including leading whitespace
+}
+
+// dotenvValuesDoc is a dotenv document of KEY=value lines.
+type dotenvValuesDoc struct {
+	lines []*dotenvLine
+}
+
+func parseDotenvValues(data []byte) (*dotenvValuesDoc, error) {
+	doc := &dotenvValuesDoc{}
+	rawLines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+	for n := 0; n < len(rawLines); n++ {
+		raw := rawLines[n]
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			doc.lines = append(doc.lines, &dotenvLine{raw: raw})
+			continue
+		}
+		line := &dotenvLine{}
+		if rest, ok := strings.CutPrefix(trimmed, "export "); ok {
+			line.export, trimmed = true, strings.TrimLeft(rest, " \t")
+		}
+		key, rest, ok := strings.Cut(trimmed, "=")
+		line.key = strings.TrimSpace(key)
+		if !ok || !isDotenvKey(line.key) {
+			return nil, fmt.Errorf("line %d: invalid dotenv variable", n+1)
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			// Double-quoted values may span several lines.
+			for !hasClosingQuote(rest[1:], '"') && n+1 < len(rawLines) {
+				n++
+				rest += "\n" + rawLines[n]
+			}
+			end := closingQuoteIndex(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", n+1)
+			}
+			line.value, line.quote, line.comment = unescapeDotenv(rest[1:1+end]), dotenvDouble, rest[2+end:]
+			if strings.Contains(rest[1:1+end], "\n") {
+				line.quote = dotenvMultiline
+			}
+		case strings.HasPrefix(rest, "'"):
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", n+1)
+			}
+			line.value, line.quote, line.comment = rest[1:1+end], dotenvSingle, rest[2+end:]
+		default:
+			line.value, line.quote = rest, dotenvPlain
+			if i := strings.Index(" "+rest, " #"); i >= 0 {
+				line.value = rest[:i]
+			}
+			line.value = strings.TrimRight(line.value, " \t")
+			line.comment = rest[len(line.value):]
+		}
+		if comment := strings.TrimSpace(line.comment); comment != "" && !strings.HasPrefix(comment, "#") {
+			return nil, fmt.Errorf("line %d: unexpected text after quoted value", n+1)
+		}
+		doc.lines = append(doc.lines, line)
+	}
+	return doc, nil
+}
+
+// isDotenvKey reports whether key is a valid variable name.
+func isDotenvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		if !(c == '_' || c == '.' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// closingQuoteIndex returns the index of the first unescaped quote in s, or -1.
+func closingQuoteIndex(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func hasClosingQuote(s string, quote byte) bool {
+	return closingQuoteIndex(s, quote) >= 0
+}
+
+var (
+	dotenvUnescaper        = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+	dotenvEscaper          = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	dotenvMultilineEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", `\r`, "\t", `\t`)
+)
+
+func unescapeDotenv(s string) string {
+	return dotenvUnescaper.Replace(s)
+}
+
+// quoteDotenv formats value in the given quoting style, falling back to double
+// quotes if the value cannot be written in that style.
+func quoteDotenv(value, quote string) string {
+	switch {
+	case quote == dotenvSingle && !strings.ContainsAny(value, "'\n"):
+		return "'" + value + "'"
+	case quote == dotenvPlain && value == strings.TrimSpace(value) && !strings.ContainsAny(value, "#\"'\\\n\r\t"):
+		return value
+	case quote == dotenvMultiline:
+		return `"` + dotenvMultilineEscaper.Replace(value) + `"`
+	}
+	return `"` + dotenvEscaper.Replace(value) + `"`
+}
+
+func (d *dotenvValuesDoc) leaves() []*valueLeaf {
+	var leaves []*valueLeaf
+	for _, line := range d.lines {
+		if line.key == "" || strings.HasPrefix(line.key, dotenvMetaPrefix) {
+			continue
+		}
+		leaves = append(leaves, &valueLeaf{
+			path:  []string{line.key},
+			typ:   line.quote,
+			text:  true,
+			value: line.value,
+			set: func(typ, value string) {
+				if typ == "" {
+					typ = dotenvPlain
+				}
+				line.quote, line.value = typ, value
+			},
+		})
+	}
+	return leaves
+}
+
+func (d *dotenvValuesDoc) meta() (*valuesMeta, error) {
+	meta := &valuesMeta{}
+	fields := map[string]*string{
+		dotenvMetaPrefix + "DOC_ID":   &meta.DocID,
+		dotenvMetaPrefix + "DATA_KEY": &meta.DataKey,
+		dotenvMetaPrefix + "MAC":      &meta.MAC,
+	}
+	found := 0
+	for _, line := range d.lines {
+		if field, ok := fields[line.key]; ok {
+			*field = line.value
+			found++
+		}
+	}
+	switch found {
+	case 0:
+		return nil, nil
+	case len(fields):
+		return meta, nil
+	}
+	return nil, fmt.Errorf("invalid %s metadata: incomplete", valuesMetaKey)
+}
+
+func (d *dotenvValuesDoc) setMeta(meta *valuesMeta) {
+	lines := d.lines[:0]
+	for _, line := range d.lines {
+		if !strings.HasPrefix(line.key, dotenvMetaPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	d.lines = lines
+	if meta == nil {
+		return
+	}
+	d.lines = append(d.lines,
+		&dotenvLine{key: dotenvMetaPrefix + "DOC_ID", value: meta.DocID, quote: dotenvPlain},
+		&dotenvLine{key: dotenvMetaPrefix + "DATA_KEY", value: meta.DataKey, quote: dotenvPlain},
+		&dotenvLine{key: dotenvMetaPrefix + "MAC", value: meta.MAC, quote: dotenvPlain},
+	)
+}
+
+func (d *dotenvValuesDoc) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, line := range d.lines {
+		if line.key == "" {
+			buf.WriteString(line.raw)
+		} else {
+			if line.export {
+				buf.WriteString("export ")
+			}
+			buf.WriteString(line.key + "=" + quoteDotenv(line.value, line.quote) + line.comment)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// vars returns the variables of the document as KEY=value pairs, in order.
+func (d *dotenvValuesDoc) vars() []string {
+	var vars []string
+	for _, line := range d.lines {
+		if line.key != "" {
+			vars = append(vars, line.key+"="+line.value)
+		}
+	}
+	return vars
+}
+
+// ParseDotenv returns the variables of a dotenv document as KEY=value pairs, in order.
+func ParseDotenv(data []byte) ([]string, error) {
+	doc, err := parseDotenvValues(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.vars(), nil
+}
+
+// isBinaryCiphertext reports whether data looks like a binary ciphertext. These
+// start with a ciphertext type byte, a control character that cannot start a
+// text document.
+func isBinaryCiphertext(data []byte) bool {
+	return len(data) > 0 && data[0] < 0x08
+}
+
+// DecryptDotenv returns the variables of a dotenv document as KEY=value pairs,
+// in order. The document may be encrypted as a whole, have its values
+// encrypted with EncryptValues, or be plaintext.
+func DecryptDotenv(secretKeyOrPwd string, data []byte) ([]string, error) {
+	if ctStr := string(bytes.TrimSpace(data)); xipher.IsCTStr(ctStr) {
+		var err error
+		if data, err = DecryptData(secretKeyOrPwd, ctStr); err != nil {
+			return nil, err
+		}
+	} else if isBinaryCiphertext(data) {
+		var buf bytes.Buffer
+		if err := DecryptStream(secretKeyOrPwd, &buf, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	doc, err := parseDotenvValues(data)
+	if err != nil {
+		return nil, err
+	}
+	if meta, err := doc.meta(); err != nil {
+		return nil, err
+	} else if meta != nil {
+		if data, _, err = DecryptValues(secretKeyOrPwd, data, ValuesDotenv); err != nil {
+			return nil, err
+		}
+		if doc, err = parseDotenvValues(data); err != nil {
+			return nil, err
+		}
+	}
+	return doc.vars(), nil
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestDecryptDotenv(t *testing.T) {
+	skStr := newTestSecretKey(t)
+	doc := []byte("# comment\nexport A=1\nB=\"two words\" # note\nC='x=y'\n")
+	want := []string{"A=1", "B=two words", "C=x=y"}
+	if vars, err := ParseDotenv(doc); err != nil || !slices.Equal(vars, want) {
+		t.Fatalf("ParseDotenv = %q, %v", vars, err)
+	}
+	valuesEncrypted, _, err := EncryptValues(skStr, doc, ValuesDotenv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var binary bytes.Buffer
+	if err := EncryptStream(skStr, &binary, bytes.NewReader(doc), false, false); err != nil {
+		t.Fatal(err)
+	}
+	text, _, err := EncryptData(skStr, doc, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := map[string][]byte{
+		"plain":            doc,
+		"values encrypted": valuesEncrypted,
+		"binary":           binary.Bytes(),
+		"text":             []byte(text + "\n"),
+	}
+	for name, input := range inputs {
+		if vars, err := DecryptDotenv(skStr, input); err != nil || !slices.Equal(vars, want) {
+			t.Errorf("%s: got %q, %v", name, vars, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"xipher.org/xipher"
+)
+
+// GitClean encrypts a file that git is staging, reading the whole file into
+// memory. path is the path of the file in the repository. The nonce is derived
+// from the key, the path and the content, so an unchanged file always cleans to
+// the same ciphertext and git sees no spurious changes. This needs a direct
+// secret key; passwords fail with xipher.ErrDeterministicUnsupported. Content
+// that is already a ciphertext for the key is passed through unchanged.
+func GitClean(secretKeyOrPwd, path string, dst io.Writer, src io.Reader) error {
+	secretKey, err := secretKeyFromSecret(secretKeyOrPwd)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	if isBinaryCiphertext(data) {
+		if _, err := secretKey.Verify(data); err == nil {
+			_, err = dst.Write(data)
+			return err
+		}
+	}
+	return secretKey.EncryptStream(dst, bytes.NewReader(data), false, false, xipher.WithSyntheticNonce([]byte(path)))
+}
+
+// GitSmudge decrypts a file that git is checking out. Content that is not a
+// ciphertext, such as files committed before the filter was set up, is copied
+// unchanged.
+func GitSmudge(secretKeyOrPwd string, dst io.Writer, src io.Reader) error {
+	reader := bufio.NewReader(src)
+	if first, err := reader.Peek(1); err != nil || !isBinaryCiphertext(first) {
+		_, err = io.Copy(dst, reader)
+		return err
+	}
+	return DecryptStream(secretKeyOrPwd, dst, reader)
+}
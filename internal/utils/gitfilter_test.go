@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"xipher.org/xipher"
+)
+
+func gitClean(t *testing.T, secret, path string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := GitClean(secret, path, &buf, bytes.NewReader(data)); err != nil {
+		t.Fatalf("GitClean: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGitFilter(t *testing.T) {
+	skStr := newTestSecretKey(t)
+	data := []byte("api_key: hunter2\n")
+	ct := gitClean(t, skStr, "config/secrets.yaml", data)
+	if !bytes.Equal(ct, gitClean(t, skStr, "config/secrets.yaml", data)) {
+		t.Errorf("cleaning the same file twice gave different ciphertexts")
+	}
+	if bytes.Equal(ct, gitClean(t, skStr, "config/other.yaml", data)) {
+		t.Errorf("the same content at another path gave the same ciphertext")
+	}
+	if bytes.Contains(ct, []byte("hunter2")) {
+		t.Errorf("plaintext left in cleaned file")
+	}
+	if again := gitClean(t, skStr, "config/secrets.yaml", ct); !bytes.Equal(again, ct) {
+		t.Errorf("cleaning a ciphertext encrypted it again")
+	}
+	var out bytes.Buffer
+	if err := GitSmudge(skStr, &out, bytes.NewReader(ct)); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("GitSmudge = %q, %v", out.Bytes(), err)
+	}
+	out.Reset()
+	if err := GitSmudge(skStr, &out, strings.NewReader("plain text")); err != nil || out.String() != "plain text" {
+		t.Errorf("GitSmudge of plaintext = %q, %v", out.String(), err)
+	}
+	binary := append([]byte{0x00, 0x01}, data...)
+	if cleaned := gitClean(t, skStr, "bin/blob", binary); bytes.Equal(cleaned, binary) {
+		t.Errorf("binary plaintext that resembles a ciphertext was not encrypted")
+	}
+	if err := GitClean("correct horse battery staple", "a.txt", &out, bytes.NewReader(data)); !errors.Is(err, xipher.ErrDeterministicUnsupported) {
+		t.Errorf("password: expected ErrDeterministicUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"xipher.org/xipher"
+)
+
+const (
+	// gitHubKeyRefPrefix marks a reference to the SSH keys a GitHub user publishes.
+	gitHubKeyRefPrefix = "github:"
+	gitHubKeysURL      = "https://github.com/%s.keys"
+	maxGitHubKeysBytes = 64 << 10 // RSA keys are long; allow for several of them.
+
+	// GitHubKeysDirEnv is the environment variable naming a directory of
+	// <user>.keys files that github:<user> references are resolved from instead
+	// of github.com, for offline use and tests.
+	GitHubKeysDirEnv = "XIPHER_GITHUB_KEYS_DIR"
+)
+
+// gitHubUserRegex matches a valid GitHub user name.
+var gitHubUserRegex = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,37}[a-zA-Z0-9])?$`)
+
+var (
+	errNoGitHubEd25519Key = errors.New("the GitHub user has no ssh-ed25519 key")
+	errGitHubKeysLarge    = errors.New("the SSH keys response exceeded the size limit")
+)
+
+// IsGitHubKeyRef reports whether raw is a github:<user> reference.
+func IsGitHubKeyRef(raw string) bool {
+	return strings.HasPrefix(strings.TrimSpace(raw), gitHubKeyRefPrefix)
+}
+
+// resolveGitHubKey resolves a github:<user> reference to the first ssh-ed25519
+// key the user publishes at https://github.com/<user>.keys, or in the <user>.keys
+// file of the GitHubKeysDirEnv directory if it is set.
+func resolveGitHubKey(ref string) (pubKey, name string, err error) {
+	user := strings.TrimPrefix(strings.TrimSpace(ref), gitHubKeyRefPrefix)
+	if !gitHubUserRegex.MatchString(user) {
+		return "", "", fmt.Errorf("invalid GitHub user name: %q", user)
+	}
+	var keys []byte
+	if dir := os.Getenv(GitHubKeysDirEnv); dir != "" {
+		keys, err = os.ReadFile(filepath.Join(dir, user+".keys"))
+	} else {
+		keys, err = fetchGitHubKeys(user)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range strings.Split(string(keys), "\n") {
+		if line = strings.TrimSpace(line); !xipher.IsSSHPublicKeyStr(line) {
+			continue
+		}
+		if _, err := xipher.ParseSSHPublicKeyStr(line); err == nil {
+			return line, user + " on GitHub", nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: %s", errNoGitHubEd25519Key, user)
+}
+
+// fetchGitHubKeys fetches the SSH public keys published by a GitHub user.
+func fetchGitHubKeys(user string) ([]byte, error) {
+	keysURL := fmt.Sprintf(gitHubKeysURL, user)
+	resp, err := gitHubClient().Get(keysURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SSH keys from %s: %w", keysURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch SSH keys from %s: unexpected status %s", keysURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGitHubKeysBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH keys from %s: %w", keysURL, err)
+	}
+	if len(body) > maxGitHubKeysBytes {
+		return nil, errGitHubKeysLarge
+	}
+	return body, nil
+}
@@ -0,0 +1,386 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"xipher.org/xipher"
+	"xipher.org/xipher/resolve"
+)
+
+const (
+	// KeyringEnv is the environment variable naming the keyring file to use
+	// instead of xipher/keyring.json in the user config directory.
+	KeyringEnv = "XIPHER_KEYRING"
+
+	// keyringRefPrefix marks a reference to a key in the keyring by its alias.
+	keyringRefPrefix = "@"
+	keyringFileName  = "keyring.json"
+)
+
+// keyringAliasRegex matches a valid keyring alias.
+var keyringAliasRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+var (
+	// ErrKeyringAliasNotFound is returned when the keyring has no key with the alias.
+	ErrKeyringAliasNotFound = errors.New("no key with this alias in the keyring")
+	// ErrKeyringAliasExists is returned when adding a key under an alias that is taken.
+	ErrKeyringAliasExists = errors.New("a key with this alias is already in the keyring")
+	// ErrKeyringNotOwned is returned when a secret key is needed for an alias
+	// the keyring only holds the public key of.
+	ErrKeyringNotOwned = errors.New("the keyring holds only the public key of this alias")
+
+	errInvalidKeyringAlias = errors.New("aliases must start with a letter or digit and contain only letters, digits, '.', '_' and '-'")
+	errNotKeyringSecret    = errors.New("only XSK_ secret keys and AGE-SECRET-KEY identities can be added to the keyring")
+	errNotKeyringPublicKey = errors.New("not a public key: use an XPK_ public key, an ssh-ed25519 key or an age recipient")
+	errNotSigningKey       = errors.New("only ssh-ed25519 keys can sign published key documents")
+)
+
+// KeyringEntry is a key in the keyring. Entries of our own keys also hold the
+// secret key, encrypted with the passphrase it was added with.
+type KeyringEntry struct {
+	Alias       string    `json:"alias"`
+	PublicKey   string    `json:"publicKey"`
+	Fingerprint string    `json:"fingerprint"`
+	SecretKey   string    `json:"secretKey,omitempty"`
+	Signs       []string  `json:"signs,omitempty"` // Key URLs and domains whose published key documents the key may sign
+	Added       time.Time `json:"added"`
+}
+
+// Owned reports whether the entry holds a secret key.
+func (entry *KeyringEntry) Owned() bool {
+	return entry.SecretKey != ""
+}
+
+// Suite returns the suite of the public key of the entry.
+func (entry *KeyringEntry) Suite() (xipher.Suite, error) {
+	pubKey, err := parseKeyringPublicKey(entry.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	return pubKey.Algorithm(), nil
+}
+
+// TrustAsSigner trusts the key of the entry, which must be an ssh-ed25519 key,
+// to sign the published key documents of the given key URLs and domains. A
+// domain covers its subdomains and the email addresses at it.
+func (entry *KeyringEntry) TrustAsSigner(scopes ...string) error {
+	suite, err := entry.Suite()
+	if err != nil {
+		return err
+	}
+	if suite != xipher.SuiteSSHEd25519 {
+		return fmt.Errorf("%w: %s", errNotSigningKey, entry.Alias)
+	}
+	for _, scope := range scopes {
+		if scope = signerScope(scope); scope != "" && !slices.Contains(entry.Signs, scope) {
+			entry.Signs = append(entry.Signs, scope)
+		}
+	}
+	return nil
+}
+
+// SignsFor reports whether the entry is trusted to sign the published key
+// document of the key URL.
+func (entry *KeyringEntry) SignsFor(keyURL string) bool {
+	keyURL = resolve.PinnedURL(keyURL)
+	host := keyURLHost(keyURL)
+	for _, scope := range entry.Signs {
+		if scope == keyURL || host != "" && (host == scope || strings.HasSuffix(host, "."+scope)) {
+			return true
+		}
+	}
+	return false
+}
+
+// signerScope normalises a key URL or domain a signing key is trusted for:
+// URLs and email addresses as they are pinned, domains lower-cased.
+func signerScope(scope string) string {
+	scope = strings.TrimSpace(scope)
+	if strings.Contains(scope, "/") || resolve.LooksLikeEmail(scope) {
+		return resolve.PinnedURL(scope)
+	}
+	return strings.TrimSuffix(strings.ToLower(scope), ".")
+}
+
+// keyURLHost returns the domain of a pinned key URL or email address.
+func keyURLHost(keyURL string) string {
+	if resolve.LooksLikeEmail(keyURL) {
+		_, domain, _ := strings.Cut(keyURL, "@")
+		return domain
+	}
+	u, err := url.Parse(keyURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// keyringSignerTrust is the resolve.SignerTrust of the keyring: a signing key
+// is trusted for the key URLs and domains its keyring entry is marked for, and
+// named by its alias.
+func keyringSignerTrust(signingKey, keyURL string) (alias string, trusted bool, err error) {
+	pubKey, err := xipher.ParseSSHPublicKeyStr(signingKey)
+	if err != nil {
+		return "", false, err
+	}
+	fingerprint, err := pubKey.Fingerprint()
+	if err != nil {
+		return "", false, err
+	}
+	keyring, err := LoadKeyring()
+	if err != nil {
+		return "", false, err
+	}
+	for _, entry := range keyring.Keys {
+		if entry.Fingerprint != fingerprint {
+			continue
+		}
+		if entry.SignsFor(keyURL) {
+			return entry.Alias, true, nil
+		}
+		alias = entry.Alias
+	}
+	return alias, false, nil
+}
+
+// Unlock decrypts the secret key of an owned entry with passphrase.
+func (entry *KeyringEntry) Unlock(passphrase string) (string, error) {
+	if !entry.Owned() {
+		return "", fmt.Errorf("%w: %s", ErrKeyringNotOwned, entry.Alias)
+	}
+	secret, err := DecryptData(passphrase, entry.SecretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to unlock the secret key of %s: %w", entry.Alias, err)
+	}
+	return string(secret), nil
+}
+
+// Keyring is the local store of contacts' public keys and our own secret keys,
+// kept as a JSON file readable only by the user.
+type Keyring struct {
+	path string
+	Keys []KeyringEntry `json:"keys"`
+}
+
+// KeyringPath returns the path of the keyring file: the value of KeyringEnv if
+// it is set, otherwise xipher/keyring.json in the user config directory.
+func KeyringPath() (string, error) {
+	return configFilePath(KeyringEnv, keyringFileName)
+}
+
+// LoadKeyring reads the keyring. A keyring that does not exist yet is empty.
+func LoadKeyring() (*Keyring, error) {
+	path, err := KeyringPath()
+	if err != nil {
+		return nil, err
+	}
+	keyring := &Keyring{path: path}
+	if _, err = readConfigFile(path, keyring); err != nil {
+		return nil, fmt.Errorf("failed to read the keyring: %w", err)
+	}
+	return keyring, nil
+}
+
+// Path returns the path of the keyring file.
+func (keyring *Keyring) Path() string {
+	return keyring.path
+}
+
+// Save writes the keyring atomically, creating its directory if needed.
+func (keyring *Keyring) Save() error {
+	return writeConfigFile(keyring.path, keyring)
+}
+
+// Get returns the entry with the alias, which may carry the @ prefix.
+func (keyring *Keyring) Get(alias string) (*KeyringEntry, error) {
+	alias = strings.TrimPrefix(strings.TrimSpace(alias), keyringRefPrefix)
+	for i := range keyring.Keys {
+		if keyring.Keys[i].Alias == alias {
+			return &keyring.Keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrKeyringAliasNotFound, alias)
+}
+
+// OwnedKeys returns the entries that hold a secret key.
+func (keyring *Keyring) OwnedKeys() []KeyringEntry {
+	var owned []KeyringEntry
+	for _, entry := range keyring.Keys {
+		if entry.Owned() {
+			owned = append(owned, entry)
+		}
+	}
+	return owned
+}
+
+// UnlockOwnedKeys returns the secret keys of the owned entries that passphrase
+// unlocks. It fails with xipher.ErrWrongKey if it unlocks none of them.
+func (keyring *Keyring) UnlockOwnedKeys(passphrase string) ([]string, error) {
+	var secrets []string
+	for _, entry := range keyring.OwnedKeys() {
+		secret, err := entry.Unlock(passphrase)
+		if errors.Is(err, xipher.ErrWrongKey) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("%w: the passphrase unlocks none of the keys in the keyring", xipher.ErrWrongKey)
+	}
+	return secrets, nil
+}
+
+// AddPublicKey adds a contact's public key, which may be an XPK_ public key,
+// an ssh-ed25519 key or an age recipient, under alias.
+func (keyring *Keyring) AddPublicKey(alias, pubKeyStr string) (*KeyringEntry, error) {
+	pubKeyStr = strings.TrimSpace(pubKeyStr)
+	pubKey, err := parseKeyringPublicKey(pubKeyStr)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.add(alias, pubKeyStr, pubKey, "")
+}
+
+// AddSecretKey adds one of our own secret keys, an XSK_ secret key or an
+// AGE-SECRET-KEY identity, under alias. The secret key is stored encrypted with
+// passphrase, along with its public key for the given suite; age identities
+// only have a SuiteECC public key.
+func (keyring *Keyring) AddSecretKey(alias, secret, passphrase string, suite xipher.Suite) (*KeyringEntry, error) {
+	secret = strings.TrimSpace(secret)
+	if !xipher.IsSecretKeyStr(secret) && !xipher.IsAgeIdentityStr(secret) {
+		return nil, errNotKeyringSecret
+	}
+	if passphrase == "" {
+		return nil, xipher.ErrInvalidPassword
+	}
+	if xipher.IsAgeIdentityStr(secret) {
+		suite = xipher.SuiteECC
+	}
+	secretKey, err := secretKeyFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := secretKey.PublicKey(suite)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyStr, err := pubKey.String()
+	if err != nil {
+		return nil, err
+	}
+	encryptedSecret, err := encryptData(passphrase, []byte(secret), false)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.add(alias, pubKeyStr, pubKey, encryptedSecret)
+}
+
+func (keyring *Keyring) add(alias, pubKeyStr string, pubKey *xipher.PublicKey, encryptedSecret string) (*KeyringEntry, error) {
+	alias = strings.TrimPrefix(strings.TrimSpace(alias), keyringRefPrefix)
+	if !keyringAliasRegex.MatchString(alias) {
+		return nil, fmt.Errorf("invalid alias %q: %w", alias, errInvalidKeyringAlias)
+	}
+	if _, err := keyring.Get(alias); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyringAliasExists, alias)
+	}
+	fingerprint, err := pubKey.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	keyring.Keys = append(keyring.Keys, KeyringEntry{
+		Alias:       alias,
+		PublicKey:   pubKeyStr,
+		Fingerprint: fingerprint,
+		SecretKey:   encryptedSecret,
+		Added:       time.Now().UTC().Truncate(time.Second),
+	})
+	return &keyring.Keys[len(keyring.Keys)-1], nil
+}
+
+// Remove removes the entry with the alias.
+func (keyring *Keyring) Remove(alias string) error {
+	entry, err := keyring.Get(alias)
+	if err != nil {
+		return err
+	}
+	keyring.Keys = slices.DeleteFunc(keyring.Keys, func(e KeyringEntry) bool {
+		return e.Alias == entry.Alias
+	})
+	return nil
+}
+
+// parseKeyringPublicKey parses an XPK_ public key, an ssh-ed25519 key or an age recipient.
+func parseKeyringPublicKey(pubKeyStr string) (*xipher.PublicKey, error) {
+	switch {
+	case xipher.IsSSHPublicKeyStr(pubKeyStr):
+		return xipher.ParseSSHPublicKeyStr(pubKeyStr)
+	case xipher.IsAgeRecipientStr(pubKeyStr):
+		return xipher.ParseAgeRecipient(pubKeyStr)
+	case xipher.IsPubKeyStr(pubKeyStr):
+		return xipher.ParsePublicKeyStr(pubKeyStr)
+	}
+	return nil, errNotKeyringPublicKey
+}
+
+// IsKeyringRef reports whether raw has the form of an @alias reference to a key
+// in the keyring. As secrets may have that form too, callers decrypting should
+// resolve references with LookupKeyringRef, which also checks that the alias
+// exists.
+func IsKeyringRef(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	return strings.HasPrefix(raw, keyringRefPrefix) && keyringAliasRegex.MatchString(raw[len(keyringRefPrefix):])
+}
+
+// LookupKeyringRef returns the keyring entry an @alias reference names. It
+// returns nil if raw is not an @alias reference or the keyring has no key with
+// the alias, so that a secret that looks like a reference is still used as one
+// when decrypting.
+func LookupKeyringRef(raw string) (*KeyringEntry, error) {
+	entry, err := keyringRefEntry(raw)
+	if errors.Is(err, ErrKeyringAliasNotFound) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// keyringRefEntry returns the keyring entry an @alias reference names, or nil
+// if raw is not an @alias reference. Unlike LookupKeyringRef, it fails with
+// ErrKeyringAliasNotFound if the keyring has no key with the alias: when
+// encrypting, a mistyped alias must not quietly become a guessable password.
+func keyringRefEntry(raw string) (*KeyringEntry, error) {
+	if !IsKeyringRef(raw) {
+		return nil, nil
+	}
+	keyring, err := LoadKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Get(raw)
+}
+
+// displayName names the entry by its alias and fingerprint.
+func (entry *KeyringEntry) displayName() string {
+	return fmt.Sprintf("%s (%s)", entry.Alias, entry.Fingerprint)
+}
+
+// ResolveKeyringSecret returns the secret key of the owned entry an @alias
+// reference names, unlocked with passphrase.
+func ResolveKeyringSecret(ref, passphrase string) (string, error) {
+	keyring, err := LoadKeyring()
+	if err != nil {
+		return "", err
+	}
+	entry, err := keyring.Get(ref)
+	if err != nil {
+		return "", err
+	}
+	return entry.Unlock(passphrase)
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"xipher.org/xipher"
+	"xipher.org/xipher/resolve"
+)
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "keyring.json")
+	t.Setenv(KeyringEnv, path)
+
+	keyring, err := LoadKeyring()
+	if err != nil || len(keyring.Keys) != 0 {
+		t.Fatalf("LoadKeyring of a missing file = %v, %v", keyring, err)
+	}
+	aliceSecret := newTestSecretKey(t)
+	aliceSK, _ := xipher.ParseSecretKeyStr(aliceSecret)
+	alicePK, _ := aliceSK.PublicKey(xipher.SuiteHybrid768)
+	alicePKStr, _ := alicePK.String()
+	entry, err := keyring.AddPublicKey("alice", alicePKStr)
+	if err != nil {
+		t.Fatalf("AddPublicKey: %v", err)
+	}
+	if fingerprint, _ := alicePK.Fingerprint(); entry.Fingerprint != fingerprint || entry.Owned() {
+		t.Errorf("entry = %+v, want fingerprint %s", entry, fingerprint)
+	}
+	if _, err := keyring.AddPublicKey("@alice", alicePKStr); !errors.Is(err, ErrKeyringAliasExists) {
+		t.Errorf("duplicate alias: expected ErrKeyringAliasExists, got %v", err)
+	}
+	if _, err := keyring.AddPublicKey("-bob", alicePKStr); err == nil {
+		t.Error("expected an error for an invalid alias")
+	}
+	if _, err := keyring.AddPublicKey("bob", "not a key"); err == nil {
+		t.Error("expected an error for an invalid public key")
+	}
+	mySecret := newTestSecretKey(t)
+	if _, err := keyring.AddSecretKey("me", mySecret, "keyring-passphrase", xipher.SuiteECC); err != nil {
+		t.Fatalf("AddSecretKey: %v", err)
+	}
+	if _, err := keyring.AddSecretKey("pwd", "a password", "keyring-passphrase", xipher.SuiteECC); !errors.Is(err, errNotKeyringSecret) {
+		t.Errorf("password as secret key: expected errNotKeyringSecret, got %v", err)
+	}
+	if err := keyring.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != configFilePerm {
+		t.Errorf("keyring file mode = %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte(mySecret)) {
+		t.Fatal("the keyring stores the secret key in plaintext")
+	}
+
+	keyring, err = LoadKeyring()
+	if err != nil || len(keyring.Keys) != 2 {
+		t.Fatalf("LoadKeyring = %+v, %v", keyring, err)
+	}
+	if owned := keyring.OwnedKeys(); len(owned) != 1 || owned[0].Alias != "me" {
+		t.Errorf("OwnedKeys = %+v", owned)
+	}
+	if secret, err := ResolveKeyringSecret("@me", "keyring-passphrase"); err != nil || secret != mySecret {
+		t.Errorf("ResolveKeyringSecret = %.12s, %v", secret, err)
+	}
+	if _, err := ResolveKeyringSecret("@me", "wrong-passphrase"); !errors.Is(err, xipher.ErrWrongKey) {
+		t.Errorf("wrong passphrase: expected ErrWrongKey, got %v", err)
+	}
+	if _, err := ResolveKeyringSecret("@alice", "keyring-passphrase"); !errors.Is(err, ErrKeyringNotOwned) {
+		t.Errorf("contact key: expected ErrKeyringNotOwned, got %v", err)
+	}
+	if _, err := ResolveKeyringSecret("@carol", "keyring-passphrase"); !errors.Is(err, ErrKeyringAliasNotFound) {
+		t.Errorf("unknown alias: expected ErrKeyringAliasNotFound, got %v", err)
+	}
+
+	// @alias references resolve to the stored public key for encryption.
+	if got, err := ResolveKeyForEncryption("@alice"); err != nil || got != alicePKStr {
+		t.Errorf("ResolveKeyForEncryption(@alice) = %.12s, %v", got, err)
+	}
+	if _, isKey, name, err := GetSanitisedKeyOrPwd("@alice"); err != nil || !isKey || name != "alice ("+entry.Fingerprint+")" {
+		t.Errorf("GetSanitisedKeyOrPwd: isKey = %v, name = %q, %v", isKey, name, err)
+	}
+	// A mistyped alias is not encrypted to as a password.
+	if got, err := ResolveKeyForEncryption("@carol"); !errors.Is(err, ErrKeyringAliasNotFound) {
+		t.Errorf("ResolveKeyForEncryption(@carol) = %q, %v, want ErrKeyringAliasNotFound", got, err)
+	}
+	if _, _, _, err := GetSanitisedKeyOrPwd("@carol"); !errors.Is(err, ErrKeyringAliasNotFound) {
+		t.Errorf("GetSanitisedKeyOrPwd(@carol): expected ErrKeyringAliasNotFound, got %v", err)
+	}
+	if entry, err := LookupKeyringRef("@alice"); err != nil || entry == nil || entry.Alias != "alice" {
+		t.Errorf("LookupKeyringRef(@alice) = %+v, %v", entry, err)
+	}
+	for _, raw := range []string{"@carol", "@-x", "alice"} {
+		if entry, err := LookupKeyringRef(raw); err != nil || entry != nil {
+			t.Errorf("LookupKeyringRef(%q) = %+v, %v, want nil", raw, entry, err)
+		}
+	}
+
+	if err := keyring.Remove("alice"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := keyring.Remove("alice"); !errors.Is(err, ErrKeyringAliasNotFound) {
+		t.Errorf("Remove twice: expected ErrKeyringAliasNotFound, got %v", err)
+	}
+	if len(keyring.Keys) != 1 || keyring.Keys[0].Alias != "me" {
+		t.Errorf("keys after Remove = %+v", keyring.Keys)
+	}
+}
+
+func TestUnlockOwnedKeys(t *testing.T) {
+	t.Setenv(KeyringEnv, filepath.Join(t.TempDir(), "keyring.json"))
+	keyring, _ := LoadKeyring()
+	first, second, third := newTestSecretKey(t), newTestSecretKey(t), newTestSecretKey(t)
+	keyring.AddSecretKey("first", first, "passphrase-one", xipher.SuiteECC)
+	keyring.AddSecretKey("second", second, "passphrase-two", xipher.SuiteECC)
+	keyring.AddSecretKey("third", third, "passphrase-one", xipher.SuiteECC)
+	secrets, err := keyring.UnlockOwnedKeys("passphrase-one")
+	if err != nil || len(secrets) != 2 || secrets[0] != first || secrets[1] != third {
+		t.Errorf("UnlockOwnedKeys = %d secrets, %v", len(secrets), err)
+	}
+	if _, err := keyring.UnlockOwnedKeys("passphrase-three"); !errors.Is(err, xipher.ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestDecryptForAny(t *testing.T) {
+	first, second := newTestSecretKey(t), newTestSecretKey(t)
+	secondSK, _ := xipher.ParseSecretKeyStr(second)
+	secondPK, _ := secondSK.PublicKey(xipher.SuiteECC)
+	secondPKStr, _ := secondPK.String()
+	identity, _ := secondSK.AgeIdentity()
+	plaintext := bytes.Repeat([]byte("for the second key "), 20000)
+
+	var xipherCT, ageCT bytes.Buffer
+	if err := EncryptStream(secondPKStr, &xipherCT, bytes.NewReader(plaintext), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptAgeStream(secondPKStr, &ageCT, bytes.NewReader(plaintext), false, false); err != nil {
+		t.Fatal(err)
+	}
+	for name, ct := range map[string][]byte{"xipher": xipherCT.Bytes(), "age": ageCT.Bytes()} {
+		for _, secrets := range [][]string{{first, second}, {first, identity}, {second}} {
+			var out bytes.Buffer
+			// A plain reader, as stdin is, cannot be seeked back.
+			if err := DecryptStreamForAny(SecretList(secrets...), &out, bytes.NewBuffer(ct)); err != nil {
+				t.Fatalf("%s: DecryptStreamForAny: %v", name, err)
+			}
+			if !bytes.Equal(out.Bytes(), plaintext) {
+				t.Fatalf("%s: plaintext mismatch", name)
+			}
+		}
+		if err := DecryptStreamForAny(SecretList(first), &bytes.Buffer{}, bytes.NewReader(ct)); !errors.Is(err, xipher.ErrWrongKey) {
+			t.Errorf("%s: expected ErrWrongKey, got %v", name, err)
+		}
+		if err := DecryptStreamForAny(SecretList(), &bytes.Buffer{}, bytes.NewReader(ct)); !errors.Is(err, errNoSecrets) {
+			t.Errorf("%s: expected errNoSecrets, got %v", name, err)
+		}
+	}
+
+	ctStr, _, err := EncryptData(secondPKStr, []byte("text"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := DecryptDataForAny(SecretList(first, second), ctStr); err != nil || string(pt) != "text" {
+		t.Errorf("DecryptDataForAny = %q, %v", pt, err)
+	}
+	// Secrets are only asked for once the ones before them fail.
+	asked := 0
+	lazy := func(yield func(string, error) bool) {
+		for _, secret := range []string{first, second} {
+			asked++
+			if !yield(secret, nil) {
+				return
+			}
+		}
+		asked++
+		yield("", errors.New("asked too often"))
+	}
+	if pt, err := DecryptDataForAny(lazy, ctStr); err != nil || string(pt) != "text" || asked != 2 {
+		t.Errorf("DecryptDataForAny = %q, %v after %d secrets", pt, err, asked)
+	}
+	errAsk := errors.New("no terminal")
+	failing := func(yield func(string, error) bool) {
+		if yield(first, nil) {
+			yield("", errAsk)
+		}
+	}
+	if _, err := DecryptDataForAny(failing, ctStr); !errors.Is(err, errAsk) {
+		t.Errorf("expected the error of the secrets, got %v", err)
+	}
+	// Errors other than a wrong key are not retried.
+	if _, err := DecryptDataForAny(SecretList(first, second), "XCT_"); !errors.Is(err, xipher.ErrTruncatedCiphertext) {
+		t.Errorf("truncated ciphertext: expected ErrTruncatedCiphertext, got %v", err)
+	}
+}
+
+// newTestSigner returns an ssh-ed25519 signing key and its private key.
+func newTestSigner(t *testing.T) (signingKey string, priv ed25519.PrivateKey) {
+	t.Helper()
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " publisher@example", edPriv
+}
+
+// signedDocument returns the published key document of pubKey signed with
+// priv, whose public key is signingKey.
+func signedDocument(t *testing.T, pubKey, signingKey string, priv ed25519.PrivateKey) string {
+	t.Helper()
+	doc := map[string]string{"name": "", "publicKey": pubKey, "signingKey": signingKey}
+	unsigned, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc["signature"] = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, append([]byte("xipher-published-key/v1\n"), unsigned...)))
+	signed, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestKeyringSignerScope(t *testing.T) {
+	signingKey, _ := newTestSigner(t)
+	keyring := &Keyring{}
+	entry, err := keyring.AddPublicKey("signer", signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entry.TrustAsSigner("Example.COM", "https://keys.other.org/alice/"); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"example.com":                      true,
+		"https://example.com/key":          true,
+		"https://xipher.example.com/key":   true,
+		"alice@example.com":                true,
+		"https://keys.other.org/alice":     true,
+		"https://keys.other.org/bob":       false,
+		"https://notexample.com":           false,
+		"https://example.com.evil.org/key": false,
+		"bob@other.org":                    false,
+	}
+	for keyURL, want := range cases {
+		if got := entry.SignsFor(keyURL); got != want {
+			t.Errorf("SignsFor(%q) = %v, want %v", keyURL, got, want)
+		}
+	}
+	other, err := keyring.AddPublicKey("not-a-signer", newTestPubKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = other.TrustAsSigner("example.com"); err == nil {
+		t.Error("expected an error trusting a non-ssh key as a signer")
+	}
+}
+
+func TestKeyringSignerTrust(t *testing.T) {
+	t.Setenv(KeyringEnv, filepath.Join(t.TempDir(), "keyring.json"))
+	first, second := newTestPubKey(t), newTestPubKey(t)
+	signingKey, priv := newTestSigner(t)
+	served := signedDocument(t, first, signingKey, priv)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(served))
+	}))
+	t.Cleanup(srv.Close)
+	isolateKeyResolver(t, srv.Client())
+	if resolved, err := KeyResolver().Resolve(srv.URL); err != nil || resolved.PublicKey != first {
+		t.Fatalf("first use = %+v, %v", resolved, err)
+	}
+
+	// A signing key in the keyring is not trusted for URLs it is not marked
+	// as the signer of.
+	otherKey, otherPriv := newTestSigner(t)
+	served = signedDocument(t, second, otherKey, otherPriv)
+	keyring, _ := LoadKeyring()
+	entry, err := keyring.AddPublicKey("alice-signing", otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entry.TrustAsSigner("bob.example.com", "https://alice.example.com/key"); err != nil {
+		t.Fatal(err)
+	}
+	if err = keyring.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = KeyResolver().Resolve(srv.URL); !errors.Is(err, resolve.ErrUntrustedSigner) {
+		t.Errorf("unrelated keyring signer: expected ErrUntrustedSigner, got %v", err)
+	}
+	known, _ := resolve.LoadKnownRecipients("")
+	if pin := known.Get(srv.URL); pin == nil || pin.PublicKey != first || pin.SigningKey != signingKey {
+		t.Errorf("pin after unrelated keyring signer = %+v", pin)
+	}
+
+	// A signing key in the keyring trusted for the URL is.
+	keyring, _ = LoadKeyring()
+	entry, _ = keyring.Get("alice-signing")
+	if err = entry.TrustAsSigner(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err = keyring.Save(); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := KeyResolver().Resolve(srv.URL)
+	if err != nil || resolved.PublicKey != second || resolved.SignerAlias != "alice-signing" {
+		t.Errorf("keyring signer = %+v, %v", resolved, err)
+	}
+}
@@ -1,8 +1,13 @@
 package utils
 
-import "xipher.org/xipher"
+import (
+	"xipher.org/xipher"
+	"xipher.org/xipher/resolve"
+)
 
 func getCachedSecretKeyForPwd(pwd string) (xsk *xipher.SecretKey, err error) {
+	pwdSecretKeyMapMu.Lock()
+	defer pwdSecretKeyMapMu.Unlock()
 	xsk = pwdSecretKeyMap[pwd]
 	if xsk == nil {
 		if xsk, err = xipher.NewSecretKeyForPassword([]byte(pwd)); err != nil {
@@ -16,20 +21,30 @@ func getCachedSecretKeyForPwd(pwd string) (xsk *xipher.SecretKey, err error) {
 func secretKeyFromSecret(secretKeyOrPwd string) (*xipher.SecretKey, error) {
 	if xipher.IsSecretKeyStr(secretKeyOrPwd) {
 		return xipher.ParseSecretKeyStr(secretKeyOrPwd)
+	} else if IsSSHPrivateKey(secretKeyOrPwd) {
+		return getSecretKeyForSSH(secretKeyOrPwd)
+	} else if xipher.IsAgeIdentityStr(secretKeyOrPwd) {
+		return xipher.ParseAgeIdentity(secretKeyOrPwd)
 	} else {
 		return getCachedSecretKeyForPwd(secretKeyOrPwd)
 	}
 }
 
-func GetPublicKey(secretKeyOrPwd string, quantumSafe bool) (pubKeyStr, pubKeyUrl string, err error) {
+func GetPublicKey(secretKeyOrPwd string, suite xipher.Suite) (pubKeyStr, pubKeyUrl string, err error) {
+	return GetPublicKeyWithMetadata(secretKeyOrPwd, suite, xipher.KeyMetadata{})
+}
+
+// GetPublicKeyWithMetadata is GetPublicKey for a public key that carries meta.
+func GetPublicKeyWithMetadata(secretKeyOrPwd string, suite xipher.Suite, meta xipher.KeyMetadata) (pubKeyStr, pubKeyUrl string, err error) {
 	secretKey, err := secretKeyFromSecret(secretKeyOrPwd)
 	if err != nil {
 		return "", "", err
 	}
-	pubKey, err := secretKey.PublicKey(quantumSafe)
+	pubKey, err := secretKey.PublicKey(suite)
 	if err != nil {
 		return "", "", err
 	}
+	pubKey = pubKey.WithMetadata(meta)
 	if pubKeyStr, err = pubKey.String(); err != nil {
 		return "", "", err
 	}
@@ -41,12 +56,28 @@ func GetPublicKey(secretKeyOrPwd string, quantumSafe bool) (pubKeyStr, pubKeyUrl
 }
 
 func GetSanitisedKeyOrPwd(keyPwdStr string) (sanitisedKey string, isKey bool, name string, err error) {
-	if isKeyURL(keyPwdStr) {
-		if sanitisedKey, name, err = fetchPublicKey(keyPwdStr); err != nil {
+	entry, err := keyringRefEntry(keyPwdStr)
+	if err != nil {
+		return "", false, "", err
+	} else if entry != nil {
+		return entry.PublicKey, true, entry.displayName(), nil
+	}
+	if IsGitHubKeyRef(keyPwdStr) {
+		if sanitisedKey, name, err = resolveGitHubKey(keyPwdStr); err != nil {
 			return "", false, "", err
 		}
 		return sanitisedKey, true, name, nil
 	}
-	keyPwdStr = getSanitisedValue(keyPwdStr, xipher.IsPubKeyStr)
-	return keyPwdStr, xipher.IsPubKeyStr(keyPwdStr) || xipher.IsSecretKeyStr(keyPwdStr), "", nil
+	if resolve.IsKeyURL(keyPwdStr) {
+		resolved, err := keyResolver.Resolve(keyPwdStr)
+		if err != nil {
+			return "", false, "", err
+		}
+		return resolved.PublicKey, true, resolved.Name, nil
+	}
+	input, err := xipher.ParseKeyInput(keyPwdStr)
+	if err != nil {
+		return "", false, "", err
+	}
+	return input.Value, input.IsKey(), "", nil
 }
@@ -0,0 +1,16 @@
+//go:build js
+
+package utils
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"xipher.org/xipher"
+)
+
+// parseSSHPrivateKey is not available in the WASM build, which leaves out the
+// OpenSSH key parser to stay small.
+func parseSSHPrivateKey(pemBytes, passphrase []byte) (ed25519.PrivateKey, error) {
+	return nil, fmt.Errorf("%w: SSH private keys are not supported in this build", xipher.ErrInvalidSSHKey)
+}
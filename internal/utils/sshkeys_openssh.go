@@ -0,0 +1,34 @@
+//go:build !js
+
+package utils
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+	"xipher.org/xipher"
+)
+
+// parseSSHPrivateKey parses an OpenSSH private key, decrypting it with
+// passphrase if it is protected, and returns its Ed25519 key. The passphrase is
+// ignored for keys that are not protected.
+func parseSSHPrivateKey(pemBytes, passphrase []byte) (ed25519.PrivateKey, error) {
+	rawKey, err := ssh.ParseRawPrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if len(passphrase) == 0 {
+			return nil, ErrSSHPassphraseRequired
+		}
+		rawKey, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", xipher.ErrInvalidSSHKey, err)
+	}
+	edKey, ok := rawKey.(*ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: only ssh-ed25519 keys are supported", xipher.ErrInvalidSSHKey)
+	}
+	return *edKey, nil
+}
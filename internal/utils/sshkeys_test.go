@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"xipher.org/xipher"
+)
+
+// newTestSSHKey returns an authorized_keys line and an OpenSSH private key,
+// protected by passphrase if it is not empty.
+func newTestSSHKey(t *testing.T, passphrase string) (authorizedKey string, privateKeyPEM []byte) {
+	t.Helper()
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(edPriv, "alice@example", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(edPriv, "alice@example")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " alice@example", pem.EncodeToMemory(block)
+}
+
+func TestSSHKeyEncryption(t *testing.T) {
+	authorizedKey, privateKeyPEM := newTestSSHKey(t, "")
+	ctStr, _, err := EncryptData(authorizedKey, []byte("for an ssh key"), true)
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	if !IsSSHPrivateKey(string(privateKeyPEM)) {
+		t.Fatal("IsSSHPrivateKey = false for an OpenSSH private key")
+	}
+	// An unprotected private key is accepted directly as the secret.
+	if pt, err := DecryptData(string(privateKeyPEM), ctStr); err != nil || string(pt) != "for an ssh key" {
+		t.Errorf("DecryptData = %q, %v", pt, err)
+	}
+	if _, isKey, _, err := GetSanitisedKeyOrPwd(authorizedKey); err != nil || !isKey {
+		t.Errorf("GetSanitisedKeyOrPwd: isKey = %v, %v", isKey, err)
+	}
+}
+
+func TestLoadSSHPrivateKeyPassphrase(t *testing.T) {
+	authorizedKey, privateKeyPEM := newTestSSHKey(t, "hunter2")
+	ctStr, _, err := EncryptData(authorizedKey, []byte("protected"), false)
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	if _, err := LoadSSHPrivateKey(privateKeyPEM, nil); !errors.Is(err, ErrSSHPassphraseRequired) {
+		t.Fatalf("expected ErrSSHPassphraseRequired, got %v", err)
+	}
+	if _, err := DecryptData(string(privateKeyPEM), ctStr); !errors.Is(err, ErrSSHPassphraseRequired) {
+		t.Fatalf("DecryptData without passphrase: expected ErrSSHPassphraseRequired, got %v", err)
+	}
+	if _, err := LoadSSHPrivateKey(privateKeyPEM, []byte("wrong")); err == nil {
+		t.Fatal("expected an error for a wrong passphrase")
+	}
+	secret, err := LoadSSHPrivateKey(privateKeyPEM, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("LoadSSHPrivateKey: %v", err)
+	}
+	if pt, err := DecryptData(secret, ctStr); err != nil || string(pt) != "protected" {
+		t.Errorf("DecryptData = %q, %v", pt, err)
+	}
+}
+
+func TestResolveGitHubKey(t *testing.T) {
+	authorizedKey, _ := newTestSSHKey(t, "")
+	dir := t.TempDir()
+	keys := "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ\n" + strings.Fields(authorizedKey)[0] + " " + strings.Fields(authorizedKey)[1] + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "alice.keys"), []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bob.keys"), []byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(GitHubKeysDirEnv, dir)
+
+	got, err := ResolveKeyForEncryption("github:alice")
+	if err != nil {
+		t.Fatalf("ResolveKeyForEncryption: %v", err)
+	}
+	if !xipher.IsSSHPublicKeyStr(got) || !strings.HasPrefix(authorizedKey, got) {
+		t.Errorf("resolved %q, want the ssh-ed25519 key %q", got, authorizedKey)
+	}
+	if _, isKey, name, err := GetSanitisedKeyOrPwd("github:alice"); err != nil || !isKey || name != "alice on GitHub" {
+		t.Errorf("GetSanitisedKeyOrPwd: isKey = %v, name = %q, %v", isKey, name, err)
+	}
+	if _, err := ResolveKeyForEncryption("github:bob"); !errors.Is(err, errNoGitHubEd25519Key) {
+		t.Errorf("bob: expected errNoGitHubEd25519Key, got %v", err)
+	}
+	if _, err := ResolveKeyForEncryption("github:-invalid"); err == nil {
+		t.Error("expected an error for an invalid user name")
+	}
+}
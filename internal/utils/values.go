@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"xipher.org/xipher"
+)
+
+// ValuesFormat is the format of a document handled by EncryptValues and DecryptValues.
+type ValuesFormat string
+
+const (
+	ValuesYAML   ValuesFormat = "yaml"
+	ValuesJSON   ValuesFormat = "json"
+	ValuesDotenv ValuesFormat = "dotenv"
+
+	// valuesMetaKey is the top-level key of the metadata record in YAML and JSON documents.
+	valuesMetaKey = "xipher"
+	// valuesDataKeyLength is the length of the per-document MAC key.
+	valuesDataKeyLength = 32
+)
+
+var (
+	// ErrValuesTampered is returned when the encrypted values of a document do not
+	// belong to it, have been moved within it, or have been added or removed, or
+	// when a value left in plaintext has been changed, added or removed.
+	ErrValuesTampered = errors.New("encrypted values have been tampered with")
+
+	errValuesEncrypted    = errors.New("document already has encrypted values (decrypt it first)")
+	errValuesNotEncrypted = errors.New("document has no encrypted values")
+)
+
+// ParseValuesFormat returns the format for a format name or, if name is empty,
+// for the extension of filePath.
+func ParseValuesFormat(name, filePath string) (ValuesFormat, error) {
+	switch strings.ToLower(name) {
+	case "yaml", "yml":
+		return ValuesYAML, nil
+	case "json":
+		return ValuesJSON, nil
+	case "dotenv", "env":
+		return ValuesDotenv, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported format: %s (use yaml, json or dotenv)", name)
+	}
+	base := strings.ToLower(filepath.Base(filePath))
+	switch ext := filepath.Ext(base); {
+	case ext == ".yaml" || ext == ".yml":
+		return ValuesYAML, nil
+	case ext == ".json":
+		return ValuesJSON, nil
+	case ext == ".env" || strings.HasPrefix(base, ".env"):
+		return ValuesDotenv, nil
+	}
+	return "", fmt.Errorf("cannot detect the format of %s", filePath)
+}
+
+// ValuesFilter selects values by their key path, the keys leading to the value
+// joined with dots, with sequence elements numbered from 0. A pattern matches
+// a value if its dot-separated segments match the leading segments of the path,
+// so a pattern selects a whole subtree, or, for patterns without a dot, if it
+// matches any key in the path. Segments use path.Match syntax.
+type ValuesFilter struct {
+	Include []string // If set, only values matching one of these are encrypted
+	Exclude []string // Values matching any of these are left in plaintext
+}
+
+// matchKeyPattern reports whether pattern matches the key path segments.
+func matchKeyPattern(pattern string, segments []string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	if len(patternSegments) == 1 {
+		for _, segment := range segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(patternSegments) > len(segments) {
+		return false
+	}
+	for i, patternSegment := range patternSegments {
+		if ok, _ := path.Match(patternSegment, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// selected reports whether the value at the key path is selected by the filter.
+func (filter *ValuesFilter) selected(segments []string) bool {
+	if filter == nil {
+		return true
+	}
+	for _, pattern := range filter.Exclude {
+		if matchKeyPattern(pattern, segments) {
+			return false
+		}
+	}
+	if len(filter.Include) == 0 {
+		return true
+	}
+	for _, pattern := range filter.Include {
+		if matchKeyPattern(pattern, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueLeaf is a scalar value of a document.
+type valueLeaf struct {
+	path  []string
+	typ   string // Format-specific type of the value, restored on decryption
+	text  bool   // Whether the value is a string, as ciphertexts are
+	value string
+	set   func(typ, value string) // Replaces the value; typ is empty for ciphertexts
+}
+
+// valuesMeta is the metadata record added to documents with encrypted values.
+type valuesMeta struct {
+	DocID   string `json:"docId" yaml:"docId"`     // Random identifier bound into every encrypted value
+	DataKey string `json:"dataKey" yaml:"dataKey"` // Encrypted MAC key
+	MAC     string `json:"mac" yaml:"mac"`         // HMAC-SHA256 over all values of the document, hex encoded
+}
+
+// valuesDoc is a parsed document.
+type valuesDoc interface {
+	leaves() []*valueLeaf
+	meta() (*valuesMeta, error)
+	setMeta(meta *valuesMeta)
+	bytes() ([]byte, error)
+}
+
+// valuePayload is the plaintext of an encrypted value. It binds the value to
+// its document and key path, so it cannot be moved to another one.
+type valuePayload struct {
+	DocID string   `json:"d"`
+	Path  []string `json:"p"`
+	Type  string   `json:"t"`
+	Value string   `json:"v"`
+}
+
+func parseValuesDoc(data []byte, format ValuesFormat) (valuesDoc, error) {
+	switch format {
+	case ValuesYAML:
+		return parseYAMLValues(data)
+	case ValuesJSON:
+		return parseJSONValues(data)
+	case ValuesDotenv:
+		return parseDotenvValues(data)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// writeMAC adds a scalar value of the document, in plaintext, to the document
+// MAC along with its key path and type. Every field is length-prefixed so that
+// no two sequences of values write the same bytes.
+func writeMAC(mac hash.Hash, keyPath []string, typ, value string) {
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(keyPath)))
+	for _, field := range append(slices.Clip(keyPath), typ, value) {
+		buf = binary.AppendUvarint(buf, uint64(len(field)))
+		buf = append(buf, field...)
+	}
+	mac.Write(buf)
+}
+
+// EncryptValues encrypts the values of a YAML, JSON or dotenv document that are
+// selected by filter, replacing each with a ciphertext string while keys, order
+// and comments are kept. It adds a metadata record holding a random document ID
+// and a MAC over every value of the document in order, with its key path and
+// type, whether encrypted or not, keyed with a random key that is itself
+// encrypted for keyOrPwd. It returns the document and the key paths of the
+// encrypted values.
+func EncryptValues(keyOrPwd string, data []byte, format ValuesFormat, filter *ValuesFilter, opts ...xipher.EncryptOption) ([]byte, []string, error) {
+	doc, err := parseValuesDoc(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta, err := doc.meta(); err != nil {
+		return nil, nil, err
+	} else if meta != nil {
+		return nil, nil, errValuesEncrypted
+	}
+	docID := make([]byte, 16)
+	dataKey := make([]byte, valuesDataKeyLength)
+	if _, err := rand.Read(docID); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	meta := &valuesMeta{DocID: hex.EncodeToString(docID)}
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte(meta.DocID))
+	var encrypted []string
+	for _, leaf := range doc.leaves() {
+		writeMAC(mac, leaf.path, leaf.typ, leaf.value)
+		if !filter.selected(leaf.path) {
+			continue
+		}
+		payload, err := json.Marshal(valuePayload{DocID: meta.DocID, Path: leaf.path, Type: leaf.typ, Value: leaf.value})
+		if err != nil {
+			return nil, nil, err
+		}
+		ct, err := encryptData(keyOrPwd, payload, false, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		leaf.set("", ct)
+		encrypted = append(encrypted, strings.Join(leaf.path, "."))
+	}
+	if meta.DataKey, err = encryptData(keyOrPwd, dataKey, false, opts...); err != nil {
+		return nil, nil, err
+	}
+	meta.MAC = hex.EncodeToString(mac.Sum(nil))
+	doc.setMeta(meta)
+	out, err := doc.bytes()
+	return out, encrypted, err
+}
+
+// DecryptValues decrypts the values of a document encrypted with EncryptValues
+// and removes its metadata record. It fails with ErrValuesTampered if an
+// encrypted value belongs to another document or key path, or if encrypted
+// values were added, removed or reordered, or if values left in plaintext were
+// changed. It returns the document and the key
+// paths of the decrypted values.
+func DecryptValues(secretKeyOrPwd string, data []byte, format ValuesFormat) ([]byte, []string, error) {
+	doc, err := parseValuesDoc(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err := doc.meta()
+	if err != nil {
+		return nil, nil, err
+	} else if meta == nil {
+		return nil, nil, errValuesNotEncrypted
+	}
+	dataKey, err := DecryptData(secretKeyOrPwd, meta.DataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(dataKey) != valuesDataKeyLength {
+		return nil, nil, fmt.Errorf("%w: invalid data key", ErrValuesTampered)
+	}
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte(meta.DocID))
+	var decrypted []string
+	for _, leaf := range doc.leaves() {
+		if !leaf.text || !xipher.IsCTStr(leaf.value) {
+			writeMAC(mac, leaf.path, leaf.typ, leaf.value)
+			continue
+		}
+		keyPath := strings.Join(leaf.path, ".")
+		payload, err := DecryptData(secretKeyOrPwd, leaf.value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", keyPath, err)
+		}
+		var value valuePayload
+		if err := json.Unmarshal(payload, &value); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: invalid value", ErrValuesTampered, keyPath)
+		}
+		if value.DocID != meta.DocID || !slices.Equal(value.Path, leaf.path) {
+			return nil, nil, fmt.Errorf("%w: %s: value was encrypted for %s", ErrValuesTampered, keyPath, strings.Join(value.Path, "."))
+		}
+		writeMAC(mac, leaf.path, value.Type, value.Value)
+		leaf.set(value.Type, value.Value)
+		decrypted = append(decrypted, keyPath)
+	}
+	expectedMAC, err := hex.DecodeString(meta.MAC)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return nil, nil, fmt.Errorf("%w: MAC mismatch", ErrValuesTampered)
+	}
+	doc.setMeta(nil)
+	out, err := doc.bytes()
+	return out, decrypted, err
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// JSON value types recorded for encrypted values.
+const (
+	jsonTypeString = "string"
+	jsonTypeNumber = "number"
+	jsonTypeBool   = "bool"
+	jsonTypeNull   = "null"
+)
+
+// jsonValue is a JSON value that keeps the order of object keys.
+type jsonValue struct {
+	object bool
+	array  bool
+	keys   []string     // Object keys, in order
+	items  []*jsonValue // Object values or array elements
+	scalar any          // string, json.Number, bool or nil
+}
+
+// jsonValuesDoc is a JSON document with a top-level object.
+type jsonValuesDoc struct {
+	root *jsonValue
+}
+
+func parseJSONValues(data []byte) (*jsonValuesDoc, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	if !root.object {
+		return nil, fmt.Errorf("the top level of the JSON document must be an object")
+	}
+	return &jsonValuesDoc{root: root}, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (*jsonValue, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return &jsonValue{scalar: token}, nil
+	}
+	value := &jsonValue{object: delim == '{', array: delim == '['}
+	for decoder.More() {
+		if value.object {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value.keys = append(value.keys, key.(string))
+		}
+		item, err := decodeJSONValue(decoder)
+		if err != nil {
+			return nil, err
+		}
+		value.items = append(value.items, item)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (d *jsonValuesDoc) leaves() []*valueLeaf {
+	var leaves []*valueLeaf
+	var walk func(value *jsonValue, path []string)
+	walk = func(value *jsonValue, path []string) {
+		switch {
+		case value.object:
+			for i, key := range value.keys {
+				if len(path) == 0 && key == valuesMetaKey {
+					continue
+				}
+				walk(value.items[i], append(path[:len(path):len(path)], key))
+			}
+		case value.array:
+			for i, item := range value.items {
+				walk(item, append(path[:len(path):len(path)], strconv.Itoa(i)))
+			}
+		default:
+			leaf := &valueLeaf{path: path, set: value.setScalar}
+			switch scalar := value.scalar.(type) {
+			case string:
+				leaf.typ, leaf.text, leaf.value = jsonTypeString, true, scalar
+			case json.Number:
+				leaf.typ, leaf.value = jsonTypeNumber, scalar.String()
+			case bool:
+				leaf.typ, leaf.value = jsonTypeBool, strconv.FormatBool(scalar)
+			default:
+				leaf.typ = jsonTypeNull
+			}
+			leaves = append(leaves, leaf)
+		}
+	}
+	walk(d.root, nil)
+	return leaves
+}
+
+// setScalar sets a scalar value from its type and text.
+func (value *jsonValue) setScalar(typ, text string) {
+	switch typ {
+	case jsonTypeNumber:
+		value.scalar = json.Number(text)
+	case jsonTypeBool:
+		value.scalar = text == "true"
+	case jsonTypeNull:
+		value.scalar = nil
+	default:
+		value.scalar = text
+	}
+}
+
+func (d *jsonValuesDoc) meta() (*valuesMeta, error) {
+	i := lastKeyIndex(d.root.keys, valuesMetaKey)
+	if i < 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := d.root.items[i].write(&buf, ""); err != nil {
+		return nil, err
+	}
+	meta := &valuesMeta{}
+	if err := json.Unmarshal(buf.Bytes(), meta); err != nil {
+		return nil, fmt.Errorf("invalid %s metadata: %w", valuesMetaKey, err)
+	}
+	return meta, nil
+}
+
+func (d *jsonValuesDoc) setMeta(meta *valuesMeta) {
+	root := d.root
+	if i := lastKeyIndex(root.keys, valuesMetaKey); i >= 0 {
+		root.keys = append(root.keys[:i], root.keys[i+1:]...)
+		root.items = append(root.items[:i], root.items[i+1:]...)
+	}
+	if meta == nil {
+		return
+	}
+	root.keys = append(root.keys, valuesMetaKey)
+	root.items = append(root.items, &jsonValue{
+		object: true,
+		keys:   []string{"docId", "dataKey", "mac"},
+		items:  []*jsonValue{{scalar: meta.DocID}, {scalar: meta.DataKey}, {scalar: meta.MAC}},
+	})
+}
+
+func (d *jsonValuesDoc) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.root.write(&buf, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// write writes the value indented by two spaces per level.
+func (value *jsonValue) write(buf *bytes.Buffer, indent string) error {
+	if !value.object && !value.array {
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value.scalar); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode appends a newline
+		return nil
+	}
+	openDelim, closeDelim := "[", "]"
+	if value.object {
+		openDelim, closeDelim = "{", "}"
+	}
+	buf.WriteString(openDelim)
+	if len(value.items) == 0 {
+		buf.WriteString(closeDelim)
+		return nil
+	}
+	inner := indent + "  "
+	for i, item := range value.items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("\n" + inner)
+		if value.object {
+			key := &jsonValue{scalar: value.keys[i]}
+			if err := key.write(buf, inner); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+		}
+		if err := item.write(buf, inner); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("\n" + indent + closeDelim)
+	return nil
+}
+
+// lastKeyIndex returns the index of the last occurrence of key in keys, or -1.
+// The last occurrence is the one that takes effect when a JSON object has
+// duplicate keys.
+func lastKeyIndex(keys []string, key string) int {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i] == key {
+			return i
+		}
+	}
+	return -1
+}
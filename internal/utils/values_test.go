@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"xipher.org/xipher"
+)
+
+func newTestSecretKey(t *testing.T) string {
+	t.Helper()
+	sk, err := xipher.NewSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	skStr, err := sk.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return skStr
+}
+
+var valuesTestDocs = map[ValuesFormat]string{
+	ValuesYAML: `# Service config
+name: api
+db:
+  host: db.internal # primary
+  port: 5432
+  password: "hunter2"
+  ssl: true
+  zip: "01234"
+tokens:
+  - abc
+  - null
+`,
+	ValuesJSON: `{
+  "name": "api",
+  "db": {
+    "host": "db.internal",
+    "port": 5432,
+    "password": "hunter2 <&>",
+    "ssl": true,
+    "ratio": 1.50
+  },
+  "tokens": [
+    "abc",
+    null
+  ],
+  "empty": {}
+}
+`,
+	ValuesDotenv: `# Service config
+export NAME=api
+DB_HOST=db.internal   # primary
+
+DB_PASSWORD="hunter2 \"quoted\""
+DB_NOTE='single # quoted'
+MULTI="line one
+line two"
+`,
+}
+
+func TestValuesRoundTrip(t *testing.T) {
+	skStr := newTestSecretKey(t)
+	for format, doc := range valuesTestDocs {
+		encrypted, paths, err := EncryptValues(skStr, []byte(doc), format, nil)
+		if err != nil {
+			t.Fatalf("%s: EncryptValues: %v", format, err)
+		}
+		if len(paths) == 0 {
+			t.Fatalf("%s: no values encrypted", format)
+		}
+		if strings.Contains(string(encrypted), "hunter2") {
+			t.Errorf("%s: plaintext value left in encrypted document:\n%s", format, encrypted)
+		}
+		if _, _, err := EncryptValues(skStr, encrypted, format, nil); err == nil {
+			t.Errorf("%s: encrypting an encrypted document succeeded", format)
+		}
+		decrypted, decryptedPaths, err := DecryptValues(skStr, encrypted, format)
+		if err != nil {
+			t.Fatalf("%s: DecryptValues: %v", format, err)
+		}
+		if string(decrypted) != doc {
+			t.Errorf("%s: round trip mismatch:\n%s\nwant:\n%s", format, decrypted, doc)
+		}
+		if !slices.Equal(paths, decryptedPaths) {
+			t.Errorf("%s: decrypted %v, encrypted %v", format, decryptedPaths, paths)
+		}
+	}
+}
+
+func TestValuesFilter(t *testing.T) {
+	skStr := newTestSecretKey(t)
+	filter := &ValuesFilter{Include: []string{"db", "tokens.0"}, Exclude: []string{"host", "db.p*t"}}
+	encrypted, paths, err := EncryptValues(skStr, []byte(valuesTestDocs[ValuesYAML]), ValuesYAML, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"db.password", "db.ssl", "db.zip", "tokens.0"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("encrypted %v, want %v", paths, want)
+	}
+	for _, kept := range []string{"name: api", "host: db.internal # primary", "port: 5432", "# Service config"} {
+		if !strings.Contains(string(encrypted), kept) {
+			t.Errorf("%q missing from encrypted document:\n%s", kept, encrypted)
+		}
+	}
+}
+
+func TestValuesTampering(t *testing.T) {
+	skStr := newTestSecretKey(t)
+	doc := "A=one\nB=two\nC=three\n"
+	encrypted, _, err := EncryptValues(skStr, []byte(doc), ValuesDotenv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := EncryptValues(skStr, []byte(doc), ValuesDotenv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := func(doc []byte) map[string]string {
+		m := make(map[string]string)
+		for _, line := range strings.Split(string(doc), "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				m[key] = value
+			}
+		}
+		return m
+	}
+	enc, oth := values(encrypted), values(other)
+	cases := map[string]string{
+		"swapped within document": strings.Replace(strings.Replace(string(encrypted), enc["A"], "SWAP", 1), enc["B"], enc["A"], 1),
+		"from other document":     strings.Replace(string(encrypted), enc["A"], oth["A"], 1),
+		"removed value":           regexp.MustCompile(`(?m)^B=.*\n`).ReplaceAllString(string(encrypted), ""),
+		"cleartext replacement":   strings.Replace(string(encrypted), enc["C"], "plain", 1),
+	}
+	for name, tampered := range cases {
+		if _, _, err := DecryptValues(skStr, []byte(tampered), ValuesDotenv); !errors.Is(err, ErrValuesTampered) {
+			t.Errorf("%s: expected ErrValuesTampered, got %v", name, err)
+		}
+	}
+
+	partial, _, err := EncryptValues(skStr, []byte(doc), ValuesDotenv, &ValuesFilter{Exclude: []string{"B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecryptValues(skStr, partial, ValuesDotenv); err != nil {
+		t.Fatalf("DecryptValues: %v", err)
+	}
+	cases = map[string]string{
+		"changed excluded value": strings.Replace(string(partial), "B=two", "B=evil", 1),
+		"added plaintext value":  strings.Replace(string(partial), "B=two\n", "B=two\nD=four\n", 1),
+		"removed excluded value": strings.Replace(string(partial), "B=two\n", "", 1),
+	}
+	for name, tampered := range cases {
+		if tampered == string(partial) {
+			t.Fatalf("%s: document unchanged", name)
+		}
+		if _, _, err := DecryptValues(skStr, []byte(tampered), ValuesDotenv); !errors.Is(err, ErrValuesTampered) {
+			t.Errorf("%s: expected ErrValuesTampered, got %v", name, err)
+		}
+	}
+}
+
+func TestParseValuesFormat(t *testing.T) {
+	cases := map[string]ValuesFormat{
+		"config.yaml":     ValuesYAML,
+		"values.YML":      ValuesYAML,
+		"settings.json":   ValuesJSON,
+		".env":            ValuesDotenv,
+		".env.production": ValuesDotenv,
+		"prod.env":        ValuesDotenv,
+	}
+	for name, want := range cases {
+		if got, err := ParseValuesFormat("", name); err != nil || got != want {
+			t.Errorf("%s: got %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseValuesFormat("", "notes.txt"); err == nil {
+		t.Errorf("expected an error for an unknown extension")
+	}
+	if got, err := ParseValuesFormat("json", "notes.txt"); err != nil || got != ValuesJSON {
+		t.Errorf("explicit format: got %q, %v", got, err)
+	}
+}
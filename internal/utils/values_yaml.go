@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const yamlStrTag = "!!str"
+
+// yamlStyles names the scalar styles recorded along with the tag of encrypted values.
+var yamlStyles = map[yaml.Style]string{
+	yaml.DoubleQuotedStyle: "double",
+	yaml.SingleQuotedStyle: "single",
+	yaml.LiteralStyle:      "literal",
+	yaml.FoldedStyle:       "folded",
+}
+
+// yamlScalarType returns the type of a scalar: its tag, followed by its style
+// if it is not plain.
+func yamlScalarType(node *yaml.Node) string {
+	if style, ok := yamlStyles[node.Style&^(yaml.TaggedStyle|yaml.FlowStyle)]; ok {
+		return node.ShortTag() + " " + style
+	}
+	return node.ShortTag()
+}
+
+// setYAMLScalar sets the value of a scalar along with the tag and style given by typ.
+func setYAMLScalar(node *yaml.Node, typ, value string) {
+	tag, styleName, _ := strings.Cut(typ, " ")
+	node.Tag, node.Value, node.Style = tag, value, 0
+	for style, name := range yamlStyles {
+		if name == styleName {
+			node.Style = style
+		}
+	}
+}
+
+// yamlValuesDoc is a YAML document, kept as a node tree to preserve key order and comments.
+type yamlValuesDoc struct {
+	doc *yaml.Node
+}
+
+func parseYAMLValues(data []byte) (*yamlValuesDoc, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	var doc yaml.Node
+	if err := decoder.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("empty YAML document")
+		}
+		return nil, err
+	}
+	if err := decoder.Decode(&yaml.Node{}); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("multiple YAML documents are not supported")
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the top level of the YAML document must be a mapping")
+	}
+	return &yamlValuesDoc{doc: &doc}, nil
+}
+
+func (d *yamlValuesDoc) root() *yaml.Node {
+	return d.doc.Content[0]
+}
+
+func (d *yamlValuesDoc) leaves() []*valueLeaf {
+	var leaves []*valueLeaf
+	var walk func(node *yaml.Node, path []string)
+	walk = func(node *yaml.Node, path []string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i]
+				if key.ShortTag() == "!!merge" || len(path) == 0 && key.Value == valuesMetaKey {
+					continue
+				}
+				walk(node.Content[i+1], append(path[:len(path):len(path)], key.Value))
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				walk(item, append(path[:len(path):len(path)], strconv.Itoa(i)))
+			}
+		case yaml.ScalarNode:
+			leaves = append(leaves, &valueLeaf{
+				path:  path,
+				typ:   yamlScalarType(node),
+				text:  node.ShortTag() == yamlStrTag,
+				value: node.Value,
+				set: func(typ, value string) {
+					if typ == "" {
+						typ = yamlStrTag
+					}
+					setYAMLScalar(node, typ, value)
+				},
+			})
+		}
+	}
+	walk(d.root(), nil)
+	return leaves
+}
+
+// metaIndex returns the index of the metadata key in the root mapping, or -1.
+func (d *yamlValuesDoc) metaIndex() int {
+	root := d.root()
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == valuesMetaKey {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *yamlValuesDoc) meta() (*valuesMeta, error) {
+	i := d.metaIndex()
+	if i < 0 {
+		return nil, nil
+	}
+	meta := &valuesMeta{}
+	if err := d.root().Content[i+1].Decode(meta); err != nil {
+		return nil, fmt.Errorf("invalid %s metadata: %w", valuesMetaKey, err)
+	}
+	return meta, nil
+}
+
+func (d *yamlValuesDoc) setMeta(meta *valuesMeta) {
+	root := d.root()
+	if i := d.metaIndex(); i >= 0 {
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+	}
+	if meta == nil {
+		return
+	}
+	var value yaml.Node
+	value.Encode(meta)
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: yamlStrTag, Value: valuesMetaKey}, &value)
+}
+
+func (d *yamlValuesDoc) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(d.doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
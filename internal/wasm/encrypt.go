@@ -9,6 +9,7 @@ import (
 	"sync"
 	"syscall/js"
 
+	"xipher.org/xipher"
 	"xipher.org/xipher/internal/utils"
 )
 
@@ -18,7 +19,7 @@ func encryptStr(args []js.Value) (any, error) {
 	}
 	keyOrPwd := args[0].String()
 	message := args[1].String()
-	ciphertext, _, err := utils.EncryptData(keyOrPwd, []byte(message), true)
+	ciphertext, err := xipher.EncryptText(keyOrPwd, []byte(message), true)
 	if err != nil {
 		return nil, err
 	}
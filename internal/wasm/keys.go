@@ -41,14 +41,27 @@ func secretKeyFromSeed(args []js.Value) (any, error) {
 
 func getPublicKey(args []js.Value) (any, error) {
 	if len(args) != 1 && len(args) != 2 {
-		return nil, fmt.Errorf("supported arguments: secret key (required), quantum safe (optional)")
+		return nil, fmt.Errorf("supported arguments: secret key (required), suite name or quantum safe flag (optional)")
 	}
 	secret := args[0].String()
-	quantumSafe := false
+	suite := xipher.SuiteECC
 	if len(args) == 2 {
-		quantumSafe = args[1].Bool()
+		switch args[1].Type() {
+		case js.TypeBoolean:
+			if args[1].Bool() {
+				suite = xipher.SuiteHybrid
+			}
+		case js.TypeString:
+			var err error
+			if suite, err = xipher.ParseSuite(args[1].String()); err != nil {
+				return nil, err
+			}
+		case js.TypeUndefined, js.TypeNull:
+		default:
+			return nil, fmt.Errorf("suite must be a suite name or a boolean")
+		}
 	}
-	pkStr, _, err := utils.GetPublicKey(secret, quantumSafe)
+	pkStr, _, err := utils.GetPublicKey(secret, suite)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,175 @@
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// KeyCacheEnv is the environment variable naming the key cache file to use
+	// instead of xipher/keys.json in the user cache directory.
+	KeyCacheEnv = "XIPHER_KEY_CACHE"
+
+	keyCacheFileName = "keys.json"
+)
+
+// ErrKeyNotCached is returned in offline mode for a key that is not in the key cache.
+var ErrKeyNotCached = errors.New("the public key is not in the key cache")
+
+// keyCacheFileMu serialises the read-modify-write of the key cache files within
+// the process.
+var keyCacheFileMu sync.Mutex
+
+// CachedKey is a published key document as fetched from a URL, with the HTTP
+// validators to revalidate it and the fingerprint of its primary key, to
+// compare with the key pinned for the URL.
+type CachedKey struct {
+	URL          string    `json:"url"`
+	Fingerprint  string    `json:"fingerprint"`
+	Document     string    `json:"document"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	FreshUntil   time.Time `json:"freshUntil"`
+}
+
+// Fresh reports whether the entry may be used without revalidating it.
+func (entry *CachedKey) Fresh() bool {
+	return time.Now().Before(entry.FreshUntil)
+}
+
+// KeyCache is the on-disk cache of published key documents, kept as a JSON file
+// readable only by the user.
+type KeyCache struct {
+	path    string
+	Entries []CachedKey `json:"entries"`
+}
+
+// KeyCachePath returns the path of the key cache file: the value of KeyCacheEnv
+// if it is set, otherwise xipher/keys.json in the user cache directory.
+func KeyCachePath() (string, error) {
+	return userFilePath(KeyCacheEnv, os.UserCacheDir, keyCacheFileName)
+}
+
+// LoadKeyCache reads the key cache file at path, or at KeyCachePath if path is
+// empty. A key cache that does not exist yet is empty.
+func LoadKeyCache(path string) (*KeyCache, error) {
+	if path == "" {
+		var err error
+		if path, err = KeyCachePath(); err != nil {
+			return nil, err
+		}
+	}
+	cache := &KeyCache{path: path}
+	if err := readJSONFile(path, cache); err != nil {
+		return nil, fmt.Errorf("failed to read the key cache: %w", err)
+	}
+	return cache, nil
+}
+
+// Path returns the path of the key cache file.
+func (cache *KeyCache) Path() string {
+	return cache.path
+}
+
+// Save writes the key cache atomically, creating its directory if needed.
+func (cache *KeyCache) Save() error {
+	return writeJSONFile(cache.path, cache)
+}
+
+// Get returns the entry for the URL, or nil if there is none.
+func (cache *KeyCache) Get(keyURL string) *CachedKey {
+	for i := range cache.Entries {
+		if cache.Entries[i].URL == keyURL {
+			return &cache.Entries[i]
+		}
+	}
+	return nil
+}
+
+// put adds entry in place of any entry for its URL.
+func (cache *KeyCache) put(entry CachedKey) {
+	cache.remove(entry.URL)
+	cache.Entries = append(cache.Entries, entry)
+}
+
+// remove removes the entry for the URL, if there is one.
+func (cache *KeyCache) remove(keyURL string) {
+	cache.Entries = slices.DeleteFunc(cache.Entries, func(e CachedKey) bool {
+		return e.URL == keyURL
+	})
+}
+
+// Clear removes every entry.
+func (cache *KeyCache) Clear() {
+	cache.Entries = nil
+}
+
+// loadCachedKey returns the entry for the URL in the key cache file at path, or nil.
+func loadCachedKey(path, keyURL string) (*CachedKey, error) {
+	keyCacheFileMu.Lock()
+	defer keyCacheFileMu.Unlock()
+	cache, err := LoadKeyCache(path)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Get(keyURL), nil
+}
+
+// storeCachedKey stores entry in the key cache file at path, or removes the
+// entry for its URL if store is false.
+func storeCachedKey(path string, entry CachedKey, store bool) error {
+	keyCacheFileMu.Lock()
+	defer keyCacheFileMu.Unlock()
+	cache, err := LoadKeyCache(path)
+	if err != nil {
+		return err
+	}
+	if store {
+		cache.put(entry)
+	} else if cache.Get(entry.URL) != nil {
+		cache.remove(entry.URL)
+	} else {
+		return nil
+	}
+	return cache.Save()
+}
+
+// keyCacheFreshness returns how long a response with header may be used
+// without revalidating it, and whether it may be stored at all, from its
+// Cache-Control max-age, no-cache and no-store directives or its Expires
+// header. Responses with neither are fresh for keyCacheTTL.
+func keyCacheFreshness(header http.Header, now time.Time) (time.Duration, bool) {
+	maxAge := -1
+	for _, directive := range strings.Split(strings.Join(header.Values("Cache-Control"), ","), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			return 0, false
+		case "no-cache":
+			maxAge = 0
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 && maxAge != 0 {
+				maxAge = seconds
+			}
+		}
+	}
+	if maxAge >= 0 {
+		return time.Duration(maxAge) * time.Second, true
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+		// An invalid Expires header means already expired.
+		return 0, true
+	}
+	return keyCacheTTL, true
+}
@@ -0,0 +1,129 @@
+package resolve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyCacheFreshness(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		header    http.Header
+		freshFor  time.Duration
+		storeable bool
+	}{
+		{http.Header{}, keyCacheTTL, true},
+		{http.Header{"Cache-Control": {"public, max-age=3600"}}, time.Hour, true},
+		{http.Header{"Cache-Control": {"max-age=3600, no-cache"}}, 0, true},
+		{http.Header{"Cache-Control": {"no-cache", "max-age=3600"}}, 0, true},
+		{http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{http.Header{"Expires": {now.Add(2 * time.Hour).UTC().Format(http.TimeFormat)}}, 2 * time.Hour, true},
+		{http.Header{"Expires": {"0"}}, 0, true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"0"}}, time.Minute, true},
+	}
+	for _, c := range cases {
+		freshFor, store := keyCacheFreshness(c.header, now)
+		if store != c.storeable || (freshFor-c.freshFor).Abs() > time.Second {
+			t.Errorf("keyCacheFreshness(%v) = %v, %v, want %v, %v", c.header, freshFor, store, c.freshFor, c.storeable)
+		}
+	}
+}
+
+func TestKeyCacheRevalidation(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	var requests, notModified int
+	cacheControl := "max-age=0"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") != "" {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(pubStr))
+	}))
+	t.Cleanup(srv.Close)
+	keyFetchClient = srv.Client()
+	clearKeyCache()
+	keyURL := srv.URL + "/key"
+
+	for range 2 {
+		if got, _, err := fetchPublicKey(keyURL); err != nil || got != pubStr {
+			t.Fatalf("fetchPublicKey = %.12s, %v", got, err)
+		}
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("stale entry: %d requests, %d not modified, want 2 and 1", requests, notModified)
+	}
+	cache, err := LoadKeyCache("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := cache.Get(keyURL)
+	fingerprint, _ := publicKeyFingerprint(pubStr)
+	if entry == nil || entry.Fingerprint != fingerprint || entry.ETag != `"v1"` || entry.Fresh() {
+		t.Fatalf("cached entry = %+v", entry)
+	}
+
+	// A fresh entry on disk is used without a request by the next process.
+	cacheControl = "max-age=3600"
+	fetchPublicKey(keyURL)
+	clearMemo()
+	requests = 0
+	if got, _, err := fetchPublicKey(keyURL); err != nil || got != pubStr || requests != 0 {
+		t.Errorf("fresh entry = %.12s, %v after %d requests", got, err, requests)
+	}
+
+	// Responses that must not be stored are not written to disk.
+	cacheControl = "no-store"
+	clearKeyCache()
+	fetchPublicKey(keyURL)
+	if cache, _ := LoadKeyCache(""); len(cache.Entries) != 0 {
+		t.Errorf("no-store response cached: %+v", cache.Entries)
+	}
+}
+
+func TestOfflineMode(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	srv := serveBody(t, pubStr)
+	t.Cleanup(func() { setOffline(false) })
+
+	setOffline(true)
+	if _, err := Resolve(srv.URL + "/key"); !errors.Is(err, ErrKeyNotCached) {
+		t.Fatalf("uncached key: expected ErrKeyNotCached, got %v", err)
+	}
+	setOffline(false)
+	if _, err := Resolve(srv.URL + "/key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Offline, cached keys are used however stale, and still checked against the pin.
+	cache, _ := LoadKeyCache("")
+	cache.Entries[0].FreshUntil = time.Now().Add(-time.Hour)
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	clearMemo()
+	srv.Close()
+	setOffline(true)
+	if resolved, err := Resolve(srv.URL + "/key"); err != nil || resolved.PublicKey != pubStr {
+		t.Errorf("offline = %+v, %v", resolved, err)
+	}
+	if _, err := ResolveWithMode("example.com", ModeDNS); !errors.Is(err, ErrKeyNotCached) {
+		t.Errorf("offline DNS: expected ErrKeyNotCached, got %v", err)
+	}
+
+	known, _ := LoadKnownRecipients("")
+	pin := known.Get(srv.URL + "/key")
+	pin.PublicKey, pin.Fingerprint = newTestPubKey(t), "SHA256:other"
+	known.Save()
+	if _, err := Resolve(srv.URL + "/key"); !errors.Is(err, ErrKeyChanged) {
+		t.Errorf("offline, pinned to another key: expected ErrKeyChanged, got %v", err)
+	}
+}
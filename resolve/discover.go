@@ -0,0 +1,326 @@
+package resolve
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	keyURLPrefix     = "https://"
+	wellKnownKeyPath = "/.well-known/xipher"
+	maxKeyRespBytes  = 8 << 10 // 8 KiB is plenty for an XPK_ string.
+	maxKeyNameLen    = 64
+	keyFetchTimeout  = 10 * time.Second
+	maxKeyRedirects  = 5
+	keyCacheTTL      = 60 * time.Second // For responses without caching headers.
+)
+
+var (
+	errInsecureKeyURL   = errors.New("only https:// URLs are supported for public key resolution")
+	errBadKeyResponse   = errors.New("the URL did not serve a valid public key")
+	errKeyResponseLarge = errors.New("public key response exceeded the size limit")
+)
+
+// domainRegex matches a bare host (optionally with a path) that has no URL
+// scheme, e.g. "alice.com" or "alice.com/keys". It requires at least one dot in
+// the host and a valid TLD-like label so ordinary passwords are not misread as
+// domains.
+var domainRegex = regexp.MustCompile(`^([a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}(?::\d+)?(?:/[^\s]*)?$`)
+
+// emailRegex matches an email address whose domain is a host domainRegex would
+// match, e.g. "alice@example.com". The local part may not contain characters
+// that have a meaning in URLs.
+var emailRegex = regexp.MustCompile(`^[^\s@/:?#]+@([a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}$`)
+
+// zBase32Encoding is the z-base-32 encoding WKD uses for hashed local parts.
+var zBase32Encoding = base32.NewEncoding("ybndrfg8ejkmcpqxot1uwisza345h769").WithPadding(base32.NoPadding)
+
+// schemeRegex matches a leading URL scheme such as "http://" or "https://".
+var schemeRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// hasScheme reports whether raw already carries a URL scheme (e.g. "http://",
+// "https://", "ftp://").
+func hasScheme(raw string) bool {
+	return schemeRegex.MatchString(strings.TrimSpace(raw))
+}
+
+// looksLikeDomain reports whether raw is a schemeless host that could be fetched
+// as an https key URL (e.g. "alice.com" or "alice.com/keys"). It is used to
+// decide whether to prompt the user; it never auto-fetches.
+func looksLikeDomain(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	return !hasScheme(raw) && domainRegex.MatchString(raw)
+}
+
+// looksLikeEmail reports whether raw is an email address whose public key could
+// be discovered at its domain (e.g. "alice@example.com"). Like looksLikeDomain,
+// it is used to decide whether to prompt the user; it never auto-fetches.
+func looksLikeEmail(raw string) bool {
+	return emailRegex.MatchString(strings.TrimSpace(raw))
+}
+
+// emailKeyURLCandidates returns the URLs to try, in order, to discover the
+// public key of an email address, WKD-style: the local part is lower-cased,
+// hashed with SHA-1 and z-base-32 encoded, and looked up first with the
+// advanced method, on the xipher subdomain, then with the direct method, e.g.
+// "alice@example.com" -> [
+// "https://xipher.example.com/.well-known/xipher/example.com/kei1q4tipxxu1yj79k9kfukdhfy631xe?l=alice",
+// "https://example.com/.well-known/xipher/kei1q4tipxxu1yj79k9kfukdhfy631xe?l=alice"].
+func emailKeyURLCandidates(email string) []string {
+	local, domain, _ := strings.Cut(strings.TrimSpace(email), "@")
+	domain = strings.ToLower(domain)
+	hashedLocal := hashEmailLocal(local)
+	// As in WKD, the l parameter carries the local part as it was given.
+	query := url.Values{"l": {local}}.Encode()
+	return []string{
+		keyURLPrefix + "xipher." + domain + wellKnownKeyPath + "/" + domain + "/" + hashedLocal + "?" + query,
+		keyURLPrefix + domain + wellKnownKeyPath + "/" + hashedLocal + "?" + query,
+	}
+}
+
+// hashEmailLocal returns the lower-cased local part of an email address hashed
+// with SHA-1 and z-base-32 encoded, as it appears in key discovery URLs.
+func hashEmailLocal(local string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(local)))
+	return zBase32Encoding.EncodeToString(sum[:])
+}
+
+// schemelessHost extracts the host (without port or path) from a schemeless
+// authority string such as "localhost:8771/path" or "127.0.0.1".
+func schemelessHost(raw string) string {
+	if i := strings.IndexByte(raw, '/'); i >= 0 {
+		raw = raw[:i]
+	}
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		return host
+	}
+	return raw
+}
+
+// normaliseKeyURL prepends a scheme to a schemeless host so it can be fetched:
+// "http://" for loopback hosts (local development) and "https://" otherwise. An
+// input that already has a scheme is returned unchanged (and is rejected later
+// if its scheme is not allowed), as is an email address.
+func normaliseKeyURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if hasScheme(raw) || looksLikeEmail(raw) {
+		return raw
+	}
+	if isLoopbackHost(schemelessHost(raw)) {
+		return "http://" + raw
+	}
+	return keyURLPrefix + raw
+}
+
+// isLoopbackHost reports whether host is a loopback address (localhost,
+// 127.0.0.0/8, or ::1), for which plain http is permitted (local development).
+func isLoopbackHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return false
+}
+
+// isSchemeAllowed reports whether u may be fetched: https everywhere, or http
+// when the host is a loopback address (for local development/testing).
+func isSchemeAllowed(u *url.URL) bool {
+	if u.Scheme == "https" {
+		return true
+	}
+	if u.Scheme == "http" && isLoopbackHost(u.Hostname()) {
+		return true
+	}
+	return false
+}
+
+// keyURLCandidates validates the scheme of rawURL (https, or http for loopback
+// hosts) and returns the URLs to try, in order:
+//   - A bare host (no path) yields a single candidate at the well-known key path
+//     (RFC 8615), e.g. "alice.com" -> "https://alice.com/.well-known/xipher".
+//   - A path-bearing URL is tried verbatim first, then with the well-known path
+//     appended, e.g. "alice.com/shib" -> ["https://alice.com/shib",
+//     "https://alice.com/shib/.well-known/xipher"]. This lets a URL point either
+//     directly at a key file or at a path that hosts one under .well-known.
+//   - An email address yields the candidates of emailKeyURLCandidates.
+func keyURLCandidates(rawURL string) ([]string, error) {
+	if looksLikeEmail(rawURL) {
+		return emailKeyURLCandidates(rawURL), nil
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key URL: %w", err)
+	}
+	if !isSchemeAllowed(u) {
+		return nil, errInsecureKeyURL
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = wellKnownKeyPath
+		return []string{u.String()}, nil
+	}
+	verbatim := u.String()
+	wk := *u
+	wk.Path = strings.TrimRight(u.Path, "/") + wellKnownKeyPath
+	return []string{verbatim, wk.String()}, nil
+}
+
+// sanitiseName trims, strips control characters from, and length-caps an
+// untrusted display name served by a remote host.
+func sanitiseName(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > maxKeyNameLen {
+		// Cap by runes to avoid splitting a multi-byte character.
+		runes := []rune(name)
+		if len(runes) > maxKeyNameLen {
+			runes = runes[:maxKeyNameLen]
+		}
+		name = string(runes)
+	}
+	return name
+}
+
+// fetchOneURL fetches and parses the published key document at a single
+// resolved URL. Unless caching is disabled, documents are kept in memory and in
+// the key cache for as long as the caching headers of the response allow, then
+// revalidated with a conditional request. In offline mode, only cached
+// documents are used, however old they are.
+func (resolver *Resolver) fetchOneURL(ctx context.Context, resolvedURL string) (*publishedKey, error) {
+	if doc, ok := resolver.recalled(resolvedURL); ok {
+		return doc, doc.checkExpiry()
+	}
+	cachePath, err := resolver.keyCachePath()
+	if err != nil {
+		return nil, err
+	}
+	var cached *CachedKey
+	if cachePath != "" {
+		if cached, err = loadCachedKey(cachePath, resolvedURL); err != nil {
+			return nil, err
+		}
+	}
+	if cached != nil && (resolver.offline || cached.Fresh()) {
+		return resolver.cachedDocument(cached)
+	}
+	if resolver.offline {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotCached, resolvedURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resolvedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key URL: %w", err)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := resolver.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch public key from %s: %w", resolvedURL, err)
+	}
+	defer resp.Body.Close()
+	now := time.Now()
+	freshFor, store := keyCacheFreshness(resp.Header, now)
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		entry := *cached
+		entry.FreshUntil = now.Add(freshFor).UTC().Truncate(time.Second)
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			entry.ETag = etag
+		}
+		if err = storeCachedKey(cachePath, entry, store); err != nil {
+			return nil, err
+		}
+		return resolver.cachedDocument(&entry)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch public key from %s: unexpected status %s", resolvedURL, resp.Status)
+	}
+
+	// Read one byte past the limit so we can detect oversize responses.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKeyRespBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key from %s: %w", resolvedURL, err)
+	}
+	if len(body) > maxKeyRespBytes {
+		return nil, errKeyResponseLarge
+	}
+
+	doc, err := parsePublishedKey(body)
+	if err != nil {
+		return nil, err
+	}
+	if cachePath == "" {
+		return doc, nil
+	}
+	fingerprint, err := publicKeyFingerprint(doc.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	entry := CachedKey{
+		URL:          resolvedURL,
+		Fingerprint:  fingerprint,
+		Document:     string(body),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      now.UTC().Truncate(time.Second),
+		FreshUntil:   now.Add(freshFor).UTC().Truncate(time.Second),
+	}
+	if err = storeCachedKey(cachePath, entry, store); err != nil {
+		return nil, err
+	}
+	resolver.remember(resolvedURL, doc, entry.FreshUntil)
+	return doc, nil
+}
+
+// cachedDocument parses, and so verifies again, a document from the key cache.
+func (resolver *Resolver) cachedDocument(entry *CachedKey) (*publishedKey, error) {
+	doc, err := parsePublishedKey([]byte(entry.Document))
+	if err != nil {
+		return nil, err
+	}
+	resolver.remember(entry.URL, doc, entry.FreshUntil)
+	return doc, nil
+}
+
+// fetchPublishedKey resolves an https:// URL to the published key document it
+// serves. A bare host is probed at the well-known path; a path-bearing URL is
+// tried verbatim and then with the well-known path appended. It hard-errors on
+// any failure and never falls back to other interpretations of the input.
+func (resolver *Resolver) fetchPublishedKey(ctx context.Context, rawURL string) (doc *publishedKey, err error) {
+	candidates, err := keyURLCandidates(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		// Try each candidate (e.g. the well-known fallback) in turn; the last
+		// candidate's error is the one returned if none succeed.
+		doc, err = resolver.fetchOneURL(ctx, candidate)
+		if err == nil {
+			return doc, nil
+		}
+	}
+	return nil, err
+}
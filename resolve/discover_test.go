@@ -0,0 +1,563 @@
+package resolve
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"xipher.org/xipher"
+)
+
+// newTestPubKey derives a valid XPK_ public key string for use in tests.
+func newTestPubKey(t *testing.T) string {
+	t.Helper()
+	sk, err := xipher.NewSecretKey()
+	if err != nil {
+		t.Fatalf("failed to create secret key: %v", err)
+	}
+	pub, err := sk.PublicKey(xipher.SuiteECC)
+	if err != nil {
+		t.Fatalf("failed to derive public key: %v", err)
+	}
+	pubStr, err := pub.String()
+	if err != nil {
+		t.Fatalf("failed to stringify public key: %v", err)
+	}
+	return pubStr
+}
+
+// serveBody starts a TLS test server returning body for every request and wires
+// keyFetchClient to trust it. It returns the server URL.
+func serveBody(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	isolatePins(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	keyFetchClient = srv.Client()
+	keyFetchClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return errInsecureKeyURL
+		}
+		return nil
+	}
+	clearKeyCache()
+	return srv
+}
+
+func TestIsKeyURL(t *testing.T) {
+	cases := map[string]bool{
+		"https://keys.example.com/xpk": true,
+		"  https://example.com  ":      true,
+		"http://example.com/xpk":       false,
+		"XPK_ABCDEF":                   false,
+		"my.dotted.password":           false,
+		"example.com":                  false,
+		"":                             false,
+	}
+	for in, want := range cases {
+		if got := IsKeyURL(in); got != want {
+			t.Errorf("IsKeyURL(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestIsKeyURLEmbeddedKey(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	cases := map[string]bool{
+		"https://xipher.org/#" + pubStr:    false,
+		"https://xipher.org/?pk=" + pubStr: false,
+		"https://xipher.org/#not-a-key":    true,
+	}
+	for in, want := range cases {
+		if got := IsKeyURL(in); got != want {
+			t.Errorf("IsKeyURL(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestFetchPublicKeyPlaintext(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	// surround with whitespace to confirm trimming
+	srv := serveBody(t, "\n  "+pubStr+"\n")
+
+	got, name, err := fetchPublicKey(srv.URL)
+	if err != nil {
+		t.Fatalf("fetchPublicKey returned error: %v", err)
+	}
+	if got != pubStr {
+		t.Errorf("fetchPublicKey key = %q, want %q", got, pubStr)
+	}
+	if name != "" {
+		t.Errorf("plaintext key should have no name, got %q", name)
+	}
+}
+
+func TestFetchPublicKeyJSON(t *testing.T) {
+	pubStr := newTestPubKey(t)
+
+	t.Run("with name", func(t *testing.T) {
+		srv := serveBody(t, `{"name":"Alice","publicKey":"`+pubStr+`"}`)
+		got, name, err := fetchPublicKey(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != pubStr {
+			t.Errorf("key = %q, want %q", got, pubStr)
+		}
+		if name != "Alice" {
+			t.Errorf("name = %q, want %q", name, "Alice")
+		}
+	})
+
+	t.Run("without name", func(t *testing.T) {
+		srv := serveBody(t, `{"publicKey":"`+pubStr+`"}`)
+		got, name, err := fetchPublicKey(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != pubStr {
+			t.Errorf("key = %q, want %q", got, pubStr)
+		}
+		if name != "" {
+			t.Errorf("name = %q, want empty", name)
+		}
+	})
+
+	t.Run("bad publicKey field", func(t *testing.T) {
+		srv := serveBody(t, `{"name":"Alice","publicKey":"not-a-key"}`)
+		if _, _, err := fetchPublicKey(srv.URL); err != errBadKeyResponse {
+			t.Errorf("want errBadKeyResponse, got %v", err)
+		}
+	})
+
+	t.Run("name length capped", func(t *testing.T) {
+		longName := strings.Repeat("a", maxKeyNameLen+50)
+		srv := serveBody(t, `{"name":"`+longName+`","publicKey":"`+pubStr+`"}`)
+		_, name, err := fetchPublicKey(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len([]rune(name)) != maxKeyNameLen {
+			t.Errorf("name length = %d, want %d", len([]rune(name)), maxKeyNameLen)
+		}
+	})
+}
+
+func TestFetchPublicKeyWellKnownProbing(t *testing.T) {
+	pubStr := newTestPubKey(t)
+
+	t.Run("bare host probes well-known", func(t *testing.T) {
+		var gotPath string
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			w.Write([]byte(pubStr))
+		}))
+		t.Cleanup(srv.Close)
+		keyFetchClient = srv.Client()
+		clearKeyCache()
+
+		if _, _, err := fetchPublicKey(srv.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gotPath != wellKnownKeyPath {
+			t.Errorf("bare host requested path %q, want %q", gotPath, wellKnownKeyPath)
+		}
+	})
+
+	t.Run("explicit path fetched verbatim", func(t *testing.T) {
+		var gotPath string
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			w.Write([]byte(pubStr))
+		}))
+		t.Cleanup(srv.Close)
+		keyFetchClient = srv.Client()
+		clearKeyCache()
+
+		if _, _, err := fetchPublicKey(srv.URL + "/mykey"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gotPath != "/mykey" {
+			t.Errorf("explicit path requested %q, want %q", gotPath, "/mykey")
+		}
+	})
+
+	t.Run("path falls back to well-known under that path", func(t *testing.T) {
+		var paths []string
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			// The verbatim path has no key; only the well-known fallback does.
+			if r.URL.Path == "/shib"+wellKnownKeyPath {
+				w.Write([]byte(pubStr))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		t.Cleanup(srv.Close)
+		keyFetchClient = srv.Client()
+		clearKeyCache()
+
+		got, _, err := fetchPublicKey(srv.URL + "/shib")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != pubStr {
+			t.Errorf("key = %q, want %q", got, pubStr)
+		}
+		want := []string{"/shib", "/shib" + wellKnownKeyPath}
+		if len(paths) != len(want) || paths[0] != want[0] || paths[1] != want[1] {
+			t.Errorf("probed paths = %v, want %v", paths, want)
+		}
+	})
+}
+
+func TestFetchPublicKeyErrors(t *testing.T) {
+	t.Run("insecure http", func(t *testing.T) {
+		clearKeyCache()
+		if _, _, err := fetchPublicKey("http://example.com/xpk"); err != errInsecureKeyURL {
+			t.Errorf("want errInsecureKeyURL, got %v", err)
+		}
+	})
+
+	t.Run("non-key body", func(t *testing.T) {
+		srv := serveBody(t, "not a public key")
+		if _, _, err := fetchPublicKey(srv.URL); err != errBadKeyResponse {
+			t.Errorf("want errBadKeyResponse, got %v", err)
+		}
+	})
+
+	t.Run("non-200", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		t.Cleanup(srv.Close)
+		keyFetchClient = srv.Client()
+		clearKeyCache()
+		if _, _, err := fetchPublicKey(srv.URL); err == nil {
+			t.Error("want error for non-200, got nil")
+		}
+	})
+
+	t.Run("oversize", func(t *testing.T) {
+		srv := serveBody(t, strings.Repeat("X", maxKeyRespBytes+10))
+		if _, _, err := fetchPublicKey(srv.URL); err != errKeyResponseLarge {
+			t.Errorf("want errKeyResponseLarge, got %v", err)
+		}
+	})
+}
+
+func TestLooksLikeDomain(t *testing.T) {
+	cases := map[string]bool{
+		"alice.com":         true,
+		"alice.example.com": true,
+		"alice.com/keys":    true,
+		"alice.com:8443/k":  true,
+		"https://alice.com": false, // already has a scheme
+		"http://alice.com":  false, // already has a scheme
+		"XPK_ABCDEF":        false,
+		"my password":       false, // space
+		"justaword":         false, // no dot
+		"":                  false,
+		"localhost":         false, // no dot/TLD
+		"a.b":               false, // single-char TLD
+		"a.io":              true,
+	}
+	for in, want := range cases {
+		if got := looksLikeDomain(in); got != want {
+			t.Errorf("looksLikeDomain(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestNormaliseKeyURL(t *testing.T) {
+	cases := map[string]string{
+		"alice.com":         "https://alice.com",
+		"alice.com/keys":    "https://alice.com/keys",
+		"https://alice.com": "https://alice.com",
+		"http://alice.com":  "http://alice.com", // scheme preserved; rejected later
+		"  alice.com  ":     "https://alice.com",
+		"localhost:8080":    "http://localhost:8080", // loopback defaults to http
+		"127.0.0.1/key":     "http://127.0.0.1/key",
+		"localhost":         "http://localhost",
+	}
+	for in, want := range cases {
+		if got := normaliseKeyURL(in); got != want {
+			t.Errorf("normaliseKeyURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFetchPublicKeyFromURLBareLoopback(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	var gotPath string
+	// Plain http loopback server; schemeless loopback input must default to http.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(pubStr))
+	}))
+	t.Cleanup(srv.Close)
+	keyFetchClient = &http.Client{Timeout: keyFetchTimeout}
+	clearKeyCache()
+	isolatePins(t)
+
+	// Strip the scheme to simulate a bare "127.0.0.1:PORT" input.
+	bareHost := strings.TrimPrefix(srv.URL, "http://")
+	got, _, err := resolvePublicKey(bareHost)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != pubStr {
+		t.Errorf("key = %q, want %q", got, pubStr)
+	}
+	if gotPath != wellKnownKeyPath {
+		t.Errorf("bare loopback requested path %q, want %q", gotPath, wellKnownKeyPath)
+	}
+}
+
+func TestFetchPublicKeyFromURLRejectsNonHTTPS(t *testing.T) {
+	clearKeyCache()
+	if _, _, err := resolvePublicKey("http://alice.com/key"); err != errInsecureKeyURL {
+		t.Errorf("want errInsecureKeyURL, got %v", err)
+	}
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	cases := map[string]bool{
+		"localhost":   true,
+		"LOCALHOST":   true,
+		"127.0.0.1":   true,
+		"127.0.0.5":   true,
+		"::1":         true,
+		"alice.com":   false,
+		"example.org": false,
+		"10.0.0.1":    false,
+	}
+	for in, want := range cases {
+		if got := isLoopbackHost(in); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestKeyURLCandidatesAllowsLoopbackHTTP(t *testing.T) {
+	cases := map[string]bool{ // url -> should be allowed
+		"http://localhost/key":      true,
+		"http://localhost:8080/key": true,
+		"http://127.0.0.1:9000":     true,
+		"https://localhost/key":     true,
+		"http://alice.com/key":      false,
+	}
+	for in, wantOK := range cases {
+		_, err := keyURLCandidates(in)
+		if wantOK && err != nil {
+			t.Errorf("keyURLCandidates(%q) = %v, want no error", in, err)
+		}
+		if !wantOK && err != errInsecureKeyURL {
+			t.Errorf("keyURLCandidates(%q) err = %v, want errInsecureKeyURL", in, err)
+		}
+	}
+}
+
+func TestKeyURLCandidatesWellKnownProbing(t *testing.T) {
+	cases := map[string][]string{
+		"https://alice.com":  {"https://alice.com/.well-known/xipher"},
+		"https://alice.com/": {"https://alice.com/.well-known/xipher"},
+		"https://alice.com/shib": {
+			"https://alice.com/shib",
+			"https://alice.com/shib/.well-known/xipher",
+		},
+		"https://alice.com/shib/": {
+			"https://alice.com/shib/",
+			"https://alice.com/shib/.well-known/xipher",
+		},
+	}
+	for in, want := range cases {
+		got, err := keyURLCandidates(in)
+		if err != nil {
+			t.Fatalf("keyURLCandidates(%q) error: %v", in, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("keyURLCandidates(%q) = %v, want %v", in, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("keyURLCandidates(%q)[%d] = %q, want %q", in, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestFetchPublicKeyLoopbackHTTP(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	// A plain (non-TLS) http server on loopback.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(pubStr))
+	}))
+	t.Cleanup(srv.Close)
+	keyFetchClient = &http.Client{Timeout: keyFetchTimeout}
+	clearKeyCache()
+
+	// httptest.NewServer yields http://127.0.0.1:PORT, a loopback http endpoint.
+	got, _, err := fetchPublicKey(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching loopback http: %v", err)
+	}
+	if got != pubStr {
+		t.Errorf("key = %q, want %q", got, pubStr)
+	}
+}
+
+func TestLooksLikeEmail(t *testing.T) {
+	cases := map[string]bool{
+		"alice@example.com":       true,
+		" Alice.Doe@mail.io ":     true,
+		"alice+tag@example.co.uk": true,
+		"alice@localhost":         false, // no dot/TLD
+		"alice@example.com/keys":  false,
+		"a/b@example.com":         false,
+		"@example.com":            false,
+		"alice@":                  false,
+		"example.com":             false,
+		"p@ss word@example.com":   false,
+	}
+	for in, want := range cases {
+		if got := looksLikeEmail(in); got != want {
+			t.Errorf("looksLikeEmail(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestEmailKeyURLCandidates(t *testing.T) {
+	// The hashed local part of the WKD specification's example.
+	got, err := keyURLCandidates("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://xipher.example.org/.well-known/xipher/example.org/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe",
+		"https://example.org/.well-known/xipher/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe",
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("keyURLCandidates = %v, want %v", got, want)
+	}
+}
+
+// serveAllHosts starts a TLS test server that handles the requests for every
+// host, as if example.com and its subdomains resolved to it, and wires
+// keyFetchClient to dial it.
+func serveAllHosts(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	isolatePins(t)
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+	keyFetchClient = srv.Client()
+	transport := keyFetchClient.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	keyFetchClient.Transport = transport
+	clearKeyCache()
+}
+
+func TestFetchPublicKeyForEmail(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	const hashedLocal = "kei1q4tipxxu1yj79k9kfukdhfy631xe" // "alice"
+
+	t.Run("advanced", func(t *testing.T) {
+		var requested string
+		serveAllHosts(t, func(w http.ResponseWriter, r *http.Request) {
+			requested = r.Host + r.URL.RequestURI()
+			w.Write([]byte(`{"name":"Alice","publicKey":"` + pubStr + `"}`))
+		})
+		got, name, err := resolvePublicKey("Alice@Example.com")
+		if err != nil || got != pubStr || name != "Alice" {
+			t.Fatalf("FetchPublicKeyFromURL = %.12s, %q, %v", got, name, err)
+		}
+		if want := "xipher.example.com" + wellKnownKeyPath + "/example.com/" + hashedLocal + "?l=Alice"; requested != want {
+			t.Errorf("requested %q, want %q", requested, want)
+		}
+		known, _ := LoadKnownRecipients("")
+		if pin := known.Get("alice@example.com"); pin == nil || pin.URL != "alice@example.com" || pin.PublicKey != pubStr {
+			t.Errorf("pin = %+v", pin)
+		}
+	})
+
+	t.Run("direct fallback", func(t *testing.T) {
+		var hosts []string
+		serveAllHosts(t, func(w http.ResponseWriter, r *http.Request) {
+			hosts = append(hosts, r.Host)
+			if r.Host != "example.com" || r.URL.Path != wellKnownKeyPath+"/"+hashedLocal {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(pubStr))
+		})
+		resolved, err := Resolve("alice@example.com")
+		if err != nil || resolved.PublicKey != pubStr || resolved.URL != "alice@example.com" {
+			t.Fatalf("ResolveKeyURL = %+v, %v", resolved, err)
+		}
+		if len(hosts) != 2 || hosts[0] != "xipher.example.com" || hosts[1] != "example.com" {
+			t.Errorf("requested hosts = %v", hosts)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		serveAllHosts(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		if _, err := Resolve("bob@example.com"); err == nil {
+			t.Error("expected an error when neither method finds a key")
+		}
+	})
+}
+
+// clearKeyCache empties the in-memory and the on-disk key cache of the default
+// resolver.
+func clearKeyCache() {
+	clearMemo()
+	keyCacheFileMu.Lock()
+	if path, err := KeyCachePath(); err == nil {
+		os.Remove(path)
+	}
+	keyCacheFileMu.Unlock()
+}
+
+// clearMemo forgets the documents the default resolver keeps in memory, as a
+// new process would.
+func clearMemo() {
+	defaultResolver.memoMu.Lock()
+	defaultResolver.memo = make(map[string]memoEntry)
+	defaultResolver.memoMu.Unlock()
+}
+
+// setOffline takes the default resolver offline, or back online.
+func setOffline(offline bool) {
+	defaultResolver.offline = offline
+}
+
+// fetchPublicKey fetches the published key document of rawURL with the default
+// resolver, without pinning, and returns its primary key and name.
+func fetchPublicKey(rawURL string) (pubKey, name string, err error) {
+	doc, err := defaultResolver.fetchPublishedKey(context.Background(), rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	return doc.PublicKey, doc.Name, nil
+}
+
+// resolvePublicKey resolves rawURL with the default resolver and returns the
+// selected key and the name of its document.
+func resolvePublicKey(rawURL string) (pubKey, name string, err error) {
+	resolved, err := Resolve(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	return resolved.PublicKey, resolved.Name, nil
+}
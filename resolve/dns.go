@@ -0,0 +1,192 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"xipher.org/xipher"
+)
+
+// Mode selects how the public key of a bare domain is discovered.
+type Mode string
+
+const (
+	// ModeAuto tries the HTTPS well-known lookup first and falls back to the
+	// _xipher DNS TXT record of the domain.
+	ModeAuto Mode = "auto"
+	// ModeHTTPS only fetches the key from the URL, or the well-known path of
+	// the domain.
+	ModeHTTPS Mode = "https"
+	// ModeDNS looks up the _xipher TXT record of the domain, then fetches and
+	// verifies the key it points to.
+	ModeDNS Mode = "dns"
+)
+
+const (
+	dnsKeyRecordPrefix  = "_xipher."
+	dnsKeyRecordVersion = "xipher1"
+)
+
+var (
+	// ErrDNSFingerprintMismatch is returned when the key served does not match
+	// the fingerprint published in DNS.
+	ErrDNSFingerprintMismatch = errors.New("the public key served does not match the fingerprint published in DNS")
+
+	errNoDNSKeyRecord   = errors.New("no xipher TXT record found")
+	errBadDNSKeyRecord  = errors.New("the xipher TXT record has neither a fingerprint nor a key URL")
+	errNotDNSDomain     = errors.New("DNS key discovery needs a bare domain, such as example.com")
+	errInvalidFetchMode = errors.New("invalid fetch mode: use auto, https or dns")
+)
+
+// ParseMode parses a mode: auto, https or dns. An empty string is ModeAuto.
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", ModeAuto:
+		return ModeAuto, nil
+	case ModeHTTPS:
+		return ModeHTTPS, nil
+	case ModeDNS:
+		return ModeDNS, nil
+	}
+	return "", fmt.Errorf("%w: %q", errInvalidFetchMode, mode)
+}
+
+// dnsKeyRecord is a _xipher TXT record. It is a list of tag=value pairs
+// separated by semicolons, starting with the version, e.g.
+// "v=xipher1; fp=SHA256:...; url=https://keys.example.com/alice". The fp tag
+// holds the fingerprint of the public key and the url tag the URL serving it,
+// which defaults to the well-known path of the domain.
+type dnsKeyRecord struct {
+	fingerprint string
+	url         string
+}
+
+// parseDNSKeyRecord parses a TXT record, reporting false if it is not a xipher
+// record.
+func parseDNSKeyRecord(txt string) (*dnsKeyRecord, bool, error) {
+	tags := strings.Split(txt, ";")
+	if version, ok := strings.CutPrefix(strings.TrimSpace(tags[0]), "v="); !ok || strings.TrimSpace(version) != dnsKeyRecordVersion {
+		return nil, false, nil
+	}
+	record := &dnsKeyRecord{}
+	for _, tag := range tags[1:] {
+		name, value, _ := strings.Cut(tag, "=")
+		switch strings.TrimSpace(name) {
+		case "fp":
+			record.fingerprint = strings.TrimSpace(value)
+		case "url":
+			record.url = strings.TrimSpace(value)
+		}
+	}
+	if record.fingerprint == "" && record.url == "" {
+		return nil, true, errBadDNSKeyRecord
+	}
+	return record, true, nil
+}
+
+// dnsKeyDomain returns the domain of raw if it names a bare domain, with or
+// without an https:// scheme and with no port or path, whose key could be
+// discovered through DNS.
+func dnsKeyDomain(raw string) (string, bool) {
+	if looksLikeEmail(raw) {
+		return "", false
+	}
+	u, err := url.Parse(normaliseKeyURL(raw))
+	if err != nil || u.Scheme != "https" || u.Port() != "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return "", false
+	}
+	domain := strings.ToLower(u.Hostname())
+	return domain, looksLikeDomain(domain)
+}
+
+// lookupDNSKeyRecord returns the first xipher record in the _xipher TXT records
+// of domain.
+func (resolver *Resolver) lookupDNSKeyRecord(ctx context.Context, domain string) (*dnsKeyRecord, error) {
+	if resolver.offline {
+		return nil, fmt.Errorf("%w: DNS records are not cached, look up %s online", ErrKeyNotCached, domain)
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolver.timeout())
+	defer cancel()
+	name := dnsKeyRecordPrefix + domain
+	txts, err := resolver.dnsResolver().LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, fmt.Errorf("%w at %s", errNoDNSKeyRecord, name)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+	for _, txt := range txts {
+		record, ok, err := parseDNSKeyRecord(txt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if ok {
+			return record, nil
+		}
+	}
+	return nil, fmt.Errorf("%w at %s", errNoDNSKeyRecord, name)
+}
+
+// fetchDNSPublishedKey discovers the published key document of a bare domain
+// through its _xipher TXT record: the document is fetched from the URL of the
+// record, or the well-known path of the domain, and its primary key must have
+// the fingerprint of the record, if it has one.
+func (resolver *Resolver) fetchDNSPublishedKey(ctx context.Context, raw string) (*publishedKey, error) {
+	domain, ok := dnsKeyDomain(raw)
+	if !ok {
+		return nil, errNotDNSDomain
+	}
+	record, err := resolver.lookupDNSKeyRecord(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	keyURL := record.url
+	if keyURL == "" {
+		keyURL = keyURLPrefix + domain
+	}
+	doc, err := resolver.fetchPublishedKey(ctx, keyURL)
+	if err != nil {
+		return nil, err
+	}
+	if record.fingerprint != "" {
+		fingerprint, err := publicKeyFingerprint(doc.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if fingerprint != record.fingerprint {
+			return nil, fmt.Errorf("%w: %s publishes %s, the key served has %s", ErrDNSFingerprintMismatch, domain, record.fingerprint, fingerprint)
+		}
+	}
+	return doc, nil
+}
+
+// discoverPublishedKey returns the published key document for raw, found as
+// mode selects. In ModeAuto mode, a bare domain whose HTTPS lookup fails
+// falls back to DNS, unless the document was found but rejected or the
+// resolver is offline.
+func (resolver *Resolver) discoverPublishedKey(ctx context.Context, raw string, mode Mode) (*publishedKey, error) {
+	switch mode {
+	case ModeHTTPS:
+		return resolver.fetchPublishedKey(ctx, raw)
+	case ModeDNS:
+		return resolver.fetchDNSPublishedKey(ctx, raw)
+	}
+	doc, err := resolver.fetchPublishedKey(ctx, raw)
+	if err == nil || errors.Is(err, ErrInvalidKeySignature) || errors.Is(err, xipher.ErrKeyExpired) {
+		return doc, err
+	}
+	if _, ok := dnsKeyDomain(raw); !ok || resolver.offline {
+		return nil, err
+	}
+	doc, dnsErr := resolver.fetchDNSPublishedKey(ctx, raw)
+	if errors.Is(dnsErr, errNoDNSKeyRecord) {
+		return nil, err
+	} else if dnsErr != nil {
+		return nil, dnsErr
+	}
+	return doc, nil
+}
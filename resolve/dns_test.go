@@ -0,0 +1,215 @@
+package resolve
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// serveDNS starts a stub DNS server on loopback answering TXT queries from
+// records, by lower-case name without the trailing dot, and returns a resolver
+// querying it. Names that are not in records do not exist.
+func serveDNS(t *testing.T, records map[string][]string) *net.Resolver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := stubDNSResponse(buf[:n], records); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+// stubDNSResponse answers a DNS query with the TXT records of the name it asks
+// for, or NXDOMAIN.
+func stubDNSResponse(query []byte, records map[string][]string) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		n := int(query[i])
+		if i+1+n > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+n]))
+		i += 1 + n
+	}
+	questionEnd := i + 5 // The root label, QTYPE and QCLASS.
+	if questionEnd > len(query) {
+		return nil
+	}
+	txts, ok := records[strings.ToLower(strings.Join(labels, "."))]
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+
+	resp := append([]byte{}, query[:2]...) // ID
+	flags := uint16(0x8180)                // Response, recursion desired and available.
+	if !ok {
+		flags |= 3 // NXDOMAIN
+	}
+	var answers [][]byte
+	if qtype == 16 {
+		for _, txt := range txts {
+			var rdata []byte
+			for len(txt) > 0 {
+				chunk := txt[:min(len(txt), 255)]
+				txt = txt[len(chunk):]
+				rdata = append(append(rdata, byte(len(chunk))), chunk...)
+			}
+			answer := []byte{0xc0, 12, 0, 16, 0, 1, 0, 0, 0, 60}
+			answer = binary.BigEndian.AppendUint16(answer, uint16(len(rdata)))
+			answers = append(answers, append(answer, rdata...))
+		}
+	}
+	resp = binary.BigEndian.AppendUint16(resp, flags)
+	resp = binary.BigEndian.AppendUint16(resp, 1)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(answers)))
+	resp = append(resp, 0, 0, 0, 0)
+	resp = append(resp, query[12:questionEnd]...)
+	for _, answer := range answers {
+		resp = append(resp, answer...)
+	}
+	return resp
+}
+
+func TestParseDNSKeyRecord(t *testing.T) {
+	record, ok, err := parseDNSKeyRecord("v=xipher1; fp=SHA256:abc; url=https://keys.example.com/alice")
+	if err != nil || !ok || record.fingerprint != "SHA256:abc" || record.url != "https://keys.example.com/alice" {
+		t.Errorf("parseDNSKeyRecord = %+v, %v, %v", record, ok, err)
+	}
+	if _, ok, err := parseDNSKeyRecord("v=spf1 include:example.com ~all"); ok || err != nil {
+		t.Errorf("SPF record: ok = %v, %v", ok, err)
+	}
+	if _, ok, err := parseDNSKeyRecord("v=xipher1; other=1"); !ok || !errors.Is(err, errBadDNSKeyRecord) {
+		t.Errorf("record without fp or url: ok = %v, %v", ok, err)
+	}
+}
+
+func TestDNSKeyDomain(t *testing.T) {
+	cases := map[string]string{
+		"example.com":          "example.com",
+		"https://Example.COM/": "example.com",
+		"example.com/keys":     "",
+		"example.com:8443":     "",
+		"alice@example.com":    "",
+		"127.0.0.1":            "",
+		"localhost":            "",
+		"http://example.com":   "",
+	}
+	for in, want := range cases {
+		got, ok := dnsKeyDomain(in)
+		if ok != (want != "") || (ok && got != want) {
+			t.Errorf("dnsKeyDomain(%q) = %q, %v, want %q", in, got, ok, want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": ModeAuto, "auto": ModeAuto, "HTTPS": ModeHTTPS, " dns ": ModeDNS} {
+		if got, err := ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseMode("ftp"); !errors.Is(err, errInvalidFetchMode) {
+		t.Errorf("expected errInvalidFetchMode, got %v", err)
+	}
+}
+
+func TestDNSKeyDiscovery(t *testing.T) {
+	pubStr, otherStr := newTestPubKey(t), newTestPubKey(t)
+	fingerprint, _ := publicKeyFingerprint(pubStr)
+	var hosts []string
+	serveAllHosts(t, func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host+r.URL.Path)
+		switch r.Host + r.URL.Path {
+		case "keys.example.com/alice", "alice.example.com" + wellKnownKeyPath:
+			w.Write([]byte(pubStr))
+		case "bob.example.com" + wellKnownKeyPath:
+			w.Write([]byte(otherStr))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	dns := serveDNS(t, map[string][]string{
+		"_xipher.example.com":       {"v=spf1 -all", "v=xipher1; fp=" + fingerprint + "; url=https://keys.example.com/alice"},
+		"_xipher.alice.example.com": {"v=xipher1; fp=" + fingerprint},
+		"_xipher.bob.example.com":   {"v=xipher1; fp=" + fingerprint},
+	})
+	resolver := New(WithDNSResolver(dns))
+
+	t.Run("dns", func(t *testing.T) {
+		resolved, err := resolver.ResolveWithMode("example.com", ModeDNS)
+		if err != nil || resolved.PublicKey != pubStr || resolved.URL != "https://example.com" {
+			t.Fatalf("ResolveKeyURLWithMode = %+v, %v", resolved, err)
+		}
+	})
+
+	t.Run("auto falls back to dns", func(t *testing.T) {
+		isolatePins(t)
+		clearKeyCache()
+		resolver = New(WithDNSResolver(dns))
+		hosts = nil
+		resolved, err := resolver.Resolve("example.com")
+		if err != nil || resolved.PublicKey != pubStr {
+			t.Fatalf("ResolveKeyURL = %+v, %v", resolved, err)
+		}
+		if len(hosts) != 2 || hosts[0] != "example.com"+wellKnownKeyPath || hosts[1] != "keys.example.com/alice" {
+			t.Errorf("requested = %v", hosts)
+		}
+	})
+
+	t.Run("https only", func(t *testing.T) {
+		clearKeyCache()
+		resolver = New(WithDNSResolver(dns))
+		if _, err := resolver.ResolveWithMode("example.com", ModeHTTPS); err == nil {
+			t.Error("expected the HTTPS lookup to fail without falling back to DNS")
+		}
+	})
+
+	t.Run("fingerprint checked", func(t *testing.T) {
+		if resolved, err := resolver.ResolveWithMode("alice.example.com", ModeDNS); err != nil || resolved.PublicKey != pubStr {
+			t.Errorf("matching fingerprint = %+v, %v", resolved, err)
+		}
+		if _, err := resolver.ResolveWithMode("bob.example.com", ModeDNS); !errors.Is(err, ErrDNSFingerprintMismatch) {
+			t.Errorf("expected ErrDNSFingerprintMismatch, got %v", err)
+		}
+	})
+
+	t.Run("no record", func(t *testing.T) {
+		if _, err := resolver.ResolveWithMode("carol.example.com", ModeDNS); !errors.Is(err, errNoDNSKeyRecord) {
+			t.Errorf("expected errNoDNSKeyRecord, got %v", err)
+		}
+		if _, err := resolver.ResolveWithMode("example.com/keys", ModeDNS); !errors.Is(err, errNotDNSDomain) {
+			t.Errorf("expected errNotDNSDomain, got %v", err)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := New(WithDNSResolver(dns), WithoutCache()).ResolveWithModeContext(ctx, "alice.example.com", ModeDNS); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package resolve_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"xipher.org/xipher"
+	"xipher.org/xipher/resolve"
+)
+
+// ExampleResolve demonstrates encrypting to the public key an email address
+// publishes.
+func ExampleResolve() {
+	key, err := resolve.Resolve("alice@example.com")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Encrypting to", key.Fingerprint, "from", key.URL)
+	ciphertext, err := xipher.EncryptText(key.PublicKey, []byte("Hello, Alice!"), true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(ciphertext)
+}
+
+// ExampleNew demonstrates resolving keys through a corporate proxy that
+// inspects TLS.
+func ExampleNew() {
+	client, err := resolve.NewHTTPClient(resolve.TransportConfig{
+		CAFiles: []string{"/etc/ssl/corp-ca.pem"},
+		Proxy:   "http://proxy.corp:3128",
+		Timeout: "30s",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, err := resolve.New(resolve.WithHTTPClient(client)).ResolveWithMode("example.com", resolve.ModeDNS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(key.PublicKey)
+}
+
+// ExampleLooksLikeEmail demonstrates telling inputs to resolve from passwords.
+func ExampleLooksLikeEmail() {
+	for _, input := range []string{"https://example.com/alice", "example.com", "alice@example.com", "my-secure-password"} {
+		fmt.Printf("%s: URL %t, domain %t, email %t\n", input,
+			resolve.IsKeyURL(input), resolve.LooksLikeDomain(input), resolve.LooksLikeEmail(input))
+	}
+	// Output:
+	// https://example.com/alice: URL true, domain false, email false
+	// example.com: URL false, domain true, email false
+	// alice@example.com: URL false, domain false, email true
+	// my-secure-password: URL false, domain false, email false
+}
+
+// ExampleNewKeyServer demonstrates publishing a public key for alice@example.com.
+func ExampleNewKeyServer() {
+	secretKey, err := xipher.NewSecretKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	publicKey, _ := secretKey.PublicKey(xipher.SuiteECC)
+	pubKeyString, _ := publicKey.String()
+
+	key := resolve.ServedKey{Path: "alice", PublicKey: pubKeyString, Name: "Alice"}
+	handler, err := resolve.NewKeyServer(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	fmt.Println(key.ServedPaths()[:3])
+	resp, err := http.Get(srv.URL + "/alice")
+	if err != nil {
+		log.Fatal(err)
+	}
+	resp.Body.Close()
+	fmt.Println(resp.Status, resp.Header.Get("Content-Type"), resp.Header.Get("Cache-Control"))
+	// Output:
+	// [/alice /alice/.well-known/xipher /.well-known/xipher/alice]
+	// 200 OK application/json public, max-age=3600
+}
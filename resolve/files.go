@@ -0,0 +1,73 @@
+package resolve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	dirName  = "xipher"
+	dirPerm  = 0o700
+	filePerm = 0o600
+)
+
+// userFilePath returns the path of a file in the xipher directory of the user
+// directory baseDir returns, or the value of the environment variable env if it
+// is set.
+func userFilePath(env string, baseDir func() (string, error), fileName string) (string, error) {
+	if path := os.Getenv(env); path != "" {
+		return path, nil
+	}
+	dir, err := baseDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user directory of %s: %w", fileName, err)
+	}
+	return filepath.Join(dir, dirName, fileName), nil
+}
+
+// readJSONFile decodes the JSON file at path into v, leaving v unchanged if
+// the file does not exist.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile atomically writes v as JSON to path, readable only by the
+// user, creating its directory if needed.
+func writeJSONFile(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(file.Name())
+	if err = file.Chmod(filePerm); err == nil {
+		if _, err = file.Write(append(data, '\n')); err == nil {
+			err = file.Sync()
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
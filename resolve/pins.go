@@ -0,0 +1,349 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"xipher.org/xipher"
+)
+
+const (
+	// KnownRecipientsEnv is the environment variable naming the file of pinned
+	// public keys to use instead of xipher/known_recipients.json in the user
+	// config directory.
+	KnownRecipientsEnv = "XIPHER_KNOWN_RECIPIENTS"
+
+	knownRecipientsFileName = "known_recipients.json"
+)
+
+var (
+	// ErrKeyChanged is matched by a *KeyChangedError.
+	ErrKeyChanged = errors.New("public key changed")
+	// ErrNotPinned is returned when untrusting a URL that has no pinned key.
+	ErrNotPinned = errors.New("no public key is pinned for this URL")
+
+	errPinningDisabled = errors.New("the resolver does not pin keys")
+)
+
+// knownRecipientsMu serialises the read-modify-write of the pin file within
+// the process, e.g. when a batch resolves several URLs.
+var knownRecipientsMu sync.Mutex
+
+// KeyChangedError is returned when a URL serves a public key other than the
+// one pinned for it the first time it was seen.
+type KeyChangedError struct {
+	URL               string
+	PinnedFingerprint string
+	Fingerprint       string
+	FirstSeen         time.Time
+}
+
+func (e *KeyChangedError) Error() string {
+	return fmt.Sprintf("%s: %s now serves a different public key than when it was first seen on %s (pinned %s, served %s); "+
+		"confirm the new fingerprint with the recipient, then trust it with: xipher keys trust %s",
+		ErrKeyChanged, e.URL, e.FirstSeen.Format(time.DateOnly), e.PinnedFingerprint, e.Fingerprint, e.URL)
+}
+
+// Is reports whether target is ErrKeyChanged.
+func (e *KeyChangedError) Is(target error) bool {
+	return target == ErrKeyChanged
+}
+
+// KnownRecipient is the public key pinned for a URL, along with the key its
+// published key document was signed with, if it was signed.
+type KnownRecipient struct {
+	URL               string    `json:"url"`
+	Fingerprint       string    `json:"fingerprint"`
+	PublicKey         string    `json:"publicKey"`
+	SigningKey        string    `json:"signingKey,omitempty"`
+	SignerFingerprint string    `json:"signerFingerprint,omitempty"`
+	FirstSeen         time.Time `json:"firstSeen"`
+}
+
+// KnownRecipients is the store of public keys pinned, trust on first use, for
+// the URLs and domains they were resolved from.
+type KnownRecipients struct {
+	path       string
+	Recipients []KnownRecipient `json:"recipients"`
+}
+
+// KnownRecipientsPath returns the path of the pin file: the value of
+// KnownRecipientsEnv if it is set, otherwise xipher/known_recipients.json in
+// the user config directory.
+func KnownRecipientsPath() (string, error) {
+	return userFilePath(KnownRecipientsEnv, os.UserConfigDir, knownRecipientsFileName)
+}
+
+// LoadKnownRecipients reads the pin file at path, or at KnownRecipientsPath if
+// path is empty. A pin file that does not exist yet is empty.
+func LoadKnownRecipients(path string) (*KnownRecipients, error) {
+	if path == "" {
+		var err error
+		if path, err = KnownRecipientsPath(); err != nil {
+			return nil, err
+		}
+	}
+	known := &KnownRecipients{path: path}
+	if err := readJSONFile(path, known); err != nil {
+		return nil, fmt.Errorf("failed to read the known recipients: %w", err)
+	}
+	return known, nil
+}
+
+// Path returns the path of the pin file.
+func (known *KnownRecipients) Path() string {
+	return known.path
+}
+
+// Save writes the pin file atomically, creating its directory if needed.
+func (known *KnownRecipients) Save() error {
+	return writeJSONFile(known.path, known)
+}
+
+// Get returns the pin for the key URL, or nil if there is none.
+func (known *KnownRecipients) Get(keyURL string) *KnownRecipient {
+	keyURL = PinnedURL(keyURL)
+	for i := range known.Recipients {
+		if known.Recipients[i].URL == keyURL {
+			return &known.Recipients[i]
+		}
+	}
+	return nil
+}
+
+// Pin pins pubKey for the key URL, replacing any earlier pin.
+func (known *KnownRecipients) Pin(keyURL, pubKey string) (*KnownRecipient, error) {
+	parsed, err := xipher.ParsePublicKeyStr(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := parsed.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	keyURL = PinnedURL(keyURL)
+	known.Recipients = slices.DeleteFunc(known.Recipients, func(r KnownRecipient) bool {
+		return r.URL == keyURL
+	})
+	known.Recipients = append(known.Recipients, KnownRecipient{
+		URL:         keyURL,
+		Fingerprint: fingerprint,
+		PublicKey:   pubKey,
+		FirstSeen:   time.Now().UTC().Truncate(time.Second),
+	})
+	return &known.Recipients[len(known.Recipients)-1], nil
+}
+
+// Unpin removes the pin for the key URL.
+func (known *KnownRecipients) Unpin(keyURL string) error {
+	keyURL = PinnedURL(keyURL)
+	if known.Get(keyURL) == nil {
+		return fmt.Errorf("%w: %s", ErrNotPinned, keyURL)
+	}
+	known.Recipients = slices.DeleteFunc(known.Recipients, func(r KnownRecipient) bool {
+		return r.URL == keyURL
+	})
+	return nil
+}
+
+// PinnedURL returns the form of the key URL of input that keys are pinned
+// under, and that a SignerTrust is asked about: with a scheme, a lower-case
+// host and no trailing slash, query or fragment, e.g. "https://example.com" for
+// "Example.com/". Email addresses are pinned under the lower-cased address.
+func PinnedURL(input string) string {
+	input = normaliseKeyURL(input)
+	if looksLikeEmail(input) {
+		return strings.ToLower(input)
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return input
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath, u.RawQuery, u.Fragment, u.RawFragment = "", "", "", ""
+	return u.String()
+}
+
+// pinDocument pins the primary public key of doc and its signing key, if it
+// is signed, for the key URL.
+func (known *KnownRecipients) pinDocument(keyURL string, doc *publishedKey) (*KnownRecipient, error) {
+	pin, err := known.Pin(keyURL, doc.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if doc.SigningKey != "" {
+		if pin.SignerFingerprint, err = signingKeyFingerprint(doc.SigningKey); err != nil {
+			return nil, err
+		}
+		pin.SigningKey = doc.SigningKey
+	}
+	return pin, nil
+}
+
+// selectPinnedKey selects the key of doc to encrypt to for keyURL, pinning the
+// primary key, and the signing key if the document is signed, the first time
+// the URL is seen. After that:
+//   - A document signed by the pinned signing key, or by a signing key the
+//     SignerTrust of the resolver trusts for the URL, vouches for its primary
+//     key, which is pinned in place of the earlier one, so the publisher can
+//     rotate keys.
+//   - A document of a URL pinned with a signing key that is not signed by a
+//     trusted key fails with ErrUntrustedSigner.
+//   - Otherwise the pinned key is selected while the document still lists it,
+//     as its primary key or one of its alternates, and a document that no
+//     longer does fails with a *KeyChangedError.
+//
+// Without pinning, the primary key of the document is selected.
+func (resolver *Resolver) selectPinnedKey(keyURL string, doc *publishedKey) (*Key, error) {
+	keyURL = PinnedURL(keyURL)
+	var (
+		signerAlias   string
+		trustedSigner bool
+	)
+	if doc.SigningKey != "" && resolver.signerTrust != nil {
+		var err error
+		if signerAlias, trustedSigner, err = resolver.signerTrust(doc.SigningKey, keyURL); err != nil {
+			return nil, err
+		}
+	}
+	pinPath, err := resolver.pinFilePath()
+	if err != nil {
+		return nil, err
+	}
+	if pinPath == "" {
+		resolved, err := doc.resolvedKey(keyURL, 0)
+		if err != nil {
+			return nil, err
+		}
+		resolved.SignerAlias = signerAlias
+		return resolved, nil
+	}
+	knownRecipientsMu.Lock()
+	defer knownRecipientsMu.Unlock()
+	known, err := LoadKnownRecipients(pinPath)
+	if err != nil {
+		return nil, err
+	}
+	pin := known.Get(keyURL)
+	pinnedSigner := pin != nil && pin.SigningKey != "" && sameSSHKey(pin.SigningKey, doc.SigningKey)
+	switch {
+	case pin == nil || (trustedSigner && !pinnedSigner):
+		if _, err = known.pinDocument(keyURL, doc); err != nil {
+			return nil, err
+		}
+		if err = known.Save(); err != nil {
+			return nil, err
+		}
+		fallthrough
+	case pinnedSigner:
+		resolved, err := doc.resolvedKey(keyURL, 0)
+		if err != nil {
+			return nil, err
+		}
+		if resolved.Fingerprint != known.Get(keyURL).Fingerprint {
+			// The signer vouches for the new primary key.
+			if _, err = known.pinDocument(keyURL, doc); err != nil {
+				return nil, err
+			}
+			if err = known.Save(); err != nil {
+				return nil, err
+			}
+		}
+		resolved.SignerAlias = signerAlias
+		return resolved, nil
+	case pin.SigningKey != "":
+		return nil, fmt.Errorf("%w: %s was signed by %s when it was first seen on %s; "+
+			"confirm the change with the recipient, then trust it with: xipher keys trust %s",
+			ErrUntrustedSigner, pin.URL, pin.SignerFingerprint, pin.FirstSeen.Format(time.DateOnly), pin.URL)
+	}
+	for i, pubKey := range doc.keys() {
+		fingerprint, err := publicKeyFingerprint(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if fingerprint != pin.Fingerprint {
+			continue
+		}
+		if i == 0 && doc.SigningKey != "" {
+			// The pinned key is now signed; pin the signing key along with it.
+			if pin.SignerFingerprint, err = signingKeyFingerprint(doc.SigningKey); err != nil {
+				return nil, err
+			}
+			pin.SigningKey = doc.SigningKey
+			if err = known.Save(); err != nil {
+				return nil, err
+			}
+		}
+		return doc.resolvedKey(keyURL, i)
+	}
+	fingerprint, err := publicKeyFingerprint(doc.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &KeyChangedError{
+		URL:               pin.URL,
+		PinnedFingerprint: pin.Fingerprint,
+		Fingerprint:       fingerprint,
+		FirstSeen:         pin.FirstSeen,
+	}
+}
+
+// Trust fetches the published key document of input, as Resolve does, and
+// pins its primary key and signing key in place of any earlier pin. It fails
+// if the resolver does not pin keys.
+func (resolver *Resolver) Trust(input string) (*KnownRecipient, error) {
+	pinPath, err := resolver.pinFilePath()
+	if err != nil {
+		return nil, err
+	}
+	if pinPath == "" {
+		return nil, errPinningDisabled
+	}
+	input = normaliseKeyURL(input)
+	doc, err := resolver.discoverPublishedKey(context.Background(), input, ModeAuto)
+	if err != nil {
+		return nil, err
+	}
+	knownRecipientsMu.Lock()
+	defer knownRecipientsMu.Unlock()
+	known, err := LoadKnownRecipients(pinPath)
+	if err != nil {
+		return nil, err
+	}
+	pin, err := known.pinDocument(input, doc)
+	if err != nil {
+		return nil, err
+	}
+	return pin, known.Save()
+}
+
+// Untrust removes the pin of input, so the key it serves next is pinned again
+// on first use. It fails if the resolver does not pin keys.
+func (resolver *Resolver) Untrust(input string) error {
+	pinPath, err := resolver.pinFilePath()
+	if err != nil {
+		return err
+	}
+	if pinPath == "" {
+		return errPinningDisabled
+	}
+	knownRecipientsMu.Lock()
+	defer knownRecipientsMu.Unlock()
+	known, err := LoadKnownRecipients(pinPath)
+	if err != nil {
+		return err
+	}
+	if err = known.Unpin(input); err != nil {
+		return err
+	}
+	return known.Save()
+}
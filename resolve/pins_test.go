@@ -0,0 +1,217 @@
+package resolve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain keeps the tests away from the pins and key cache of the user.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "xipher-resolve-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv(KnownRecipientsEnv, filepath.Join(dir, "known_recipients.json"))
+	os.Setenv(KeyCacheEnv, filepath.Join(dir, "keys.json"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// isolatePins gives the test its own pin file, as test servers on loopback may
+// reuse the address of an earlier one.
+func isolatePins(t *testing.T) {
+	t.Helper()
+	t.Setenv(KnownRecipientsEnv, filepath.Join(t.TempDir(), "known_recipients.json"))
+}
+
+// serveSwitchableKey starts a TLS test server serving *pubKey at every path.
+func serveSwitchableKey(t *testing.T, pubKey *string) string {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(*pubKey))
+	}))
+	t.Cleanup(srv.Close)
+	keyFetchClient = srv.Client()
+	isolatePins(t)
+	return srv.URL
+}
+
+func TestKeyPinning(t *testing.T) {
+	first, second := newTestPubKey(t), newTestPubKey(t)
+	served := first
+	srvURL := serveSwitchableKey(t, &served)
+
+	clearKeyCache()
+	if got, _, err := resolvePublicKey(srvURL + "/key"); err != nil || got != first {
+		t.Fatalf("first use = %.12s, %v", got, err)
+	}
+	known, err := LoadKnownRecipients("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := known.Get(srvURL + "/key/")
+	if pin == nil || pin.PublicKey != first || !strings.HasPrefix(pin.Fingerprint, "SHA256:") {
+		t.Fatalf("pin after first use = %+v", pin)
+	}
+
+	served = second
+	clearKeyCache()
+	_, _, err = resolvePublicKey(srvURL + "/key")
+	var changed *KeyChangedError
+	if !errors.As(err, &changed) || !errors.Is(err, ErrKeyChanged) {
+		t.Fatalf("changed key: expected a KeyChangedError, got %v", err)
+	}
+	if changed.PinnedFingerprint != pin.Fingerprint || changed.Fingerprint == pin.Fingerprint {
+		t.Errorf("KeyChangedError = %+v", changed)
+	}
+	if !strings.Contains(err.Error(), changed.PinnedFingerprint) || !strings.Contains(err.Error(), changed.Fingerprint) {
+		t.Errorf("the error does not show both fingerprints: %v", err)
+	}
+	// Other URLs of the same host are pinned separately.
+	if got, _, err := resolvePublicKey(srvURL + "/other"); err != nil || got != second {
+		t.Errorf("other URL = %.12s, %v", got, err)
+	}
+
+	pin, err = defaultResolver.Trust(srvURL + "/key")
+	if err != nil || pin.PublicKey != second {
+		t.Fatalf("Trust = %+v, %v", pin, err)
+	}
+	clearKeyCache()
+	if got, _, err := resolvePublicKey(srvURL + "/key"); err != nil || got != second {
+		t.Errorf("after trust = %.12s, %v", got, err)
+	}
+
+	if err := defaultResolver.Untrust(srvURL + "/key"); err != nil {
+		t.Fatalf("Untrust: %v", err)
+	}
+	if err := defaultResolver.Untrust(srvURL + "/key"); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("untrust twice: expected ErrNotPinned, got %v", err)
+	}
+	served = first
+	clearKeyCache()
+	if got, _, err := resolvePublicKey(srvURL + "/key"); err != nil || got != first {
+		t.Errorf("after untrust = %.12s, %v", got, err)
+	}
+}
+
+func TestPinnedURL(t *testing.T) {
+	cases := map[string]string{
+		"alice.com":                        "https://alice.com",
+		"https://Alice.COM/":               "https://alice.com",
+		"https://alice.com/keys/?x=1#frag": "https://alice.com/keys",
+		"localhost:8080/key":               "http://localhost:8080/key",
+		"Alice@Example.com":                "alice@example.com",
+	}
+	for in, want := range cases {
+		if got := PinnedURL(in); got != want {
+			t.Errorf("PinnedURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSignedKeyRotation(t *testing.T) {
+	first, second, third := newTestPubKey(t), newTestPubKey(t), newTestPubKey(t)
+	signingKey, priv := newTestSigner(t)
+	served := signedDocument(t, publishedKey{Name: "Alice", PublicKey: first}, signingKey, priv)
+	srvURL := serveSwitchableKey(t, &served)
+	var trustedURL string
+
+	clearKeyCache()
+	resolved, err := Resolve(srvURL)
+	if err != nil || resolved.PublicKey != first || !resolved.Signed() || resolved.SignerAlias != "" {
+		t.Fatalf("first use = %+v, %v", resolved, err)
+	}
+	known, _ := LoadKnownRecipients("")
+	if pin := known.Get(srvURL); pin == nil || pin.SignerFingerprint != resolved.SignerFingerprint {
+		t.Fatalf("pin after first use = %+v", pin)
+	}
+
+	// The pinned signer vouches for a rotation to a new primary key.
+	served = signedDocument(t, publishedKey{PublicKey: second, Alternates: []string{first}}, signingKey, priv)
+	clearKeyCache()
+	if resolved, err = Resolve(srvURL); err != nil || resolved.PublicKey != second || resolved.Alternate != -1 {
+		t.Fatalf("signed rotation = %+v, %v", resolved, err)
+	}
+	known, _ = LoadKnownRecipients("")
+	if pin := known.Get(srvURL); pin == nil || pin.PublicKey != second {
+		t.Errorf("pin after rotation = %+v", pin)
+	}
+
+	// Once signed, a document must stay signed by a trusted key.
+	served = `{"publicKey":"` + third + `"}`
+	clearKeyCache()
+	if _, err = Resolve(srvURL); !errors.Is(err, ErrUntrustedSigner) {
+		t.Errorf("unsigned document: expected ErrUntrustedSigner, got %v", err)
+	}
+	otherKey, otherPriv := newTestSigner(t)
+	served = signedDocument(t, publishedKey{PublicKey: third}, otherKey, otherPriv)
+	clearKeyCache()
+	if _, err = Resolve(srvURL); !errors.Is(err, ErrUntrustedSigner) {
+		t.Errorf("other signer: expected ErrUntrustedSigner, got %v", err)
+	}
+
+	// A signing key the SignerTrust of the resolver does not trust for the URL
+	// is not trusted, whatever it trusts it for.
+	defaultResolver.signerTrust = func(signingKey, keyURL string) (string, bool, error) {
+		if signingKey != otherKey {
+			return "", false, nil
+		}
+		return "alice-signing", keyURL == trustedURL, nil
+	}
+	t.Cleanup(func() { defaultResolver.signerTrust = nil })
+	trustedURL = "https://alice.example.com/key"
+	if _, err = Resolve(srvURL); !errors.Is(err, ErrUntrustedSigner) {
+		t.Errorf("signer trusted for another URL: expected ErrUntrustedSigner, got %v", err)
+	}
+	known, _ = LoadKnownRecipients("")
+	if pin := known.Get(srvURL); pin == nil || pin.PublicKey != second || pin.SigningKey != signingKey {
+		t.Errorf("pin after signer trusted for another URL = %+v", pin)
+	}
+
+	// A signing key it trusts for the URL is.
+	trustedURL = PinnedURL(srvURL)
+	if resolved, err = Resolve(srvURL); err != nil || resolved.PublicKey != third || resolved.SignerAlias != "alice-signing" {
+		t.Errorf("trusted signer = %+v, %v", resolved, err)
+	}
+}
+
+func TestAlternateKeySelection(t *testing.T) {
+	first, second := newTestPubKey(t), newTestPubKey(t)
+	served := first
+	srvURL := serveSwitchableKey(t, &served)
+
+	clearKeyCache()
+	if _, err := Resolve(srvURL); err != nil {
+		t.Fatal(err)
+	}
+	// Without a trusted signature, the pinned key is kept while it is listed.
+	served = `{"publicKey":"` + second + `","alternates":["` + first + `"]}`
+	clearKeyCache()
+	resolved, err := Resolve(srvURL)
+	if err != nil || resolved.PublicKey != first || resolved.Alternate != 0 || resolved.Selection() != "alternate key 1" {
+		t.Fatalf("pinned alternate = %+v, %v", resolved, err)
+	}
+	served = `{"publicKey":"` + second + `"}`
+	clearKeyCache()
+	if _, err = Resolve(srvURL); !errors.Is(err, ErrKeyChanged) {
+		t.Errorf("pinned key dropped: expected ErrKeyChanged, got %v", err)
+	}
+
+	// A pinned key that becomes signed pins the signing key too.
+	signingKey, priv := newTestSigner(t)
+	served = signedDocument(t, publishedKey{PublicKey: first}, signingKey, priv)
+	clearKeyCache()
+	if resolved, err = Resolve(srvURL); err != nil || resolved.PublicKey != first || !resolved.Signed() {
+		t.Fatalf("newly signed = %+v, %v", resolved, err)
+	}
+	known, _ := LoadKnownRecipients("")
+	if pin := known.Get(srvURL); pin == nil || !sameSSHKey(pin.SigningKey, signingKey) {
+		t.Errorf("pin after signing = %+v", pin)
+	}
+}
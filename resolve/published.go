@@ -0,0 +1,258 @@
+package resolve
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"xipher.org/xipher"
+)
+
+// publishedKeySigLabel prefixes the bytes the signature of a published key
+// document covers, so the signature cannot be replayed in another context.
+const publishedKeySigLabel = "xipher-published-key/v1\n"
+
+var (
+	// ErrInvalidKeySignature is returned when a published key document carries a
+	// signature that does not verify against its signing key.
+	ErrInvalidKeySignature = errors.New("the published key document has an invalid signature")
+	// ErrUntrustedSigner is returned when a published key document that was
+	// signed when it was first seen is no longer signed by the same key or by a
+	// signing key the SignerTrust of the resolver trusts for its URL.
+	ErrUntrustedSigner = errors.New("the published key document is not signed by a trusted key")
+
+	errBadSigningKey    = errors.New("the signing key of the published key document is not a valid ssh-ed25519 key")
+	errMissingSignature = errors.New("the published key document names a signing key but has no signature")
+)
+
+// publishedKey is the JSON document a host may serve to publish its public key
+// along with a friendly, display-only name. It may also list alternate public
+// keys, for a rotation in progress, give an RFC 3339 expiry time after which it
+// must not be used, and be signed with an Ed25519 key. The signature is the
+// base64 Ed25519 signature of publishedKeySigLabel followed by the compact JSON
+// of the document without its signature field; signingKey holds the public key
+// in the authorized_keys format, "ssh-ed25519 AAAA...".
+type publishedKey struct {
+	Name       string   `json:"name"`
+	PublicKey  string   `json:"publicKey"`
+	Expires    string   `json:"expires,omitempty"`
+	Alternates []string `json:"alternates,omitempty"`
+	SigningKey string   `json:"signingKey,omitempty"`
+	Signature  string   `json:"signature,omitempty"`
+
+	expiresAt time.Time
+}
+
+// Key is a public key resolved from a published key document.
+type Key struct {
+	// URL is the key URL of the document, in the form keys are pinned under.
+	URL string
+	// PublicKey is the XPK_ public key to encrypt to.
+	PublicKey string
+	// Name is the display name of the document, if any.
+	Name string
+	// Fingerprint is the fingerprint of PublicKey.
+	Fingerprint string
+	// Alternate is the index in the alternates of the document of the selected
+	// key, or -1 if the primary public key was selected.
+	Alternate int
+	// Expires is when the document expires, or the zero time if it does not.
+	Expires time.Time
+	// SignerFingerprint is the fingerprint of the key the document was verified
+	// against, or empty if the document is not signed.
+	SignerFingerprint string
+	// SignerAlias is the name the SignerTrust of the resolver gave the signing
+	// key, such as its keyring alias, if any.
+	SignerAlias string
+}
+
+// Selection describes which key of the document was selected.
+func (key *Key) Selection() string {
+	if key.Alternate < 0 {
+		return "primary key"
+	}
+	return fmt.Sprintf("alternate key %d", key.Alternate+1)
+}
+
+// Signed reports whether the document the key was selected from is signed.
+func (key *Key) Signed() bool {
+	return key.SignerFingerprint != ""
+}
+
+// parsePublishedKey extracts the published key document from a fetched
+// response body. It tries the JSON document form first and falls back to
+// treating the whole body as a bare XPK_ string. A document with an invalid
+// signature or past its expiry is rejected.
+func parsePublishedKey(body []byte) (*publishedKey, error) {
+	var doc publishedKey
+	if jsonErr := json.Unmarshal(body, &doc); jsonErr == nil && xipher.IsPubKeyStr(strings.TrimSpace(doc.PublicKey)) {
+		if err := doc.verify(); err != nil {
+			return nil, err
+		}
+		if err := doc.checkExpiry(); err != nil {
+			return nil, err
+		}
+		doc.Name = sanitiseName(doc.Name)
+		return &doc, nil
+	}
+	if pk := strings.TrimSpace(string(body)); xipher.IsPubKeyStr(pk) {
+		return &publishedKey{PublicKey: pk}, nil
+	}
+	return nil, errBadKeyResponse
+}
+
+// verify checks the fields of a document as served, before any of them are
+// trimmed or sanitised, and normalises its keys.
+func (doc *publishedKey) verify() error {
+	if doc.SigningKey != "" || doc.Signature != "" {
+		if doc.Signature == "" {
+			return errMissingSignature
+		}
+		signingKey, err := parseSigningKey(doc.SigningKey)
+		if err != nil {
+			return err
+		}
+		sig, err := base64.StdEncoding.DecodeString(doc.Signature)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidKeySignature, err)
+		}
+		payload, err := doc.signedPayload()
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(signingKey, payload, sig) {
+			return ErrInvalidKeySignature
+		}
+	}
+	if doc.Expires != "" {
+		expiresAt, err := time.Parse(time.RFC3339, doc.Expires)
+		if err != nil {
+			return fmt.Errorf("%w: invalid expires: %w", errBadKeyResponse, err)
+		}
+		doc.expiresAt = expiresAt
+	}
+	doc.PublicKey = strings.TrimSpace(doc.PublicKey)
+	for i, alternate := range doc.Alternates {
+		if doc.Alternates[i] = strings.TrimSpace(alternate); !xipher.IsPubKeyStr(doc.Alternates[i]) {
+			return fmt.Errorf("%w: invalid alternate key %d", errBadKeyResponse, i+1)
+		}
+	}
+	return nil
+}
+
+// signedPayload returns the bytes the signature of the document covers.
+func (doc *publishedKey) signedPayload() ([]byte, error) {
+	unsigned := *doc
+	unsigned.Signature = ""
+	var buf bytes.Buffer
+	buf.WriteString(publishedKeySigLabel)
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(unsigned); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// checkExpiry returns xipher.ErrKeyExpired if the document has expired.
+func (doc *publishedKey) checkExpiry() error {
+	if !doc.expiresAt.IsZero() && !time.Now().Before(doc.expiresAt) {
+		return fmt.Errorf("%w: the published key document expired on %s", xipher.ErrKeyExpired, doc.expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// keys returns the primary public key of the document followed by its alternates.
+func (doc *publishedKey) keys() []string {
+	return append([]string{doc.PublicKey}, doc.Alternates...)
+}
+
+// resolvedKey returns the key of the document at index i of keys, described as
+// a Key for keyURL.
+func (doc *publishedKey) resolvedKey(keyURL string, i int) (*Key, error) {
+	pubKey := doc.keys()[i]
+	fingerprint, err := publicKeyFingerprint(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &Key{
+		URL:         keyURL,
+		PublicKey:   pubKey,
+		Name:        doc.Name,
+		Fingerprint: fingerprint,
+		Alternate:   i - 1,
+		Expires:     doc.expiresAt,
+	}
+	if doc.SigningKey != "" {
+		if resolved.SignerFingerprint, err = signingKeyFingerprint(doc.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// publicKeyFingerprint returns the fingerprint of an XPK_ public key.
+func publicKeyFingerprint(pubKeyStr string) (string, error) {
+	pubKey, err := xipher.ParsePublicKeyStr(pubKeyStr)
+	if err != nil {
+		return "", err
+	}
+	return pubKey.Fingerprint()
+}
+
+// signingKeyFingerprint returns the fingerprint of an ssh-ed25519 signing key,
+// the same one the keyring shows for it.
+func signingKeyFingerprint(signingKey string) (string, error) {
+	pubKey, err := xipher.ParseSSHPublicKeyStr(signingKey)
+	if err != nil {
+		return "", err
+	}
+	return pubKey.Fingerprint()
+}
+
+// sameSSHKey reports whether two keys in the authorized_keys format are the
+// same key, whatever their comments.
+func sameSSHKey(a, b string) bool {
+	aFields, bFields := strings.Fields(a), strings.Fields(b)
+	return len(aFields) >= 2 && len(bFields) >= 2 && aFields[0] == bFields[0] && aFields[1] == bFields[1]
+}
+
+// parseSigningKey parses an ssh-ed25519 key in the authorized_keys format into
+// the Ed25519 public key it holds.
+func parseSigningKey(signingKey string) (ed25519.PublicKey, error) {
+	fields := strings.Fields(signingKey)
+	if len(fields) < 2 || fields[0] != "ssh-ed25519" {
+		return nil, errBadSigningKey
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errBadSigningKey
+	}
+	keyType, rest, ok := readSSHWireString(blob)
+	if !ok || string(keyType) != fields[0] {
+		return nil, errBadSigningKey
+	}
+	key, rest, ok := readSSHWireString(rest)
+	if !ok || len(rest) != 0 || len(key) != ed25519.PublicKeySize {
+		return nil, errBadSigningKey
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// readSSHWireString reads a length-prefixed string of the SSH wire format from b.
+func readSSHWireString(b []byte) (str, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
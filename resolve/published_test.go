@@ -0,0 +1,101 @@
+package resolve
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"xipher.org/xipher"
+)
+
+// newTestSigner returns an ssh-ed25519 signing key and its private key.
+func newTestSigner(t *testing.T) (signingKey string, priv ed25519.PrivateKey) {
+	t.Helper()
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " publisher@example", edPriv
+}
+
+// signedDocument signs doc with priv, whose public key is signingKey, and
+// returns it as JSON.
+func signedDocument(t *testing.T, doc publishedKey, signingKey string, priv ed25519.PrivateKey) string {
+	t.Helper()
+	doc.SigningKey = signingKey
+	payload, err := doc.signedPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload))
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParsePublishedKey(t *testing.T) {
+	primary, alternate := newTestPubKey(t), newTestPubKey(t)
+	signingKey, priv := newTestSigner(t)
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	body := signedDocument(t, publishedKey{
+		Name:       "Alice",
+		PublicKey:  primary,
+		Expires:    expires.Format(time.RFC3339),
+		Alternates: []string{alternate},
+	}, signingKey, priv)
+	doc, err := parsePublishedKey([]byte(body))
+	if err != nil {
+		t.Fatalf("signed document: %v", err)
+	}
+	if doc.PublicKey != primary || doc.Name != "Alice" || len(doc.Alternates) != 1 || !doc.expiresAt.Equal(expires) {
+		t.Errorf("doc = %+v", doc)
+	}
+	resolved, err := doc.resolvedKey("https://alice.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerFingerprint, _ := signingKeyFingerprint(signingKey)
+	if resolved.PublicKey != alternate || resolved.Selection() != "alternate key 1" || !resolved.Signed() || resolved.SignerFingerprint != signerFingerprint {
+		t.Errorf("resolved = %+v", resolved)
+	}
+
+	// The signature covers every field but itself.
+	tampered := strings.Replace(body, `"name":"Alice"`, `"name":"Mallory"`, 1)
+	if _, err := parsePublishedKey([]byte(tampered)); !errors.Is(err, ErrInvalidKeySignature) {
+		t.Errorf("tampered document: expected ErrInvalidKeySignature, got %v", err)
+	}
+	otherKey, _ := newTestSigner(t)
+	if _, err := parsePublishedKey([]byte(strings.Replace(body, signingKey, otherKey, 1))); !errors.Is(err, ErrInvalidKeySignature) {
+		t.Errorf("other signing key: expected ErrInvalidKeySignature, got %v", err)
+	}
+
+	cases := map[string]struct {
+		doc  publishedKey
+		want error
+	}{
+		"expired":           {publishedKey{PublicKey: primary, Expires: "2020-01-01T00:00:00Z"}, xipher.ErrKeyExpired},
+		"bad expires":       {publishedKey{PublicKey: primary, Expires: "tomorrow"}, errBadKeyResponse},
+		"bad alternate":     {publishedKey{PublicKey: primary, Alternates: []string{"not-a-key"}}, errBadKeyResponse},
+		"missing signature": {publishedKey{PublicKey: primary, SigningKey: signingKey}, errMissingSignature},
+		"bad signing key":   {publishedKey{PublicKey: primary, SigningKey: primary, Signature: "AAAA"}, errBadSigningKey},
+	}
+	for name, c := range cases {
+		data, _ := json.Marshal(c.doc)
+		if _, err := parsePublishedKey(data); !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", name, c.want, err)
+		}
+	}
+}
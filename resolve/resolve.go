@@ -0,0 +1,326 @@
+/*
+Package resolve discovers the xipher public keys that URLs, domains and email
+addresses publish, as xipher encrypt --key does.
+
+# Discovery
+
+Resolve accepts:
+
+• An https:// URL serving a published key document or a bare XPK_ key
+• A domain, such as example.com, publishing its key at
+https://example.com/.well-known/xipher or in a _xipher DNS TXT record
+• A URL path, such as example.com/alice, publishing a key at
+https://example.com/alice or https://example.com/alice/.well-known/xipher
+• An email address, such as alice@example.com, publishing a key at the hashed
+local part paths of the domain, like OpenPGP's Web Key Directory
+
+Published key documents may carry alternate keys, an expiry and a signature,
+which is verified. Keys are cached per the HTTP caching headers of the server,
+and pinned to the URL the first time they are seen: a different key served
+later without a trusted signature fails with a *KeyChangedError, matched by
+ErrKeyChanged. By default, the key cache and the pin file are the files of the
+user the xipher command line uses; WithCacheFile and WithPinFile move them,
+and WithoutCache and WithoutPinning turn them off.
+
+# Usage
+
+	key, err := resolve.Resolve("alice@example.com")
+	if err != nil {
+		return err
+	}
+	ciphertext, err := xipher.EncryptText(key.PublicKey, []byte("Hello"), true)
+
+Keys are fetched with a client trusting the system roots, through the proxy of
+the environment. Use NewHTTPClient for private CAs, proxies and mutual TLS, or
+any client of your own:
+
+	client, err := resolve.NewHTTPClient(resolve.TransportConfig{CAFiles: []string{"corp-ca.pem"}})
+	if err != nil {
+		return err
+	}
+	key, err := resolve.New(resolve.WithHTTPClient(client)).Resolve("example.com")
+
+A document whose signing key is not the one pinned for its URL is trusted only
+if the SignerTrust given by WithSignerTrust vouches for it.
+
+Only https:// URLs, or http:// URLs of loopback hosts, are ever fetched, and
+redirects elsewhere are refused whatever the client. TXT records are looked up
+with net.DefaultResolver, or the one given by WithDNSResolver.
+
+# Publishing
+
+NewKeyServer returns an http.Handler serving public keys at the paths Resolve
+looks them up at, as xipher serve-key does.
+*/
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"xipher.org/xipher"
+)
+
+// SignerTrust reports whether signingKey, an ssh-ed25519 key in the
+// authorized_keys format, is trusted to sign the published key documents of
+// keyURL, given in the form of PinnedURL, along with a name to show for the
+// key, such as its alias in a keyring.
+type SignerTrust func(signingKey, keyURL string) (alias string, trusted bool, err error)
+
+// Resolver resolves URLs, domains and email addresses to the public keys they
+// publish.
+type Resolver struct {
+	client      *http.Client
+	dns         *net.Resolver
+	offline     bool
+	noPinning   bool
+	pinFile     string
+	noCache     bool
+	cacheFile   string
+	signerTrust SignerTrust
+
+	memoMu sync.Mutex
+	memo   map[string]memoEntry
+}
+
+// memoEntry is a document kept in memory by a Resolver until it expires.
+type memoEntry struct {
+	doc     *publishedKey
+	expires time.Time
+}
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithHTTPClient makes the Resolver fetch keys with a copy of client, which
+// refuses redirects to URLs other than https:// ones, or http:// URLs of
+// loopback hosts, before applying the redirect policy of client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(resolver *Resolver) {
+		clientCopy := *client
+		checkRedirect := client.CheckRedirect
+		clientCopy.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if !isSchemeAllowed(req.URL) {
+				return errInsecureKeyURL
+			}
+			if checkRedirect != nil {
+				return checkRedirect(req, via)
+			}
+			if len(via) > maxKeyRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxKeyRedirects)
+			}
+			return nil
+		}
+		resolver.client = &clientCopy
+	}
+}
+
+// WithOffline makes the Resolver use keys from the key cache only, however old,
+// without any network request. Keys that are not cached fail with
+// ErrKeyNotCached.
+func WithOffline() Option {
+	return func(resolver *Resolver) {
+		resolver.offline = true
+	}
+}
+
+// WithPinFile makes the Resolver pin keys in the file at path instead of the
+// one KnownRecipientsPath returns.
+func WithPinFile(path string) Option {
+	return func(resolver *Resolver) {
+		resolver.pinFile = path
+		resolver.noPinning = false
+	}
+}
+
+// WithoutPinning makes the Resolver select the primary key of every document
+// without pinning it, so a changed key goes unnoticed. Signed documents are
+// still verified.
+func WithoutPinning() Option {
+	return func(resolver *Resolver) {
+		resolver.noPinning = true
+	}
+}
+
+// WithCacheFile makes the Resolver cache keys in the file at path instead of
+// the one KeyCachePath returns.
+func WithCacheFile(path string) Option {
+	return func(resolver *Resolver) {
+		resolver.cacheFile = path
+		resolver.noCache = false
+	}
+}
+
+// WithoutCache makes the Resolver fetch every document when it is resolved,
+// keeping none in memory or on disk.
+func WithoutCache() Option {
+	return func(resolver *Resolver) {
+		resolver.noCache = true
+	}
+}
+
+// WithDNSResolver makes the Resolver look up the _xipher TXT records of
+// domains with dns instead of net.DefaultResolver.
+func WithDNSResolver(dns *net.Resolver) Option {
+	return func(resolver *Resolver) {
+		resolver.dns = dns
+	}
+}
+
+// WithSignerTrust makes the Resolver ask trust whether the signing key of a
+// document that is not the one pinned for its URL may vouch for the key it
+// publishes. Without it, only pinned signing keys are trusted.
+func WithSignerTrust(trust SignerTrust) Option {
+	return func(resolver *Resolver) {
+		resolver.signerTrust = trust
+	}
+}
+
+// defaultResolver backs the package-level functions.
+var defaultResolver = New()
+
+// New returns a Resolver configured by opts: by default, it fetches keys with
+// a client trusting the system roots, through the proxy of the environment,
+// and caches and pins them in the files of the user.
+func New(opts ...Option) *Resolver {
+	resolver := &Resolver{memo: make(map[string]memoEntry)}
+	for _, opt := range opts {
+		opt(resolver)
+	}
+	return resolver
+}
+
+// httpClient returns the client the resolver fetches keys with.
+func (resolver *Resolver) httpClient() *http.Client {
+	if resolver.client != nil {
+		return resolver.client
+	}
+	return keyFetchClient
+}
+
+// dnsResolver returns the resolver the resolver looks up TXT records with.
+func (resolver *Resolver) dnsResolver() *net.Resolver {
+	if resolver.dns != nil {
+		return resolver.dns
+	}
+	return net.DefaultResolver
+}
+
+// timeout returns the time limit of a lookup by the resolver.
+func (resolver *Resolver) timeout() time.Duration {
+	if timeout := resolver.httpClient().Timeout; timeout > 0 {
+		return timeout
+	}
+	return keyFetchTimeout
+}
+
+// pinFilePath returns the path of the pin file of the resolver, or an empty
+// string if it does not pin keys.
+func (resolver *Resolver) pinFilePath() (string, error) {
+	if resolver.noPinning {
+		return "", nil
+	} else if resolver.pinFile != "" {
+		return resolver.pinFile, nil
+	}
+	return KnownRecipientsPath()
+}
+
+// keyCachePath returns the path of the key cache file of the resolver, or an
+// empty string if it does not cache keys.
+func (resolver *Resolver) keyCachePath() (string, error) {
+	if resolver.noCache {
+		return "", nil
+	} else if resolver.cacheFile != "" {
+		return resolver.cacheFile, nil
+	}
+	return KeyCachePath()
+}
+
+// recalled returns the document for the URL kept in memory, if it has not
+// expired or the resolver is offline.
+func (resolver *Resolver) recalled(resolvedURL string) (*publishedKey, bool) {
+	resolver.memoMu.Lock()
+	defer resolver.memoMu.Unlock()
+	entry, ok := resolver.memo[resolvedURL]
+	if !ok || !resolver.offline && !time.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.doc, true
+}
+
+// remember keeps doc in memory until expires, unless the resolver does not
+// cache keys.
+func (resolver *Resolver) remember(resolvedURL string, doc *publishedKey, expires time.Time) {
+	if resolver.noCache {
+		return
+	}
+	resolver.memoMu.Lock()
+	resolver.memo[resolvedURL] = memoEntry{doc: doc, expires: expires}
+	resolver.memoMu.Unlock()
+}
+
+// Resolve is ResolveWithMode in ModeAuto.
+func (resolver *Resolver) Resolve(input string) (*Key, error) {
+	return resolver.ResolveWithModeContext(context.Background(), input, ModeAuto)
+}
+
+// ResolveWithMode is ResolveWithModeContext with the background context.
+func (resolver *Resolver) ResolveWithMode(input string, mode Mode) (*Key, error) {
+	return resolver.ResolveWithModeContext(context.Background(), input, mode)
+}
+
+// ResolveWithModeContext fetches the published key document of input, an
+// https:// URL, a URL without its scheme, a domain or an email address,
+// discovering the document of a bare domain as mode selects, and selects the
+// public key to encrypt to from it. The requests and DNS lookups are made with
+// ctx.
+func (resolver *Resolver) ResolveWithModeContext(ctx context.Context, input string, mode Mode) (*Key, error) {
+	input = normaliseKeyURL(input)
+	doc, err := resolver.discoverPublishedKey(ctx, input, mode)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.selectPinnedKey(input, doc)
+}
+
+// Resolve resolves input with the default Resolver, see Resolver.ResolveWithMode.
+func Resolve(input string) (*Key, error) {
+	return defaultResolver.ResolveWithMode(input, ModeAuto)
+}
+
+// ResolveWithMode resolves input with the default Resolver, see
+// Resolver.ResolveWithMode.
+func ResolveWithMode(input string, mode Mode) (*Key, error) {
+	return defaultResolver.ResolveWithMode(input, mode)
+}
+
+// IsKeyURL reports whether input is an https:// URL that is resolved to the
+// public key it serves rather than used as a password. Links carrying a key in
+// their fragment or query, such as the https://xipher.org/#XPK_... links xipher
+// shares keys as, are not.
+func IsKeyURL(input string) bool {
+	if !strings.HasPrefix(strings.TrimSpace(input), keyURLPrefix) {
+		return false
+	}
+	parsed, err := xipher.ParseKeyInput(input)
+	return err == nil && parsed.Kind == xipher.KeyInputURL
+}
+
+// LooksLikeDomain reports whether input is a schemeless host, such as
+// example.com or example.com/alice, that could be resolved. As such input may
+// also be a password, callers should confirm with the user before resolving it.
+func LooksLikeDomain(input string) bool {
+	return looksLikeDomain(input)
+}
+
+// LooksLikeEmail reports whether input is an email address whose public key
+// could be resolved. As such input may also be a password, callers should
+// confirm with the user before resolving it.
+func LooksLikeEmail(input string) bool {
+	return looksLikeEmail(input)
+}
@@ -0,0 +1,164 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveKeys serves keys over TLS for every host, keeping pins and cached keys
+// out of the files of the user, and returns a client trusting the server.
+func serveKeys(t *testing.T, keys ...ServedKey) *http.Client {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv(KnownRecipientsEnv, filepath.Join(dir, "known_recipients.json"))
+	t.Setenv(KeyCacheEnv, filepath.Join(dir, "key_cache.json"))
+	handler, err := NewKeyServer(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	client.Transport = transport
+	return client
+}
+
+func TestResolve(t *testing.T) {
+	hostKey, aliceKey := newTestPubKey(t), newTestPubKey(t)
+	client := serveKeys(t, ServedKey{PublicKey: hostKey}, ServedKey{Path: "alice", PublicKey: aliceKey, Name: "Alice"})
+	resolver := New(WithHTTPClient(client))
+
+	cases := map[string]string{
+		"example.com":                                  hostKey,
+		"https://example.com":                          hostKey,
+		"example.com/alice":                            aliceKey,
+		"https://example.com/alice":                    aliceKey,
+		"alice@example.com":                            aliceKey,
+		"https://keys.example.com/alice/":              aliceKey,
+		"https://example.com/.well-known/xipher/alice": aliceKey,
+	}
+	for input, want := range cases {
+		key, err := resolver.ResolveWithMode(input, ModeHTTPS)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", input, err)
+			continue
+		}
+		if key.PublicKey != want {
+			t.Errorf("Resolve(%q) = %.12s..., want %.12s...", input, key.PublicKey, want)
+		}
+		if key.Selection() != "primary key" || key.Signed() {
+			t.Errorf("Resolve(%q): selection %q, signed %v", input, key.Selection(), key.Signed())
+		}
+	}
+	if key, err := resolver.Resolve("alice@example.com"); err != nil || key.Name != "Alice" || key.Fingerprint == "" {
+		t.Errorf("Resolve(alice@example.com) = %+v, %v", key, err)
+	}
+	if _, err := resolver.ResolveWithMode("example.com/bob", ModeHTTPS); err == nil {
+		t.Error("expected an unpublished path to fail")
+	}
+	if _, err := resolver.Resolve("http://example.com"); err == nil {
+		t.Error("expected an http:// URL to be refused")
+	}
+}
+
+func TestResolveKeyChanged(t *testing.T) {
+	first, second := newTestPubKey(t), newTestPubKey(t)
+	dir := t.TempDir()
+	t.Setenv(KnownRecipientsEnv, filepath.Join(dir, "known_recipients.json"))
+	t.Setenv(KeyCacheEnv, filepath.Join(dir, "key_cache.json"))
+	served := first
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(served))
+	}))
+	t.Cleanup(srv.Close)
+	resolver := New(WithHTTPClient(srv.Client()))
+
+	if key, err := resolver.Resolve(srv.URL + "/key"); err != nil || key.PublicKey != first {
+		t.Fatalf("Resolve = %+v, %v", key, err)
+	}
+	served = second
+	_, err := resolver.Resolve(srv.URL + "/key")
+	var changed *KeyChangedError
+	if !errors.Is(err, ErrKeyChanged) || !errors.As(err, &changed) {
+		t.Fatalf("expected a *KeyChangedError, got %v", err)
+	}
+}
+
+func TestResolverFiles(t *testing.T) {
+	first, second := newTestPubKey(t), newTestPubKey(t)
+	dir := t.TempDir()
+	t.Setenv(KnownRecipientsEnv, filepath.Join(dir, "default_pins.json"))
+	t.Setenv(KeyCacheEnv, filepath.Join(dir, "default_keys.json"))
+	served, requests := first, 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Write([]byte(served))
+	}))
+	t.Cleanup(srv.Close)
+	keyURL := srv.URL + "/key"
+
+	// Relocated files are used in place of the default ones.
+	pinFile, cacheFile := filepath.Join(dir, "pins.json"), filepath.Join(dir, "keys.json")
+	relocated := New(WithHTTPClient(srv.Client()), WithPinFile(pinFile), WithCacheFile(cacheFile))
+	if key, err := relocated.Resolve(keyURL); err != nil || key.PublicKey != first {
+		t.Fatalf("relocated = %+v, %v", key, err)
+	}
+	if known, _ := LoadKnownRecipients(pinFile); known.Get(keyURL) == nil {
+		t.Error("the key is not pinned in the pin file given")
+	}
+	if cache, _ := LoadKeyCache(cacheFile); cache.Get(keyURL) == nil {
+		t.Error("the key is not cached in the cache file given")
+	}
+	for _, path := range []string{filepath.Join(dir, "default_pins.json"), filepath.Join(dir, "default_keys.json")} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was written: %v", path, err)
+		}
+	}
+	// The fresh cached document is used by another resolver with the same files.
+	requests = 0
+	if _, err := New(WithHTTPClient(srv.Client()), WithPinFile(pinFile), WithCacheFile(cacheFile)).Resolve(keyURL); err != nil || requests != 0 {
+		t.Errorf("cached = %v after %d requests", err, requests)
+	}
+
+	// Without pinning and caching, every document is fetched and its primary
+	// key selected, however it changed.
+	served = second
+	unpinned := New(WithHTTPClient(srv.Client()), WithoutPinning(), WithoutCache())
+	for range 2 {
+		if key, err := unpinned.Resolve(keyURL); err != nil || key.PublicKey != second {
+			t.Fatalf("unpinned = %+v, %v", key, err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("uncached: %d requests, want 2", requests)
+	}
+	if _, err := unpinned.Trust(keyURL); err == nil {
+		t.Error("expected Trust to fail without pinning")
+	}
+	if _, err := New(WithOffline(), WithoutCache()).Resolve(keyURL); !errors.Is(err, ErrKeyNotCached) {
+		t.Errorf("offline without a cache: expected ErrKeyNotCached, got %v", err)
+	}
+	if _, err := relocated.Resolve(keyURL); err != nil {
+		t.Errorf("the cached document of the relocated resolver: %v", err)
+	}
+	if _, err := New(WithHTTPClient(srv.Client()), WithPinFile(pinFile), WithoutCache()).Resolve(keyURL); !errors.Is(err, ErrKeyChanged) {
+		t.Errorf("changed key in the pin file given: expected ErrKeyChanged, got %v", err)
+	}
+	for _, path := range []string{filepath.Join(dir, "default_pins.json"), filepath.Join(dir, "default_keys.json")} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was written: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package resolve
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"xipher.org/xipher"
+)
+
+// servedKeyMaxAge is how long clients may cache a served key document before
+// revalidating it.
+const servedKeyMaxAge = time.Hour
+
+var (
+	errNoServedKeys       = errors.New("no public keys to serve")
+	errBadServedKeyPath   = errors.New("invalid key path: use letters, digits, dots, dashes and underscores, starting with a letter or digit")
+	errDuplicateServedKey = errors.New("more than one public key to serve at the same path")
+)
+
+// servedKeyPathRegex matches the path a key may be served under: a single URL
+// segment, which also serves as the local part of an email address.
+var servedKeyPathRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ServedKey is a public key for NewKeyServer to publish.
+type ServedKey struct {
+	// Path is the name the key is served under, such as "alice", or empty for
+	// the key of the host itself.
+	Path string
+	// PublicKey is the XPK_ public key.
+	PublicKey string
+	// Name is the display name served with the key.
+	Name string
+}
+
+// ServedPaths returns the URL paths the key is served at.
+func (key *ServedKey) ServedPaths() []string {
+	if key.Path == "" {
+		return []string{wellKnownKeyPath}
+	}
+	return []string{
+		"/" + key.Path,
+		"/" + key.Path + wellKnownKeyPath,
+		wellKnownKeyPath + "/" + key.Path,
+		wellKnownKeyPath + "/" + hashEmailLocal(key.Path),
+	}
+}
+
+// servedDocument is the published key document of a served key, encoded once.
+type servedDocument struct {
+	body []byte
+	etag string
+}
+
+// KeyServer is an http.Handler publishing public keys as published key
+// documents, at the paths Resolve looks them up at: the key with an empty
+// path at /.well-known/xipher, for "example.com", and a key with the path
+// alice at /alice and /alice/.well-known/xipher, for "example.com/alice", and
+// at the hashed local part paths of the direct and advanced email lookups, for
+// "alice@example.com". Responses carry permissive CORS headers, as public keys
+// carry no authentication, and cache validators.
+type KeyServer struct {
+	docs    map[string]*servedDocument
+	hashed  map[string]*servedDocument
+	modTime time.Time
+}
+
+// NewKeyServer returns a KeyServer publishing keys, as xipher serve-key does.
+// Serve it over HTTPS: keys are only ever resolved from https:// URLs.
+func NewKeyServer(keys ...ServedKey) (*KeyServer, error) {
+	if len(keys) == 0 {
+		return nil, errNoServedKeys
+	}
+	server := &KeyServer{
+		docs:    make(map[string]*servedDocument),
+		hashed:  make(map[string]*servedDocument),
+		modTime: time.Now(),
+	}
+	for _, key := range keys {
+		if key.Path != "" && !servedKeyPathRegex.MatchString(key.Path) {
+			return nil, fmt.Errorf("%w: %q", errBadServedKeyPath, key.Path)
+		}
+		doc, err := newServedDocument(key)
+		if err != nil {
+			return nil, err
+		}
+		paths := key.ServedPaths()
+		if key.Path != "" {
+			hashed := hashEmailLocal(key.Path)
+			if server.hashed[hashed] != nil {
+				return nil, fmt.Errorf("%w: %s", errDuplicateServedKey, key.Path)
+			}
+			server.hashed[hashed] = doc
+			paths = paths[:len(paths)-1]
+		}
+		for _, path := range paths {
+			if server.docs[path] != nil {
+				return nil, fmt.Errorf("%w: %s", errDuplicateServedKey, path)
+			}
+			server.docs[path] = doc
+		}
+	}
+	return server, nil
+}
+
+// newServedDocument encodes the published key document of key.
+func newServedDocument(key ServedKey) (*servedDocument, error) {
+	pubKey := strings.TrimSpace(key.PublicKey)
+	if _, err := xipher.ParsePublicKeyStr(pubKey); err != nil || !xipher.IsPubKeyStr(pubKey) {
+		return nil, fmt.Errorf("%w: %.12s...", xipher.ErrInvalidPublicKey, pubKey)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(publishedKey{Name: sanitiseName(key.Name), PublicKey: pubKey}); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return &servedDocument{
+		body: buf.Bytes(),
+		etag: `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`,
+	}, nil
+}
+
+// lookup returns the document served at path, or nil.
+func (server *KeyServer) lookup(path string) *servedDocument {
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if doc := server.docs[path]; doc != nil {
+		return doc
+	}
+	rest, ok := strings.CutPrefix(path, wellKnownKeyPath+"/")
+	if !ok {
+		return nil
+	}
+	// The advanced email lookup puts the domain before the hashed local part.
+	if _, hashed, ok := strings.Cut(rest, "/"); ok {
+		rest = hashed
+	}
+	return server.hashed[rest]
+}
+
+// ServeHTTP serves the document at the path of the request.
+func (server *KeyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	h.Set("Vary", "Origin")
+	h.Set("X-Content-Type-Options", "nosniff")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		h.Set("Allow", "GET, HEAD, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc := server.lookup(r.URL.Path)
+	if doc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(servedKeyMaxAge.Seconds())))
+	h.Set("ETag", doc.etag)
+	http.ServeContent(w, r, "", server.modTime, bytes.NewReader(doc.body))
+}
@@ -0,0 +1,98 @@
+package resolve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"xipher.org/xipher"
+)
+
+func TestKeyServer(t *testing.T) {
+	hostKey, aliceKey := newTestPubKey(t), newTestPubKey(t)
+	server, err := NewKeyServer(
+		ServedKey{PublicKey: hostKey, Name: "Example"},
+		ServedKey{Path: "alice", PublicKey: aliceKey, Name: "Alice"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveAllHosts(t, server.ServeHTTP)
+
+	cases := map[string]struct{ pubKey, name string }{
+		"example.com":               {hostKey, "Example"},
+		"https://example.com/alice": {aliceKey, "Alice"},
+		"example.com/alice/":        {aliceKey, "Alice"},
+		"Alice@example.com":         {aliceKey, "Alice"},
+	}
+	for raw, want := range cases {
+		resolved, err := ResolveWithMode(raw, ModeHTTPS)
+		if err != nil || resolved.PublicKey != want.pubKey || resolved.Name != want.name {
+			t.Errorf("ResolveWithMode(%q) = %+v, %v", raw, resolved, err)
+		}
+	}
+	if _, err := ResolveWithMode("bob@example.com", ModeHTTPS); err == nil {
+		t.Error("expected no key for bob@example.com")
+	}
+}
+
+func TestKeyServerHeaders(t *testing.T) {
+	server, err := NewKeyServer(ServedKey{Path: "alice", PublicKey: newTestPubKey(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/.well-known/xipher/alice", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET = %d %v", rec.Code, rec.Header())
+	}
+	if freshFor, store := keyCacheFreshness(rec.Header(), server.modTime); !store || freshFor != servedKeyMaxAge {
+		t.Errorf("cache headers give %v, %v", freshFor, store)
+	}
+	if rec := serve(http.MethodGet, "/alice", http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d", rec.Code)
+	}
+	if rec := serve(http.MethodOptions, "/alice", nil); rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("OPTIONS = %d %v", rec.Code, rec.Header())
+	}
+	if rec := serve(http.MethodPost, "/alice", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", rec.Code)
+	}
+	for _, path := range []string{"/.well-known/xipher", "/bob", "/alice/other"} {
+		if rec := serve(http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d", path, rec.Code)
+		}
+	}
+}
+
+func TestNewKeyServerErrors(t *testing.T) {
+	pubKey := newTestPubKey(t)
+	cases := map[string]struct {
+		keys []ServedKey
+		want error
+	}{
+		"no keys":     {nil, errNoServedKeys},
+		"bad path":    {[]ServedKey{{Path: ".well-known", PublicKey: pubKey}}, errBadServedKeyPath},
+		"nested path": {[]ServedKey{{Path: "team/alice", PublicKey: pubKey}}, errBadServedKeyPath},
+		"same path":   {[]ServedKey{{PublicKey: pubKey}, {PublicKey: pubKey}}, errDuplicateServedKey},
+		"same email":  {[]ServedKey{{Path: "alice", PublicKey: pubKey}, {Path: "Alice", PublicKey: pubKey}}, errDuplicateServedKey},
+		"secret key":  {[]ServedKey{{PublicKey: "XSK_abc"}}, xipher.ErrInvalidPublicKey},
+	}
+	for name, c := range cases {
+		_, err := NewKeyServer(c.keys...)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", name, c.want, err)
+		}
+	}
+}
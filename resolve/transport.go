@@ -0,0 +1,126 @@
+package resolve
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	errBadCABundle     = errors.New("no PEM certificates found in the CA bundle")
+	errClientCertPair  = errors.New("the client certificate and its private key must be given together")
+	errBadProxyURL     = errors.New("invalid proxy URL: use http://, https:// or socks5:// followed by a host")
+	errBadFetchTimeout = errors.New("invalid fetch timeout: use a positive duration such as 30s")
+)
+
+// TransportConfig configures the HTTP client NewHTTPClient returns. The zero
+// value is the default client: the system roots, the proxy named by the
+// HTTPS_PROXY and NO_PROXY environment variables, a 10s timeout and up to 5
+// redirects. It is the "resolver" object of the xipher config file.
+type TransportConfig struct {
+	// CAFiles are PEM bundles of CA certificates trusted in addition to the
+	// system roots, e.g. of a private CA or a TLS-inspecting proxy.
+	CAFiles []string `json:"caFiles,omitempty"`
+	// Proxy is the URL of the HTTP(S) or SOCKS5 proxy to fetch keys through, in
+	// place of the proxy environment variables.
+	Proxy string `json:"proxy,omitempty"`
+	// ClientCert and ClientKey are the PEM certificate chain and private key to
+	// present to key hosts that require mutual TLS.
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	// Timeout is the time limit of each request, as a Go duration such as 30s.
+	Timeout string `json:"timeout,omitempty"`
+	// MaxRedirects is the number of redirects to follow: 0 for the default of 5,
+	// or a negative number to follow none.
+	MaxRedirects int `json:"maxRedirects,omitempty"`
+}
+
+// IsZero reports whether config selects the default client.
+func (config *TransportConfig) IsZero() bool {
+	return len(config.CAFiles) == 0 && config.Proxy == "" && config.ClientCert == "" && config.ClientKey == "" &&
+		config.Timeout == "" && config.MaxRedirects == 0
+}
+
+// keyFetchClient is the client public keys are fetched with, unless a Resolver
+// is given its own.
+var keyFetchClient = &http.Client{
+	Timeout:       keyFetchTimeout,
+	CheckRedirect: keyRedirectPolicy(maxKeyRedirects),
+}
+
+// NewHTTPClient returns an HTTP client for fetching public keys configured by
+// config, for WithHTTPClient. Like the default client, it only follows
+// redirects to https:// URLs, or http:// URLs of loopback hosts.
+func NewHTTPClient(config TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(config.CAFiles) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		for _, caFile := range config.CAFiles {
+			data, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the CA bundle: %w", err)
+			}
+			if !roots.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("%w: %s", errBadCABundle, caFile)
+			}
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if config.ClientCert != "" || config.ClientKey != "" {
+		if config.ClientCert == "" || config.ClientKey == "" {
+			return nil, errClientCertPair
+		}
+		cert, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil || proxyURL.Host == "" || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5") {
+			return nil, fmt.Errorf("%w: %q", errBadProxyURL, config.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	timeout := keyFetchTimeout
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("%w: %q", errBadFetchTimeout, config.Timeout)
+		}
+	}
+	maxRedirects := maxKeyRedirects
+	if config.MaxRedirects != 0 {
+		maxRedirects = max(config.MaxRedirects, 0)
+	}
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: keyRedirectPolicy(maxRedirects),
+	}, nil
+}
+
+// keyRedirectPolicy returns a CheckRedirect function following up to
+// maxRedirects redirects, to URLs isSchemeAllowed allows.
+func keyRedirectPolicy(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !isSchemeAllowed(req.URL) {
+			return errInsecureKeyURL
+		}
+		return nil
+	}
+}
@@ -0,0 +1,212 @@
+package resolve
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes a PEM block of the type and bytes to a file in dir and
+// returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestClientCert writes a self-signed client certificate and its private key
+// to dir and returns their paths.
+func newTestClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "xipher test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "PRIVATE KEY", keyDER)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	dir := t.TempDir()
+	var clientCerts int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCerts = len(r.TLS.PeerCertificates)
+		w.Write([]byte(pubStr))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // The expected handshake failure.
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	isolatePins(t)
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+	certFile, keyFile := newTestClientCert(t, dir)
+
+	// The test server is signed by its own CA, which the default client does not trust.
+	clearKeyCache()
+	if _, err := New(WithHTTPClient(&http.Client{})).Resolve(srv.URL + "/key"); err == nil {
+		t.Fatal("expected the default roots to reject the test server")
+	}
+
+	client, err := NewHTTPClient(TransportConfig{CAFiles: []string{caFile}, ClientCert: certFile, ClientKey: keyFile, Timeout: "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 5*time.Second {
+		t.Errorf("timeout = %v", client.Timeout)
+	}
+	resolved, err := New(WithHTTPClient(client)).Resolve(srv.URL + "/key")
+	if err != nil || resolved.PublicKey != pubStr {
+		t.Fatalf("ResolveKeyURL = %+v, %v", resolved, err)
+	}
+	if clientCerts != 1 {
+		t.Errorf("server saw %d client certificates, want 1", clientCerts)
+	}
+
+	cases := map[string]struct {
+		config TransportConfig
+		want   error
+	}{
+		"missing CA file": {TransportConfig{CAFiles: []string{filepath.Join(dir, "missing.pem")}}, os.ErrNotExist},
+		"bad CA file":     {TransportConfig{CAFiles: []string{keyFile}}, errBadCABundle},
+		"cert alone":      {TransportConfig{ClientCert: certFile}, errClientCertPair},
+		"bad proxy":       {TransportConfig{Proxy: "proxy.corp:3128"}, errBadProxyURL},
+		"bad timeout":     {TransportConfig{Timeout: "-1s"}, errBadFetchTimeout},
+	}
+	for name, c := range cases {
+		if _, err := NewHTTPClient(c.config); !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestKeyFetchProxy(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	srv := serveBody(t, pubStr)
+	var tunnelled string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		tunnelled = r.Host
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(proxy.Close)
+
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+	client, err := NewHTTPClient(TransportConfig{CAFiles: []string{caFile}, Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := New(WithHTTPClient(client)).Resolve(srv.URL + "/key")
+	if err != nil || resolved.PublicKey != pubStr {
+		t.Fatalf("ResolveKeyURL = %+v, %v", resolved, err)
+	}
+	if tunnelled != srv.Listener.Addr().String() {
+		t.Errorf("proxy tunnelled to %q, want %q", tunnelled, srv.Listener.Addr().String())
+	}
+}
+
+func TestKeyFetchRedirects(t *testing.T) {
+	pubStr := newTestPubKey(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case r.URL.Path == "/b":
+			http.Redirect(w, r, "/key", http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/insecure"):
+			http.Redirect(w, r, "http://example.com/key", http.StatusFound)
+		case r.URL.Path == "/key":
+			w.Write([]byte(pubStr))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	isolatePins(t)
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+	resolve := func(maxRedirects int, path string) error {
+		t.Helper()
+		client, err := NewHTTPClient(TransportConfig{CAFiles: []string{caFile}, MaxRedirects: maxRedirects})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clearKeyCache()
+		_, err = New(WithHTTPClient(client)).ResolveWithMode(srv.URL+path, ModeHTTPS)
+		return err
+	}
+
+	if err := resolve(0, "/a"); err != nil {
+		t.Errorf("default limit: %v", err)
+	}
+	if err := resolve(2, "/a"); err != nil {
+		t.Errorf("two redirects allowed: %v", err)
+	}
+	if err := resolve(1, "/a"); err == nil {
+		t.Error("expected one redirect to be too few")
+	}
+	if err := resolve(-1, "/b"); err == nil {
+		t.Error("expected no redirects to be followed")
+	}
+	if err := resolve(0, "/insecure"); !errors.Is(err, errInsecureKeyURL) {
+		t.Errorf("redirect to http: expected errInsecureKeyURL, got %v", err)
+	}
+
+	// An injected client keeps its own redirect policy, but never leaves https.
+	clearKeyCache()
+	client := srv.Client()
+	client.CheckRedirect = nil
+	if _, err := New(WithHTTPClient(client)).ResolveWithMode(srv.URL+"/insecure", ModeHTTPS); !errors.Is(err, errInsecureKeyURL) {
+		t.Errorf("injected client, redirect to http: expected errInsecureKeyURL, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package xipher
+
+import (
+	"fmt"
+	"strings"
+
+	"xipher.org/xipher/internal/crypto/age"
+	"xipher.org/xipher/internal/crypto/asx"
+)
+
+// IsAgeRecipientStr reports whether str is an age X25519 recipient, "age1...".
+func IsAgeRecipientStr(str string) bool {
+	return age.IsRecipient(strings.TrimSpace(str))
+}
+
+// IsAgeIdentityStr reports whether str is an age X25519 identity, "AGE-SECRET-KEY-1...".
+func IsAgeIdentityStr(str string) bool {
+	return age.IsIdentity(strings.TrimSpace(str))
+}
+
+// ParseAgeRecipient parses an age X25519 recipient and returns it as a
+// SuiteECC public key. Data encrypted to it by xipher can be decrypted with the
+// matching age identity imported with ParseAgeIdentity.
+//
+// Example:
+//
+//	publicKey, err := xipher.ParseAgeRecipient("age1w3tyke4gev25vaxxsvcgqu4484rf6ejpmavs57p6yz6lhy2sfs5swrvwyn")
+//	if err != nil {
+//		return err
+//	}
+//	pubKeyStr, err := publicKey.String() // XPK_...
+func ParseAgeRecipient(recipient string) (*PublicKey, error) {
+	r, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	asxPubKey, err := asx.ParsePublicKey(append([]byte{asx.AlgoECC}, r.Bytes()...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	return &PublicKey{
+		version:   keyVersion,
+		keyType:   keyTypeDirect,
+		publicKey: asxPubKey,
+	}, nil
+}
+
+// AgeRecipient returns the public key as an age X25519 recipient, "age1...".
+// Only direct SuiteECC public keys have an age equivalent; password-based keys
+// and other suites return ErrAgeKeyUnsupported. Metadata is not carried over.
+func (publicKey *PublicKey) AgeRecipient() (string, error) {
+	if publicKey.keyType != keyTypeDirect || publicKey.Algorithm() != SuiteECC {
+		return "", ErrAgeKeyUnsupported
+	}
+	asxPubKeyBytes, err := publicKey.publicKey.Bytes()
+	if err != nil {
+		return "", err
+	}
+	r, err := age.NewX25519Recipient(asxPubKeyBytes[1:])
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// ParseAgeIdentity parses an age X25519 identity and returns it as a secret
+// key. It decrypts data xipher encrypted to its SuiteECC public key, which
+// PublicKey(SuiteECC) derives and which matches the identity's age recipient.
+// Other uses, including symmetric encryption and exporting the key, return
+// ErrAgeKeyUnsupported.
+func ParseAgeIdentity(identity string) (*SecretKey, error) {
+	id, err := age.ParseX25519Identity(strings.TrimSpace(identity))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSecretKey, err)
+	}
+	return &SecretKey{
+		version: keyVersion,
+		keyType: keyTypeAge,
+		key:     id.Bytes(),
+	}, nil
+}
+
+// AgeIdentity returns the X25519 part of a direct secret key as an age
+// identity, "AGE-SECRET-KEY-1...". Its recipient is the age form of
+// PublicKey(SuiteECC), so age can decrypt what xipher encrypts to that key. The
+// post-quantum parts of the key have no age equivalent.
+//
+// Returns ErrSecretKeyUnavailable for password-based keys and
+// ErrAgeKeyUnsupported for keys imported from SSH keys.
+func (secretKey *SecretKey) AgeIdentity() (string, error) {
+	if isPwdBased(secretKey.keyType) {
+		return "", ErrSecretKeyUnavailable
+	}
+	if secretKey.keyType == keyTypeSSH {
+		return "", ErrAgeKeyUnsupported
+	}
+	asxPrivKey, err := secretKey.asxPrivateKey(secretKey.key)
+	if err != nil {
+		return "", err
+	}
+	scalar, err := asxPrivKey.X25519()
+	if err != nil {
+		return "", err
+	}
+	id, err := age.NewX25519Identity(scalar)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
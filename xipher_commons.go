@@ -99,3 +99,16 @@ func (pr *peekableReader) Read(p []byte) (n int, err error) {
 func (pr *peekableReader) Discard(n int) (int, error) {
 	return pr.Read(make([]byte, n))
 }
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and adds the bytes read to the count.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -21,7 +21,7 @@
 //	}
 //
 //	// Generate public key
-//	publicKey, err := secretKey.PublicKey(false)
+//	publicKey, err := secretKey.PublicKey(xipher.SuiteECC)
 //	if err != nil {
 //		panic(err)
 //	}
@@ -45,6 +45,7 @@ import (
 	"runtime"
 
 	"xipher.org/xipher/internal/crypto/asx"
+	"xipher.org/xipher/internal/crypto/xcp"
 )
 
 const (
@@ -54,6 +55,8 @@ const (
 	xipherSecretKeyPrefix = "XSK_"
 	// xipherTxtPrefix is the prefix used for encoded ciphertext.
 	xipherTxtPrefix = "XCT_"
+	// fingerprintPrefix is the prefix of public key fingerprints.
+	fingerprintPrefix = "SHA256:"
 	// secretKeyStrRegex is the regular expression pattern for validating secret key strings.
 	secretKeyStrRegex = "^" + xipherSecretKeyPrefix + "[A-Z2-7]{106}$"
 
@@ -88,42 +91,85 @@ const (
 	keyTypeDirect uint8 = 0
 	// keyTypePwd indicates a password-based key.
 	keyTypePwd uint8 = 1
+	// keyTypeSSH indicates a secret key imported from an SSH Ed25519 private key.
+	// It is never serialized.
+	keyTypeSSH uint8 = 2
+	// keyTypeAge indicates a secret key imported from an age X25519 identity.
+	// It is never serialized.
+	keyTypeAge uint8 = 4
+	// sshEd25519KeyType is the key type name of SSH Ed25519 keys.
+	sshEd25519KeyType = "ssh-ed25519"
 
 	// Ciphertext type constants
 
 	// ctKeyAsymmetric indicates asymmetric encryption with a direct key.
-	ctKeyAsymmetric uint8 = 0
+	ctKeyAsymmetric CiphertextType = 0
 	// ctPwdAsymmetric indicates asymmetric encryption with a password-based key.
-	ctPwdAsymmetric uint8 = 1
+	ctPwdAsymmetric CiphertextType = 1
 	// ctKeySymmetric indicates symmetric encryption with a direct key.
-	ctKeySymmetric uint8 = 2
+	ctKeySymmetric CiphertextType = 2
 	// ctPwdSymmetric indicates symmetric encryption with a password-based key.
-	ctPwdSymmetric uint8 = 3
+	ctPwdSymmetric CiphertextType = 3
+	// ctUnknown is reported when the ciphertext type could not be read.
+	ctUnknown CiphertextType = 0xFF
 
 	// keyVersion is the current version of the key format.
 	keyVersion uint8 = 0
+	// keyVersionMetadata is the public key format version that carries a metadata block.
+	keyVersionMetadata uint8 = 1
+	// padmeMinLength is the length short payloads are padded to by PadPadme.
+	padmeMinLength = 256
+	// syntheticNonceLabel is the HKDF info of the key synthetic nonces are derived with.
+	syntheticNonceLabel = "xipher synthetic nonce key"
 )
 
-// Common errors returned by xipher operations.
+// Common errors returned by xipher operations. They can be matched with
+// errors.Is, including when wrapped in a *DecryptError.
 var (
 	// errGeneratingSalt is returned when random salt generation fails.
 	errGeneratingSalt = fmt.Errorf("%s: error generating salt", "xipher")
-	// errInvalidPassword is returned when an invalid password is provided.
-	errInvalidPassword = fmt.Errorf("%s: invalid password", "xipher")
-	// errInvalidCiphertext is returned when the ciphertext format is invalid.
-	errInvalidCiphertext = fmt.Errorf("%s: invalid ciphertext", "xipher")
-	// errSecretKeyUnavailableForPwd is returned when trying to export a password-based secret key.
-	errSecretKeyUnavailableForPwd = fmt.Errorf("%s: can't derive secret key for passwords", "xipher")
-	// errInvalidPublicKey is returned when the public key format is invalid.
-	errInvalidPublicKey = fmt.Errorf("%s: invalid public key", "xipher")
-	// errInvalidSecretKey is returned when the secret key format is invalid.
-	errInvalidSecretKey = fmt.Errorf("%s: invalid secret key", "xipher")
-	// errInvalidKDFSpec is returned when the key derivation function specification is invalid.
-	errInvalidKDFSpec = fmt.Errorf("%s: invalid kdf spec", "xipher")
-	// errDecryptionFailedPwdRequired is returned when password-based decryption is attempted with a direct key.
-	errDecryptionFailedPwdRequired = fmt.Errorf("%s: decryption failed, password required", "xipher")
-	// errDecryptionFailedKeyRequired is returned when direct key decryption is attempted with a password-based key.
-	errDecryptionFailedKeyRequired = fmt.Errorf("%s: decryption failed, key required", "xipher")
+	// ErrInvalidPassword is returned when an invalid password is provided.
+	ErrInvalidPassword = fmt.Errorf("%s: invalid password", "xipher")
+	// ErrInvalidCiphertext is returned when the ciphertext format is invalid.
+	ErrInvalidCiphertext = fmt.Errorf("%s: invalid ciphertext", "xipher")
+	// ErrSecretKeyUnavailable is returned when trying to export a password-based secret key.
+	ErrSecretKeyUnavailable = fmt.Errorf("%s: can't derive secret key for passwords", "xipher")
+	// ErrInvalidPublicKey is returned when the public key format is invalid.
+	ErrInvalidPublicKey = fmt.Errorf("%s: invalid public key", "xipher")
+	// ErrInvalidSecretKey is returned when the secret key format is invalid.
+	ErrInvalidSecretKey = fmt.Errorf("%s: invalid secret key", "xipher")
+	// ErrInvalidKDFSpec is returned when the key derivation function specification is invalid.
+	ErrInvalidKDFSpec = fmt.Errorf("%s: invalid kdf spec", "xipher")
+	// ErrPasswordRequired is returned when password-based ciphertext is decrypted with a direct key.
+	ErrPasswordRequired = fmt.Errorf("%s: decryption failed, password required", "xipher")
+	// ErrKeyRequired is returned when direct key ciphertext is decrypted with a password.
+	ErrKeyRequired = fmt.Errorf("%s: decryption failed, key required", "xipher")
+	// ErrKeyExpired is returned when encrypting to a public key past its expiry.
+	ErrKeyExpired = fmt.Errorf("%s: public key expired", "xipher")
+	// ErrDeterministicUnsupported is returned when WithSyntheticNonce is used with a
+	// public key or a password-based secret key, which cannot encrypt deterministically.
+	ErrDeterministicUnsupported = fmt.Errorf("%s: deterministic encryption requires a direct secret key", "xipher")
+	// ErrInvalidSSHKey is returned when an SSH key is malformed or not an Ed25519 key.
+	ErrInvalidSSHKey = fmt.Errorf("%s: invalid ssh-ed25519 key", "xipher")
+	// ErrSSHKeyUnsupported is returned when a secret key imported from an SSH key
+	// is used for anything but decryption and deriving its public key.
+	ErrSSHKeyUnsupported = fmt.Errorf("%s: SSH keys can only be used to decrypt", "xipher")
+	// ErrAgeKeyUnsupported is returned when a key cannot be converted to an age
+	// key, or a secret key imported from an age identity is used for anything but
+	// decryption and deriving its ECC public key.
+	ErrAgeKeyUnsupported = fmt.Errorf("%s: not supported for age keys", "xipher")
+
+	// ErrWrongKey is returned when the ciphertext could not be authenticated
+	// with the given key or password.
+	ErrWrongKey = xcp.ErrWrongKey
+	// ErrCorruptedCiphertext is returned when the ciphertext authenticates
+	// partially but has been altered or is otherwise malformed.
+	ErrCorruptedCiphertext = xcp.ErrCorrupted
+	// ErrTruncatedCiphertext is returned when the ciphertext ends early.
+	ErrTruncatedCiphertext = xcp.ErrTruncated
+	// ErrUnsupportedVersion is returned when a key or ciphertext uses a format
+	// version, algorithm or flag this version of xipher does not understand.
+	ErrUnsupportedVersion = xcp.ErrUnsupported
 )
 
 // Application metadata constants.
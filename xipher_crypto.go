@@ -2,6 +2,7 @@ package xipher
 
 import (
 	"bytes"
+	"crypto/hkdf"
 	"crypto/sha256"
 	"io"
 
@@ -20,6 +21,120 @@ func newVariableKeySymmCipher(key []byte) (*xcp.SymmetricCipher, error) {
 	return xcp.New(key)
 }
 
+// EncryptOption configures an encryption operation.
+type EncryptOption func(*encryptOptions)
+
+// encryptOptions holds the settings applied by EncryptOption values.
+type encryptOptions struct {
+	allowExpiredKey bool        // Encrypt to public keys past their expiry
+	pad             xcp.PadFunc // Padding applied to the payload, nil for none
+	fileInfo        *FileInfo   // File info stored at the start of the payload
+	synthetic       bool        // Derive the nonce from the key and what is encrypted
+	nonceContext    []byte      // Context bound into a synthetic nonce
+}
+
+// writerOptions returns the stream options selected by the encryption options.
+func (options *encryptOptions) writerOptions() ([]xcp.WriterOption, error) {
+	var writerOpts []xcp.WriterOption
+	if options.pad != nil {
+		writerOpts = append(writerOpts, xcp.WithPadding(options.pad))
+	}
+	if options.fileInfo != nil {
+		header, err := options.fileInfo.bytes()
+		if err != nil {
+			return nil, err
+		}
+		writerOpts = append(writerOpts, xcp.WithHeader(header))
+	}
+	return writerOpts, nil
+}
+
+// newEncryptOptions applies opts over the defaults.
+func newEncryptOptions(opts []EncryptOption) *encryptOptions {
+	options := &encryptOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// AllowExpiredKey lets encryption proceed with a public key whose metadata marks it as expired.
+//
+// Example:
+//
+//	ciphertext, err := publicKey.Encrypt(data, true, true, xipher.AllowExpiredKey())
+func AllowExpiredKey() EncryptOption {
+	return func(options *encryptOptions) {
+		options.allowExpiredKey = true
+	}
+}
+
+// PadPadme pads the payload with the Padmé scheme, which hides all but the
+// magnitude of its length at a cost of at most 12%. Payloads are padded to at
+// least 256 bytes, so short secrets such as tokens and passwords all look alike.
+//
+// Example:
+//
+//	ciphertext, err := publicKey.Encrypt([]byte("s3cr3t-t0k3n"), false, true, xipher.PadPadme())
+func PadPadme() EncryptOption {
+	return func(options *encryptOptions) {
+		options.pad = func(n int64) int64 {
+			return xcp.Padme(max(n, padmeMinLength))
+		}
+	}
+}
+
+// PadToMultiple pads the payload to the next multiple of size bytes.
+//
+// Example:
+//
+//	ciphertext, err := secretKey.Encrypt(data, false, true, xipher.PadToMultiple(4096))
+func PadToMultiple(size int) EncryptOption {
+	return func(options *encryptOptions) {
+		options.pad = xcp.PadToMultiple(int64(size))
+	}
+}
+
+// WithSyntheticNonce makes encryption with a direct secret key deterministic:
+// the nonce is derived, with a key of its own derived from the secret key, from
+// context and everything that is encrypted: the plaintext, the file info and
+// the compression and padding settings. Identical plaintexts encrypted with the
+// same context and options then give identical ciphertexts, which reveals that
+// they are equal, so only use it where that is acceptable, such as files kept
+// in version control. context, for example the path of a file, keeps equal
+// plaintexts in different places apart; it may be nil. The plaintext is held in
+// memory until the writer is closed. Public keys and password-based secret keys
+// return ErrDeterministicUnsupported.
+//
+// Example:
+//
+//	ciphertext, err := secretKey.Encrypt(data, false, false, xipher.WithSyntheticNonce([]byte(path)))
+func WithSyntheticNonce(context []byte) EncryptOption {
+	return func(options *encryptOptions) {
+		options.synthetic = true
+		options.nonceContext = context
+	}
+}
+
+// syntheticNonceKey derives the key of synthetic nonces from the secret key.
+func (secretKey *SecretKey) syntheticNonceKey() ([]byte, error) {
+	return hkdf.Key(sha256.New, secretKey.key, nil, syntheticNonceLabel, sha256.Size)
+}
+
+// getSymmCipher returns the cached symmetric cipher for the secret key, creating it on first use.
+func (secretKey *SecretKey) getSymmCipher() (*xcp.SymmetricCipher, error) {
+	secretKey.mu.Lock()
+	defer secretKey.mu.Unlock()
+	if secretKey.symmCipher == nil {
+		symmCipher, err := newVariableKeySymmCipher(secretKey.key)
+		if err != nil {
+			return nil, err
+		}
+		secretKey.symmCipher = symmCipher
+	}
+	return secretKey.symmCipher, nil
+}
+
 // IsCTStr validates whether a string is a properly formatted ciphertext string.
 // It checks if the string starts with the xipher ciphertext prefix "XCT_".
 //
@@ -45,6 +160,7 @@ func IsCTStr(str string) bool {
 //   - dst: Destination writer for encrypted output
 //   - compress: If true, compresses data before encryption (reduces size)
 //   - encode: If true, base32-encodes the output with "XCT_" prefix
+//   - opts: Optional settings such as PadPadme
 //
 // Returns a WriteCloser that must be closed to finalize encryption.
 // The Close() method is essential for proper encryption completion.
@@ -59,7 +175,28 @@ func IsCTStr(str string) bool {
 //	writer.Write([]byte("Hello, World!"))
 //	writer.Close() // Essential for proper encryption
 //	ciphertext := buf.Bytes()
-func (secretKey *SecretKey) NewEncryptingWriter(dst io.Writer, compress, encode bool) (writer io.WriteCloser, err error) {
+func (secretKey *SecretKey) NewEncryptingWriter(dst io.Writer, compress, encode bool, opts ...EncryptOption) (writer io.WriteCloser, err error) {
+	if secretKey.keyType == keyTypeSSH {
+		return nil, ErrSSHKeyUnsupported
+	}
+	if secretKey.keyType == keyTypeAge {
+		return nil, ErrAgeKeyUnsupported
+	}
+	options := newEncryptOptions(opts)
+	writerOpts, err := options.writerOptions()
+	if err != nil {
+		return nil, err
+	}
+	if options.synthetic {
+		if isPwdBased(secretKey.keyType) {
+			return nil, ErrDeterministicUnsupported
+		}
+		nonceKey, err := secretKey.syntheticNonceKey()
+		if err != nil {
+			return nil, err
+		}
+		writerOpts = append(writerOpts, xcp.WithSyntheticNonce(nonceKey, options.nonceContext))
+	}
 	var encodeWriteCloser io.WriteCloser
 	if encode {
 		dst.Write([]byte(xipherTxtPrefix))
@@ -67,23 +204,22 @@ func (secretKey *SecretKey) NewEncryptingWriter(dst io.Writer, compress, encode
 		dst = encodeWriteCloser
 	}
 	if isPwdBased(secretKey.keyType) {
-		if _, err := dst.Write([]byte{ctPwdSymmetric}); err != nil {
+		if _, err := dst.Write([]byte{byte(ctPwdSymmetric)}); err != nil {
 			return nil, err
 		}
 		if _, err := dst.Write(secretKey.spec.bytes()); err != nil {
 			return nil, err
 		}
 	} else {
-		if _, err := dst.Write([]byte{ctKeySymmetric}); err != nil {
+		if _, err := dst.Write([]byte{byte(ctKeySymmetric)}); err != nil {
 			return nil, err
 		}
 	}
-	if secretKey.symmCipher == nil {
-		if secretKey.symmCipher, err = newVariableKeySymmCipher(secretKey.key); err != nil {
-			return nil, err
-		}
+	symmCipher, err := secretKey.getSymmCipher()
+	if err != nil {
+		return nil, err
 	}
-	encryptingWriteCloser, err := secretKey.symmCipher.NewEncryptingWriter(dst, compress)
+	encryptingWriteCloser, err := symmCipher.NewEncryptingWriter(dst, compress, writerOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -110,8 +246,8 @@ func (secretKey *SecretKey) NewEncryptingWriter(dst io.Writer, compress, encode
 //	defer file.Close()
 //	var encrypted bytes.Buffer
 //	err := secretKey.EncryptStream(&encrypted, file, true, true)
-func (secretKey *SecretKey) EncryptStream(dst io.Writer, src io.Reader, compress, encode bool) (err error) {
-	encryptedWriter, err := secretKey.NewEncryptingWriter(dst, compress, encode)
+func (secretKey *SecretKey) EncryptStream(dst io.Writer, src io.Reader, compress, encode bool, opts ...EncryptOption) (err error) {
+	encryptedWriter, err := secretKey.NewEncryptingWriter(dst, compress, encode, opts...)
 	if err != nil {
 		return err
 	}
@@ -139,9 +275,9 @@ func (secretKey *SecretKey) EncryptStream(dst io.Writer, src io.Reader, compress
 //		return err
 //	}
 //	// ciphertext is now encrypted and optionally compressed/encoded
-func (secretKey *SecretKey) Encrypt(data []byte, compress, encode bool) (ciphertext []byte, err error) {
+func (secretKey *SecretKey) Encrypt(data []byte, compress, encode bool, opts ...EncryptOption) (ciphertext []byte, err error) {
 	var buf bytes.Buffer
-	if err = secretKey.EncryptStream(&buf, bytes.NewReader(data), compress, encode); err != nil {
+	if err = secretKey.EncryptStream(&buf, bytes.NewReader(data), compress, encode, opts...); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
@@ -154,9 +290,12 @@ func (secretKey *SecretKey) Encrypt(data []byte, compress, encode bool) (ciphert
 //   - dst: Destination writer for encrypted output
 //   - compress: If true, compresses data before encryption (reduces size)
 //   - encode: If true, base32-encodes the output with "XCT_" prefix
+//   - opts: Optional settings such as AllowExpiredKey or PadPadme
 //
 // Returns a WriteCloser that must be closed to finalize encryption.
 // The Close() method is essential for proper encryption completion.
+// Returns ErrKeyExpired if the key's metadata marks it as expired, unless
+// AllowExpiredKey is given.
 //
 // Example:
 //
@@ -168,7 +307,18 @@ func (secretKey *SecretKey) Encrypt(data []byte, compress, encode bool) (ciphert
 //	writer.Write([]byte("Hello, World!"))
 //	writer.Close() // Essential for proper encryption
 //	ciphertext := buf.Bytes()
-func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress, encode bool) (writer io.WriteCloser, err error) {
+func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress, encode bool, opts ...EncryptOption) (writer io.WriteCloser, err error) {
+	options := newEncryptOptions(opts)
+	if options.synthetic {
+		return nil, ErrDeterministicUnsupported
+	}
+	if err := publicKey.checkExpiry(options); err != nil {
+		return nil, err
+	}
+	writerOpts, err := options.writerOptions()
+	if err != nil {
+		return nil, err
+	}
 	var encodeWriteCloser io.WriteCloser
 	if encode {
 		dst.Write([]byte(xipherTxtPrefix))
@@ -176,18 +326,18 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress, encode
 		dst = encodeWriteCloser
 	}
 	if isPwdBased(publicKey.keyType) {
-		if _, err := dst.Write([]byte{ctPwdAsymmetric}); err != nil {
+		if _, err := dst.Write([]byte{byte(ctPwdAsymmetric)}); err != nil {
 			return nil, err
 		}
 		if _, err := dst.Write(publicKey.spec.bytes()); err != nil {
 			return nil, err
 		}
 	} else {
-		if _, err := dst.Write([]byte{ctKeyAsymmetric}); err != nil {
+		if _, err := dst.Write([]byte{byte(ctKeyAsymmetric)}); err != nil {
 			return nil, err
 		}
 	}
-	encryptingWriteCloser, err := publicKey.publicKey.NewEncryptingWriter(dst, compress)
+	encryptingWriteCloser, err := publicKey.publicKey.NewEncryptingWriter(dst, compress, writerOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -214,8 +364,8 @@ func (publicKey *PublicKey) NewEncryptingWriter(dst io.Writer, compress, encode
 //	defer file.Close()
 //	var encrypted bytes.Buffer
 //	err := publicKey.EncryptStream(&encrypted, file, true, true)
-func (publicKey *PublicKey) EncryptStream(dst io.Writer, src io.Reader, compress, encode bool) (err error) {
-	encryptedWriter, err := publicKey.NewEncryptingWriter(dst, compress, encode)
+func (publicKey *PublicKey) EncryptStream(dst io.Writer, src io.Reader, compress, encode bool, opts ...EncryptOption) (err error) {
+	encryptedWriter, err := publicKey.NewEncryptingWriter(dst, compress, encode, opts...)
 	if err != nil {
 		return err
 	}
@@ -243,9 +393,9 @@ func (publicKey *PublicKey) EncryptStream(dst io.Writer, src io.Reader, compress
 //		return err
 //	}
 //	// ciphertext is now encrypted and optionally compressed/encoded
-func (publicKey *PublicKey) Encrypt(data []byte, compress, encode bool) (ciphertext []byte, err error) {
+func (publicKey *PublicKey) Encrypt(data []byte, compress, encode bool, opts ...EncryptOption) (ciphertext []byte, err error) {
 	var buf bytes.Buffer
-	if err = publicKey.EncryptStream(&buf, bytes.NewReader(data), compress, encode); err != nil {
+	if err = publicKey.EncryptStream(&buf, bytes.NewReader(data), compress, encode, opts...); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
@@ -254,49 +404,63 @@ func (publicKey *PublicKey) Encrypt(data []byte, compress, encode bool) (ciphert
 // newPlainDecryptingReader creates a reader that decrypts data without base32 decoding.
 // This is used internally when the ciphertext is in binary format (not base32-encoded).
 // It handles both symmetric and asymmetric decryption based on the ciphertext type.
-func (secretKey *SecretKey) newPlainDecryptingReader(src io.Reader) (io.Reader, error) {
+// Errors, including those returned later by the reader, are reported as *DecryptError.
+func (secretKey *SecretKey) newPlainDecryptingReader(src io.Reader) (*decryptingReader, error) {
 	ctTypeBytes := make([]byte, 1)
 	if _, err := io.ReadFull(src, ctTypeBytes); err != nil {
-		return nil, err
+		return nil, newDecryptError(StageHeader, ctUnknown, err)
 	}
-	var ctType uint8 = ctTypeBytes[0]
+	ctType := CiphertextType(ctTypeBytes[0])
 	key := secretKey.key
 	switch ctType {
 	case ctKeyAsymmetric, ctKeySymmetric:
 		if isPwdBased(secretKey.keyType) {
-			return nil, errDecryptionFailedKeyRequired
+			return nil, newDecryptError(StageHeader, ctType, ErrKeyRequired)
+		}
+		if ctType == ctKeySymmetric && (secretKey.keyType == keyTypeSSH || secretKey.keyType == keyTypeAge) {
+			return nil, newDecryptError(StageHeader, ctType, ErrWrongKey)
 		}
 	case ctPwdAsymmetric, ctPwdSymmetric:
 		if !isPwdBased(secretKey.keyType) {
-			return nil, errDecryptionFailedPwdRequired
+			return nil, newDecryptError(StageHeader, ctType, ErrPasswordRequired)
 		}
 		specBytes := make([]byte, kdfSpecLength)
 		if _, err := io.ReadFull(src, specBytes); err != nil {
-			return nil, err
+			return nil, newDecryptError(StageHeader, ctType, err)
 		}
 		spec, err := parseKdfSpec(specBytes)
 		if err != nil {
-			return nil, err
+			return nil, newDecryptError(StageHeader, ctType, err)
 		}
 		key = secretKey.getKeyForPwdSpec(*spec)
 	default:
-		return nil, errInvalidCiphertext
+		return nil, newDecryptError(StageHeader, ctType, ErrInvalidCiphertext)
 	}
+	var (
+		reader io.Reader
+		stage  DecryptStage
+		err    error
+	)
 	switch ctType {
 	case ctKeyAsymmetric, ctPwdAsymmetric:
-		asxPrivKey, err := asx.ParsePrivateKey(key)
-		if err != nil {
+		var asxPrivKey *asx.PrivateKey
+		if asxPrivKey, err = secretKey.asxPrivateKey(key); err != nil {
 			return nil, err
 		}
-		return asxPrivKey.NewDecryptingReader(src)
+		stage = StageKeyExchange
+		reader, err = asxPrivKey.NewDecryptingReader(src)
 	case ctKeySymmetric, ctPwdSymmetric:
-		symmCipher, err := newVariableKeySymmCipher(key)
-		if err != nil {
+		var symmCipher *xcp.SymmetricCipher
+		if symmCipher, err = newVariableKeySymmCipher(key); err != nil {
 			return nil, err
 		}
-		return symmCipher.NewDecryptingReader(src)
+		stage = StageHeader
+		reader, err = symmCipher.NewDecryptingReader(src)
+	}
+	if err != nil {
+		return nil, newDecryptError(stage, ctType, err)
 	}
-	return nil, errInvalidCiphertext
+	return &decryptingReader{r: reader, ctType: ctType}, nil
 }
 
 // NewDecryptingReader creates a streaming reader that decrypts data from src.
@@ -306,7 +470,8 @@ func (secretKey *SecretKey) newPlainDecryptingReader(src io.Reader) (io.Reader,
 // Parameters:
 //   - src: Source reader containing encrypted data
 //
-// Returns a reader that provides decrypted plaintext data.
+// Returns a reader that provides decrypted plaintext data. Errors returned here
+// and by the reader are *DecryptError values wrapping one of the sentinel errors.
 //
 // Example:
 //
@@ -319,19 +484,33 @@ func (secretKey *SecretKey) newPlainDecryptingReader(src io.Reader) (io.Reader,
 //	// Read decrypted data from decryptedReader
 //	plaintext, _ := io.ReadAll(decryptedReader)
 func (secretKey *SecretKey) NewDecryptingReader(src io.Reader) (io.Reader, error) {
+	dr, err := secretKey.newDecryptingReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+// newDecryptingReader detects the ciphertext encoding and returns the decrypting reader.
+func (secretKey *SecretKey) newDecryptingReader(src io.Reader) (*decryptingReader, error) {
 	pr := &peekableReader{
 		r:   src,
 		buf: bytes.Buffer{},
 	}
 	ctPrefix, err := pr.Peek(len(xipherTxtPrefix))
 	if err != nil {
-		return nil, err
+		return nil, newDecryptError(StageHeader, ctUnknown, err)
 	}
 	if string(ctPrefix) != xipherTxtPrefix {
 		return secretKey.newPlainDecryptingReader(pr)
 	}
 	pr.Discard(len(xipherTxtPrefix))
-	return secretKey.newPlainDecryptingReader(decoder(pr))
+	dr, err := secretKey.newPlainDecryptingReader(decoder(pr))
+	if err != nil {
+		return nil, err
+	}
+	dr.encoded = true
+	return dr, nil
 }
 
 // DecryptStream decrypts data from src and writes the decrypted result to dst.
@@ -384,3 +563,69 @@ func (secretKey *SecretKey) Decrypt(ciphertext []byte) (data []byte, err error)
 	}
 	return buf.Bytes(), nil
 }
+
+// IntegrityReport describes a ciphertext that was fully authenticated by VerifyStream.
+type IntegrityReport struct {
+	CiphertextType CiphertextType // Type of the ciphertext
+	Encoded        bool           // Whether the ciphertext is base32-encoded with the "XCT_" prefix
+	Compressed     bool           // Whether the payload is compressed
+	Framed         bool           // Whether the payload ends with an authenticated final chunk
+	Padded         bool           // Whether the payload is padded to hide its length
+	FileInfo       *FileInfo      // File info stored with the payload, nil if none
+	Chunks         int            // Number of authenticated chunks
+	CiphertextSize int64          // Bytes of ciphertext read from the source
+	PlaintextSize  int64          // Bytes of plaintext recovered (and discarded)
+}
+
+// VerifyStream reads src to the end, authenticating every chunk, the final
+// chunk marker and the decompressed payload, without keeping any plaintext.
+// A nil error means the ciphertext would decrypt successfully with this key.
+//
+// Ciphertext written by older versions has no final chunk marker, so truncation
+// at a chunk boundary cannot be detected for it; such reports have Framed set to false.
+//
+// Example:
+//
+//	file, _ := os.Open("backup.tar.xipher")
+//	defer file.Close()
+//	report, err := secretKey.VerifyStream(file)
+//	if err != nil {
+//		return err // errors.Is(err, xipher.ErrWrongKey), ...
+//	}
+//	fmt.Println(report.PlaintextSize, "bytes verified")
+func (secretKey *SecretKey) VerifyStream(src io.Reader) (*IntegrityReport, error) {
+	cr := &countingReader{r: src}
+	dr, err := secretKey.newDecryptingReader(cr)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := dr.fileInfo()
+	if err != nil {
+		return nil, err
+	}
+	ptSize, err := io.Copy(io.Discard, dr)
+	if err != nil {
+		return nil, err
+	}
+	report := &IntegrityReport{
+		CiphertextType: dr.ctType,
+		Encoded:        dr.encoded,
+		CiphertextSize: cr.n,
+		PlaintextSize:  ptSize,
+		FileInfo:       fileInfo,
+	}
+	if sr, ok := dr.r.(interface{ Stats() xcp.Stats }); ok {
+		stats := sr.Stats()
+		report.Compressed = stats.Compressed
+		report.Framed = stats.Framed
+		report.Padded = stats.Padded
+		report.Chunks = stats.Chunks
+	}
+	return report, nil
+}
+
+// Verify authenticates the given ciphertext without returning the plaintext.
+// See VerifyStream for details.
+func (secretKey *SecretKey) Verify(ciphertext []byte) (*IntegrityReport, error) {
+	return secretKey.VerifyStream(bytes.NewReader(ciphertext))
+}
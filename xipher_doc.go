@@ -66,7 +66,7 @@ parameter to true.
 	}
 
 	// Generate public key (standard ECC)
-	publicKey, err := secretKey.PublicKey(false)
+	publicKey, err := secretKey.PublicKey(xipher.SuiteECC)
 	if err != nil {
 		return err
 	}
@@ -113,7 +113,7 @@ parameter to true.
 	}
 
 	// Generate post-quantum public key
-	pqPublicKey, err := secretKey.PublicKey(true) // true enables post-quantum
+	pqPublicKey, err := secretKey.PublicKey(xipher.SuiteHybrid) // post-quantum hybrid
 	if err != nil {
 		return err
 	}
@@ -124,6 +124,47 @@ parameter to true.
 		return err
 	}
 
+Available suites are SuiteECC (X25519), SuiteHybrid (X25519 + ML-KEM-1024),
+SuiteHybrid768 (X25519 + ML-KEM-768, smaller keys that fit in URLs) and
+SuiteMLKEM (ML-KEM-1024 only). PublicKey.Algorithm and PublicKey.IsQuantumSafe
+report which one a parsed key uses.
+
+## SSH Keys
+
+	// Encrypt for an SSH Ed25519 public key, such as one published on GitHub
+	publicKey, err := xipher.ParseSSHPublicKeyStr("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAA...")
+	if err != nil {
+		return err
+	}
+	ciphertext, err := publicKey.Encrypt([]byte("for your SSH key"), true, true)
+
+	// Decrypt with the matching private key
+	secretKey, err := xipher.NewSecretKeyForSSH(ed25519PrivateKey)
+	if err != nil {
+		return err
+	}
+	plaintext, err := secretKey.Decrypt(ciphertext)
+
+The Ed25519 key is converted to X25519 as age does, and the suite is
+SuiteSSHEd25519. It is not quantum-safe. Secret keys imported from SSH keys can
+only decrypt and derive their public key.
+
+## age Keys
+
+	// Use an age recipient as a xipher public key
+	publicKey, err := xipher.ParseAgeRecipient("age1...")
+
+	// Export the X25519 part of a xipher secret key as an age identity
+	identity, err := secretKey.AgeIdentity() // AGE-SECRET-KEY-1...
+
+	// Decrypt with an age identity
+	secretKey, err := xipher.ParseAgeIdentity("AGE-SECRET-KEY-1...")
+
+age X25519 keys are the X25519 keys of SuiteECC, so PublicKey.AgeRecipient and
+SecretKey.AgeIdentity convert direct keys back. Password-based keys and the
+post-quantum suites have no age equivalent. Secret keys imported from age
+identities can only decrypt and derive their SuiteECC public key.
+
 ## Stream Processing
 
 	// Encrypt large files efficiently
@@ -163,6 +204,49 @@ parameter to true.
 		return err
 	}
 
+## Padding
+
+Ciphertext size reveals the plaintext length. To hide it, pad the payload
+with PadPadme or PadToMultiple; decryption strips the padding transparently:
+
+	ciphertext, err := publicKey.Encrypt([]byte("s3cr3t-t0k3n"), false, true, xipher.PadPadme())
+
+## File Metadata
+
+WithFileInfo stores a file's name, size, permissions, modification time and
+content type encrypted inside the ciphertext; NewFileDecryptingReader returns
+it on decryption:
+
+	stat, _ := file.Stat()
+	err = publicKey.EncryptStream(dst, file, true, false, xipher.WithFileInfo(xipher.NewFileInfo(stat)))
+
+	reader, info, err := secretKey.NewFileDecryptingReader(src)
+
+## Deterministic Encryption
+
+WithSyntheticNonce derives the nonce from a direct secret key, a context such
+as a file path and everything that is encrypted, so the same content encrypts
+to the same ciphertext. This suits files kept in version control, at the cost
+of revealing when content repeats:
+
+	ciphertext, err := secretKey.Encrypt(data, false, false, xipher.WithSyntheticNonce([]byte(path)))
+
+## User Input
+
+ParseKeyInput tells apart the keys, key URLs and passwords users paste, and
+extracts keys shared as links such as https://xipher.org/#XPK_...; EncryptText
+and DecryptText encrypt and decrypt text with any of them, and accept
+ciphertext shared as a link. URLs that serve a public key are resolved with the
+xipher.org/xipher/resolve package:
+
+	input, err := xipher.ParseKeyInput(userInput)
+	if input.Kind == xipher.KeyInputURL {
+		key, err := resolve.Resolve(input.Value)
+	}
+
+	ciphertext, err := xipher.EncryptText("https://xipher.org/#XPK_...", []byte("Hello"), true)
+	text, err := xipher.DecryptText("my-secure-password", "https://xipher.org/#XCT_...")
+
 # Key Derivation Parameters
 
 For password-based keys, you can customize the Argon2id parameters:
@@ -182,6 +266,12 @@ For password-based keys, you can customize the Argon2id parameters:
 Secret keys are encoded with the "XSK_" prefix followed by base32-encoded data.
 Public keys are encoded with the "XPK_" prefix followed by base32-encoded data.
 
+A public key may carry metadata (label, creation time, expiry and intended
+usage), added with PublicKey.WithMetadata and read with PublicKey.Metadata.
+Encrypting to a key past its expiry fails with ErrKeyExpired unless the
+AllowExpiredKey option is given. PublicKey.Fingerprint identifies a key by the
+SHA-256 digest of everything but its metadata, e.g. "SHA256:Ml8Nq...".
+
 ## Ciphertext Format
 
 Encrypted data can be output in two formats:
@@ -200,13 +290,26 @@ The encoded format is human-readable and safe for text-based transmission.
 
 # Error Handling
 
-The package defines several specific error types for different failure modes:
-• errInvalidPassword: Password does not meet the strength policy
-• errInvalidCiphertext: Malformed ciphertext data
-• errInvalidPublicKey: Invalid public key format
-• errInvalidSecretKey: Invalid secret key format
-• errDecryptionFailedPwdRequired: Password required for decryption
-• errDecryptionFailedKeyRequired: Direct key required for decryption
+The package exports sentinel errors that can be matched with errors.Is:
+• ErrInvalidPassword: Password does not meet the strength policy
+• ErrInvalidCiphertext: Malformed ciphertext data
+• ErrInvalidPublicKey: Invalid public key format
+• ErrInvalidSecretKey: Invalid secret key format
+• ErrPasswordRequired: Password required for decryption
+• ErrKeyRequired: Direct key required for decryption
+• ErrWrongKey: The key or password does not match the ciphertext
+• ErrCorruptedCiphertext: The ciphertext has been altered
+• ErrTruncatedCiphertext: The ciphertext ends early
+• ErrUnsupportedVersion: The key or ciphertext needs a newer version of xipher
+
+Decryption failures are returned as *DecryptError, which records the stage that
+failed (header, key-exchange, payload or decompression) and the ciphertext type,
+and unwraps to one of the sentinels above:
+
+	plaintext, err := secretKey.Decrypt(ciphertext)
+	if errors.Is(err, xipher.ErrWrongKey) {
+		// retry with another password
+	}
 
 # Performance Notes
 
@@ -220,5 +323,11 @@ The package defines several specific error types for different failure modes:
 Xipher maintains backward compatibility for encrypted data. Newer versions can
 decrypt data encrypted with older versions, but older versions may not support
 features introduced in newer versions (like post-quantum cryptography).
+
+Streams are framed: each chunk is sealed with its own nonce and marked as final
+or not, so truncated and reordered ciphertexts are detected. This is a format
+change, recorded in the stream flags. Unframed ciphertexts of older versions
+still decrypt, but versions that predate framing cannot decrypt ciphertexts
+written by this one, whatever the key or options.
 */
 package xipher
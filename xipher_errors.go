@@ -0,0 +1,115 @@
+package xipher
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+
+	"xipher.org/xipher/internal/crypto/xcp"
+)
+
+// CiphertextType identifies how a ciphertext was produced. It is the first byte
+// of every (decoded) ciphertext.
+type CiphertextType uint8
+
+// String returns a human-readable name for the ciphertext type.
+func (ctType CiphertextType) String() string {
+	switch ctType {
+	case ctKeyAsymmetric:
+		return "key-asymmetric"
+	case ctPwdAsymmetric:
+		return "password-asymmetric"
+	case ctKeySymmetric:
+		return "key-symmetric"
+	case ctPwdSymmetric:
+		return "password-symmetric"
+	default:
+		return "unknown"
+	}
+}
+
+// DecryptStage identifies the step of decryption that failed.
+type DecryptStage string
+
+const (
+	// StageHeader covers the ciphertext prefix, type byte, KDF spec and stream header.
+	StageHeader DecryptStage = "header"
+	// StageKeyExchange covers reading the encapsulated key of asymmetric ciphertext.
+	StageKeyExchange DecryptStage = "key-exchange"
+	// StagePayload covers authenticating and decrypting the data chunks.
+	StagePayload DecryptStage = "payload"
+	// StageDecompression covers inflating authenticated, compressed plaintext.
+	StageDecompression DecryptStage = "decompression"
+)
+
+// DecryptError is returned by every decryption method when decryption fails.
+// It records where decryption stopped and what kind of ciphertext was being read.
+// The underlying cause is one of the sentinel errors of this package (ErrWrongKey,
+// ErrCorruptedCiphertext, ...) and can be matched with errors.Is.
+//
+// Example:
+//
+//	plaintext, err := secretKey.Decrypt(ciphertext)
+//	if errors.Is(err, xipher.ErrWrongKey) {
+//		// ask for another password
+//	}
+//	var decErr *xipher.DecryptError
+//	if errors.As(err, &decErr) {
+//		fmt.Println(decErr.Stage, decErr.CiphertextType)
+//	}
+type DecryptError struct {
+	Stage          DecryptStage   // Stage at which decryption failed
+	CiphertextType CiphertextType // Type of the ciphertext, or unknown if it could not be read
+	Err            error          // Underlying cause
+}
+
+// Error returns the underlying error message annotated with the stage and ciphertext type.
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("%v (%s stage, %s ciphertext)", e.Err, e.Stage, e.CiphertextType)
+}
+
+// Unwrap returns the underlying cause.
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// newDecryptError wraps err in a *DecryptError, normalising the raw io and
+// encoding errors of the lower layers to the sentinel errors of this package.
+func newDecryptError(stage DecryptStage, ctType CiphertextType, err error) error {
+	if err == nil {
+		return nil
+	}
+	var decErr *DecryptError
+	if errors.As(err, &decErr) {
+		return err
+	}
+	var corruptErr base32.CorruptInputError
+	switch {
+	case errors.Is(err, xcp.ErrDecompression):
+		stage = StageDecompression
+	case errors.Is(err, ErrWrongKey), errors.Is(err, ErrCorruptedCiphertext),
+		errors.Is(err, ErrTruncatedCiphertext), errors.Is(err, ErrUnsupportedVersion):
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		err = fmt.Errorf("%w: %w", ErrTruncatedCiphertext, err)
+	case errors.As(err, &corruptErr):
+		err = fmt.Errorf("%w: %w", ErrCorruptedCiphertext, err)
+	}
+	return &DecryptError{Stage: stage, CiphertextType: ctType, Err: err}
+}
+
+// decryptingReader converts the errors of a plaintext reader into *DecryptError.
+type decryptingReader struct {
+	r       io.Reader
+	ctType  CiphertextType
+	encoded bool
+}
+
+// Read reads decrypted data from the underlying reader.
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = newDecryptError(StagePayload, dr.ctType, err)
+	}
+	return n, err
+}
@@ -0,0 +1,172 @@
+package xipher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File info record tags, encoded like key metadata records.
+const (
+	fileInfoVersion uint8 = 0
+
+	fileTagName        uint8 = 1
+	fileTagSize        uint8 = 2
+	fileTagMode        uint8 = 3
+	fileTagModTime     uint8 = 4
+	fileTagContentType uint8 = 5
+)
+
+// FileInfo describes the file a ciphertext was made from. It is encrypted
+// along with the data, at the start of the plaintext stream, so it is as
+// confidential and tamper-proof as the file contents. Decryption does not
+// enforce Size; callers writing the file out should compare it with the number
+// of bytes decrypted, as the xipher CLI does.
+type FileInfo struct {
+	Name        string      `json:"name,omitempty"`        // Base name of the original file
+	Size        int64       `json:"size"`                  // Size of the original file in bytes, -1 if unknown
+	Mode        fs.FileMode `json:"mode,omitempty"`        // Permission bits of the original file
+	ModTime     time.Time   `json:"modTime,omitzero"`      // Modification time of the original file
+	ContentType string      `json:"contentType,omitempty"` // MIME type of the original file, if known
+}
+
+// NewFileInfo returns the FileInfo for a file described by info, as returned by os.Stat.
+//
+// Example:
+//
+//	stat, _ := file.Stat()
+//	err := publicKey.EncryptStream(dst, file, true, false, xipher.WithFileInfo(xipher.NewFileInfo(stat)))
+func NewFileInfo(info fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:        info.Name(),
+		Size:        info.Size(),
+		Mode:        info.Mode().Perm(),
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(filepath.Ext(info.Name())),
+	}
+}
+
+// WithFileInfo stores info in the ciphertext. Decrypting with
+// NewFileDecryptingReader returns it; other decryption methods skip it.
+func WithFileInfo(info *FileInfo) EncryptOption {
+	return func(options *encryptOptions) {
+		options.fileInfo = info
+	}
+}
+
+// bytes encodes the file info as a version byte followed by tagged records.
+func (info *FileInfo) bytes() ([]byte, error) {
+	records, err := appendStringRecord([]byte{fileInfoVersion}, fileTagName, sanitiseFileName(info.Name))
+	if err == nil && info.Size >= 0 {
+		records, err = appendRecord(records, fileTagSize, binary.BigEndian.AppendUint64(nil, uint64(info.Size)))
+	}
+	if err == nil && info.Mode != 0 {
+		records, err = appendRecord(records, fileTagMode, binary.BigEndian.AppendUint32(nil, uint32(info.Mode.Perm())))
+	}
+	if err == nil && !info.ModTime.IsZero() {
+		modTime := binary.BigEndian.AppendUint64(nil, uint64(info.ModTime.Unix()))
+		records, err = appendRecord(records, fileTagModTime, binary.BigEndian.AppendUint32(modTime, uint32(info.ModTime.Nanosecond())))
+	}
+	if err == nil {
+		records, err = appendStringRecord(records, fileTagContentType, info.ContentType)
+	}
+	return records, err
+}
+
+// parseFileInfo decodes a file info record. Unknown tags are skipped.
+func parseFileInfo(data []byte) (*FileInfo, error) {
+	if len(data) < 1 {
+		return nil, ErrCorruptedCiphertext
+	}
+	if data[0] > fileInfoVersion {
+		return nil, fmt.Errorf("%w: file info version %d", ErrUnsupportedVersion, data[0])
+	}
+	info := &FileInfo{Size: -1}
+	err := parseRecords(data[1:], ErrCorruptedCiphertext, func(tag uint8, value []byte) error {
+		switch tag {
+		case fileTagName:
+			info.Name = sanitiseFileName(string(value))
+		case fileTagContentType:
+			info.ContentType = string(value)
+		case fileTagSize:
+			if len(value) != 8 {
+				return ErrCorruptedCiphertext
+			}
+			info.Size = int64(binary.BigEndian.Uint64(value))
+		case fileTagMode:
+			if len(value) != 4 {
+				return ErrCorruptedCiphertext
+			}
+			info.Mode = fs.FileMode(binary.BigEndian.Uint32(value)).Perm()
+		case fileTagModTime:
+			if len(value) != 12 {
+				return ErrCorruptedCiphertext
+			}
+			info.ModTime = time.Unix(int64(binary.BigEndian.Uint64(value)), int64(binary.BigEndian.Uint32(value[8:])))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// sanitiseFileName reduces name to a plain file name, so that a stored name
+// can never point outside the directory it is restored into.
+func sanitiseFileName(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	if name == "." || name == ".." || strings.ContainsRune(name, 0) {
+		return ""
+	}
+	return name
+}
+
+// fileInfo returns the file info stored in the ciphertext, or nil if there is none.
+func (dr *decryptingReader) fileInfo() (*FileInfo, error) {
+	hr, ok := dr.r.(interface{ Header() ([]byte, error) })
+	if !ok {
+		return nil, nil
+	}
+	header, err := hr.Header()
+	if err != nil {
+		return nil, newDecryptError(StagePayload, dr.ctType, err)
+	}
+	info, err := parseFileInfo(header)
+	if err != nil {
+		return nil, newDecryptError(StagePayload, dr.ctType, err)
+	}
+	return info, nil
+}
+
+// NewFileDecryptingReader is NewDecryptingReader for ciphertext that may carry
+// a FileInfo, which it returns along with the reader. The info is nil if the
+// ciphertext was encrypted without WithFileInfo. The stored name is reduced to
+// a plain file name, but callers restoring files should still treat it as
+// untrusted input.
+//
+// Example:
+//
+//	reader, info, err := secretKey.NewFileDecryptingReader(encryptedFile)
+//	if err != nil {
+//		return err
+//	}
+//	if info != nil {
+//		fmt.Println("Original name:", info.Name)
+//	}
+func (secretKey *SecretKey) NewFileDecryptingReader(src io.Reader) (io.Reader, *FileInfo, error) {
+	dr, err := secretKey.newDecryptingReader(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := dr.fileInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	return dr, info, nil
+}
@@ -0,0 +1,218 @@
+package xipher
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+// KeyInputKind identifies what a key input parsed by ParseKeyInput is.
+type KeyInputKind uint8
+
+const (
+	// KeyInputPassword is any input that is not a key or a key URL.
+	KeyInputPassword KeyInputKind = iota
+	// KeyInputPublicKey is an XPK_ public key.
+	KeyInputPublicKey
+	// KeyInputSecretKey is an XSK_ secret key.
+	KeyInputSecretKey
+	// KeyInputSSHPublicKey is an ssh-ed25519 public key.
+	KeyInputSSHPublicKey
+	// KeyInputAgeRecipient is an age X25519 recipient, "age1...".
+	KeyInputAgeRecipient
+	// KeyInputAgeIdentity is an age X25519 identity, "AGE-SECRET-KEY-1...".
+	KeyInputAgeIdentity
+	// KeyInputURL is an https:// URL that may serve a public key, to be resolved
+	// with the xipher.org/xipher/resolve package.
+	KeyInputURL
+)
+
+// String returns a human-readable name for the kind of key input.
+func (kind KeyInputKind) String() string {
+	switch kind {
+	case KeyInputPassword:
+		return "password"
+	case KeyInputPublicKey:
+		return "public-key"
+	case KeyInputSecretKey:
+		return "secret-key"
+	case KeyInputSSHPublicKey:
+		return "ssh-public-key"
+	case KeyInputAgeRecipient:
+		return "age-recipient"
+	case KeyInputAgeIdentity:
+		return "age-identity"
+	case KeyInputURL:
+		return "url"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyInput is a key, password or key URL as given by a user, parsed by
+// ParseKeyInput.
+type KeyInput struct {
+	// Kind is what the input is.
+	Kind KeyInputKind
+	// Value is the input without surrounding whitespace, or the XPK_ or XSK_ key
+	// embedded in the fragment or query of a URL such as
+	// "https://xipher.org/#XPK_...".
+	Value string
+	// PublicKey is the parsed public key of KeyInputPublicKey,
+	// KeyInputSSHPublicKey and KeyInputAgeRecipient inputs.
+	PublicKey *PublicKey
+	// SecretKey is the parsed secret key of KeyInputSecretKey and
+	// KeyInputAgeIdentity inputs.
+	SecretKey *SecretKey
+}
+
+// IsKey reports whether the input is a key rather than a password or a URL.
+func (input *KeyInput) IsKey() bool {
+	return input.Kind != KeyInputPassword && input.Kind != KeyInputURL
+}
+
+// ParseKeyInput parses a user-supplied public key, secret key, password or
+// key URL, as accepted wherever xipher asks for a key or password: XPK_ and
+// XSK_ keys, ssh-ed25519 public keys, age recipients and identities, URLs
+// carrying an XPK_ or XSK_ key in their fragment or query, https:// URLs that
+// may serve a public key, and passwords, which are anything else. Keys are
+// parsed and returned; URLs are not fetched. An empty input is ErrInvalidPassword.
+//
+// A KeyInputURL is neither a key nor a password: it must be resolved to the
+// public key it serves before encrypting, and encrypting to it as given fails
+// with ErrInvalidPublicKey rather than using the URL as a password.
+//
+// Example:
+//
+//	input, err := xipher.ParseKeyInput("https://xipher.org/#XPK_...")
+//	if err != nil {
+//		return err
+//	}
+//	if input.Kind == xipher.KeyInputPublicKey {
+//		ciphertext, err := input.PublicKey.Encrypt(data, true, true)
+//	}
+func ParseKeyInput(input string) (*KeyInput, error) {
+	value := embeddedValue(input, func(s string) bool { return IsPubKeyStr(s) || IsSecretKeyStr(s) })
+	keyInput := &KeyInput{Value: value}
+	var err error
+	switch {
+	case value == "":
+		return nil, ErrInvalidPassword
+	case IsPubKeyStr(value):
+		keyInput.Kind = KeyInputPublicKey
+		keyInput.PublicKey, err = ParsePublicKeyStr(value)
+	case IsSecretKeyStr(value):
+		keyInput.Kind = KeyInputSecretKey
+		keyInput.SecretKey, err = ParseSecretKeyStr(value)
+	case IsSSHPublicKeyStr(value):
+		keyInput.Kind = KeyInputSSHPublicKey
+		keyInput.PublicKey, err = ParseSSHPublicKeyStr(value)
+	case IsAgeRecipientStr(value):
+		keyInput.Kind = KeyInputAgeRecipient
+		keyInput.PublicKey, err = ParseAgeRecipient(value)
+	case IsAgeIdentityStr(value):
+		keyInput.Kind = KeyInputAgeIdentity
+		keyInput.SecretKey, err = ParseAgeIdentity(value)
+	case strings.HasPrefix(value, "https://"):
+		keyInput.Kind = KeyInputURL
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keyInput, nil
+}
+
+// ExtractCiphertext returns the XCT_ ciphertext of input, which may be the
+// ciphertext itself or a URL carrying it in its fragment or query, such as
+// "https://xipher.org/#XCT_...". It returns ErrInvalidCiphertext if input
+// holds no ciphertext.
+func ExtractCiphertext(input string) (string, error) {
+	ciphertext := embeddedValue(input, IsCTStr)
+	if !IsCTStr(ciphertext) {
+		return "", ErrInvalidCiphertext
+	}
+	return ciphertext, nil
+}
+
+// embeddedValue returns the trimmed fragment or query value of input that
+// isValue matches, if input is a URL that has one, or else input trimmed.
+func embeddedValue(input string, isValue func(string) bool) string {
+	if u, err := url.Parse(input); err == nil {
+		if fragment := strings.TrimSpace(u.Fragment); fragment != "" && isValue(fragment) {
+			return fragment
+		}
+		for _, values := range u.Query() {
+			for _, value := range values {
+				if value = strings.TrimSpace(value); isValue(value) {
+					return value
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(input)
+}
+
+// EncryptText encrypts text to keyOrPwd, which may be any input ParseKeyInput
+// accepts but a URL, and returns the XCT_ ciphertext. Text encrypted to a
+// public key can only be decrypted with its secret key; text encrypted with a
+// secret key or a password can be decrypted with the same.
+//
+// Example:
+//
+//	ciphertext, err := xipher.EncryptText("XPK_...", []byte("Hello"), true)
+func EncryptText(keyOrPwd string, text []byte, compress bool, opts ...EncryptOption) (string, error) {
+	input, err := ParseKeyInput(keyOrPwd)
+	if err != nil {
+		return "", err
+	}
+	var ciphertext []byte
+	switch {
+	case input.PublicKey != nil:
+		ciphertext, err = input.PublicKey.Encrypt(text, compress, true, opts...)
+	case input.SecretKey != nil:
+		ciphertext, err = input.SecretKey.Encrypt(text, compress, true, opts...)
+	case input.Kind == KeyInputURL:
+		return "", ErrInvalidPublicKey
+	default:
+		var secretKey *SecretKey
+		if secretKey, err = NewSecretKeyForPassword([]byte(input.Value)); err != nil {
+			return "", err
+		}
+		ciphertext, err = secretKey.Encrypt(text, compress, true, opts...)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(ciphertext), nil
+}
+
+// DecryptText decrypts an XCT_ ciphertext, which may be embedded in a URL as
+// ExtractCiphertext accepts, with secretKeyOrPwd: an XSK_ secret key, an age
+// identity or a password.
+//
+// Example:
+//
+//	text, err := xipher.DecryptText("my-secure-password", "https://xipher.org/#XCT_...")
+func DecryptText(secretKeyOrPwd, ciphertext string) ([]byte, error) {
+	ciphertext, err := ExtractCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	var secretKey *SecretKey
+	switch {
+	case IsSecretKeyStr(secretKeyOrPwd):
+		secretKey, err = ParseSecretKeyStr(secretKeyOrPwd)
+	case IsAgeIdentityStr(secretKeyOrPwd):
+		secretKey, err = ParseAgeIdentity(secretKeyOrPwd)
+	default:
+		secretKey, err = NewSecretKeyForPassword([]byte(secretKeyOrPwd))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = secretKey.DecryptStream(&buf, strings.NewReader(ciphertext)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -27,7 +27,7 @@ type kdfSpec struct {
 // Returns an error if any parameter is zero or if salt generation fails.
 func newSpec(iterations, memory, threads uint8) (*kdfSpec, error) {
 	if iterations == 0 || memory == 0 || threads == 0 {
-		return nil, errInvalidKDFSpec
+		return nil, ErrInvalidKDFSpec
 	}
 	salt := make([]byte, kdfSaltLength)
 	if _, err := rand.Read(salt); err != nil {
@@ -70,7 +70,7 @@ func (s *kdfSpec) bytes() []byte {
 // Returns nil if the input is all zeros (indicating no KDF spec).
 func parseKdfSpec(kdfBytes []byte) (*kdfSpec, error) {
 	if kdfBytes == nil || len(kdfBytes) != kdfSpecLength {
-		return nil, errInvalidKDFSpec
+		return nil, ErrInvalidKDFSpec
 	}
 	if [kdfSpecLength]byte(kdfBytes) == [kdfSpecLength]byte{} {
 		return nil, nil
@@ -80,7 +80,7 @@ func parseKdfSpec(kdfBytes []byte) (*kdfSpec, error) {
 	threads := kdfBytes[2]
 	salt := kdfBytes[kdfParamsLength:]
 	if iterations == 0 || memory == 0 || threads == 0 {
-		return nil, errInvalidKDFSpec
+		return nil, ErrInvalidKDFSpec
 	}
 	spec := &kdfSpec{
 		iterations: iterations,
@@ -2,8 +2,13 @@ package xipher
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
 
 	"xipher.org/xipher/internal/crypto/asx"
 	"xipher.org/xipher/internal/crypto/xcp"
@@ -20,6 +25,7 @@ type SecretKey struct {
 	key        []byte               // Derived or direct key material
 	symmCipher *xcp.SymmetricCipher // Cached symmetric cipher instance
 	specKeyMap map[string][]byte    // Cache for derived keys with different specs
+	mu         sync.Mutex           // Guards symmCipher and specKeyMap
 }
 
 // NewSecretKeyForPassword creates a new secret key derived from the given password.
@@ -72,7 +78,7 @@ func NewSecretKeyForPasswordAndSpec(password []byte, iterations, memory, threads
 // This is an internal function used by the public constructors.
 func newSecretKeyForPwdAndSpec(password []byte, spec *kdfSpec) (secretKey *SecretKey, err error) {
 	if len(password) == 0 {
-		return nil, errInvalidPassword
+		return nil, ErrInvalidPassword
 	}
 	secretKey = &SecretKey{
 		version:    keyVersion,
@@ -141,7 +147,10 @@ func SecretKeyFromSeed(seed [secretKeyBaseLength]byte) (*SecretKey, error) {
 // Only supports direct (non-password-based) keys.
 func ParseSecretKey(key []byte) (*SecretKey, error) {
 	if len(key) != secretKeyLength || key[1] != keyTypeDirect {
-		return nil, fmt.Errorf("%s: invalid secret key length: expected %d, got %d", "xipher", secretKeyLength, len(key))
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidSecretKey, secretKeyLength, len(key))
+	}
+	if key[0] > keyVersion {
+		return nil, fmt.Errorf("%w: secret key version %d", ErrUnsupportedVersion, key[0])
 	}
 	return &SecretKey{
 		version: key[0],
@@ -184,7 +193,7 @@ func IsSecretKeyStr(secretKeyStr string) bool {
 //	}
 func ParseSecretKeyStr(secretKeyStr string) (*SecretKey, error) {
 	if !IsSecretKeyStr(secretKeyStr) {
-		return nil, errInvalidSecretKey
+		return nil, ErrInvalidSecretKey
 	}
 	keyBytes, err := decode(secretKeyStr[len(xipherSecretKeyPrefix):])
 	if err != nil {
@@ -202,6 +211,8 @@ func isPwdBased(keyType uint8) bool {
 // getKeyForPwdSpec derives or retrieves a cached key for the given KDF specification.
 // This implements caching to avoid redundant key derivation operations.
 func (secretKey *SecretKey) getKeyForPwdSpec(spec kdfSpec) (key []byte) {
+	secretKey.mu.Lock()
+	defer secretKey.mu.Unlock()
 	specBytes := spec.bytes()
 	key = secretKey.specKeyMap[string(specBytes)]
 	if len(key) == 0 {
@@ -229,7 +240,13 @@ func (secretKey *SecretKey) getKeyForPwdSpec(spec kdfSpec) (key []byte) {
 //	// Store keyBytes securely
 func (secretKey *SecretKey) Bytes() ([]byte, error) {
 	if isPwdBased(secretKey.keyType) {
-		return nil, errSecretKeyUnavailableForPwd
+		return nil, ErrSecretKeyUnavailable
+	}
+	if secretKey.keyType == keyTypeSSH {
+		return nil, ErrSSHKeyUnsupported
+	}
+	if secretKey.keyType == keyTypeAge {
+		return nil, ErrAgeKeyUnsupported
 	}
 	return append([]byte{secretKey.version, secretKey.keyType}, secretKey.key...), nil
 }
@@ -262,52 +279,168 @@ type PublicKey struct {
 	keyType   uint8          // Type of key (direct or password-based)
 	publicKey *asx.PublicKey // The actual public key for asymmetric operations
 	spec      *kdfSpec       // KDF specification (for password-based keys)
+	metadata  *KeyMetadata   // Optional metadata (label, expiry, ...)
+}
+
+// Suite selects the key encapsulation algorithm of a public key.
+type Suite uint8
+
+const (
+	// SuiteECC uses X25519. It gives the smallest keys and ciphertext but is not quantum-safe.
+	SuiteECC Suite = 0
+	// SuiteHybrid combines X25519 with ML-KEM-1024 and stays secure as long as either holds.
+	SuiteHybrid Suite = 1
+	// SuiteHybrid768 combines X25519 with ML-KEM-768, for keys small enough to share in URLs.
+	SuiteHybrid768 Suite = 2
+	// SuiteMLKEM uses ML-KEM-1024 alone.
+	SuiteMLKEM Suite = 3
+	// SuiteSSHEd25519 uses X25519 with the key of an SSH Ed25519 key. It is the
+	// suite of keys from NewPublicKeyForSSH and cannot be derived from other
+	// secret keys, so Suites does not list it.
+	SuiteSSHEd25519 Suite = 4
+)
+
+// suiteNames lists the canonical name of every suite that can be selected by
+// name, followed by accepted aliases.
+var suiteNames = map[Suite][]string{
+	SuiteECC:       {"x25519", "ecc"},
+	SuiteHybrid:    {"x25519-mlkem1024", "hybrid", "hybrid-1024"},
+	SuiteHybrid768: {"x25519-mlkem768", "hybrid-768", "hybrid768"},
+	SuiteMLKEM:     {"mlkem1024", "mlkem", "kyber"},
+}
+
+// sshEd25519SuiteName is the name of SuiteSSHEd25519. ParseSuite does not
+// accept it, as keys of the suite only come from SSH keys.
+const sshEd25519SuiteName = "ssh-ed25519"
+
+// String returns the canonical name of the suite, such as "x25519-mlkem768".
+func (suite Suite) String() string {
+	if names, ok := suiteNames[suite]; ok {
+		return names[0]
+	}
+	if suite == SuiteSSHEd25519 {
+		return sshEd25519SuiteName
+	}
+	return fmt.Sprintf("Suite(%d)", uint8(suite))
+}
+
+// IsQuantumSafe reports whether the suite includes a post-quantum KEM.
+func (suite Suite) IsQuantumSafe() bool {
+	return suite != SuiteECC && suite != SuiteSSHEd25519
+}
+
+// ParseSuite returns the suite for a canonical name or alias (case-insensitive),
+// for example "x25519", "hybrid", "hybrid-768" or "mlkem". SuiteSSHEd25519
+// cannot be selected by name.
+func ParseSuite(name string) (Suite, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for suite, names := range suiteNames {
+		if slices.Contains(names, name) {
+			return suite, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: unknown suite %q", "xipher", name)
+}
+
+// Suites returns every supported suite.
+func Suites() []Suite {
+	return []Suite{SuiteECC, SuiteHybrid, SuiteHybrid768, SuiteMLKEM}
 }
 
 // PublicKey derives the public key corresponding to this secret key.
 // The public key can be used for encryption, while the secret key is needed for decryption.
 //
 // Parameters:
-//   - pq: If true, uses quantum-safe hybrid cryptography (X25519 + ML-KEM-1024); if false, uses ECC
+//   - suite: The key encapsulation algorithm (SuiteECC, SuiteHybrid, SuiteHybrid768 or SuiteMLKEM)
 //
-// The hybrid mode combines classical X25519 with post-quantum ML-KEM-1024, providing
+// The hybrid suites combine classical X25519 with post-quantum ML-KEM, providing
 // resistance against quantum computer attacks while retaining classical security if
-// either primitive is broken. It results in larger key sizes and ciphertext.
+// either primitive is broken. They result in larger key sizes and ciphertext;
+// SuiteHybrid768 trades some margin for keys about a quarter smaller than SuiteHybrid.
 //
-// Returns an error if key derivation fails.
+// Returns an error if the suite is unknown or key derivation fails.
 //
 // Example:
 //
 //	// Standard ECC public key
-//	pubKey, err := secretKey.PublicKey(false)
+//	pubKey, err := secretKey.PublicKey(xipher.SuiteECC)
 //
 //	// Post-quantum public key
-//	pqPubKey, err := secretKey.PublicKey(true)
-func (secretKey *SecretKey) PublicKey(pq bool) (*PublicKey, error) {
-	asxPrivKey, err := asx.ParsePrivateKey(secretKey.key)
+//	pqPubKey, err := secretKey.PublicKey(xipher.SuiteHybrid)
+func (secretKey *SecretKey) PublicKey(suite Suite) (*PublicKey, error) {
+	if secretKey.keyType == keyTypeSSH && suite != SuiteSSHEd25519 {
+		return nil, ErrSSHKeyUnsupported
+	}
+	if secretKey.keyType == keyTypeAge && suite != SuiteECC {
+		return nil, ErrAgeKeyUnsupported
+	}
+	if secretKey.keyType != keyTypeSSH && suite == SuiteSSHEd25519 {
+		return nil, fmt.Errorf("%s: suite %s requires a secret key imported from an SSH key", "xipher", suite)
+	}
+	asxPrivKey, err := secretKey.asxPrivateKey(secretKey.key)
 	if err != nil {
 		return nil, err
 	}
 	var asxPubKey *asx.PublicKey
-	if pq {
-		asxPubKey, err = asxPrivKey.PublicKeyHybrid()
-	} else {
+	switch suite {
+	case SuiteECC:
 		asxPubKey, err = asxPrivKey.PublicKeyECC()
+	case SuiteHybrid:
+		asxPubKey, err = asxPrivKey.PublicKeyHybrid()
+	case SuiteHybrid768:
+		asxPubKey, err = asxPrivKey.PublicKeyHybrid768()
+	case SuiteMLKEM:
+		asxPubKey, err = asxPrivKey.PublicKeyKyber()
+	case SuiteSSHEd25519:
+		asxPubKey, err = asxPrivKey.PublicKeySSHEd25519()
+	default:
+		return nil, fmt.Errorf("%s: unknown suite %d", "xipher", suite)
 	}
 	if err != nil {
 		return nil, err
 	}
+	keyType := secretKey.keyType
+	if keyType == keyTypeSSH || keyType == keyTypeAge {
+		keyType = keyTypeDirect // Public keys of imported keys are plain direct keys
+	}
 	return &PublicKey{
 		version:   secretKey.version,
-		keyType:   secretKey.keyType,
+		keyType:   keyType,
 		publicKey: asxPubKey,
 		spec:      secretKey.spec,
 	}, nil
 }
 
+// Algorithm returns the suite of the public key.
+//
+// Example:
+//
+//	pubKey, _ := xipher.ParsePublicKeyStr(pubKeyStr)
+//	fmt.Println(pubKey.Algorithm()) // x25519-mlkem1024
+func (publicKey *PublicKey) Algorithm() Suite {
+	algo, _ := publicKey.publicKey.Algorithm()
+	switch algo {
+	case asx.AlgoKyber:
+		return SuiteMLKEM
+	case asx.AlgoHybrid:
+		return SuiteHybrid
+	case asx.AlgoHybrid768:
+		return SuiteHybrid768
+	case asx.AlgoSSHEd25519:
+		return SuiteSSHEd25519
+	default:
+		return SuiteECC
+	}
+}
+
+// IsQuantumSafe reports whether the public key includes a post-quantum KEM.
+func (publicKey *PublicKey) IsQuantumSafe() bool {
+	return publicKey.Algorithm().IsQuantumSafe()
+}
+
 // Bytes returns the binary representation of the public key.
-// The format includes version, type, and optionally KDF specification,
-// followed by the actual public key material.
+// The format includes version, type, optionally KDF specification and
+// metadata, followed by the actual public key material.
 //
 // Returns an error if serialization fails.
 //
@@ -323,12 +456,21 @@ func (publicKey *PublicKey) Bytes() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	headers := []byte{publicKey.version, publicKey.keyType}
+	headers := []byte{keyVersion, publicKey.keyType}
+	if publicKey.metadata != nil {
+		headers[0] = keyVersionMetadata
+	}
 	if isPwdBased(publicKey.keyType) {
-		return append(headers, append(publicKey.spec.bytes(), asxPubKeyBytes...)...), nil
-	} else {
-		return append(headers, asxPubKeyBytes...), nil
+		headers = append(headers, publicKey.spec.bytes()...)
 	}
+	if publicKey.metadata != nil {
+		metaBytes, err := publicKey.metadata.bytes()
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, metaBytes...)
+	}
+	return append(headers, asxPubKeyBytes...), nil
 }
 
 // String returns the string representation of the public key.
@@ -351,6 +493,19 @@ func (publicKey *PublicKey) String() (string, error) {
 	return xipherPublicKeyPrefix + encode(pubKeyBytes), nil
 }
 
+// Fingerprint returns the SHA-256 fingerprint of the public key, formatted as
+// "SHA256:" followed by the unpadded base64 digest, as OpenSSH does. Metadata
+// is not covered, so relabelling a key keeps its fingerprint, and an age
+// recipient has the same fingerprint as its SuiteECC public key.
+func (publicKey *PublicKey) Fingerprint() (string, error) {
+	pubKeyBytes, err := publicKey.WithMetadata(KeyMetadata{}).Bytes()
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(pubKeyBytes)
+	return fingerprintPrefix + base64.RawStdEncoding.EncodeToString(digest[:]), nil
+}
+
 // ParsePublicKey parses a public key from its binary representation.
 // It supports both direct and password-based public keys.
 //
@@ -367,12 +522,15 @@ func (publicKey *PublicKey) String() (string, error) {
 //	}
 func ParsePublicKey(pubKeyBytes []byte) (*PublicKey, error) {
 	if len(pubKeyBytes) < publicKeyMinLength {
-		return nil, errInvalidPublicKey
+		return nil, ErrInvalidPublicKey
 	}
 	version := pubKeyBytes[0]
+	if version > keyVersionMetadata {
+		return nil, fmt.Errorf("%w: public key version %d", ErrUnsupportedVersion, version)
+	}
 	keyType := pubKeyBytes[1]
 	if keyType != keyTypeDirect && keyType != keyTypePwd {
-		return nil, errInvalidPublicKey
+		return nil, ErrInvalidPublicKey
 	}
 	keyBytes := pubKeyBytes[2:]
 	var spec *kdfSpec
@@ -384,6 +542,16 @@ func ParsePublicKey(pubKeyBytes []byte) (*PublicKey, error) {
 		}
 		keyBytes = keyBytes[kdfSpecLength:]
 	}
+	var metadata *KeyMetadata
+	if version == keyVersionMetadata {
+		var err error
+		if metadata, keyBytes, err = parseKeyMetadata(keyBytes); err != nil {
+			return nil, err
+		}
+		if metadata.isEmpty() {
+			metadata = nil
+		}
+	}
 	asxPubKey, err := asx.ParsePublicKey(keyBytes)
 	if err != nil {
 		return nil, err
@@ -393,6 +561,7 @@ func ParsePublicKey(pubKeyBytes []byte) (*PublicKey, error) {
 		keyType:   keyType,
 		publicKey: asxPubKey,
 		spec:      spec,
+		metadata:  metadata,
 	}, nil
 }
 
@@ -430,7 +599,7 @@ func IsPubKeyStr(pubKeyStr string) bool {
 //	}
 func ParsePublicKeyStr(pubKeyStr string) (*PublicKey, error) {
 	if !IsPubKeyStr(pubKeyStr) {
-		return nil, errInvalidPublicKey
+		return nil, ErrInvalidPublicKey
 	}
 	pubKeyBytes, err := decode(pubKeyStr[len(xipherPublicKeyPrefix):])
 	if err != nil {
@@ -0,0 +1,191 @@
+package xipher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Metadata record tags. Each record is encoded as tag (1 byte), length (1 byte)
+// and value. Unknown tags are skipped when parsing so that later versions can
+// add fields without breaking older readers. FileInfo uses the same encoding.
+const (
+	metaTagLabel    uint8 = 1
+	metaTagCreated  uint8 = 2
+	metaTagNotAfter uint8 = 3
+	metaTagUsage    uint8 = 4
+
+	// metaMaxValueLength is the maximum length of a single record value.
+	metaMaxValueLength = 255
+)
+
+// KeyMetadata is optional information carried in a public key. It is advisory:
+// it travels with the key string and is only as trustworthy as the channel the
+// key was received over.
+type KeyMetadata struct {
+	Label    string    `json:"label,omitempty"`   // Human-readable name of the key
+	Created  time.Time `json:"created,omitzero"`  // When the key was issued
+	NotAfter time.Time `json:"notAfter,omitzero"` // When the key expires, zero for never
+	Usage    string    `json:"usage,omitempty"`   // Intended usage, such as "backup" or "email"
+}
+
+// IsExpired reports whether the key has expired at the given time.
+func (meta *KeyMetadata) IsExpired(at time.Time) bool {
+	return !meta.NotAfter.IsZero() && at.After(meta.NotAfter)
+}
+
+// isEmpty reports whether the metadata carries no information.
+func (meta *KeyMetadata) isEmpty() bool {
+	return meta.Label == "" && meta.Created.IsZero() && meta.NotAfter.IsZero() && meta.Usage == ""
+}
+
+// appendRecord appends a tagged record to records.
+func appendRecord(records []byte, tag uint8, value []byte) ([]byte, error) {
+	if len(value) > metaMaxValueLength {
+		return nil, fmt.Errorf("%s: record value too long: %d bytes (max %d)", "xipher", len(value), metaMaxValueLength)
+	}
+	records = append(records, tag, uint8(len(value)))
+	return append(records, value...), nil
+}
+
+// appendTimeRecord appends t as a record of unix seconds, unless it is zero.
+func appendTimeRecord(records []byte, tag uint8, t time.Time) ([]byte, error) {
+	if t.IsZero() {
+		return records, nil
+	}
+	return appendRecord(records, tag, binary.BigEndian.AppendUint64(nil, uint64(t.Unix())))
+}
+
+// appendStringRecord appends s as a record, unless it is empty.
+func appendStringRecord(records []byte, tag uint8, s string) ([]byte, error) {
+	if s == "" {
+		return records, nil
+	}
+	return appendRecord(records, tag, []byte(s))
+}
+
+// parseRecords calls fn for every tagged record. It returns errInvalid if the
+// records are malformed or a tag appears twice.
+func parseRecords(records []byte, errInvalid error, fn func(tag uint8, value []byte) error) error {
+	seen := make(map[uint8]bool)
+	for len(records) > 0 {
+		if len(records) < 2 || len(records) < 2+int(records[1]) {
+			return errInvalid
+		}
+		tag, value := records[0], records[2:2+int(records[1])]
+		records = records[2+len(value):]
+		if seen[tag] {
+			return fmt.Errorf("%w: duplicate record %d", errInvalid, tag)
+		}
+		seen[tag] = true
+		if err := fn(tag, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTimeRecord decodes a record written by appendTimeRecord.
+func parseTimeRecord(value []byte, errInvalid error) (time.Time, error) {
+	if len(value) != 8 {
+		return time.Time{}, fmt.Errorf("%w: invalid time record", errInvalid)
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(value)), 0).UTC(), nil
+}
+
+// bytes encodes the metadata as a length-prefixed block of tagged records.
+func (meta *KeyMetadata) bytes() ([]byte, error) {
+	records, err := appendStringRecord(nil, metaTagLabel, meta.Label)
+	if err == nil {
+		records, err = appendTimeRecord(records, metaTagCreated, meta.Created)
+	}
+	if err == nil {
+		records, err = appendTimeRecord(records, metaTagNotAfter, meta.NotAfter)
+	}
+	if err == nil {
+		records, err = appendStringRecord(records, metaTagUsage, meta.Usage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(records))), records...), nil
+}
+
+// parseKeyMetadata decodes a metadata block from the start of data and returns
+// the metadata along with the remaining bytes.
+func parseKeyMetadata(data []byte) (*KeyMetadata, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, ErrInvalidPublicKey
+	}
+	blockLength := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < blockLength {
+		return nil, nil, ErrInvalidPublicKey
+	}
+	records, rest := data[:blockLength], data[blockLength:]
+	meta := &KeyMetadata{}
+	err := parseRecords(records, ErrInvalidPublicKey, func(tag uint8, value []byte) (err error) {
+		switch tag {
+		case metaTagLabel:
+			meta.Label = string(value)
+		case metaTagUsage:
+			meta.Usage = string(value)
+		case metaTagCreated:
+			meta.Created, err = parseTimeRecord(value, ErrInvalidPublicKey)
+		case metaTagNotAfter:
+			meta.NotAfter, err = parseTimeRecord(value, ErrInvalidPublicKey)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, rest, nil
+}
+
+// Metadata returns a copy of the metadata carried by the public key, or nil if it has none.
+//
+// Example:
+//
+//	if meta := publicKey.Metadata(); meta != nil && !meta.NotAfter.IsZero() {
+//		fmt.Println("Key expires:", meta.NotAfter)
+//	}
+func (publicKey *PublicKey) Metadata() *KeyMetadata {
+	if publicKey.metadata == nil {
+		return nil
+	}
+	meta := *publicKey.metadata
+	return &meta
+}
+
+// WithMetadata returns a copy of the public key that carries the given metadata.
+// Keys with metadata are encoded in key format version 1, which older versions
+// of xipher reject; keys without metadata keep the original format.
+//
+// Example:
+//
+//	pubKey, _ := secretKey.PublicKey(xipher.SuiteECC)
+//	pubKey = pubKey.WithMetadata(xipher.KeyMetadata{
+//		Label:    "backups",
+//		Created:  time.Now(),
+//		NotAfter: time.Now().AddDate(0, 0, 90),
+//	})
+func (publicKey *PublicKey) WithMetadata(meta KeyMetadata) *PublicKey {
+	pubKey := *publicKey
+	pubKey.metadata = nil
+	if !meta.isEmpty() {
+		pubKey.metadata = &meta
+	}
+	return &pubKey
+}
+
+// checkExpiry returns ErrKeyExpired if the key has expired and the options do not allow it.
+func (publicKey *PublicKey) checkExpiry(opts *encryptOptions) error {
+	if publicKey.metadata == nil || opts.allowExpiredKey {
+		return nil
+	}
+	if publicKey.metadata.IsExpired(time.Now()) {
+		return fmt.Errorf("%w on %s", ErrKeyExpired, publicKey.metadata.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package xipher
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"xipher.org/xipher/internal/crypto/asx"
+)
+
+// IsSSHPublicKeyStr reports whether str is an SSH Ed25519 public key in the
+// authorized_keys format, "ssh-ed25519 AAAA... [comment]".
+// It checks the format but does not validate the key.
+func IsSSHPublicKeyStr(str string) bool {
+	return strings.HasPrefix(strings.TrimSpace(str), sshEd25519KeyType+" ")
+}
+
+// ParseSSHPublicKeyStr parses an SSH Ed25519 public key in the authorized_keys
+// format, as found in ~/.ssh/id_ed25519.pub or https://github.com/<user>.keys,
+// and returns it as a public key. Data encrypted for it can be decrypted with a
+// secret key from NewSecretKeyForSSH for the matching private key.
+//
+// Example:
+//
+//	publicKey, err := xipher.ParseSSHPublicKeyStr("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAA... alice@laptop")
+//	if err != nil {
+//		return err
+//	}
+//	ciphertext, err := publicKey.Encrypt(data, true, true)
+func ParseSSHPublicKeyStr(sshPubKeyStr string) (*PublicKey, error) {
+	fields := strings.Fields(sshPubKeyStr)
+	if len(fields) < 2 || fields[0] != sshEd25519KeyType {
+		return nil, ErrInvalidSSHKey
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSSHKey, err)
+	}
+	keyType, rest, ok := readSSHString(blob)
+	if !ok || string(keyType) != sshEd25519KeyType {
+		return nil, ErrInvalidSSHKey
+	}
+	edPub, rest, ok := readSSHString(rest)
+	if !ok || len(rest) != 0 {
+		return nil, ErrInvalidSSHKey
+	}
+	return NewPublicKeyForSSH(edPub)
+}
+
+// readSSHString reads a length-prefixed string of the SSH wire format from b.
+func readSSHString(b []byte) (str, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
+
+// NewPublicKeyForSSH returns the public key for an SSH Ed25519 public key. The
+// key is converted to X25519, as age does, and data is encrypted to it with the
+// SuiteSSHEd25519 suite.
+func NewPublicKeyForSSH(sshPublicKey ed25519.PublicKey) (*PublicKey, error) {
+	asxPubKey, err := asx.NewPublicKeySSHEd25519(sshPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSSHKey, err)
+	}
+	return &PublicKey{
+		version:   keyVersion,
+		keyType:   keyTypeDirect,
+		publicKey: asxPubKey,
+	}, nil
+}
+
+// NewSecretKeyForSSH returns a secret key for an SSH Ed25519 private key. It
+// decrypts data encrypted for the matching public key and derives that public
+// key with PublicKey(SuiteSSHEd25519). Other uses, including symmetric
+// encryption and exporting the key, return ErrSSHKeyUnsupported.
+//
+// Example:
+//
+//	raw, err := ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+//	if err != nil {
+//		return err
+//	}
+//	secretKey, err := xipher.NewSecretKeyForSSH(*raw.(*ed25519.PrivateKey))
+func NewSecretKeyForSSH(sshPrivateKey ed25519.PrivateKey) (*SecretKey, error) {
+	if len(sshPrivateKey) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidSSHKey
+	}
+	return &SecretKey{
+		version: keyVersion,
+		keyType: keyTypeSSH,
+		key:     sshPrivateKey.Seed(),
+	}, nil
+}
+
+// asxPrivateKey returns the asymmetric private key for the key material of the secret key.
+func (secretKey *SecretKey) asxPrivateKey(key []byte) (*asx.PrivateKey, error) {
+	switch secretKey.keyType {
+	case keyTypeSSH:
+		return asx.NewPrivateKeySSHEd25519(key)
+	case keyTypeAge:
+		return asx.NewPrivateKeyX25519(key)
+	}
+	return asx.ParsePrivateKey(key)
+}